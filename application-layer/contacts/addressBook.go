@@ -0,0 +1,341 @@
+package contacts
+
+import (
+	"application-layer/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// the address book only lives on this machine, it never goes into the dht
+const addressBookVersion = 1
+
+// next to the other files kept in utils, relative to where the servers run
+var dirPath = filepath.Join("..", "..", "utils")
+
+var (
+	ErrContactNotFound = errors.New("contact not found")
+	ErrBadContact      = errors.New("invalid contact")
+	ErrContactConflict = errors.New("peer id or wallet address already belongs to another contact")
+)
+
+var trustLevels = map[string]bool{"trusted": true, "neutral": true, "untrusted": true}
+
+var (
+	AddressBookPath = filepath.Join(dirPath, "addressBook.json")
+	AddressBook     = newAddressBook()
+)
+
+// addressBook maps peer ids and wallet addresses to the names the user gave them
+type addressBook struct {
+	mu       sync.Mutex
+	contacts map[string]models.Contact // keyed by contact id
+}
+
+func newAddressBook() *addressBook {
+	return &addressBook{contacts: make(map[string]models.Contact)}
+}
+
+// read the saved address book, if any
+func LoadAddressBook() error {
+	data, err := os.ReadFile(AddressBookPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read address book: %v", err)
+	}
+
+	var contacts []models.Contact
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return fmt.Errorf("failed to parse address book: %v", err)
+	}
+	AddressBook.mu.Lock()
+	defer AddressBook.mu.Unlock()
+	AddressBook.contacts = make(map[string]models.Contact)
+	for _, contact := range contacts {
+		AddressBook.contacts[contact.ID] = contact
+	}
+	return nil
+}
+
+// caller holds ab.mu
+func (ab *addressBook) save() error {
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(ab.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal address book: %v", err)
+	}
+	if err := os.WriteFile(AddressBookPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write address book: %v", err)
+	}
+	return nil
+}
+
+// caller holds ab.mu
+func (ab *addressBook) sorted() []models.Contact {
+	contacts := []models.Contact{}
+	for _, contact := range ab.contacts {
+		contacts = append(contacts, contact)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return strings.ToLower(contacts[i].Label) < strings.ToLower(contacts[j].Label)
+	})
+	return contacts
+}
+
+// List returns the contacts by label, only those whose label, notes, peer id or addresses contain query when it isn't empty
+func (ab *addressBook) List(query string) []models.Contact {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	query = strings.ToLower(query)
+	contacts := []models.Contact{}
+	for _, contact := range ab.sorted() {
+		text := strings.ToLower(strings.Join(append([]string{contact.Label, contact.Notes, contact.PeerID}, contact.WalletAddresses...), " "))
+		if query == "" || strings.Contains(text, query) {
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts
+}
+
+func (ab *addressBook) Get(id string) (models.Contact, error) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	contact, ok := ab.contacts[id]
+	if !ok {
+		return models.Contact{}, ErrContactNotFound
+	}
+	return contact, nil
+}
+
+// normalizeContact checks a contact and cleans it up, the peer id and addresses have to parse
+func normalizeContact(contact models.Contact) (models.Contact, error) {
+	contact.Label = strings.TrimSpace(contact.Label)
+	contact.PeerID = strings.TrimSpace(contact.PeerID)
+	contact.Trust = strings.ToLower(strings.TrimSpace(contact.Trust))
+	if contact.Label == "" {
+		return contact, fmt.Errorf("%w: label missing", ErrBadContact)
+	}
+	if contact.Trust == "" {
+		contact.Trust = "neutral"
+	}
+	if !trustLevels[contact.Trust] {
+		return contact, fmt.Errorf("%w: trust must be trusted, neutral or untrusted", ErrBadContact)
+	}
+	if contact.PeerID != "" {
+		if _, err := peer.Decode(contact.PeerID); err != nil {
+			return contact, fmt.Errorf("%w: peer id %s: %v", ErrBadContact, contact.PeerID, err)
+		}
+	}
+	addresses := []string{}
+	for _, address := range contact.WalletAddresses {
+		address = strings.TrimSpace(address)
+		if address == "" || contains(addresses, address) {
+			continue
+		}
+		if _, err := btcutil.DecodeAddress(address, &chaincfg.MainNetParams); err != nil {
+			return contact, fmt.Errorf("%w: wallet address %s: %v", ErrBadContact, address, err)
+		}
+		addresses = append(addresses, address)
+	}
+	contact.WalletAddresses = addresses
+	if contact.PeerID == "" && len(contact.WalletAddresses) == 0 {
+		return contact, fmt.Errorf("%w: a peer id or wallet address is needed", ErrBadContact)
+	}
+	return contact, nil
+}
+
+// owner finds the contact a peer id or wallet address belongs to, caller holds ab.mu
+func (ab *addressBook) owner(key string) (models.Contact, bool) {
+	if key == "" {
+		return models.Contact{}, false
+	}
+	for _, contact := range ab.contacts {
+		if contact.PeerID == key || contains(contact.WalletAddresses, key) {
+			return contact, true
+		}
+	}
+	return models.Contact{}, false
+}
+
+// conflict reports another contact already holding one of contact's peer id or addresses, caller holds ab.mu
+func (ab *addressBook) conflict(contact models.Contact) error {
+	for _, key := range append([]string{contact.PeerID}, contact.WalletAddresses...) {
+		if other, ok := ab.owner(key); ok && other.ID != contact.ID {
+			return fmt.Errorf("%w: %s is %s", ErrContactConflict, key, other.Label)
+		}
+	}
+	return nil
+}
+
+// Save adds a contact, or replaces the one with the same id
+func (ab *addressBook) Save(contact models.Contact) (models.Contact, error) {
+	contact, err := normalizeContact(contact)
+	if err != nil {
+		return models.Contact{}, err
+	}
+
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	if contact.ID == "" {
+		contact.ID = uuid.New().String()
+		contact.CreatedAt = timestamp()
+	} else if existing, ok := ab.contacts[contact.ID]; ok {
+		contact.CreatedAt = existing.CreatedAt
+	} else {
+		return models.Contact{}, ErrContactNotFound
+	}
+	if err := ab.conflict(contact); err != nil {
+		return models.Contact{}, err
+	}
+	contact.UpdatedAt = timestamp()
+	ab.contacts[contact.ID] = contact
+	return contact, ab.save()
+}
+
+func (ab *addressBook) Delete(id string) error {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	if _, ok := ab.contacts[id]; !ok {
+		return ErrContactNotFound
+	}
+	delete(ab.contacts, id)
+	return ab.save()
+}
+
+// Labels returns the labels of the keys that are in the address book, nil when none are
+func (ab *addressBook) Labels(keys ...string) map[string]models.ContactLabel {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	var labels map[string]models.ContactLabel
+	for _, key := range keys {
+		contact, ok := ab.owner(key)
+		if !ok {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]models.ContactLabel)
+		}
+		labels[key] = models.ContactLabel{ContactID: contact.ID, Label: contact.Label, Trust: contact.Trust}
+	}
+	return labels
+}
+
+func (ab *addressBook) Export() models.AddressBookExport {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	return models.AddressBookExport{Version: addressBookVersion, ExportedAt: timestamp(), Contacts: ab.sorted()}
+}
+
+// Import merges an exported address book into ours. an entry whose peer id or addresses
+// we already have updates that contact, anything else is added, and with replace the
+// current contacts are dropped first. entries that don't check out are skipped
+func (ab *addressBook) Import(export models.AddressBookExport, replace bool) (models.AddressBookImport, error) {
+	result := models.AddressBookImport{Skipped: []string{}}
+	if export.Version > addressBookVersion {
+		return result, fmt.Errorf("%w: address book version %d is newer than %d", ErrBadContact, export.Version, addressBookVersion)
+	}
+
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	if replace {
+		ab.contacts = make(map[string]models.Contact)
+	}
+	for _, entry := range export.Contacts {
+		contact, err := normalizeContact(entry)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", entry.Label, err))
+			continue
+		}
+
+		// the ids of another machine mean nothing here, contacts are matched by what they name
+		contact.ID = ""
+		for _, key := range append([]string{contact.PeerID}, contact.WalletAddresses...) {
+			if existing, ok := ab.owner(key); ok {
+				contact.ID, contact.CreatedAt = existing.ID, existing.CreatedAt
+				break
+			}
+		}
+		updated := contact.ID != ""
+		if !updated {
+			contact.ID = uuid.New().String()
+			if contact.CreatedAt == "" {
+				contact.CreatedAt = timestamp()
+			}
+		}
+		if err := ab.conflict(contact); err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", entry.Label, err))
+			continue
+		}
+		contact.UpdatedAt = timestamp()
+		ab.contacts[contact.ID] = contact
+		if updated {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+	}
+	return result, ab.save()
+}
+
+// LabelTransactions adds the labels of the requester and target, by peer id and wallet
+func LabelTransactions(transactions []models.Transaction) []models.LabeledTransaction {
+	labeled := make([]models.LabeledTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		labeled = append(labeled, models.LabeledTransaction{
+			Transaction: transaction,
+			Labels:      AddressBook.Labels(transaction.RequesterID, transaction.RequesterWallet, transaction.TargetID, transaction.TargetWallet),
+		})
+	}
+	return labeled
+}
+
+// LabelListings adds the labels of the providers of marketplace files
+func LabelListings(listings []models.DHTMetadata) []models.LabeledListing {
+	labeled := make([]models.LabeledListing, 0, len(listings))
+	for _, listing := range listings {
+		providers := make([]string, 0, len(listing.Providers))
+		for peerID := range listing.Providers {
+			providers = append(providers, peerID)
+		}
+		labeled = append(labeled, models.LabeledListing{DHTMetadata: listing, Labels: AddressBook.Labels(providers...)})
+	}
+	return labeled
+}
+
+// LabelProxies adds the labels of proxy hosts, their payment addresses and connected peers
+func LabelProxies(proxies []models.Proxy) []models.LabeledProxy {
+	labeled := make([]models.LabeledProxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		keys := append([]string{proxy.PeerID, proxy.WalletAddressToSend}, proxy.ConnectedPeers...)
+		labeled = append(labeled, models.LabeledProxy{Proxy: proxy, Labels: AddressBook.Labels(keys...)})
+	}
+	return labeled
+}
+
+func timestamp() string {
+	return time.Now().Format("2006-01-02 15:04:05")
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package contacts
+
+import (
+	"application-layer/models"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// go test -v -run ^TestAddressBook$ -count=1 application-layer/contacts
+func TestAddressBook(t *testing.T) {
+	oldDirPath, oldAddressBookPath, oldAddressBook := dirPath, AddressBookPath, AddressBook
+	dirPath = t.TempDir()
+	AddressBookPath = filepath.Join(dirPath, "addressBook.json")
+	AddressBook = newAddressBook()
+	t.Cleanup(func() { dirPath, AddressBookPath, AddressBook = oldDirPath, oldAddressBookPath, oldAddressBook })
+
+	alice := "12D3KooWAZv5dC3xtzos2KiJm2wDqiLGJ5y4gwC7WSKU5DvmCLEL"
+	bob := "12D3KooWE1xpVccUXZJWZLVWPxXzUJQ7kMqN8UQ2WLn9uQVytmdA"
+	aliceWallet := "14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc"
+
+	for _, bad := range []models.Contact{
+		{PeerID: alice},
+		{Label: "nobody"},
+		{Label: "typo", PeerID: "not a peer"},
+		{Label: "typo", WalletAddresses: []string{"not an address"}},
+		{Label: "odd", PeerID: alice, Trust: "somewhat"},
+	} {
+		if _, err := AddressBook.Save(bad); !errors.Is(err, ErrBadContact) {
+			t.Errorf("contact %+v accepted, err = %v", bad, err)
+		}
+	}
+
+	contact, err := AddressBook.Save(models.Contact{Label: " Alice ", PeerID: alice, WalletAddresses: []string{aliceWallet, aliceWallet}})
+	if err != nil {
+		t.Fatalf("failed to save contact: %v", err)
+	}
+	if contact.ID == "" || contact.Label != "Alice" || contact.Trust != "neutral" || len(contact.WalletAddresses) != 1 {
+		t.Errorf("contact = %+v, want a trimmed neutral contact with one address", contact)
+	}
+	if _, err := AddressBook.Save(models.Contact{Label: "Mallory", WalletAddresses: []string{aliceWallet}}); !errors.Is(err, ErrContactConflict) {
+		t.Errorf("second contact for the same wallet saved, err = %v", err)
+	}
+
+	transactions := LabelTransactions([]models.Transaction{{RequesterID: bob, TargetID: alice, TargetWallet: aliceWallet}})
+	labels := transactions[0].Labels
+	if len(labels) != 2 || labels[alice].Label != "Alice" || labels[aliceWallet].ContactID != contact.ID {
+		t.Errorf("labels = %+v, want Alice by peer id and wallet", labels)
+	}
+
+	// an import from another machine updates Alice by her peer id and adds Bob
+	export := models.AddressBookExport{Version: addressBookVersion, Contacts: []models.Contact{
+		{ID: "elsewhere", Label: "Alice (work)", PeerID: alice, Trust: "trusted"},
+		{Label: "Bob", PeerID: bob},
+		{Label: "broken", PeerID: "nope"},
+	}}
+	result, err := AddressBook.Import(export, false)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result.Added != 1 || result.Updated != 1 || len(result.Skipped) != 1 {
+		t.Errorf("import = %+v, want 1 added, 1 updated, 1 skipped", result)
+	}
+	if updated, _ := AddressBook.Get(contact.ID); updated.Label != "Alice (work)" || updated.Trust != "trusted" {
+		t.Errorf("Alice after import = %+v", updated)
+	}
+
+	// what was saved comes back after a restart
+	AddressBook = newAddressBook()
+	if err := LoadAddressBook(); err != nil {
+		t.Fatalf("failed to load address book: %v", err)
+	}
+	if contacts := AddressBook.List("bob"); len(contacts) != 1 || contacts[0].PeerID != bob {
+		t.Errorf("search for bob = %+v", contacts)
+	}
+	if err := AddressBook.Delete(contact.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if labels := AddressBook.Labels(alice, aliceWallet); labels != nil {
+		t.Errorf("labels of a deleted contact = %+v", labels)
+	}
+}
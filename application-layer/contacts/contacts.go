@@ -0,0 +1,95 @@
+package contacts
+
+import (
+	"application-layer/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+func contactError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrContactNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrContactConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrBadContact):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// the address book, one contact with ?id=... or those matching ?query=...
+func handleGetContacts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if id := r.URL.Query().Get("id"); id != "" {
+		contact, err := AddressBook.Get(id)
+		if err != nil {
+			contactError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(contact)
+		return
+	}
+	json.NewEncoder(w).Encode(AddressBook.List(r.URL.Query().Get("query")))
+}
+
+// add a contact, or update it when the body has its ID
+func handleSaveContact(w http.ResponseWriter, r *http.Request) {
+	var contact models.Contact
+	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	contact, err := AddressBook.Save(contact)
+	if err != nil {
+		contactError(w, err)
+		return
+	}
+	log.Infof("saved contact %s (%s)", contact.Label, contact.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contact)
+}
+
+// e.g. DELETE /contacts?id=...
+func handleDeleteContact(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "contact id not provided", http.StatusBadRequest)
+		return
+	}
+	if err := AddressBook.Delete(id); err != nil {
+		contactError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// the whole address book as a file to keep or load on another machine
+func handleExportContacts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="addressBook.json"`)
+	json.NewEncoder(w).Encode(AddressBook.Export())
+}
+
+// merge an exported address book into ours, ?replace=true drops our contacts first
+func handleImportContacts(w http.ResponseWriter, r *http.Request) {
+	var export models.AddressBookExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := AddressBook.Import(export, r.URL.Query().Get("replace") == "true")
+	if err != nil {
+		contactError(w, err)
+		return
+	}
+	log.Infof("imported address book: %d added, %d updated, %d skipped", result.Added, result.Updated, len(result.Skipped))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
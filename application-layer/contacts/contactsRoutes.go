@@ -0,0 +1,18 @@
+package contacts
+
+import (
+	"application-layer/metrics"
+	"github.com/gorilla/mux"
+)
+
+func InitContactsRoutes() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(metrics.Middleware)
+
+	r.HandleFunc("/contacts", handleGetContacts).Methods("GET")
+	r.HandleFunc("/contacts", handleSaveContact).Methods("POST")
+	r.HandleFunc("/contacts", handleDeleteContact).Methods("DELETE")
+	r.HandleFunc("/contacts/export", handleExportContacts).Methods("GET")
+	r.HandleFunc("/contacts/import", handleImportContacts).Methods("POST")
+	return r
+}
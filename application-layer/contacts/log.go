@@ -0,0 +1,5 @@
+package contacts
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("CTCT")
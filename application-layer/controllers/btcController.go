@@ -2,15 +2,19 @@
 package controllers
 
 import (
+	"application-layer/models"
 	"application-layer/services"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
 )
 
 type BtcController struct {
@@ -34,9 +38,9 @@ type SignupRequest struct {
 }
 
 type SignupResponse struct {
-	Address    string `json:"address,omitempty"`
-	PrivateKey string `json:"private_key,omitempty"`
-	Message    string `json:"message"`
+	Address  string `json:"address,omitempty"`
+	Mnemonic string `json:"mnemonic,omitempty"` // BIP39 seed phrase, only shown once
+	Message  string `json:"message"`
 }
 
 // Helper function: respondWithJSON
@@ -62,7 +66,7 @@ func respondWithError(w http.ResponseWriter, status int, message string) {
 
 // SignupHandler processes signup requests.
 func (bc *BtcController) SignupHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("SignupHandler called")
+	log.Info("SignupHandler called")
 
 	var req SignupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -82,17 +86,15 @@ func (bc *BtcController) SignupHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Execute wallet creation in a separate goroutine
 	go func() {
-		newAddress, err := bc.Service.CreateWallet(req.Passphrase)
+		newAddress, mnemonic, err := bc.Service.CreateWallet(req.Passphrase)
 		if err != nil {
 			errorCh <- err
 			return
 		}
-		// Replace with actual private key generation logic
-		privateKey := "generated-private-key"
 		response := SignupResponse{
-			Address:    newAddress,
-			PrivateKey: privateKey,
-			Message:    "Wallet successfully created.",
+			Address:  newAddress,
+			Mnemonic: mnemonic,
+			Message:  "Wallet successfully created. Write down the seed phrase, it is the only way to restore the wallet.",
 		}
 		resultCh <- response
 	}()
@@ -105,10 +107,10 @@ func (bc *BtcController) SignupHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 	case <-time.After(30 * time.Second):
 		// Stop processes on timeout
-		log.Println("SignupHandler: Request timed out.")
-		stopWalletMsg := bc.Service.StopBtcwallet()
-		stopBtcdMsg := bc.Service.StopBtcd()
-		errorMessage := fmt.Sprintf("Request timed out. %s %s", stopWalletMsg, stopBtcdMsg)
+		log.Info("SignupHandler: Request timed out.")
+		walletStatus, _ := bc.Service.StopBtcwallet()
+		btcdStatus, _ := bc.Service.StopBtcd()
+		errorMessage := fmt.Sprintf("Request timed out. btcwallet %s, btcd %s", walletStatus.State, btcdStatus.State)
 		respondWithError(w, http.StatusGatewayTimeout, errorMessage)
 	}
 }
@@ -142,6 +144,7 @@ func (bc *BtcController) SignupHandler(w http.ResponseWriter, r *http.Request) {
 type LoginRequest struct {
 	WalletAddress string `json:"wallet_address"`
 	Passphrase    string `json:"passphrase"`
+	Wallet        string `json:"wallet,omitempty"` // named wallet, the active one when empty
 }
 
 // LoginResponse represents the structure of the login response payload.
@@ -151,34 +154,34 @@ type LoginResponse struct {
 
 // LoginHandler handles the login process for users.
 func (bc *BtcController) LoginHandler(w http.ResponseWriter, r *http.Request) {
-    fmt.Println("LoginHandler called")
+    log.Info("LoginHandler called")
 
     // Decode JSON request payload
     var req LoginRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        fmt.Printf("Failed to decode request payload: %v\n", err)
+        log.Errorf("Failed to decode request payload: %v", err)
         respondWithError(w, http.StatusBadRequest, "Invalid request payload")
         return
     }
 
-    fmt.Printf("Login request received for wallet address: %s\n", req.WalletAddress)
+    log.Infof("Login request received for wallet address: %s", req.WalletAddress)
 
     // Validate input fields
     if req.WalletAddress == "" || req.Passphrase == "" {
-        fmt.Println("Wallet address or passphrase missing")
+        log.Info("Wallet address or passphrase missing")
         respondWithError(w, http.StatusBadRequest, "Both wallet address and passphrase are required")
         return
     }
 
     // Call the Login method
-    result, err := bc.Service.Login(req.WalletAddress, req.Passphrase)
+    result, err := bc.Service.Login(req.WalletAddress, req.Passphrase, req.Wallet)
     if err != nil {
-        fmt.Printf("Login error: %v\n", err)
+        log.Errorf("Login error: %v", err)
         respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Login failed: %v", err))
         return
     }
 
-    fmt.Println("Login successful.")
+    log.Info("Login successful.")
     respondWithJSON(w, http.StatusOK, LoginResponse{Message: result})
 }
 
@@ -190,7 +193,7 @@ type LogoutResponse struct {
 
 // LogoutHandler handles the logout process for users.
 func (bc *BtcController) LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("LogoutHandler called")
+	log.Info("LogoutHandler called")
 
 	// Call the Logout method from BtcService
 	result, err := bc.Service.Logout()
@@ -210,10 +213,21 @@ func (bc *BtcController) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteAccountHandler handles the account deletion process for users.
 func (bc *BtcController) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("DeleteAccountHandler called")
+	log.Info("DeleteAccountHandler called")
+
+	// The passphrase is optional, with it the backup taken before deleting is encrypted
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
 
 	// Call the DeleteAccount method from BtcService
-	result, err := bc.Service.DeleteAccount()
+	result, err := bc.Service.DeleteAccount(req.Passphrase)
 	if err != nil {
 		// Respond with an error if account deletion fails
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -231,7 +245,7 @@ func (bc *BtcController) DeleteAccountHandler(w http.ResponseWriter, r *http.Req
 
 // GetMiningAddressAndBalanceHandler handles the retrieval of the mining address and its associated Bitcoin balance.
 func (bc *BtcController) GetMiningAddressAndBalanceHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("GetMiningAddressAndBalanceHandler called")
+	log.Info("GetMiningAddressAndBalanceHandler called")
 
 	// Call the GetMiningAddressAndBalance method from BtcService
 	miningAddress, balance, err := bc.Service.GetMiningAddressAndBalance()
@@ -282,6 +296,19 @@ func (bc *BtcController) TransactionHandler(w http.ResponseWriter, r *http.Reque
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
+// respondWithProcessStatus answers start and stop requests with the state of the process
+func respondWithProcessStatus(w http.ResponseWriter, status models.ProcessStatus, err error) {
+	if errors.Is(err, services.ErrAlreadyRunning) || errors.Is(err, services.ErrNotRunning) {
+		respondWithJSON(w, http.StatusConflict, Response{Status: "error", Message: err.Error(), Data: status})
+		return
+	}
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, Response{Status: "error", Message: err.Error(), Data: status})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: status})
+}
+
 func (bc *BtcController) StartBtcdHandler(w http.ResponseWriter, r *http.Request) {
 	var params struct {
 		WalletAddress string `json:"walletAddress,omitempty"`
@@ -292,47 +319,314 @@ func (bc *BtcController) StartBtcdHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var result string
+	var status models.ProcessStatus
+	var err error
 	if params.WalletAddress != "" {
-		result = bc.Service.StartBtcd(params.WalletAddress)
+		status, err = bc.Service.StartBtcd(params.WalletAddress)
 	} else {
-		result = bc.Service.StartBtcd()
+		status, err = bc.Service.StartBtcd()
 	}
+	respondWithProcessStatus(w, status, err)
+}
 
+func (bc *BtcController) StopBtcdHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := bc.Service.StopBtcd()
+	respondWithProcessStatus(w, status, err)
+}
+
+func (bc *BtcController) StartBtcwalletHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := bc.Service.StartBtcwallet()
+	respondWithProcessStatus(w, status, err)
+}
+
+func (bc *BtcController) StopBtcwalletHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := bc.Service.StopBtcwallet()
+	respondWithProcessStatus(w, status, err)
+}
+
+// GetProcessStatusHandler reports btcd and btcwallet as the supervisor sees them, with pid, restarts and log file
+func (bc *BtcController) GetProcessStatusHandler(w http.ResponseWriter, r *http.Request) {
 	resp := Response{
-		Status:  "success",
-		Message: result,
+		Status: "success",
+		Data:   bc.Service.GetProcessStatus(),
 	}
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
-func (bc *BtcController) StopBtcdHandler(w http.ResponseWriter, r *http.Request) {
-	result := bc.Service.StopBtcd()
-	resp := Response{
-		Status:  "success",
-		Message: result,
+// respondWithWalletError maps the wallet backup and restore errors to status codes
+func respondWithWalletError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMnemonic), errors.Is(err, services.ErrPassphraseRequired):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrWrongPassphrase):
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, services.ErrBackupNotFound), errors.Is(err, services.ErrNoWallet),
+		errors.Is(err, services.ErrWalletNotFound), errors.Is(err, services.ErrAccountUnknown):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrAlreadyRunning), errors.Is(err, services.ErrWalletExists):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 	}
-	respondWithJSON(w, http.StatusOK, resp)
 }
 
-func (bc *BtcController) StartBtcwalletHandler(w http.ResponseWriter, r *http.Request) {
-	result := bc.Service.StartBtcwallet()
-	resp := Response{
-		Status:  "success",
-		Message: result,
+// RestoreWalletHandler recreates the wallet from its BIP39 seed phrase
+func (bc *BtcController) RestoreWalletHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Mnemonic   string `json:"mnemonic"`
+		Passphrase string `json:"passphrase"`
 	}
-	respondWithJSON(w, http.StatusOK, resp)
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if params.Mnemonic == "" || params.Passphrase == "" {
+		respondWithError(w, http.StatusBadRequest, "Both mnemonic and passphrase are required")
+		return
+	}
+
+	result, err := bc.Service.RestoreWallet(params.Mnemonic, params.Passphrase)
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Message: result})
 }
 
-func (bc *BtcController) StopBtcwalletHandler(w http.ResponseWriter, r *http.Request) {
-	result := bc.Service.StopBtcwallet()
+// BackupWalletHandler writes an encrypted copy of wallet.db
+func (bc *BtcController) BackupWalletHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if params.Passphrase == "" {
+		respondWithError(w, http.StatusBadRequest, "Passphrase is required")
+		return
+	}
+
+	backup, err := bc.Service.BackupWallet(params.Passphrase)
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: backup})
+}
+
+func (bc *BtcController) ListWalletBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	backups, err := bc.Service.ListWalletBackups()
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: backups})
+}
+
+// RestoreWalletBackupHandler puts a backup back in place of wallet.db
+func (bc *BtcController) RestoreWalletBackupHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name       string `json:"name"`
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Backup name is required")
+		return
+	}
+
+	backup, err := bc.Service.RestoreWalletBackup(params.Name, params.Passphrase)
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Message: "Wallet restored from backup.", Data: backup})
+}
+
+// ListWalletsHandler lists the named wallets and which one is active
+func (bc *BtcController) ListWalletsHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: bc.Service.ListWallets()})
+}
+
+// CreateNamedWalletHandler creates another wallet and switches to it, the seed phrase is only shown here
+func (bc *BtcController) CreateNamedWalletHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name       string `json:"name"`
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if params.Name == "" || params.Passphrase == "" {
+		respondWithError(w, http.StatusBadRequest, "Both name and passphrase are required")
+		return
+	}
+
+	wallet, mnemonic, err := bc.Service.CreateNamedWallet(params.Name, params.Passphrase)
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
 	resp := Response{
 		Status:  "success",
-		Message: result,
+		Message: "Wallet created. Write down the seed phrase, it is the only way to restore the wallet.",
+		Data: map[string]interface{}{
+			"wallet":   wallet,
+			"mnemonic": mnemonic,
+		},
 	}
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
+// SwitchWalletHandler restarts btcwallet on another wallet, btcd keeps running
+func (bc *BtcController) SwitchWalletHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name       string `json:"name"`
+		Passphrase string `json:"passphrase,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Wallet name is required")
+		return
+	}
+
+	wallet, message, err := bc.Service.SwitchWallet(params.Name, params.Passphrase)
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Message: message, Data: wallet})
+}
+
+// ListAccountsHandler lists the accounts of the active wallet with balances and addresses
+func (bc *BtcController) ListAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	accounts, err := bc.Service.ListAccounts()
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: accounts})
+}
+
+// CreateAccountHandler adds an account to the active wallet, which has to be unlocked
+func (bc *BtcController) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	account, err := bc.Service.CreateAccount(params.Name)
+	if err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: account})
+}
+
+// SelectAccountHandler picks the account new receiving addresses come from
+func (bc *BtcController) SelectAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := bc.Service.SelectAccount(params.Name); err != nil {
+		respondWithWalletError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Message: fmt.Sprintf("New addresses now come from account %s.", params.Name)})
+}
+
+// respondWithInvoiceError maps the invoice errors to status codes
+func respondWithInvoiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInvoice):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrInvoiceNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CreateInvoiceHandler invoices an amount to a fresh address, expiry is in seconds and defaults to an hour
+func (bc *BtcController) CreateInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Amount float64 `json:"amount"`
+		Memo   string  `json:"memo"`
+		Expiry int64   `json:"expiry"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// amount is in BTC like everywhere else in the wallet api, the invoice keeps satoshis
+	amount, err := btcutil.NewAmount(params.Amount)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	invoice, err := bc.Service.CreateInvoice(amount, params.Memo, time.Duration(params.Expiry)*time.Second, "", "")
+	if err != nil {
+		respondWithInvoiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: invoice})
+}
+
+// ListInvoicesHandler lists the invoices, ?status= keeps only open, pending, paid or expired ones
+func (bc *BtcController) ListInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: bc.Service.ListInvoices(r.URL.Query().Get("status"))})
+}
+
+// GetInvoiceHandler returns one invoice by ?id=
+func (bc *BtcController) GetInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	invoice, err := bc.Service.GetInvoice(r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithInvoiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: invoice})
+}
+
+// PayURIHandler pays a bitcoin: uri, e.g. the one on a seller's invoice
+func (bc *BtcController) PayURIHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		URI        string `json:"uri"`
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if _, _, _, err := services.ParseBIP21(params.URI); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	txid, err := bc.Service.PayURI(params.URI, params.Passphrase)
+	if err != nil {
+		respondWithInvoiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{Status: "success", Data: map[string]string{"txid": txid}})
+}
+
 func (bc *BtcController) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	balance, err := bc.Service.GetBalance()
 	if err != nil {
@@ -454,7 +748,7 @@ func (bc *BtcController) GetCurrentAddressHandler(w http.ResponseWriter, r *http
 	}
 
 	// Debugging
-	fmt.Println("Current address: ", currentAddress)
+	log.Debug("Current address: ", currentAddress)
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
@@ -472,22 +766,29 @@ func (bc *BtcController) GetMiningStatusHandler(w http.ResponseWriter, r *http.R
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
+// StartMiningHandler starts mining in the background, e.g. {"threads": 2}, no threads uses the saved setting
 func (bc *BtcController) StartMiningHandler(w http.ResponseWriter, r *http.Request) {
 	var params struct {
-		NumBlock int `json:"numBlock"`
+		Threads int `json:"threads"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
 	}
 
-	if params.NumBlock <= 0 {
-		respondWithError(w, http.StatusBadRequest, "numBlock must be greater than 0")
+	if params.Threads < 0 {
+		respondWithError(w, http.StatusBadRequest, "threads can't be negative")
 		return
 	}
 
-	result := bc.Service.StartMining(params.NumBlock)
+	result := bc.Service.StartMining(params.Threads)
+	if result != "mining started successfully" && result != "mining is running" {
+		respondWithError(w, http.StatusInternalServerError, result)
+		return
+	}
 
 	resp := Response{
 		Status:  "success",
@@ -498,6 +799,10 @@ func (bc *BtcController) StartMiningHandler(w http.ResponseWriter, r *http.Reque
 
 func (bc *BtcController) StopMiningHandler(w http.ResponseWriter, r *http.Request) {
 	result := bc.Service.StopMining()
+	if result != "mining stopped successfully" && result != "Mining is not active" {
+		respondWithError(w, http.StatusInternalServerError, result)
+		return
+	}
 
 	resp := Response{
 		Status:  "success",
@@ -506,6 +811,70 @@ func (bc *BtcController) StopMiningHandler(w http.ResponseWriter, r *http.Reques
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
+// GetMiningInfoHandler returns whether we mine, how fast and the state of the chain
+// the same status is pushed over the websocket every few seconds while mining
+func (bc *BtcController) GetMiningInfoHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := bc.Service.GetMiningInfoStatus()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get mining info: %v", err))
+		return
+	}
+
+	resp := Response{
+		Status: "success",
+		Data:   status,
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (bc *BtcController) GetMiningSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := Response{
+		Status: "success",
+		Data:   bc.Service.GetMiningSettings(),
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// UpdateMiningSettingsHandler switches miner, threads or mining address while mining keeps going
+func (bc *BtcController) UpdateMiningSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings models.MiningSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	updated, err := bc.Service.SetMiningSettings(settings)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := Response{
+		Status: "success",
+		Data:   updated,
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetMiningHistoryHandler lists the blocks we mined with their maturity and totals, e.g. GET /api/btc/mininghistory?limit=20
+func (bc *BtcController) GetMiningHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondWithError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = parsed
+	}
+
+	resp := Response{
+		Status: "success",
+		Data:   bc.Service.GetMiningHistory(limit),
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
 // GetMiningDashboardHandler returns the mining dashboard data
 func (bc *BtcController) GetMiningDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	// Get balance
@@ -529,10 +898,11 @@ func (bc *BtcController) GetMiningDashboardHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Combine results
+	// Combine results, with the totals of the blocks we mined
 	dashboard := map[string]interface{}{
-		"balance":    balance,
-		"miningInfo": miningInfo,
+		"balance":     balance,
+		"miningInfo":  miningInfo,
+		"miningStats": bc.Service.GetMiningHistory(0).Stats,
 	}
 
 	// Respond with combined data
@@ -550,7 +920,7 @@ func (bc *BtcController) InitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Println("InitHandler called")
+	log.Info("InitHandler called")
 
 	result := bc.Service.Init()
 
@@ -0,0 +1,5 @@
+package controllers
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("CTRL")
@@ -0,0 +1,431 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"application-layer/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// a bundle is a manifest published as an ordinary file, its members travel as ordinary files too
+// but are only handed out to peers that got the manifest from us
+
+var (
+	ErrBadManifest     = errors.New("invalid bundle manifest")
+	ErrUnknownBundle   = errors.New("unknown bundle")
+	ErrNotInBundle     = errors.New("file is not part of the bundle")
+	ErrBundleNotBought = errors.New("bundle was not bought from us")
+)
+
+var (
+	BundlesPath = filepath.Join(dirPath, "bundles.json")
+	Bundles     = newBundleStore()
+)
+
+type bundlesFile struct {
+	Manifests map[string]models.BundleManifest `json:"Manifests"`
+	Sellers   map[string]string                `json:"Sellers"` // who we got a bundle from, members are asked from them
+	Buyers    map[string][]string              `json:"Buyers"`  // who got a bundle from us
+}
+
+type bundleStore struct {
+	mu        sync.Mutex
+	manifests map[string]models.BundleManifest
+	sellers   map[string]string
+	buyers    map[string]map[string]bool
+}
+
+func newBundleStore() *bundleStore {
+	return &bundleStore{
+		manifests: make(map[string]models.BundleManifest),
+		sellers:   make(map[string]string),
+		buyers:    make(map[string]map[string]bool),
+	}
+}
+
+// read the bundles we hold, if any
+func LoadBundles() error {
+	data, err := os.ReadFile(BundlesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read bundles: %v", err)
+	}
+
+	var saved bundlesFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse bundles: %v", err)
+	}
+	Bundles.mu.Lock()
+	defer Bundles.mu.Unlock()
+	for hash, manifest := range saved.Manifests {
+		Bundles.manifests[hash] = manifest
+	}
+	for hash, seller := range saved.Sellers {
+		Bundles.sellers[hash] = seller
+	}
+	for hash, buyers := range saved.Buyers {
+		Bundles.buyers[hash] = make(map[string]bool)
+		for _, buyer := range buyers {
+			Bundles.buyers[hash][buyer] = true
+		}
+	}
+	return nil
+}
+
+// caller holds bs.mu
+func (bs *bundleStore) save() error {
+	saved := bundlesFile{Manifests: bs.manifests, Sellers: bs.sellers, Buyers: make(map[string][]string)}
+	for hash, buyers := range bs.buyers {
+		for buyer := range buyers {
+			saved.Buyers[hash] = append(saved.Buyers[hash], buyer)
+		}
+		sort.Strings(saved.Buyers[hash])
+	}
+
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundles: %v", err)
+	}
+	if err := os.WriteFile(BundlesPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write bundles: %v", err)
+	}
+	return nil
+}
+
+// EncodeManifest is the content a manifest is published with, entries sorted by path
+func EncodeManifest(manifest models.BundleManifest) ([]byte, error) {
+	sort.Slice(manifest.Entries, func(i, j int) bool { return manifest.Entries[i].Path < manifest.Entries[j].Path })
+	if err := checkManifest(manifest); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(manifest, "", "  ")
+}
+
+// ParseManifest reads a manifest that came from someone else, nothing in it is trusted
+func ParseManifest(data []byte) (models.BundleManifest, error) {
+	var manifest models.BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return models.BundleManifest{}, fmt.Errorf("%w: %v", ErrBadManifest, err)
+	}
+	if err := checkManifest(manifest); err != nil {
+		return models.BundleManifest{}, err
+	}
+	return manifest, nil
+}
+
+func checkManifest(manifest models.BundleManifest) error {
+	if len(manifest.Entries) == 0 {
+		return fmt.Errorf("%w: no files", ErrBadManifest)
+	}
+	seen := make(map[string]bool)
+	for _, entry := range manifest.Entries {
+		// paths end up joined onto a download directory, keep them inside it
+		clean := path.Clean(entry.Path)
+		if clean != entry.Path || path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, "\\") {
+			return fmt.Errorf("%w: bad path %q", ErrBadManifest, entry.Path)
+		}
+		if seen[clean] {
+			return fmt.Errorf("%w: %q listed twice", ErrBadManifest, entry.Path)
+		}
+		seen[clean] = true
+		if !storage.ValidHash(entry.Hash) || entry.Size < 0 {
+			return fmt.Errorf("%w: bad entry for %q", ErrBadManifest, entry.Path)
+		}
+	}
+	return nil
+}
+
+// Add keeps a manifest we publish or downloaded, seller is empty for our own bundles
+func (bs *bundleStore) Add(hash string, manifest models.BundleManifest, seller string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.manifests[hash] = manifest
+	if seller != "" {
+		bs.sellers[hash] = seller
+	}
+	return bs.save()
+}
+
+// adopt picks up a downloaded manifest so its members can be fetched and served
+func (bs *bundleStore) adopt(hash string, seller string) error {
+	blobPath, err := storage.Blobs.Path(hash)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(blobPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %v", err)
+	}
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return err
+	}
+	return bs.Add(hash, manifest, seller)
+}
+
+// caller holds bs.mu
+func (bs *bundleStore) status(hash string, manifest models.BundleManifest) models.BundleStatus {
+	status := models.BundleStatus{Hash: hash, Manifest: manifest, Have: make(map[string]bool), Complete: true}
+	for _, entry := range manifest.Entries {
+		status.Have[entry.Path] = storage.Blobs.Has(entry.Hash)
+		status.Complete = status.Complete && status.Have[entry.Path]
+	}
+	return status
+}
+
+func (bs *bundleStore) Status(hash string) (models.BundleStatus, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	manifest, exists := bs.manifests[hash]
+	if !exists {
+		return models.BundleStatus{}, ErrUnknownBundle
+	}
+	return bs.status(hash, manifest), nil
+}
+
+func (bs *bundleStore) List() []models.BundleStatus {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	list := []models.BundleStatus{}
+	for hash, manifest := range bs.manifests {
+		list = append(list, bs.status(hash, manifest))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Manifest.Name < list[j].Manifest.Name })
+	return list
+}
+
+// Keep lists the manifests and members the garbage collector has to leave alone
+func (bs *bundleStore) Keep() map[string]bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	keep := make(map[string]bool)
+	for hash, manifest := range bs.manifests {
+		keep[hash] = true
+		for _, entry := range manifest.Entries {
+			keep[entry.Hash] = true
+		}
+	}
+	return keep
+}
+
+// MemberRequests builds download requests for the members of a bundle we don't have yet,
+// all of them when paths is empty. they go to the peer we got the manifest from
+func (bs *bundleStore) MemberRequests(hash string, paths []string) ([]models.Transaction, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	manifest, exists := bs.manifests[hash]
+	if !exists {
+		return nil, fmt.Errorf("%w: download the bundle %s first", ErrUnknownBundle, hash)
+	}
+
+	wanted := make(map[string]bool)
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	requests := []models.Transaction{}
+	for _, entry := range manifest.Entries {
+		if len(wanted) > 0 && !wanted[entry.Path] {
+			continue
+		}
+		delete(wanted, entry.Path)
+		if storage.Blobs.Has(entry.Hash) {
+			continue
+		}
+		requests = append(requests, models.Transaction{
+			Type:       "request",
+			FileHash:   entry.Hash,
+			FileName:   path.Base(entry.Path),
+			TargetID:   bs.sellers[hash],
+			Size:       entry.Size,
+			BundleHash: hash,
+		})
+	}
+	for p := range wanted {
+		return nil, fmt.Errorf("%w: %s", ErrNotInBundle, p)
+	}
+	return requests, nil
+}
+
+// sold remembers that peerID got the bundle hash from us, nothing happens for other files
+func (bs *bundleStore) sold(hash string, peerID string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if _, exists := bs.manifests[hash]; !exists {
+		return
+	}
+	if bs.buyers[hash] == nil {
+		bs.buyers[hash] = make(map[string]bool)
+	}
+	bs.buyers[hash][peerID] = true
+	if err := bs.save(); err != nil {
+		log.Info("bundles:", err)
+	}
+}
+
+// has reports whether hash is the manifest of a bundle we sell
+func (bs *bundleStore) has(hash string) bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	_, exists := bs.manifests[hash]
+	return exists
+}
+
+// authorize checks a request for a member of a bundle, the bundle is paid for as a whole
+// and a free one is open to everyone, like its manifest
+func (bs *bundleStore) authorize(peerID string, hash string, fileHash string) (models.BundleEntry, error) {
+	bs.mu.Lock()
+	manifest, exists := bs.manifests[hash]
+	bought := bs.buyers[hash][peerID]
+	bs.mu.Unlock()
+	if !exists {
+		return models.BundleEntry{}, ErrUnknownBundle
+	}
+	if !bought {
+		// the price is looked up in the dht, not while holding bs.mu
+		if fee, err := Pricing.feeFor(models.Transaction{FileHash: hash, RequesterID: peerID}); err != nil || fee > 0 {
+			return models.BundleEntry{}, ErrBundleNotBought
+		}
+	}
+	for _, entry := range manifest.Entries {
+		if entry.Hash == fileHash {
+			if !storage.Blobs.Has(fileHash) {
+				return models.BundleEntry{}, fmt.Errorf("we don't have %s of this bundle", entry.Path)
+			}
+			return entry, nil
+		}
+	}
+	return models.BundleEntry{}, ErrNotInBundle
+}
+
+// members have no dht record of their own, their metadata comes from the manifest
+func sendBundleMemberMetadata(stream network.Stream, request models.Transaction) error {
+	entry, err := Bundles.authorize(request.RequesterID, request.BundleHash, request.FileHash)
+	if err != nil {
+		return fmt.Errorf("sendBundleMemberMetadata: %w", err)
+	}
+	name := path.Base(entry.Path)
+	metadata := models.FileMetadata{
+		Name:              strings.TrimSuffix(name, path.Ext(name)),
+		NameWithExtension: name,
+		Size:              entry.Size,
+		Description:       entry.Path,
+		Hash:              entry.Hash,
+		ChunkRoot:         entry.ChunkRoot,
+	}
+	if err := WriteMessage(stream, metadata); err != nil {
+		return fmt.Errorf("sendBundleMemberMetadata: failed to write metadata to stream: %w", err)
+	}
+	return nil
+}
+
+// member looks up the entry for fileHash in a manifest we hold, its ChunkRoot is what we trust the seller's chunks against
+func (bs *bundleStore) member(hash string, fileHash string) (models.BundleEntry, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	manifest, exists := bs.manifests[hash]
+	if !exists {
+		return models.BundleEntry{}, ErrUnknownBundle
+	}
+	for _, entry := range manifest.Entries {
+		if entry.Hash == fileHash {
+			return entry, nil
+		}
+	}
+	return models.BundleEntry{}, ErrNotInBundle
+}
+
+// RequestChunkTree asks the seller for the chunk hashes of a member and checks them against
+// the ChunkRoot in our copy of the manifest, which came with the bundle's own verified hash
+func RequestChunkTree(targetID string, bundleHash string, fileHash string) (models.ChunkTree, error) {
+	entry, err := Bundles.member(bundleHash, fileHash)
+	if err != nil {
+		return models.ChunkTree{}, err
+	}
+	if entry.ChunkRoot == "" {
+		return models.ChunkTree{}, fmt.Errorf("%w: no chunk root for %s", ErrBadManifest, entry.Path)
+	}
+
+	s, err := openStream(targetID, ProtocolChunkTree)
+	if err != nil {
+		return models.ChunkTree{}, fmt.Errorf("error requesting chunk tree: %w", err)
+	}
+	defer s.Close()
+	if err := WriteMessage(s, models.ChunkTreeRequest{BundleHash: bundleHash, FileHash: fileHash}); err != nil {
+		return models.ChunkTree{}, fmt.Errorf("error requesting chunk tree: %v", err)
+	}
+	var response models.ChunkTreeResponse
+	if err := ReadMessage(s, &response); err != nil {
+		return models.ChunkTree{}, err
+	}
+	if response.Status != "ok" {
+		return models.ChunkTree{}, fmt.Errorf("chunk tree declined: %s", response.Message)
+	}
+
+	tree := response.Tree
+	if tree.ChunkSize != storage.ChunkSize || tree.Root != entry.ChunkRoot {
+		return models.ChunkTree{}, fmt.Errorf("%w: chunk tree of %s doesn't match the manifest", storage.ErrHashMismatch, entry.Path)
+	}
+	if err := storage.VerifyTree(tree); err != nil {
+		return models.ChunkTree{}, err
+	}
+	return tree, nil
+}
+
+func receiveChunkTreeRequest(node host.Host) {
+	handleProtocol(node, ProtocolChunkTree, func(s network.Stream) {
+		defer s.Close()
+
+		var request models.ChunkTreeRequest
+		if err := ReadMessage(s, &request); err != nil {
+			rejectStream(s, err)
+			return
+		}
+
+		// only buyers of the bundle get to see what its members look like
+		response := models.ChunkTreeResponse{Status: "declined"}
+		if _, err := Bundles.authorize(s.Conn().RemotePeer().String(), request.BundleHash, request.FileHash); err != nil {
+			response.Message = err.Error()
+		} else if tree, err := storage.Blobs.Tree(request.FileHash); err != nil {
+			response.Message = err.Error()
+		} else {
+			response.Status, response.Tree = "ok", tree
+		}
+		if err := WriteMessage(s, response); err != nil {
+			log.Info("receiveChunkTreeRequest:", messageError(s, err))
+		}
+	})
+}
+
+// a verified member is in the blob store, unlike a whole file it isn't listed or published on its own
+func completeBundleMember(transaction models.Transaction, metadata models.FileMetadata, entry models.BlobEntry) {
+	if metadata.Hash != transaction.FileHash {
+		err := fmt.Errorf("%w: got %s instead of %s", ErrNotInBundle, metadata.Hash, transaction.FileHash)
+		log.Info("completeBundleMember:", err)
+		Transfers.finish(transaction.TransactionID, err)
+		Reputation.record(transaction.TargetID, eventCorrupt, transaction.TransactionID, 0, 0)
+		return
+	}
+
+	Transfers.finish(transaction.TransactionID, nil)
+	Reputation.record(transaction.TargetID, eventSuccess, transaction.TransactionID, entry.Size, Transfers.receiveTime(transaction.TransactionID))
+	transaction.Status = "complete"
+	utils.AddOrUpdateTransaction(transaction)
+	log.Infof("bundle %s: received %s", transaction.BundleHash, metadata.Description)
+	sendMessageConfirmation(transaction)
+}
@@ -0,0 +1,134 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// go test -v -run ^TestBundle$ -count=1 application-layer/dht
+func TestBundle(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	requester := net.Nodes[1]
+
+	// members only go into the blob store, the manifest is the one published file
+	contents := map[string][]byte{
+		"README.md":   []byte("# project\n"),
+		"src/main.go": []byte("package main\n"),
+	}
+	manifest := models.BundleManifest{Name: "project"}
+	for path, content := range contents {
+		entry, err := storage.Blobs.Put(bytes.NewReader(content), path, "")
+		if err != nil {
+			t.Fatalf("failed to store %s: %v", path, err)
+		}
+		storage.Blobs.Unpin(entry.Hash)
+		manifest.Entries = append(manifest.Entries, models.BundleEntry{Path: path, Hash: entry.Hash, Size: entry.Size, ChunkRoot: entry.ChunkRoot})
+	}
+	data, err := EncodeManifest(manifest)
+	if err != nil {
+		t.Fatalf("failed to encode manifest: %v", err)
+	}
+	parsed, err := ParseManifest(data)
+	if err != nil || parsed.Entries[0].Path != "README.md" {
+		t.Fatalf("parsed manifest = %+v, %v", parsed, err)
+	}
+	bundle := net.addFile("project.bundle.json", data, 3)
+	bundle.Type = models.BundleType
+	if _, err := UpdateFileInDHT(bundle); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if err := Bundles.Add(bundle.Hash, parsed, ""); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	member := parsed.Entries[1]
+	memberRequest := func(transactionID string, bundleHash string) models.Transaction {
+		return models.Transaction{Type: "request", TransactionID: transactionID, FileHash: member.Hash, RequesterID: requester.ID(), TargetID: PeerID, BundleHash: bundleHash}
+	}
+
+	// members aren't handed out on their own, nor before the bundle was bought
+	if _, decline := net.download(requester, memberRequest("m1", "")); decline == nil {
+		t.Errorf("member served outside its bundle")
+	}
+	if _, decline := net.download(requester, memberRequest("m2", bundle.Hash)); decline == nil || decline.Message != ErrBundleNotBought.Error() {
+		t.Errorf("member of an unbought bundle: got %+v", decline)
+	}
+
+	askForTree := func() models.ChunkTreeResponse {
+		t.Helper()
+		s, err := requester.Host.NewStream(net.ctx, Host.ID(), ProtocolChunkTree)
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		defer s.Close()
+		var response models.ChunkTreeResponse
+		if err := WriteMessage(s, models.ChunkTreeRequest{BundleHash: bundle.Hash, FileHash: member.Hash}); err != nil {
+			t.Fatalf("failed to ask for chunk tree: %v", err)
+		}
+		if err := ReadMessage(s, &response); err != nil {
+			t.Fatalf("failed to read chunk tree: %v", err)
+		}
+		return response
+	}
+	if response := askForTree(); response.Status != "declined" {
+		t.Errorf("chunk tree of an unbought bundle: got %+v", response)
+	}
+
+	// a priced manifest comes encrypted even unasked, the bundle is only bought once the key is paid for
+	d := net.requestFile(requester, bundle, "b1")
+	if !d.Transaction.Encrypted || bytes.Equal(d.Content, data) {
+		t.Fatalf("manifest of a priced bundle sent in the clear")
+	}
+	if _, err := Bundles.authorize(requester.ID(), bundle.Hash, member.Hash); !errors.Is(err, ErrBundleNotBought) {
+		t.Fatalf("bundle bought without paying: %v", err)
+	}
+	response := net.askForKey(requester, d.Transaction, net.pay(3))
+	if response.Status != "released" || !bytes.Equal(d.decrypt(t, response.Key), data) {
+		t.Fatalf("paid for the manifest: got %+v", response)
+	}
+	if _, err := Bundles.authorize(requester.ID(), bundle.Hash, member.Hash); err != nil {
+		t.Fatalf("bundle not bought after paying: %v", err)
+	}
+
+	// buyers check members chunk by chunk against the root in their manifest
+	if response := askForTree(); response.Status != "ok" || response.Tree.Root != member.ChunkRoot || storage.VerifyTree(response.Tree) != nil {
+		t.Errorf("chunk tree of a bought bundle: got %+v", response)
+	}
+
+	d, decline := net.download(requester, memberRequest("m3", bundle.Hash))
+	if decline != nil {
+		t.Fatalf("member of a bought bundle declined: %s", decline.Message)
+	}
+	if d.Transaction.Encrypted || d.Metadata.Hash != member.Hash || d.Metadata.Description != member.Path || d.Metadata.ChunkRoot != member.ChunkRoot {
+		t.Errorf("member metadata = %+v, encrypted %v", d.Metadata, d.Transaction.Encrypted)
+	}
+	if !bytes.Equal(d.Content, contents[member.Path]) {
+		t.Errorf("member content differs")
+	}
+
+	// the requester asks its seller for what it is missing, only the paths it picked
+	if err := Bundles.Add(bundle.Hash, parsed, requester.ID()); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	storage.Blobs.Remove(member.Hash)
+	requests, err := Bundles.MemberRequests(bundle.Hash, []string{member.Path})
+	if err != nil || len(requests) != 1 || requests[0].FileHash != member.Hash || requests[0].TargetID != requester.ID() {
+		t.Errorf("member requests = %+v, %v", requests, err)
+	}
+	if requests, _ := Bundles.MemberRequests(bundle.Hash, nil); len(requests) != 1 {
+		t.Errorf("requests for the whole bundle = %+v, want only the missing member", requests)
+	}
+	if _, err := Bundles.MemberRequests(bundle.Hash, []string{"nope"}); !errors.Is(err, ErrNotInBundle) {
+		t.Errorf("unknown path: got %v", err)
+	}
+
+	// paths from someone else's manifest must stay inside the download directory
+	for _, path := range []string{"../escape", "/etc/passwd", "a/../../b", "a//b"} {
+		bad := models.BundleManifest{Entries: []models.BundleEntry{{Path: path, Hash: member.Hash}}}
+		if _, err := EncodeManifest(bad); !errors.Is(err, ErrBadManifest) {
+			t.Errorf("path %q: got %v", path, err)
+		}
+	}
+}
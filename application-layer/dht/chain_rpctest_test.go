@@ -0,0 +1,141 @@
+//go:build rpctest
+
+package dht_kad
+
+import (
+	"application-layer/models"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// payments on a real btcd simnet chain instead of the fake one in harness_test.go
+// rpctest pays from its own in-memory wallet, btcwallet and btcctl aren't involved -
+// the chain takes the place of BtcService through walletAddress and lookupPayment
+// btcd is built from ../btcd on first use, or set BTCD_EXE to an existing binary
+
+type testChain struct {
+	t       *testing.T
+	harness *rpctest.Harness
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+	// txindex so payments can be looked up once they are mined
+	harness, err := rpctest.New(&chaincfg.SimNetParams, nil, []string{"--txindex"}, os.Getenv("BTCD_EXE"))
+	if err != nil {
+		t.Fatalf("failed to create simnet harness: %v", err)
+	}
+	if err := harness.SetUp(true, 25); err != nil {
+		harness.TearDown()
+		t.Fatalf("failed to start simnet harness: %v", err)
+	}
+	t.Cleanup(func() { harness.TearDown() })
+	return &testChain{t: t, harness: harness}
+}
+
+// use makes the chain our wallet, address is where we get paid
+func (c *testChain) use(address btcutil.Address) {
+	walletAddress = func() (string, error) {
+		return address.EncodeAddress(), nil
+	}
+	lookupPayment = c.lookupPayment
+}
+
+func (c *testChain) newAddress() btcutil.Address {
+	c.t.Helper()
+	address, err := c.harness.NewAddress()
+	if err != nil {
+		c.t.Fatalf("failed to create address: %v", err)
+	}
+	return address
+}
+
+// pay sends amount btc to address and returns the txid, mine before it counts as confirmed
+func (c *testChain) pay(address string, amount float64) string {
+	c.t.Helper()
+	decoded, err := btcutil.DecodeAddress(address, &chaincfg.SimNetParams)
+	if err != nil {
+		c.t.Fatalf("bad address %s: %v", address, err)
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		c.t.Fatalf("failed to build output script: %v", err)
+	}
+	value, err := btcutil.NewAmount(amount)
+	if err != nil {
+		c.t.Fatalf("bad amount %f: %v", amount, err)
+	}
+	txid, err := c.harness.SendOutputs([]*wire.TxOut{wire.NewTxOut(int64(value), script)}, 10)
+	if err != nil {
+		c.t.Fatalf("failed to send payment: %v", err)
+	}
+	return txid.String()
+}
+
+func (c *testChain) mine(blocks uint32) {
+	c.t.Helper()
+	if _, err := c.harness.Client.Generate(blocks); err != nil {
+		c.t.Fatalf("failed to mine: %v", err)
+	}
+}
+
+// same answer GetPaymentAmount gives: btc paid to address by txid and its confirmations
+func (c *testChain) lookupPayment(txid string, address string) (float64, int64, error) {
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid transaction id: %v", err)
+	}
+	tx, err := c.harness.Client.GetRawTransactionVerbose(hash)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to look up transaction: %v", err)
+	}
+	var amount float64
+	for _, out := range tx.Vout {
+		if out.ScriptPubKey.Address == address {
+			amount += out.Value
+		}
+	}
+	return amount, int64(tx.Confirmations), nil
+}
+
+// go test -v -tags rpctest -run ^TestPaidDownloadOnSimnet$ -count=1 application-layer/dht
+func TestPaidDownloadOnSimnet(t *testing.T) {
+	// before the network, which moves the working directory out of the module rpctest builds btcd in
+	chain := newTestChain(t)
+	net := newTestNetwork(t, 2)
+	chain.use(chain.newAddress())
+	requester := net.Nodes[1]
+
+	content := []byte("paid for on simnet")
+	file := net.addFile("simnet.txt", content, 50000)
+	if _, err := UpdateFileInDHT(file); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if err := Uploads.SetPolicy(models.UploadPolicy{EncryptTransfers: true}); err != nil {
+		t.Fatalf("failed to set upload policy: %v", err)
+	}
+	d := net.requestFile(requester, file, "simnet-1")
+
+	// the requester pays the wallet the provider put in the transaction
+	txid := chain.pay(d.Transaction.TargetWallet, 0.0005)
+	if response := net.askForKey(requester, d.Transaction, txid); response.Status != "declined" {
+		t.Fatalf("unconfirmed payment: got %+v", response)
+	}
+
+	chain.mine(1)
+	response := net.askForKey(requester, d.Transaction, txid)
+	if response.Status != "released" {
+		t.Fatalf("confirmed payment: got %+v", response)
+	}
+	if hashOf(d.decrypt(t, response.Key)) != file.Hash {
+		t.Errorf("decrypted content does not match the advertised hash")
+	}
+}
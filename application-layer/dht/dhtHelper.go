@@ -1,6 +1,7 @@
 package dht_kad
 
 import (
+	"application-layer/metrics"
 	"application-layer/models"
 	"bufio"
 	"bytes"
@@ -8,12 +9,10 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/libp2p/go-libp2p-kad-dht/providers"
@@ -30,7 +29,6 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/multiformats/go-multiaddr"
-	"github.com/multiformats/go-multihash"
 )
 
 var (
@@ -71,13 +69,13 @@ func setupDHT(ctx context.Context, h host.Host) *dht.IpfsDHT {
 	// Set up the DHT instance
 	kadDHT, err := dht.New(ctx, h, dht.Mode(dht.ModeClient))
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
 
 	// Bootstrap the DHT (connect to other peers to join the DHT network)
 	err = kadDHT.Bootstrap(ctx)
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
 
 	// Configure the DHT to use the custom validator - idk if this even goes here
@@ -97,17 +95,17 @@ func createNode() (host.Host, *dht.IpfsDHT, error) {
 	}
 	privKey, err := generatePrivateKeyFromSeed(seed)
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
 	relayAddr, err := multiaddr.NewMultiaddr(Relay_node_addr)
 	if err != nil {
-		log.Fatalf("Failed to create relay multiaddr: %v", err)
+		fatalf("Failed to create relay multiaddr: %v", err)
 	}
 
 	// Convert the relay multiaddress to AddrInfo
 	relayInfo, err := peer.AddrInfoFromP2pAddr(relayAddr)
 	if err != nil {
-		log.Fatalf("Failed to create AddrInfo from relay multiaddr: %v", err)
+		fatalf("Failed to create AddrInfo from relay multiaddr: %v", err)
 	}
 
 	node, err := libp2p.New(
@@ -118,6 +116,7 @@ func createNode() (host.Host, *dht.IpfsDHT, error) {
 		libp2p.EnableAutoRelayWithStaticRelays([]peer.AddrInfo{*relayInfo}),
 		libp2p.EnableRelayService(),
 		libp2p.EnableHolePunching(),
+		libp2p.PrometheusRegisterer(metrics.Registry), // swarm, relay and hole punching stats go to /metrics too
 	)
 
 	if err != nil {
@@ -125,7 +124,7 @@ func createNode() (host.Host, *dht.IpfsDHT, error) {
 	}
 	_, err = relay.New(node)
 	if err != nil {
-		log.Printf("Failed to instantiate the relay: %v", err)
+		log.Errorf("Failed to instantiate the relay: %v", err)
 	}
 
 	dhtRouting, err := dht.New(ctx, node, dht.Mode(dht.ModeClient))
@@ -142,142 +141,28 @@ func createNode() (host.Host, *dht.IpfsDHT, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	fmt.Println("DHT bootstrap complete.")
+	log.Info("DHT bootstrap complete.")
 
 	// Set up notifications for new connections
 	node.Network().Notify(&network.NotifyBundle{
 		ConnectedF: func(n network.Network, conn network.Conn) {
-			fmt.Printf("Notification: New peer connected %s\n", conn.RemotePeer().String())
+			log.Infof("Notification: New peer connected %s", conn.RemotePeer().String())
 		},
 	})
 
 	return node, dhtRouting, nil
 }
 
-func handleInput(ctx context.Context, dht *dht.IpfsDHT) {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("User Input \n ")
-	for {
-		fmt.Print("> ")
-		input, _ := reader.ReadString('\n') // Read input from keyboard
-		input = strings.TrimSpace(input)    // Trim any trailing newline or spaces
-		args := strings.Split(input, " ")
-		if len(args) < 1 {
-			fmt.Println("No command provided")
-			continue
-		}
-		command := args[0]
-		command = strings.ToUpper(command)
-		switch command {
-		// case "LIST_ALL":
-		// 	if len(args) >= 2 {
-		// 		fmt.Println("We don't want arguments")
-		// 		continue
-		// 	}
-		// 	listKeys(ctx, dht)
-		case "GET":
-			if len(args) < 2 {
-				fmt.Println("Expected key")
-				continue
-			}
-			key := args[1]
-			dhtKey := "/orcanet/" + key
-			res, err := dht.GetValue(ctx, dhtKey)
-			if err != nil {
-				fmt.Printf("Failed to get record: %v\n", err)
-				continue
-			}
-			fmt.Printf("Record: %s\n", res)
-
-		case "GET_PROVIDERS":
-			if len(args) < 2 {
-				fmt.Println("Expected key")
-				continue
-			}
-			key := args[1]
-			data := []byte(key)
-			hash := sha256.Sum256(data)
-			mh, err := multihash.EncodeName(hash[:], "sha2-256")
-			if err != nil {
-				fmt.Printf("Error encoding multihash: %v\n", err)
-				continue
-			}
-			c := cid.NewCidV1(cid.Raw, mh)
-			providers := dht.FindProvidersAsync(ctx, c, 20)
-
-			fmt.Println("Searching for providers...")
-			for p := range providers {
-				if p.ID == peer.ID("") {
-					break
-				}
-				fmt.Printf("Found provider: %s\n", p.ID.String())
-				for _, addr := range p.Addrs {
-					fmt.Printf(" - Address: %s\n", addr.String())
-				}
-			}
-
-		case "PUT":
-			if len(args) < 3 {
-				fmt.Println("Expected key and value")
-				continue
-			}
-			key := args[1]
-			value := args[2]
-			dhtKey := "/orcanet/" + key
-			log.Println(dhtKey)
-			err := dht.PutValue(ctx, dhtKey, []byte(value))
-			if err != nil {
-				fmt.Printf("Failed to put record: %v\n", err)
-				continue
-			}
-			// ProvideKey(ctx, dht, key)
-			fmt.Println("Record stored successfully")
-
-		case "PUT_PROVIDER":
-			if len(args) < 2 {
-				fmt.Println("Expected key")
-				continue
-			}
-			key := args[1]
-			ProvideKey(ctx, dht, key)
-
-			// doesnt work
-		// case "GET_FILE":
-		// 	if len(args) < 2 {
-		// 		fmt.Println("Expected file request")
-		// 		continue
-		// 	}
-		// 	fmt.Println("download request", args[1])
-		// 	jsonInput := os.Args[1]
-
-		// 	// Create a Transaction struct
-		// 	var transaction models.Transaction
-
-		// 	// Parse the JSON string into the struct
-		// 	err := json.Unmarshal([]byte(jsonInput), &transaction)
-		// 	if err != nil {
-		// 		fmt.Println("Error parsing JSON:", err)
-		// 		return
-		// 	}
-		// 	SendDownloadRequest(transaction)
-
-		default:
-			fmt.Println("Expected GET, GET_PROVIDERS, PUT or PUT_PROVIDER")
-		}
-	}
-}
-
 func ProvideKey(ctx context.Context, dht *dht.IpfsDHT, key string) error {
-	data := []byte(key)
-	hash := sha256.Sum256(data)
-	mh, err := multihash.EncodeName(hash[:], "sha2-256")
+	c, err := keyCid(key)
 	if err != nil {
-		return fmt.Errorf("error encoding multihash: %v", err)
+		return err
 	}
-	c := cid.NewCidV1(cid.Raw, mh)
 
 	// Start providing the key
+	start := time.Now()
 	err = dht.Provide(ctx, c, true)
+	metrics.DHTOperation("provide", start, err)
 	if err != nil {
 		return fmt.Errorf("failed to start providing key: %v", err)
 	}
@@ -288,13 +173,13 @@ func makeReservation(node host.Host) {
 	ctx := GlobalCtx
 	relayInfo, err := peer.AddrInfoFromString(Relay_node_addr)
 	if err != nil {
-		log.Fatalf("Failed to create addrInfo from string representation of relay multiaddr: %v", err)
+		fatalf("Failed to create addrInfo from string representation of relay multiaddr: %v", err)
 	}
 	_, err = client.Reserve(ctx, node, *relayInfo)
 	if err != nil {
-		log.Fatalf("Failed to make reservation on relay: %v", err)
+		fatalf("Failed to make reservation on relay: %v", err)
 	}
-	fmt.Printf("Reservation successfull \n")
+	log.Infof("Reservation successfull")
 }
 
 func refreshReservation(node host.Host, interval time.Duration) {
@@ -306,13 +191,19 @@ func refreshReservation(node host.Host, interval time.Duration) {
 		case <-ticker.C:
 			makeReservation(node)
 		case <-GlobalCtx.Done():
-			fmt.Println("Context done, stopping reservation refresh.")
+			log.Info("Context done, stopping reservation refresh.")
 			return
 		}
 	}
 }
 
+// the id can come from NODE_ID so the server runs without a terminal, it's asked for otherwise
 func getNodeId() {
+	if id := strings.TrimSpace(os.Getenv("NODE_ID")); id != "" {
+		Node_id = id
+		log.Infof("node id %s from NODE_ID", Node_id)
+		return
+	}
 	for {
 		fmt.Print("Enter SBU ID: ")
 		reader := bufio.NewReader(os.Stdin)
@@ -336,15 +227,15 @@ func getNodeId() {
 
 // move to files package?
 func UpdateFileInDHT(currentInfo models.FileMetadata) (models.DHTMetadata, error) {
-	fmt.Println("-----UpdateFileInDHT-----")
-	fmt.Println("NEW FEE: ", currentInfo.Fee)
+	log.Info("-----UpdateFileInDHT-----")
+	log.Debug("NEW FEE: ", currentInfo.Fee)
 	// Retrieve the current metadata for the file, if it exists
 	var currentMetadata models.DHTMetadata
-	existingData, err := DHT.GetValue(GlobalCtx, "/orcanet/"+currentInfo.Hash)
+	existingData, err := GetValue(GlobalCtx, "/orcanet/"+currentInfo.Hash)
 	if err == nil { // If data exists, unmarshal it
 		err = json.Unmarshal(existingData, &currentMetadata)
 		if err != nil {
-			log.Fatal("Failed to unmarshal existing DHTMetadata:", err)
+			return models.DHTMetadata{}, fmt.Errorf("failed to unmarshal existing DHTMetadata: %w", err)
 		}
 	} else {
 		// If no existing metadata, initialize a new DHTMetadata
@@ -357,8 +248,14 @@ func UpdateFileInDHT(currentInfo models.FileMetadata) (models.DHTMetadata, error
 			NameWithExtension: currentInfo.NameWithExtension,
 			Rating:            0,
 			Hash:              currentInfo.Hash,
+			ChunkRoot:         currentInfo.ChunkRoot,
 		}
 		currentMetadata.Providers = make(map[string]models.Provider)
+		Series.annotate(&currentMetadata)
+	}
+
+	if currentMetadata.ChunkRoot == "" {
+		currentMetadata.ChunkRoot = currentInfo.ChunkRoot
 	}
 
 	// create a new provider
@@ -372,14 +269,14 @@ func UpdateFileInDHT(currentInfo models.FileMetadata) (models.DHTMetadata, error
 
 	// Check if the provider already exists in the metadata by PeerID
 	if existingProvider, exists := currentMetadata.Providers[PeerID]; exists {
-		fmt.Println("provider already exists")
+		log.Info("provider already exists")
 		// Update the IsActive field
 		existingProvider.IsActive = currentInfo.IsPublished
 		existingProvider.Fee = currentInfo.Fee
 		// Update the provider in the map
 		currentMetadata.Providers[PeerID] = existingProvider
 	} else {
-		fmt.Println("adding new provider")
+		log.Info("adding new provider")
 		// If provider does not exist, add the new provider
 		currentMetadata.Providers[PeerID] = provider
 	}
@@ -401,7 +298,7 @@ func UpdateFileInDHT(currentInfo models.FileMetadata) (models.DHTMetadata, error
 		currentMetadata.Providers[PeerID] = provider // Reassign the modified provider back to the map
 	}
 
-	fmt.Println("UpdateFileInDHT: metadata to be added to DHT: ", currentMetadata)
+	log.Debug("UpdateFileInDHT: metadata to be added to DHT: ", currentMetadata)
 	// Marshal the updated metadata
 	dhtMetadataBytes, err := json.Marshal(currentMetadata)
 	if err != nil {
@@ -413,14 +310,14 @@ func UpdateFileInDHT(currentInfo models.FileMetadata) (models.DHTMetadata, error
 	if err != nil {
 		return models.DHTMetadata{}, fmt.Errorf("failed to register updated file to dht: %w", err)
 	}
-	fmt.Println("am now a provider of", currentMetadata.Hash)
+	log.Info("am now a provider of", currentMetadata.Hash)
 
 	// Store the updated metadata in the DHT
-	err = DHT.PutValue(GlobalCtx, "/orcanet/"+currentInfo.Hash, dhtMetadataBytes)
+	err = PutValue(GlobalCtx, "/orcanet/"+currentInfo.Hash, dhtMetadataBytes)
 	if err != nil {
 		return models.DHTMetadata{}, fmt.Errorf("failed to updated file in dht: %w", err)
 	}
-	fmt.Println("updateFileInDHT: successfully updated file to dht with new provider", currentMetadata)
+	log.Debug("updateFileInDHT: successfully updated file to dht with new provider", currentMetadata)
 
 	return currentMetadata, nil
 }
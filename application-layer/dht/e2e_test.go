@@ -0,0 +1,313 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"application-layer/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multihash"
+)
+
+// go test -v -run ^TestPublishAndDiscover$ -count=1 application-layer/dht
+func TestPublishAndDiscover(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	file := net.addFile("hello.txt", []byte("hello from node 0"), 2)
+
+	dhtMetadata, err := UpdateFileInDHT(file)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if err := SendCloudNodeFiles(dhtMetadata); err != nil {
+		t.Fatalf("failed to reach the cloud node through the relay: %v", err)
+	}
+	if got := net.cloudFile(file.Hash); got.Providers[PeerID].Fee != 2 {
+		t.Errorf("cloud node got fee %d, want 2", got.Providers[PeerID].Fee)
+	}
+
+	// a node that never talked to us about the file finds both the metadata and us as its provider
+	remote := net.Nodes[2]
+	data, err := remote.DHT.GetValue(net.ctx, "/orcanet/"+file.Hash)
+	if err != nil {
+		t.Fatalf("metadata not found from remote node: %v", err)
+	}
+	var metadata models.DHTMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatalf("bad metadata in dht: %v", err)
+	}
+	provider, exists := metadata.Providers[PeerID]
+	if !exists || !provider.IsActive || provider.Fee != 2 {
+		t.Errorf("provider entry = %+v (exists %v), want an active provider with fee 2", provider, exists)
+	}
+	if metadata.ChunkRoot != file.ChunkRoot {
+		t.Errorf("chunk root = %q, want %q", metadata.ChunkRoot, file.ChunkRoot)
+	}
+
+	found := false
+	for p := range remote.DHT.FindProvidersAsync(net.ctx, fileCID(t, file.Hash), 1) {
+		if p.ID == Host.ID() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("remote node did not find us as a provider")
+	}
+}
+
+// go test -v -run ^TestDownloadFromProvider$ -count=1 application-layer/dht
+func TestDownloadFromProvider(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	provider := net.Nodes[1]
+	content := bytes.Repeat([]byte("0123456789abcdef"), 32*1024) // several chunks and stream windows
+	hash := hashOf(content)
+
+	// the provider answers a download request by opening a file stream back to us
+	confirmations := make(chan models.Transaction, 1)
+	net.handle(provider, ProtocolDownloadRequest, func(s network.Stream) {
+		defer s.Close()
+		var request models.Transaction
+		if err := ReadMessage(s, &request); err != nil {
+			t.Errorf("provider: %v", err)
+			return
+		}
+		if request.RequesterWallet != "wallet-"+PeerID {
+			t.Errorf("requester wallet = %q", request.RequesterWallet)
+		}
+
+		fileStream, err := provider.Host.NewStream(net.ctx, Host.ID(), ProtocolFile)
+		if err != nil {
+			t.Errorf("provider: %v", err)
+			return
+		}
+		defer fileStream.Close()
+		metadata := models.FileMetadata{Name: "data", NameWithExtension: "data.bin", Size: int64(len(content)), Hash: hash}
+		// what the provider writes into its reply doesn't change what we agreed to pay
+		reply := request
+		reply.Fee = 1000
+		if err := WriteMessage(fileStream, reply); err != nil {
+			t.Errorf("provider: %v", err)
+			return
+		}
+		if err := WriteMessage(fileStream, metadata); err != nil {
+			t.Errorf("provider: %v", err)
+			return
+		}
+		if _, err := fileStream.Write(content); err != nil {
+			t.Errorf("provider: %v", err)
+		}
+	})
+	net.handle(provider, ProtocolResponse, func(s network.Stream) {
+		defer s.Close()
+		var confirmation models.Transaction
+		if err := ReadMessage(s, &confirmation); err == nil {
+			confirmations <- confirmation
+		}
+	})
+
+	request := models.Transaction{
+		Type:          "request",
+		TransactionID: "download-1",
+		FileHash:      hash,
+		FileName:      "data.bin",
+		RequesterID:   PeerID,
+		TargetID:      provider.ID(),
+		Size:          int64(len(content)),
+		Fee:           3,
+		Status:        "pending",
+	}
+	Transfers.Add(request)
+	if err := SendDownloadRequest(request); err != nil {
+		t.Fatalf("failed to send download request: %v", err)
+	}
+
+	select {
+	case confirmation := <-confirmations:
+		if confirmation.Status != "complete" {
+			t.Errorf("confirmation status = %q, want complete", confirmation.Status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("provider never got a confirmation")
+	}
+	// we became a provider and told the cloud node, the last thing a download does
+	net.cloudFile(hash)
+
+	transfer, _ := Transfers.Get(request.TransactionID)
+	if transfer.State != "complete" || transfer.BytesReceived != int64(len(content)) {
+		t.Errorf("transfer = %+v, want complete with %d bytes", transfer, len(content))
+	}
+	path, err := storage.Blobs.Path(hash)
+	if err != nil {
+		t.Fatalf("download not in blob store: %v", err)
+	}
+	stored, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("stored content differs from what the provider sent (err %v)", err)
+	}
+	downloads, err := loadFileList(DownloadedFilePath)
+	if err != nil || len(downloads) != 1 || downloads[0].Fee != 3 {
+		t.Errorf("downloads = %+v, %v, want one at the fee we agreed to", downloads, err)
+	}
+}
+
+// go test -v -run ^TestEncryptedUploadReleasesKeyAfterPayment$ -count=1 application-layer/dht
+func TestEncryptedUploadReleasesKeyAfterPayment(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	requester := net.Nodes[1]
+	content := []byte("paid content, useless without the key")
+	file := net.addFile("paid.txt", content, 5)
+	if _, err := UpdateFileInDHT(file); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if err := Uploads.SetPolicy(models.UploadPolicy{EncryptTransfers: true}); err != nil {
+		t.Fatalf("failed to set upload policy: %v", err)
+	}
+
+	d := net.requestFile(requester, file, "paid-1")
+	if !d.Transaction.Encrypted || d.Transaction.EncryptionIV == "" {
+		t.Fatalf("transfer was not encrypted: %+v", d.Transaction)
+	}
+	if d.Transaction.TargetWallet != "wallet-"+PeerID {
+		t.Errorf("target wallet = %q", d.Transaction.TargetWallet)
+	}
+	if d.Metadata.Hash != file.Hash || bytes.Equal(d.Content, content) {
+		t.Fatalf("expected ciphertext of %s", file.Hash)
+	}
+	askForKey := func(paymentTxID string) models.KeyResponse {
+		return net.askForKey(requester, d.Transaction, paymentTxID)
+	}
+
+	if response := askForKey("never-sent"); response.Status != "declined" || response.Key != "" {
+		t.Errorf("unknown payment: got %+v", response)
+	}
+	if response := askForKey(net.pay(1)); response.Status != "declined" || response.Key != "" {
+		t.Errorf("underpaid: got %+v", response)
+	}
+
+	paid := net.pay(5)
+	response := askForKey(paid)
+	if response.Status != "released" {
+		t.Fatalf("paid in full: got %+v", response)
+	}
+	if hashOf(d.decrypt(t, response.Key)) != file.Hash {
+		t.Errorf("decrypted content does not match the advertised hash")
+	}
+
+	// asking again after a dropped connection is fine, unlocking another transfer with the same payment is not
+	if response := askForKey(paid); response.Status != "released" {
+		t.Errorf("asking again after paying: got %+v", response)
+	}
+	forged := d.Transaction
+	forged.Fee, forged.TargetWallet, forged.FileHash = 1, "elsewhere", "other"
+	if response := net.askForKey(requester, forged, paid); response.Status != "released" {
+		t.Errorf("asking again with a changed transaction: got %+v", response)
+	}
+	if stored, err := utils.GetTransaction("paid-1"); err != nil || stored.Status != "paid" || stored.PaymentTxID != paid ||
+		stored.Fee != 5 || stored.FileHash != file.Hash || stored.TargetWallet != d.Transaction.TargetWallet {
+		t.Errorf("stored transaction = %+v, %v, want ours marked paid", stored, err)
+	}
+	second := net.requestFile(requester, file, "paid-2")
+	if response := net.askForKey(requester, second.Transaction, paid); response.Status != "declined" {
+		t.Errorf("reused payment: got %+v", response)
+	}
+
+	// a requester naming its own fee still pays ours
+	free, decline := net.download(requester, models.Transaction{Type: "request", TransactionID: "paid-3", FileHash: file.Hash,
+		FileName: file.NameWithExtension, RequesterID: requester.ID(), TargetID: PeerID, Fee: 0})
+	if decline != nil || free.Transaction.Fee != 5 {
+		t.Fatalf("request with fee 0: fee %d, decline %+v", free.Transaction.Fee, decline)
+	}
+	if response := net.askForKey(requester, free.Transaction, net.pay(0)); response.Status != "declined" || response.Key != "" {
+		t.Errorf("key released for a zero payment: got %+v", response)
+	}
+}
+
+// go test -v -run ^TestMessageFraming$ -count=1 application-layer/dht
+func TestMessageFraming(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	sender, receiver := net.Nodes[1], net.Nodes[2]
+
+	type result struct {
+		transaction models.Transaction
+		err         error
+	}
+	results := make(chan result, 1)
+	handleProtocol(receiver.Host, ProtocolQueuePosition, func(s network.Stream) {
+		defer s.Close()
+		var r result
+		r.err = ReadMessage(s, &r.transaction)
+		results <- r
+	})
+	receive := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(10 * time.Second):
+			t.Fatalf("receiver got nothing")
+		}
+		return result{}
+	}
+	send := func(id protocol.ID, raw []byte) {
+		t.Helper()
+		s, err := sender.Host.NewStream(net.ctx, receiver.Host.ID(), id)
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		defer s.Close()
+		if raw == nil {
+			err = WriteMessage(s, models.Transaction{TransactionID: "framed", QueuePosition: 2})
+		} else {
+			_, err = s.Write(raw)
+		}
+		if err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	send(ProtocolQueuePosition, nil)
+	if r := receive(); r.err != nil || r.transaction.TransactionID != "framed" || r.transaction.QueuePosition != 2 {
+		t.Errorf("framed message: got %+v, %v", r.transaction, r.err)
+	}
+
+	// older clients write newline terminated json on the unversioned id
+	send("/queuePosition/p2p", []byte(`{"TransactionID":"legacy","QueuePosition":3}`+"\n"))
+	if r := receive(); r.err != nil || r.transaction.TransactionID != "legacy" || r.transaction.QueuePosition != 3 {
+		t.Errorf("legacy message: got %+v, %v", r.transaction, r.err)
+	}
+
+	// a length prefix over the cap is refused before anything is allocated
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], maxMessageSize+1)
+	send(ProtocolQueuePosition, header[:])
+	r := receive()
+	var messageErr *MessageError
+	if !errors.Is(r.err, ErrMessageTooLarge) || !errors.As(r.err, &messageErr) || messageErr.Peer != sender.ID() {
+		t.Errorf("oversized message: got %v", r.err)
+	}
+
+	send(ProtocolQueuePosition, []byte{0, 0, 0, 5, '{', 'b', 'a', 'd', '!'})
+	if r := receive(); !errors.Is(r.err, ErrMalformedMessage) {
+		t.Errorf("malformed message: got %v", r.err)
+	}
+}
+
+// same cid ProvideKey announces for a file hash
+func fileCID(t *testing.T, hash string) cid.Cid {
+	t.Helper()
+	sum := sha256.Sum256([]byte(hash))
+	mh, err := multihash.EncodeName(sum[:], "sha2-256")
+	if err != nil {
+		t.Fatalf("failed to encode multihash: %v", err)
+	}
+	return cid.NewCidV1(cid.Raw, mh)
+}
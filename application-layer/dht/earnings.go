@@ -0,0 +1,162 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+var (
+	EarningsPath = filepath.Join(dirPath, "earnings.json")
+	Earnings     = newEarningsLedger()
+)
+
+type earningsFile struct {
+	Files    map[string]models.FileEarnings `json:"Files"`
+	Payments []models.Payment               `json:"Payments"`
+}
+
+// earningsLedger counts what we served and the payments our wallet received for it
+// a payment is matched to a download through the transaction id the requester proved it with
+type earningsLedger struct {
+	mu       sync.Mutex
+	files    map[string]models.FileEarnings
+	payments []models.Payment
+}
+
+func newEarningsLedger() *earningsLedger {
+	return &earningsLedger{files: make(map[string]models.FileEarnings)}
+}
+
+// read the saved ledger, if any
+func LoadEarnings() error {
+	data, err := os.ReadFile(EarningsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read earnings: %v", err)
+	}
+
+	var saved earningsFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse earnings: %v", err)
+	}
+	Earnings.mu.Lock()
+	defer Earnings.mu.Unlock()
+	for hash, file := range saved.Files {
+		Earnings.files[hash] = file
+	}
+	Earnings.payments = saved.Payments
+	return nil
+}
+
+// caller holds el.mu
+func (el *earningsLedger) save() error {
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(earningsFile{Files: el.files, Payments: el.payments}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal earnings: %v", err)
+	}
+	if err := os.WriteFile(EarningsPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write earnings: %v", err)
+	}
+	return nil
+}
+
+// served counts a file we sent in full
+func (el *earningsLedger) served(request models.Transaction) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	file := el.files[request.FileHash]
+	file.FileHash = request.FileHash
+	if request.FileName != "" {
+		file.Name = request.FileName
+	}
+	file.Downloads++
+	el.files[request.FileHash] = file
+	if err := el.save(); err != nil {
+		log.Info("earnings:", err)
+	}
+}
+
+// paid records a payment we verified on chain for the transfer key belongs to
+func (el *earningsLedger) paid(key models.TransferKey, paymentTxID string, amount btcutil.Amount) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	payment := models.Payment{
+		TransactionID: key.TransactionID,
+		FileHash:      key.FileHash,
+		RequesterID:   key.RequesterID,
+		PaymentTxID:   paymentTxID,
+		Fee:           key.Fee,
+		Amount:        int64(amount),
+		PaidAt:        time.Now().Format("2006-01-02 15:04:05"),
+	}
+	el.payments = append(el.payments, payment)
+
+	file := el.files[key.FileHash]
+	file.FileHash = key.FileHash
+	file.Payments++
+	file.Earned += int64(amount)
+	file.LastPaidAt = payment.PaidAt
+	el.files[key.FileHash] = file
+	if err := el.save(); err != nil {
+		log.Info("earnings:", err)
+	}
+	log.Infof("earnings: %d %s for %s from %s", int64(amount), models.FeeUnit, key.FileHash, key.RequesterID)
+}
+
+// Report sums up earnings per file, with the payments for fileHash when one is given
+func (el *earningsLedger) Report(fileHash string) (models.EarningsReport, error) {
+	// transfers we sent encrypted and nobody paid for yet
+	transferKeysMu.Lock()
+	keys, err := loadTransferKeys()
+	transferKeysMu.Unlock()
+	if err != nil {
+		return models.EarningsReport{}, err
+	}
+	awaiting := make(map[string]int64)
+	for _, key := range keys {
+		if key.Fee > 0 && key.PaymentTxID == "" && key.FileHash != "" {
+			awaiting[key.FileHash]++
+		}
+	}
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	report := models.EarningsReport{Unit: models.FeeUnit, Files: []models.FileEarnings{}}
+	for hash, file := range el.files {
+		if fileHash != "" && hash != fileHash {
+			continue
+		}
+		file.AwaitingPayment = awaiting[hash]
+		report.Earned += file.Earned
+		report.Files = append(report.Files, file)
+	}
+	sort.Slice(report.Files, func(i, j int) bool {
+		if report.Files[i].Earned != report.Files[j].Earned {
+			return report.Files[i].Earned > report.Files[j].Earned
+		}
+		return report.Files[i].FileHash < report.Files[j].FileHash
+	})
+
+	if fileHash != "" {
+		report.Payments = []models.Payment{}
+		for _, payment := range el.payments {
+			if payment.FileHash == fileHash {
+				report.Payments = append(report.Payments, payment)
+			}
+		}
+	}
+	return report, nil
+}
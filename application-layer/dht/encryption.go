@@ -0,0 +1,433 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/services"
+	"application-layer/storage"
+	"application-layer/utils"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// confirmations a payment needs before the provider releases a transfer key
+const minPaymentConfirmations = 1
+
+var (
+	TransferKeysPath = filepath.Join(dirPath, "transferKeys.json")
+	transferKeysMu   sync.Mutex
+
+	// how a payment to our wallet is checked, tests running without a wallet swap it out
+	lookupPayment = func(txid string, address string) (float64, int64, error) {
+		return services.NewBtcService().GetPaymentAmount(txid, address)
+	}
+
+	// downloads with a fee are invoiced to a fresh address, tests swap these out too
+	newInvoice = func(amount btcutil.Amount, memo string, purpose string, reference string) (models.Invoice, error) {
+		return services.NewBtcService().CreateInvoice(amount, memo, 0, purpose, reference)
+	}
+	lookupInvoice = func(id string) (models.Invoice, error) {
+		return services.NewBtcService().GetInvoice(id)
+	}
+	payInvoiceURI = func(uri string, passphrase string) (string, error) {
+		return services.NewBtcService().PayURI(uri, passphrase)
+	}
+)
+
+// encrypted download waiting for its key, saved next to the ciphertext so it survives restarts
+type pendingDownload struct {
+	Request     models.Transaction  `json:"Request"`     // as we sent it
+	Transaction models.Transaction  `json:"Transaction"` // as the provider sent it back, with its invoice
+	Metadata    models.FileMetadata `json:"Metadata"`
+}
+
+func loadTransferKeys() (map[string]models.TransferKey, error) {
+	keys := make(map[string]models.TransferKey)
+	data, err := os.ReadFile(TransferKeysPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return nil, fmt.Errorf("failed to read transfer keys: %v", err)
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse transfer keys: %v", err)
+	}
+	return keys, nil
+}
+
+func saveTransferKeys(keys map[string]models.TransferKey) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer keys: %v", err)
+	}
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	return os.WriteFile(TransferKeysPath, data, 0600)
+}
+
+// newTransferKey creates the key for one upload and returns the writer that encrypts into w
+// the iv is stored on the transaction, the key stays with us until the requester pays
+// request.Fee must be the fee we set in receiveDownloadRequest, never the requester's
+func newTransferKey(request *models.Transaction, w io.Writer) (io.Writer, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate transfer key: %v", err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("failed to generate iv: %v", err)
+	}
+
+	// the fee goes to an address of its own so the payment is matched to this transfer,
+	// without a wallet we fall back to the address the requester already has
+	var invoiceID string
+	if request.Fee > 0 {
+		invoice, err := newInvoice(btcutil.Amount(request.Fee), request.FileName, "file", request.TransactionID)
+		if err != nil {
+			log.Infof("newTransferKey: no invoice for %s, payment goes to %s: %v", request.TransactionID, request.TargetWallet, err)
+		} else {
+			invoiceID = invoice.ID
+			request.TargetWallet = invoice.Address
+			request.InvoiceURI = invoice.URI
+		}
+	}
+
+	transferKeysMu.Lock()
+	keys, err := loadTransferKeys()
+	if err == nil {
+		keys[request.TransactionID] = models.TransferKey{
+			TransactionID: request.TransactionID,
+			RequesterID:   request.RequesterID,
+			TargetWallet:  request.TargetWallet,
+			FileHash:      request.FileHash,
+			Fee:           request.Fee,
+			Key:           hex.EncodeToString(key),
+			InvoiceID:     invoiceID,
+			CreatedAt:     timestamp(),
+		}
+		err = saveTransferKeys(keys)
+	}
+	transferKeysMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	request.Encrypted = true
+	request.EncryptionIV = hex.EncodeToString(iv)
+	return cipher.StreamWriter{S: cipher.NewCTR(block, iv), W: w}, nil
+}
+
+func decryptReader(r io.Reader, keyHex string, ivHex string) (io.Reader, error) {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer key: %v", err)
+	}
+	iv, err := hex.DecodeString(ivHex)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid iv")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer key: %v", err)
+	}
+	return cipher.StreamReader{S: cipher.NewCTR(block, iv), R: r}, nil
+}
+
+// create the file the ciphertext of an encrypted download is written to
+func createEncryptedDownload(transaction models.Transaction) (*os.File, error) {
+	path := storage.Blobs.EncryptedPath(transaction.TransactionID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+	return os.Create(path)
+}
+
+// the ciphertext has arrived, remember the download until the requester pays for the key
+func awaitPayment(request models.Transaction, transaction models.Transaction, metadata models.FileMetadata) error {
+	data, err := json.Marshal(pendingDownload{Request: request, Transaction: transaction, Metadata: metadata})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending download: %v", err)
+	}
+	if err := os.WriteFile(storage.Blobs.EncryptedPath(transaction.TransactionID)+".json", data, 0644); err != nil {
+		return fmt.Errorf("failed to save pending download: %v", err)
+	}
+
+	transaction.Status = "awaiting payment"
+	utils.AddOrUpdateTransaction(transaction)
+	Transfers.SetState(transaction, "awaiting payment")
+	log.Infof("download %s received encrypted, waiting for payment of %d to %s", transaction.TransactionID, transaction.Fee, transaction.TargetWallet)
+	return nil
+}
+
+func discardEncryptedDownload(transactionID string) {
+	path := storage.Blobs.EncryptedPath(transactionID)
+	os.Remove(path)
+	os.Remove(path + ".json")
+}
+
+func loadPendingDownload(transactionID string) (pendingDownload, error) {
+	var pending pendingDownload
+	data, err := os.ReadFile(storage.Blobs.EncryptedPath(transactionID) + ".json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pending, fmt.Errorf("no encrypted download waiting for payment with id %s", transactionID)
+		}
+		return pending, fmt.Errorf("failed to read pending download: %v", err)
+	}
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return pending, fmt.Errorf("failed to parse pending download: %v", err)
+	}
+	return pending, nil
+}
+
+// PayTransferInvoice pays the provider's invoice for an encrypted download from our wallet
+// and asks for the key. the key only comes once the payment confirms, until then
+// PayForTransfer can be called again without a payment id and reuses this one
+func PayTransferInvoice(transactionID string, passphrase string) (string, error) {
+	pending, err := loadPendingDownload(transactionID)
+	if err != nil {
+		return "", err
+	}
+	if pending.Transaction.InvoiceURI == "" {
+		return "", fmt.Errorf("provider did not send an invoice for %s, pay %d to %s and pass the payment id", transactionID, pending.Transaction.Fee, pending.Transaction.TargetWallet)
+	}
+	if pending.Transaction.PaymentTxID != "" {
+		return pending.Transaction.PaymentTxID, PayForTransfer(transactionID, pending.Transaction.PaymentTxID)
+	}
+
+	// the provider writes the invoice, we only pay the fee we agreed to and only to the address it sent with the transfer
+	address, amount, _, err := services.ParseBIP21(pending.Transaction.InvoiceURI)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadInvoice, err)
+	}
+	invoiced, err := btcutil.NewAmount(amount)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadInvoice, err)
+	}
+	if invoiced > btcutil.Amount(pending.Request.Fee) {
+		return "", fmt.Errorf("%w: invoice for %v is more than the agreed fee of %v", ErrBadInvoice, invoiced, btcutil.Amount(pending.Request.Fee))
+	}
+	if address != pending.Transaction.TargetWallet {
+		return "", fmt.Errorf("%w: invoice pays %s, the transfer names %s", ErrBadInvoice, address, pending.Transaction.TargetWallet)
+	}
+
+	paymentTxID, err := payInvoiceURI(pending.Transaction.InvoiceURI, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to pay invoice: %v", err)
+	}
+	pending.Transaction.PaymentTxID = paymentTxID
+	if data, err := json.Marshal(pending); err == nil {
+		os.WriteFile(storage.Blobs.EncryptedPath(transactionID)+".json", data, 0644)
+	}
+	log.Infof("paid invoice for %s with %s", transactionID, paymentTxID)
+	return paymentTxID, PayForTransfer(transactionID, paymentTxID)
+}
+
+// PayForTransfer sends proof of payment to the provider, and once the key comes back
+// decrypts the download into the blob store and finishes it like a plaintext one
+// an empty paymentTxID reuses the payment PayTransferInvoice made
+func PayForTransfer(transactionID string, paymentTxID string) error {
+	path := storage.Blobs.EncryptedPath(transactionID)
+	pending, err := loadPendingDownload(transactionID)
+	if err != nil {
+		return err
+	}
+	transaction, metadata := pending.Transaction, pending.Metadata
+	if paymentTxID != "" {
+		transaction.PaymentTxID = paymentTxID
+	}
+	paymentTxID = transaction.PaymentTxID
+
+	key, err := requestTransferKey(transaction)
+	if err != nil {
+		// we sent the content's price and got nothing for it
+		if paymentTxID != "" {
+			Reputation.record(transaction.TargetID, eventFailedDelivery, transactionID, 0, 0)
+		}
+		return err
+	}
+	transaction.Status = "paid"
+	utils.AddOrUpdateTransaction(transaction)
+
+	encrypted, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open encrypted download: %v", err)
+	}
+	defer encrypted.Close()
+
+	plaintext, err := decryptReader(encrypted, key, transaction.EncryptionIV)
+	if err != nil {
+		return err
+	}
+	blob, err := storage.Blobs.Create(metadata.NameWithExtension)
+	if err != nil {
+		return err
+	}
+	defer blob.Abort()
+	if _, err := io.Copy(blob, plaintext); err != nil {
+		return fmt.Errorf("failed to decrypt download: %v", err)
+	}
+
+	entry, err := blob.Commit(metadata.Hash)
+	if err != nil {
+		// a wrong key is as bad as corrupted content, the ciphertext is no use to us any more
+		log.Infof("PayForTransfer: discarding %s: %v", metadata.Name, err)
+		Reputation.record(transaction.TargetID, eventCorrupt, transactionID, 0, 0)
+		encrypted.Close()
+		discardEncryptedDownload(transactionID)
+		Transfers.finish(transactionID, err)
+		transaction.Status = "failed"
+		utils.AddOrUpdateTransaction(transaction)
+		return err
+	}
+
+	encrypted.Close()
+	discardEncryptedDownload(transactionID)
+	completeDownload(pending.Request, transaction, metadata, entry)
+	return nil
+}
+
+// ask the provider for the key of a paid transfer
+func requestTransferKey(transaction models.Transaction) (string, error) {
+	keyStream, err := openStream(transaction.TargetID, ProtocolTransferKey)
+	if err != nil {
+		return "", fmt.Errorf("error requesting transfer key: %v", err)
+	}
+	defer keyStream.Close()
+
+	if err := WriteMessage(keyStream, transaction); err != nil {
+		return "", fmt.Errorf("error sending key request: %v", err)
+	}
+
+	var response models.KeyResponse
+	if err := ReadMessage(keyStream, &response); err != nil {
+		return "", fmt.Errorf("error reading key response: %v", err)
+	}
+	if response.Status != "released" {
+		return "", fmt.Errorf("provider declined to release the key: %s", response.Message)
+	}
+	return response.Key, nil
+}
+
+// provider side - check the payment and hand over the key
+func receiveKeyRequest(node host.Host) {
+	handleProtocol(node, ProtocolTransferKey, func(s network.Stream) {
+		defer s.Close()
+
+		var request models.Transaction
+		if err := ReadMessage(s, &request); err != nil {
+			rejectStream(s, err)
+			return
+		}
+
+		response := releaseTransferKey(request, s.Conn().RemotePeer().String())
+		log.Infof("key request for %s: %s %s", request.TransactionID, response.Status, response.Message)
+
+		if err := WriteMessage(s, response); err != nil {
+			log.Errorf("Error writing to stream: %v", err)
+		}
+	})
+}
+
+func releaseTransferKey(request models.Transaction, remotePeer string) models.KeyResponse {
+	response := models.KeyResponse{TransactionID: request.TransactionID, Status: "declined"}
+
+	transferKeysMu.Lock()
+	defer transferKeysMu.Unlock()
+
+	keys, err := loadTransferKeys()
+	if err != nil {
+		response.Message = err.Error()
+		return response
+	}
+	key, exists := keys[request.TransactionID]
+	if !exists || key.RequesterID != remotePeer {
+		response.Message = "unknown transfer"
+		return response
+	}
+
+	// an invoiced transfer can be paid without telling us the transaction, we saw it arrive
+	if key.Fee > 0 && key.PaymentTxID == "" && request.PaymentTxID == "" && key.InvoiceID != "" {
+		if invoice, err := lookupInvoice(key.InvoiceID); err == nil && invoice.Status == "paid" {
+			request.PaymentTxID = invoice.PaymentTxID
+		}
+	}
+
+	// asking again after a dropped connection is fine, paying with someone else's transaction is not
+	if key.Fee > 0 && key.PaymentTxID == "" {
+		if request.PaymentTxID == "" {
+			response.Message = "payment transaction id missing"
+			return response
+		}
+		for _, other := range keys {
+			if other.PaymentTxID == request.PaymentTxID {
+				response.Message = "payment already used for another transfer"
+				return response
+			}
+		}
+
+		received, confirmations, err := lookupPayment(request.PaymentTxID, key.TargetWallet)
+		if err != nil {
+			response.Message = err.Error()
+			return response
+		}
+		// the wallet reports btc, fees are satoshis
+		amount, err := btcutil.NewAmount(received)
+		if err != nil {
+			response.Message = fmt.Sprintf("invalid payment amount: %v", err)
+			return response
+		}
+		if amount < btcutil.Amount(key.Fee) {
+			response.Message = fmt.Sprintf("payment of %v is less than the fee of %v", amount, btcutil.Amount(key.Fee))
+			return response
+		}
+		if confirmations < minPaymentConfirmations {
+			response.Message = fmt.Sprintf("payment has %d confirmations, %d needed", confirmations, minPaymentConfirmations)
+			return response
+		}
+
+		key.PaymentTxID = request.PaymentTxID
+		keys[request.TransactionID] = key
+		if err := saveTransferKeys(keys); err != nil {
+			response.Message = err.Error()
+			return response
+		}
+		Reputation.record(remotePeer, eventVerifiedPayment, request.TransactionID, 0, 0)
+		Pricing.sold(remotePeer)
+		Earnings.paid(key, request.PaymentTxID, amount)
+		// a bundle's members are served to whoever paid for its manifest
+		Bundles.sold(key.FileHash, remotePeer)
+	} else if key.Fee > 0 && key.PaymentTxID != request.PaymentTxID {
+		response.Message = "transfer was paid with a different transaction"
+		return response
+	}
+
+	// the requester's copy of the transaction is only trusted to name it, the rest is what we stored
+	if transaction, err := utils.GetTransaction(request.TransactionID); err != nil {
+		log.Infof("releaseTransferKey: not updating history of %s: %v", request.TransactionID, err)
+	} else {
+		transaction.Status, transaction.PaymentTxID = "paid", key.PaymentTxID
+		utils.AddOrUpdateTransaction(transaction)
+	}
+
+	response.Status = "released"
+	response.Key = key.Key
+	return response
+}
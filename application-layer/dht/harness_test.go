@@ -0,0 +1,434 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	record "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+)
+
+// in-process network for end to end tests - a relay and n nodes with their own dht, all on 127.0.0.1
+// node 0 is "us": the package globals point at it and it runs the real stream handlers
+// the other nodes play remote peers and are driven by the test through WriteMessage/ReadMessage
+// a fake cloud node is only reachable through the relay, so every publish crosses a relayed connection
+// nothing leaves the machine, the wallet is faked through walletAddress and lookupPayment
+// (see chain_rpctest_test.go for payments on a real simnet chain)
+
+type testNode struct {
+	Host host.Host
+	DHT  *dht.IpfsDHT
+}
+
+func (n *testNode) ID() string {
+	return n.Host.ID().String()
+}
+
+type testNetwork struct {
+	t     *testing.T
+	ctx   context.Context
+	Relay host.Host
+	Cloud host.Host // stands in for the cloud node, only reachable through the relay
+	Nodes []*testNode
+	Dir   string
+
+	cloudFiles chan models.DHTMetadata // metadata sent to the cloud node on /nodeFiles/p2p
+
+	paymentsMu sync.Mutex
+	payments   map[string]float64 // fake chain, txid -> amount paid to us
+}
+
+func newTestNetwork(t *testing.T, n int) *testNetwork {
+	t.Helper()
+	if n < 2 {
+		t.Fatalf("a test network needs at least 2 nodes, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	net := &testNetwork{
+		t:          t,
+		ctx:        ctx,
+		cloudFiles: make(chan models.DHTMetadata, 16),
+		payments:   make(map[string]float64),
+	}
+	t.Cleanup(cancel)
+
+	net.useTempDir()
+	net.startRelay()
+	net.startCloudNode()
+	for i := 0; i < n; i++ {
+		net.Nodes = append(net.Nodes, net.startNode())
+	}
+	net.connectAll()
+	net.becomeNode(net.Nodes[0])
+	return net
+}
+
+// every path in the package is relative to the working directory (../../utils, ../../squidcoinFiles),
+// running from <tmp>/application-layer/dht keeps all json files and blobs inside the test's temp dir
+func (net *testNetwork) useTempDir() {
+	t := net.t
+	net.Dir = t.TempDir()
+	workDir := filepath.Join(net.Dir, "application-layer", "dht")
+	for _, dir := range []string{workDir, filepath.Join(net.Dir, "utils"), filepath.Join(net.Dir, "squidcoinFiles")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	oldBlobs := storage.Blobs
+	storage.Blobs = storage.NewBlobStore(storage.FileCopyPath)
+
+	t.Cleanup(func() {
+		os.Chdir(oldDir)
+		storage.Blobs = oldBlobs
+	})
+}
+
+func (net *testNetwork) startRelay() {
+	t := net.t
+	relayHost, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.DisableRelay())
+	if err != nil {
+		t.Fatalf("failed to create relay host: %v", err)
+	}
+	// the default limits cut relayed connections off after 128KiB
+	if _, err := relay.New(relayHost, relay.WithInfiniteLimits()); err != nil {
+		t.Fatalf("failed to start relay: %v", err)
+	}
+	net.Relay = relayHost
+	t.Cleanup(func() { relayHost.Close() })
+
+	oldRelayAddr := Relay_node_addr
+	Relay_node_addr = fmt.Sprintf("%s/p2p/%s", relayHost.Addrs()[0], relayHost.ID())
+	t.Cleanup(func() { Relay_node_addr = oldRelayAddr })
+}
+
+func (net *testNetwork) startCloudNode() {
+	t := net.t
+	cloud, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.EnableRelay())
+	if err != nil {
+		t.Fatalf("failed to create cloud node: %v", err)
+	}
+	t.Cleanup(func() { cloud.Close() })
+	net.reserve(cloud)
+
+	cloud.SetStreamHandler("/nodeFiles/p2p", func(s network.Stream) {
+		defer s.Close()
+		var metadata models.DHTMetadata
+		if err := readUnframed(s, &metadata); err != nil {
+			rejectStream(s, err)
+			return
+		}
+		net.cloudFiles <- metadata
+	})
+	net.Cloud = cloud
+
+	oldCloudNodeID := Cloud_node_id
+	Cloud_node_id = cloud.ID().String()
+	t.Cleanup(func() { Cloud_node_id = oldCloudNodeID })
+}
+
+func (net *testNetwork) reserve(h host.Host) {
+	t := net.t
+	relayInfo := peer.AddrInfo{ID: net.Relay.ID(), Addrs: net.Relay.Addrs()}
+	if err := h.Connect(net.ctx, relayInfo); err != nil {
+		t.Fatalf("failed to connect to relay: %v", err)
+	}
+	if _, err := client.Reserve(net.ctx, h, relayInfo); err != nil {
+		t.Fatalf("failed to reserve a slot on the relay: %v", err)
+	}
+}
+
+func (net *testNetwork) startNode() *testNode {
+	t := net.t
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.EnableRelay())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	// server mode so the nodes store records for each other, there is nobody else to do it
+	kadDHT, err := dht.New(net.ctx, h, dht.Mode(dht.ModeServer))
+	if err != nil {
+		t.Fatalf("failed to create dht: %v", err)
+	}
+	// same validator as createNode
+	kadDHT.Validator = record.NamespacedValidator{
+		"orcanet": &CustomValidator{},
+	}
+	t.Cleanup(func() { kadDHT.Close() })
+
+	net.reserve(h)
+	return &testNode{Host: h, DHT: kadDHT}
+}
+
+func (net *testNetwork) connectAll() {
+	t := net.t
+	for i, a := range net.Nodes {
+		for _, b := range net.Nodes[i+1:] {
+			if err := a.Host.Connect(net.ctx, peer.AddrInfo{ID: b.Host.ID(), Addrs: b.Host.Addrs()}); err != nil {
+				t.Fatalf("failed to connect %s to %s: %v", a.ID(), b.ID(), err)
+			}
+		}
+	}
+	// routing tables fill in once identify has run on every connection
+	for _, node := range net.Nodes {
+		node := node
+		net.waitFor("routing table of "+node.ID(), func() bool {
+			return node.DHT.RoutingTable().Size() >= len(net.Nodes)-1
+		})
+	}
+}
+
+// point the package globals at node and run our handlers on it
+func (net *testNetwork) becomeNode(node *testNode) {
+	t := net.t
+	oldDHT, oldHost, oldPeerID, oldCtx := DHT, Host, PeerID, GlobalCtx
+	oldUploads, oldTransfers, oldReputation, oldModeration, oldSeries, oldBundles, oldPricing := Uploads, Transfers, Reputation, Moderation, Series, Bundles, Pricing
+	oldSeeding, oldEarnings := Seeding, Earnings
+	oldWalletAddress, oldLookupPayment, oldInvoices := walletAddress, lookupPayment, invoices
+	FileMapMutex.Lock()
+	oldFileHashToPath := FileHashToPath
+	FileHashToPath = make(map[string]string)
+	FileMapMutex.Unlock()
+
+	DHT, Host, PeerID, GlobalCtx = node.DHT, node.Host, node.ID(), net.ctx
+	Uploads, Transfers, Reputation, Moderation, Series, Bundles, Pricing = newUploadManager(models.UploadPolicy{}), newTransferManager(), newReputationStore(), newModerator(), newSeriesStore(), newBundleStore(), newPricer()
+	Seeding, Earnings = newSeedingManager(), newEarningsLedger()
+	invoices = newInvoiceBook()
+	walletAddress = func() (string, error) {
+		return "wallet-" + PeerID, nil
+	}
+	lookupPayment = func(txid string, address string) (float64, int64, error) {
+		net.paymentsMu.Lock()
+		defer net.paymentsMu.Unlock()
+		amount, exists := net.payments[txid]
+		if !exists {
+			return 0, 0, fmt.Errorf("transaction %s not found", txid)
+		}
+		return amount, minPaymentConfirmations, nil
+	}
+	setupStreams(node.Host)
+
+	t.Cleanup(func() {
+		DHT, Host, PeerID, GlobalCtx = oldDHT, oldHost, oldPeerID, oldCtx
+		Uploads, Transfers, Reputation, Moderation, Series, Bundles, Pricing = oldUploads, oldTransfers, oldReputation, oldModeration, oldSeries, oldBundles, oldPricing
+		Seeding, Earnings = oldSeeding, oldEarnings
+		walletAddress, lookupPayment, invoices = oldWalletAddress, oldLookupPayment, oldInvoices
+		FileMapMutex.Lock()
+		FileHashToPath = oldFileHashToPath
+		FileMapMutex.Unlock()
+	})
+}
+
+// handle registers a protocol on a remote node and waits until identify has told us about it,
+// openStream refuses protocols the peerstore says a peer doesn't speak
+func (net *testNetwork) handle(node *testNode, id protocol.ID, handler network.StreamHandler) {
+	net.t.Helper()
+	handleProtocol(node.Host, id, handler)
+	net.waitFor(string(id)+" on "+node.ID(), func() bool {
+		supported, _ := SupportsProtocol(node.ID(), id)
+		return supported
+	})
+}
+
+// cloudFile waits for the cloud node to be told about hash, the last step of publishing or downloading
+func (net *testNetwork) cloudFile(hash string) models.DHTMetadata {
+	net.t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case metadata := <-net.cloudFiles:
+			if metadata.Hash == hash {
+				return metadata
+			}
+		case <-timeout:
+			net.t.Fatalf("timed out waiting for the cloud node to receive %s", hash)
+		}
+	}
+}
+
+// pay records a confirmed payment of satoshis on the fake chain and returns its txid
+func (net *testNetwork) pay(satoshis int64) string {
+	net.paymentsMu.Lock()
+	defer net.paymentsMu.Unlock()
+	txid := fmt.Sprintf("tx%d", len(net.payments)+1)
+	net.payments[txid] = btcutil.Amount(satoshis).ToBTC() // the wallet reports btc
+	return txid
+}
+
+// addFile puts content into our blob store and returns its metadata, ready for UpdateFileInDHT
+func (net *testNetwork) addFile(name string, content []byte, fee int64) models.FileMetadata {
+	t := net.t
+	entry, err := storage.Blobs.Put(bytes.NewReader(content), name, hashOf(content))
+	if err != nil {
+		t.Fatalf("failed to store file: %v", err)
+	}
+	path, _ := storage.Blobs.Path(entry.Hash)
+
+	FileMapMutex.Lock()
+	FileHashToPath[entry.Hash] = path
+	FileMapMutex.Unlock()
+	storage.Blobs.Unpin(entry.Hash)
+
+	return models.FileMetadata{
+		Name:              name,
+		NameWithExtension: name,
+		Type:              "text/plain",
+		Size:              int64(len(content)),
+		Hash:              entry.Hash,
+		ChunkRoot:         entry.ChunkRoot,
+		Fee:               fee,
+		IsPublished:       true,
+		OriginalUploader:  true,
+	}
+}
+
+// what a scripted requester got on its file stream
+type fileDelivery struct {
+	Transaction models.Transaction
+	Metadata    models.FileMetadata
+	Content     []byte
+}
+
+func (d fileDelivery) decrypt(t *testing.T, key string) []byte {
+	t.Helper()
+	plaintext, err := decryptReader(bytes.NewReader(d.Content), key, d.Transaction.EncryptionIV)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	content, err := io.ReadAll(plaintext)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	return content
+}
+
+// requestFile has a remote node download one of our files the way a requester does and returns what we sent it
+func (net *testNetwork) requestFile(requester *testNode, file models.FileMetadata, transactionID string) fileDelivery {
+	net.t.Helper()
+	d, decline := net.download(requester, models.Transaction{
+		Type:          "request",
+		TransactionID: transactionID,
+		FileHash:      file.Hash,
+		FileName:      file.NameWithExtension,
+		RequesterID:   requester.ID(),
+		TargetID:      PeerID,
+		Fee:           file.Fee,
+	})
+	if decline != nil {
+		net.t.Fatalf("request for %s declined: %s", file.Hash, decline.Message)
+	}
+	return d
+}
+
+// download sends us request from a remote node and returns either the delivery or our decline
+func (net *testNetwork) download(requester *testNode, request models.Transaction) (fileDelivery, *models.Transaction) {
+	t := net.t
+	t.Helper()
+	deliveries := make(chan fileDelivery, 1)
+	declines := make(chan models.Transaction, 1)
+	net.handle(requester, ProtocolFile, func(s network.Stream) {
+		defer s.Close()
+		var d fileDelivery
+		if err := ReadMessage(s, &d.Transaction); err != nil {
+			t.Errorf("requester: %v", err)
+			return
+		}
+		if err := ReadMessage(s, &d.Metadata); err != nil {
+			t.Errorf("requester: %v", err)
+			return
+		}
+		d.Content, _ = io.ReadAll(s)
+		deliveries <- d
+	})
+	net.handle(requester, ProtocolResponse, func(s network.Stream) {
+		defer s.Close()
+		var decline models.Transaction
+		if err := ReadMessage(s, &decline); err == nil {
+			declines <- decline
+		}
+	})
+
+	requestStream, err := requester.Host.NewStream(net.ctx, Host.ID(), ProtocolDownloadRequest)
+	if err != nil {
+		t.Fatalf("failed to open request stream: %v", err)
+	}
+	defer requestStream.Close()
+	if err := WriteMessage(requestStream, request); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+
+	select {
+	case d := <-deliveries:
+		return d, nil
+	case decline := <-declines:
+		return fileDelivery{}, &decline
+	case <-time.After(10 * time.Second):
+		t.Fatalf("file never arrived")
+	}
+	return fileDelivery{}, nil
+}
+
+// askForKey has a remote node ask us for the key of an encrypted transfer
+func (net *testNetwork) askForKey(requester *testNode, transaction models.Transaction, paymentTxID string) models.KeyResponse {
+	t := net.t
+	t.Helper()
+	s, err := requester.Host.NewStream(net.ctx, Host.ID(), ProtocolTransferKey)
+	if err != nil {
+		t.Fatalf("failed to open key stream: %v", err)
+	}
+	defer s.Close()
+	transaction.PaymentTxID = paymentTxID
+	if err := WriteMessage(s, transaction); err != nil {
+		t.Fatalf("failed to request key: %v", err)
+	}
+	var response models.KeyResponse
+	if err := ReadMessage(s, &response); err != nil {
+		t.Fatalf("failed to read key response: %v", err)
+	}
+	return response
+}
+
+func (net *testNetwork) waitFor(what string, done func() bool) {
+	net.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			net.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
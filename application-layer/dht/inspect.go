@@ -0,0 +1,144 @@
+package dht_kad
+
+import (
+	"application-layer/contacts"
+	"application-layer/metrics"
+	"application-layer/models"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+// what the old stdin commands (GET, PUT, GET_PROVIDERS, PUT_PROVIDER) did, for the api and orcactl
+// keys are given without the /orcanet/ namespace, like they were typed into the prompt
+
+var ErrDHTNotStarted = errors.New("dht not started")
+
+const maxProviderLookup = 20
+
+// providers are announced under the sha256 of the key, see ProvideKey
+func keyCid(key string) (cid.Cid, error) {
+	hash := sha256.Sum256([]byte(key))
+	mh, err := multihash.EncodeName(hash[:], "sha2-256")
+	if err != nil {
+		return cid.Undef, fmt.Errorf("error encoding multihash: %v", err)
+	}
+	return cid.NewCidV1(cid.Raw, mh), nil
+}
+
+// GetRecord reads the value stored under /orcanet/<key>
+func GetRecord(key string) (models.DHTRecord, error) {
+	if DHT == nil {
+		return models.DHTRecord{}, ErrDHTNotStarted
+	}
+	value, err := GetValue(GlobalCtx, "/orcanet/"+key)
+	if err != nil {
+		return models.DHTRecord{}, fmt.Errorf("failed to get record: %v", err)
+	}
+	return models.DHTRecord{Key: key, Value: string(value)}, nil
+}
+
+// PutRecord stores value under /orcanet/<key>, the validator still applies
+func PutRecord(key string, value string) error {
+	if DHT == nil {
+		return ErrDHTNotStarted
+	}
+	if err := PutValue(GlobalCtx, "/orcanet/"+key, []byte(value)); err != nil {
+		return fmt.Errorf("failed to put record: %v", err)
+	}
+	log.Infof("stored dht record %s", key)
+	return nil
+}
+
+// ProvideRecord announces us as a provider of key
+func ProvideRecord(key string) error {
+	if DHT == nil {
+		return ErrDHTNotStarted
+	}
+	return ProvideKey(GlobalCtx, DHT, key)
+}
+
+// LookupProviders lists the peers providing key
+func LookupProviders(key string) ([]models.DHTProvider, error) {
+	if DHT == nil {
+		return nil, ErrDHTNotStarted
+	}
+	c, err := keyCid(key)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	found := []models.DHTProvider{}
+	for p := range DHT.FindProvidersAsync(GlobalCtx, c, maxProviderLookup) {
+		if p.ID == peer.ID("") {
+			break
+		}
+		provider := models.DHTProvider{PeerID: p.ID.String(), Addrs: []string{}}
+		for _, addr := range p.Addrs {
+			provider.Addrs = append(provider.Addrs, addr.String())
+		}
+		found = append(found, provider)
+	}
+	metrics.DHTOperation("find_providers", start, nil)
+	return found, nil
+}
+
+// ConnectedPeers lists the peers we have a connection to, with their address book labels
+func ConnectedPeers() ([]models.DHTPeer, error) {
+	if DHT == nil {
+		return nil, ErrDHTNotStarted
+	}
+	swarm := DHT.Host().Network()
+	peers := []models.DHTPeer{}
+	for _, pid := range swarm.Peers() {
+		entry := models.DHTPeer{PeerID: pid.String(), Addrs: []string{}, Labels: contacts.AddressBook.Labels(pid.String())}
+		for _, conn := range swarm.ConnsToPeer(pid) {
+			entry.Addrs = append(entry.Addrs, conn.RemoteMultiaddr().String())
+			entry.Direction = directionName(conn.Stat().Direction)
+			if _, err := conn.RemoteMultiaddr().ValueForProtocol(ma.P_CIRCUIT); err == nil {
+				entry.Relayed = true
+			}
+		}
+		peers = append(peers, entry)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].PeerID < peers[j].PeerID })
+	return peers, nil
+}
+
+func directionName(direction network.Direction) string {
+	switch direction {
+	case network.DirInbound:
+		return "inbound"
+	case network.DirOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
+
+// Status describes our own node
+func Status() (models.DHTStatus, error) {
+	if DHT == nil {
+		return models.DHTStatus{}, ErrDHTNotStarted
+	}
+	status := models.DHTStatus{
+		PeerID:           DHT.Host().ID().String(),
+		Addrs:            []string{},
+		ConnectedPeers:   len(DHT.Host().Network().Peers()),
+		RoutingTableSize: DHT.RoutingTable().Size(),
+		Protocols:        RegisteredProtocols(),
+	}
+	for _, addr := range DHT.Host().Addrs() {
+		status.Addrs = append(status.Addrs, addr.String())
+	}
+	return status, nil
+}
@@ -0,0 +1,184 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/services"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// peers ask each other for invoices for things that aren't file downloads, a proxy session for now
+// what is sold and at what price is up to the package selling it, which registers a pricer for its purpose
+
+var (
+	ErrBadInvoice      = errors.New("invalid invoice")
+	ErrTooManyInvoices = errors.New("too many invoices requested, pay or wait for the open one")
+)
+
+// every invoice takes a fresh wallet address and stays in btc_invoices.json, so a peer asking again
+// gets its open invoice back and only invoicesPerWindow new ones are made for it per invoiceWindow
+const (
+	invoicesPerWindow = 5
+	invoiceWindow     = time.Hour
+)
+
+// InvoicePricer returns the amount in BTC and a memo for what reference names, or an error to decline
+type InvoicePricer func(reference string, remotePeer string) (float64, string, error)
+
+var (
+	invoicePricers   = make(map[string]InvoicePricer)
+	invoicePricersMu sync.RWMutex
+)
+
+func RegisterInvoicePricer(purpose string, pricer InvoicePricer) {
+	invoicePricersMu.Lock()
+	defer invoicePricersMu.Unlock()
+	invoicePricers[purpose] = pricer
+}
+
+// invoiceBook remembers what we invoiced each peer for
+type invoiceBook struct {
+	mu   sync.Mutex
+	open map[string]string      // remote peer/purpose -> id of the last invoice made for it
+	made map[string][]time.Time // remote peer -> when its invoices in the current window were made
+}
+
+var invoices = newInvoiceBook()
+
+func newInvoiceBook() *invoiceBook {
+	return &invoiceBook{open: make(map[string]string), made: make(map[string][]time.Time)}
+}
+
+// invoice returns the peer's open invoice for purpose if it is still for the same thing at the same price,
+// otherwise makes a new one if the peer hasn't had too many lately
+func (ib *invoiceBook) invoice(remotePeer string, purpose string, reference string, amount btcutil.Amount, memo string) (models.Invoice, error) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	key := remotePeer + "/" + purpose
+	if id, exists := ib.open[key]; exists {
+		invoice, err := lookupInvoice(id)
+		if err == nil && invoice.Status == "open" && invoice.Reference == reference && invoice.Amount == int64(amount) {
+			return invoice, nil
+		}
+		delete(ib.open, key)
+	}
+
+	now := time.Now()
+	recent := ib.made[remotePeer][:0]
+	for _, made := range ib.made[remotePeer] {
+		if now.Sub(made) < invoiceWindow {
+			recent = append(recent, made)
+		}
+	}
+	if len(recent) >= invoicesPerWindow {
+		ib.made[remotePeer] = recent
+		return models.Invoice{}, ErrTooManyInvoices
+	}
+
+	invoice, err := newInvoice(amount, memo, purpose, reference)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	ib.open[key] = invoice.ID
+	ib.made[remotePeer] = append(recent, now)
+	ib.prune(now)
+	return invoice, nil
+}
+
+// prune forgets peers with no invoices left in the window, caller holds ib.mu
+func (ib *invoiceBook) prune(now time.Time) {
+	for remotePeer, made := range ib.made {
+		if len(made) > 0 && now.Sub(made[len(made)-1]) < invoiceWindow {
+			continue
+		}
+		delete(ib.made, remotePeer)
+		for key := range ib.open {
+			if strings.HasPrefix(key, remotePeer+"/") {
+				delete(ib.open, key)
+			}
+		}
+	}
+}
+
+// RequestInvoice asks targetID to invoice us for purpose and checks the uri says what the invoice does
+func RequestInvoice(targetID string, purpose string, reference string) (models.Invoice, error) {
+	s, err := openStream(targetID, ProtocolInvoice)
+	if err != nil {
+		return models.Invoice{}, fmt.Errorf("error requesting invoice: %v", err)
+	}
+	defer s.Close()
+
+	if err := WriteMessage(s, models.InvoiceRequest{Purpose: purpose, Reference: reference}); err != nil {
+		return models.Invoice{}, fmt.Errorf("error requesting invoice: %v", err)
+	}
+	var response models.InvoiceResponse
+	if err := ReadMessage(s, &response); err != nil {
+		return models.Invoice{}, err
+	}
+	if response.Status != "invoiced" {
+		return models.Invoice{}, fmt.Errorf("invoice declined: %s", response.Message)
+	}
+
+	// the uri is what gets paid, so it has to match the rest of the invoice
+	invoice := response.Invoice
+	address, btc, _, err := services.ParseBIP21(invoice.URI)
+	if err != nil {
+		return models.Invoice{}, fmt.Errorf("%w: %v", ErrBadInvoice, err)
+	}
+	amount, err := btcutil.NewAmount(btc)
+	if err != nil {
+		return models.Invoice{}, fmt.Errorf("%w: %v", ErrBadInvoice, err)
+	}
+	if address != invoice.Address || int64(amount) != invoice.Amount || amount <= 0 {
+		return models.Invoice{}, fmt.Errorf("%w: uri doesn't match the invoice", ErrBadInvoice)
+	}
+	return invoice, nil
+}
+
+func receiveInvoiceRequest(node host.Host) {
+	handleProtocol(node, ProtocolInvoice, func(s network.Stream) {
+		defer s.Close()
+
+		var request models.InvoiceRequest
+		if err := ReadMessage(s, &request); err != nil {
+			rejectStream(s, err)
+			return
+		}
+
+		remotePeer := s.Conn().RemotePeer().String()
+		response := models.InvoiceResponse{Status: "declined"}
+		invoicePricersMu.RLock()
+		pricer := invoicePricers[request.Purpose]
+		invoicePricersMu.RUnlock()
+
+		reference := request.Reference
+		if reference == "" {
+			reference = remotePeer
+		}
+		if Reputation.IsBlocked(remotePeer) {
+			response.Message = "requester is blocked"
+		} else if pricer == nil {
+			response.Message = fmt.Sprintf("nothing to invoice for %q", request.Purpose)
+		} else if price, memo, err := pricer(request.Reference, remotePeer); err != nil {
+			response.Message = err.Error()
+		} else if amount, err := btcutil.NewAmount(price); err != nil {
+			response.Message = err.Error()
+		} else if invoice, err := invoices.invoice(remotePeer, request.Purpose, reference, amount, memo); err != nil {
+			response.Message = err.Error()
+		} else {
+			response.Status, response.Invoice = "invoiced", invoice
+			log.Infof("invoiced %v for %s to %s", amount, request.Purpose, remotePeer)
+		}
+
+		if err := WriteMessage(s, response); err != nil {
+			log.Info("receiveInvoiceRequest:", messageError(s, err))
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// go test -v -run ^TestInvoiceRequests$ -count=1 application-layer/dht
+func TestInvoiceRequests(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	requester, other := net.Nodes[1], net.Nodes[2]
+
+	// invoices live in memory instead of the wallet
+	made := make(map[string]models.Invoice)
+	oldNewInvoice, oldLookupInvoice := newInvoice, lookupInvoice
+	newInvoice = func(amount btcutil.Amount, memo string, purpose string, reference string) (models.Invoice, error) {
+		invoice := models.Invoice{ID: fmt.Sprintf("inv-%d", len(made)), Amount: int64(amount), Memo: memo, Purpose: purpose, Reference: reference, Status: "open"}
+		made[invoice.ID] = invoice
+		return invoice, nil
+	}
+	lookupInvoice = func(id string) (models.Invoice, error) {
+		invoice, exists := made[id]
+		if !exists {
+			return models.Invoice{}, fmt.Errorf("no invoice %s", id)
+		}
+		return invoice, nil
+	}
+	price := 0.001
+	RegisterInvoicePricer("test", func(reference string, remotePeer string) (float64, string, error) {
+		return price, "test session", nil
+	})
+	t.Cleanup(func() {
+		newInvoice, lookupInvoice = oldNewInvoice, oldLookupInvoice
+		invoicePricersMu.Lock()
+		delete(invoicePricers, "test")
+		invoicePricersMu.Unlock()
+	})
+
+	ask := func(node *testNode) models.InvoiceResponse {
+		t.Helper()
+		s, err := node.Host.NewStream(net.ctx, Host.ID(), ProtocolInvoice)
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		defer s.Close()
+		if err := WriteMessage(s, models.InvoiceRequest{Purpose: "test"}); err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		var response models.InvoiceResponse
+		if err := ReadMessage(s, &response); err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		return response
+	}
+
+	// asking again gets the open invoice back
+	first := ask(requester)
+	if first.Status != "invoiced" {
+		t.Fatalf("first request: %+v", first)
+	}
+	if again := ask(requester); again.Invoice.ID != first.Invoice.ID || len(made) != 1 {
+		t.Errorf("second request got %s, %d invoices made", again.Invoice.ID, len(made))
+	}
+
+	// a paid invoice or a new price makes a new one, up to the limit per peer
+	paid := made[first.Invoice.ID]
+	paid.Status = "paid"
+	made[paid.ID] = paid
+	for i := 1; i < invoicesPerWindow; i++ {
+		price += 0.001
+		if response := ask(requester); response.Status != "invoiced" || response.Invoice.ID == first.Invoice.ID {
+			t.Fatalf("request %d: %+v", i, response)
+		}
+	}
+	price += 0.001
+	if response := ask(requester); response.Status != "declined" || response.Message != ErrTooManyInvoices.Error() {
+		t.Errorf("request past the limit: %+v", response)
+	}
+	if len(made) != invoicesPerWindow {
+		t.Errorf("made %d invoices, want %d", len(made), invoicesPerWindow)
+	}
+
+	// other peers have their own limit
+	if response := ask(other); response.Status != "invoiced" {
+		t.Errorf("other peer: %+v", response)
+	}
+}
+
+// go test -v -run ^TestPayTransferInvoice$ -count=1 application-layer/dht
+func TestPayTransferInvoice(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	provider := net.Nodes[1]
+	var paid []string
+	oldPayInvoiceURI := payInvoiceURI
+	payInvoiceURI = func(uri string, passphrase string) (string, error) {
+		paid = append(paid, uri)
+		return "payment", nil
+	}
+	t.Cleanup(func() { payInvoiceURI = oldPayInvoiceURI })
+
+	address := "14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc"
+	pay := func(transactionID string, uri string) error {
+		t.Helper()
+		request := models.Transaction{TransactionID: transactionID, RequesterID: PeerID, TargetID: provider.ID(), Fee: 5000}
+		transaction := request
+		transaction.TargetWallet, transaction.InvoiceURI = address, uri
+		encrypted, err := createEncryptedDownload(transaction)
+		if err != nil {
+			t.Fatalf("failed to create download: %v", err)
+		}
+		encrypted.Close()
+		if err := awaitPayment(request, transaction, models.FileMetadata{}); err != nil {
+			t.Fatalf("failed to save pending download: %v", err)
+		}
+		_, err = PayTransferInvoice(transactionID, "passphrase")
+		return err
+	}
+
+	// the provider can't charge more than the fee we agreed to or send it elsewhere
+	for transactionID, uri := range map[string]string{
+		"overcharged": "bitcoin:" + address + "?amount=0.0001",
+		"elsewhere":   "bitcoin:1BoatSLRHtKNngkdXEeobR76b53LETtpyT?amount=0.00005",
+		"garbled":     "bitcoin:?amount=lots",
+	} {
+		if err := pay(transactionID, uri); !errors.Is(err, ErrBadInvoice) {
+			t.Errorf("%s invoice: got %v", transactionID, err)
+		}
+	}
+	if len(paid) != 0 {
+		t.Fatalf("paid %v", paid)
+	}
+
+	// the provider doesn't know the transfer so the key request after paying fails, the payment is what counts here
+	pay("agreed", "bitcoin:"+address+"?amount=0.00005")
+	if len(paid) != 1 {
+		t.Errorf("invoice for the agreed fee not paid")
+	}
+}
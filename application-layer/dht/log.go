@@ -0,0 +1,15 @@
+package dht_kad
+
+import (
+	"application-layer/logging"
+	"os"
+)
+
+var log = logging.Subsystem("DHT")
+
+// fatalf logs at critical level and exits, the way log.Fatalf did
+func fatalf(format string, args ...interface{}) {
+	log.Criticalf(format, args...)
+	logging.Close()
+	os.Exit(1)
+}
@@ -0,0 +1,166 @@
+package dht_kad
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// every message between our nodes is a 4 byte big-endian length followed by that many bytes of json
+// streams on unversioned ids from older clients carry newline terminated json instead (see protocols.go)
+// the cloud node speaks its own unframed format, those streams go through readUnframed/writeUnframed
+
+const (
+	// largest control message we accept - transactions, metadata, queue positions and keys are far smaller
+	maxMessageSize = 1 << 20
+	// largest unframed payload from the cloud node, e.g. the whole marketplace listing
+	maxUnframedSize = 16 << 20
+	// time allowed to read or write a single message
+	messageTimeout = 30 * time.Second
+	// longest a file transfer may go without receiving any data while not paused
+	transferIdleTimeout = 2 * time.Minute
+)
+
+var (
+	ErrMessageTooLarge  = errors.New("message too large")
+	ErrMalformedMessage = errors.New("malformed message")
+	ErrStreamTimeout    = errors.New("stream timed out")
+	ErrStreamClosed     = errors.New("stream closed by peer")
+)
+
+// MessageError says which protocol and peer a bad message came from
+type MessageError struct {
+	Protocol string
+	Peer     string
+	Err      error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("%s from %s: %v", e.Protocol, e.Peer, e.Err)
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+func messageError(s network.Stream, err error) error {
+	return &MessageError{Protocol: string(s.Protocol()), Peer: s.Conn().RemotePeer().String(), Err: err}
+}
+
+// map low level stream errors onto our typed errors
+func streamError(err error) error {
+	switch {
+	case err == io.EOF, err == io.ErrUnexpectedEOF:
+		return ErrStreamClosed
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrStreamTimeout
+	}
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrStreamTimeout
+	}
+	return err
+}
+
+// WriteMessage sends v as one framed json message
+func WriteMessage(s network.Stream, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return messageError(s, fmt.Errorf("%w: %v", ErrMalformedMessage, err))
+	}
+	if len(payload) > maxMessageSize {
+		return messageError(s, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(payload)))
+	}
+
+	var frame []byte
+	if isLegacyProtocol(s.Protocol()) {
+		frame = append(payload, '\n')
+	} else {
+		frame = make([]byte, 4+len(payload))
+		binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+		copy(frame[4:], payload)
+	}
+
+	s.SetWriteDeadline(time.Now().Add(messageTimeout))
+	defer s.SetWriteDeadline(time.Time{})
+	if _, err := s.Write(frame); err != nil {
+		return messageError(s, streamError(err))
+	}
+	return nil
+}
+
+// ReadMessage reads one framed json message into v
+func ReadMessage(s network.Stream, v interface{}) error {
+	if isLegacyProtocol(s.Protocol()) {
+		payload, err := readLegacyMessage(s)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(payload, v); err != nil {
+			return messageError(s, fmt.Errorf("%w: %v", ErrMalformedMessage, err))
+		}
+		return nil
+	}
+
+	s.SetReadDeadline(time.Now().Add(messageTimeout))
+	defer s.SetReadDeadline(time.Time{})
+
+	var header [4]byte
+	if _, err := io.ReadFull(s, header[:]); err != nil {
+		return messageError(s, streamError(err))
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxMessageSize {
+		return messageError(s, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, size))
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(s, payload); err != nil {
+		return messageError(s, streamError(err))
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return messageError(s, fmt.Errorf("%w: %v", ErrMalformedMessage, err))
+	}
+	return nil
+}
+
+// readUnframed reads everything the peer sends until it closes the stream
+func readUnframed(s network.Stream, v interface{}) error {
+	s.SetReadDeadline(time.Now().Add(messageTimeout))
+	defer s.SetReadDeadline(time.Time{})
+
+	data, err := io.ReadAll(io.LimitReader(s, maxUnframedSize+1))
+	if err != nil {
+		return messageError(s, streamError(err))
+	}
+	if len(data) > maxUnframedSize {
+		return messageError(s, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, maxUnframedSize))
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return messageError(s, fmt.Errorf("%w: %v", ErrMalformedMessage, err))
+	}
+	return nil
+}
+
+// writeUnframed sends raw bytes to a peer that doesn't understand framing
+func writeUnframed(s network.Stream, data []byte) error {
+	s.SetWriteDeadline(time.Now().Add(messageTimeout))
+	defer s.SetWriteDeadline(time.Time{})
+	if _, err := s.Write(data); err != nil {
+		return messageError(s, streamError(err))
+	}
+	return nil
+}
+
+// drop a stream that sent us something we can't use, the node itself carries on
+func rejectStream(s network.Stream, err error) {
+	log.Infof("rejecting stream: %v", err)
+	s.Reset()
+}
@@ -0,0 +1,95 @@
+package dht_kad
+
+import (
+	"application-layer/metrics"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// streams of our protocols are counted as they are opened and served, labelled with
+// the versioned id even when the peer only speaks the legacy one
+
+// meteredStream counts what goes over a stream and how long it stays open
+type meteredStream struct {
+	network.Stream
+	protocol  string
+	direction string
+	opened    time.Time
+	failed    atomic.Bool
+	done      sync.Once
+}
+
+func meterStream(s network.Stream, id protocol.ID, direction string) network.Stream {
+	_, err := s.Conn().RemoteMultiaddr().ValueForProtocol(ma.P_CIRCUIT)
+	metrics.StreamOpened(string(id), direction, err == nil)
+	return &meteredStream{Stream: s, protocol: string(id), direction: direction, opened: time.Now()}
+}
+
+func (s *meteredStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	metrics.StreamBytes(s.protocol, "read", n)
+	if err != nil && err != io.EOF {
+		s.fail()
+	}
+	return n, err
+}
+
+func (s *meteredStream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	metrics.StreamBytes(s.protocol, "write", n)
+	if err != nil {
+		s.fail()
+	}
+	return n, err
+}
+
+func (s *meteredStream) Close() error {
+	s.finish()
+	return s.Stream.Close()
+}
+
+// a reset isn't counted as an error, senders reset on purpose once everything is out
+func (s *meteredStream) Reset() error {
+	s.finish()
+	return s.Stream.Reset()
+}
+
+// one error per stream, however many reads fail after the first
+func (s *meteredStream) fail() {
+	if s.failed.CompareAndSwap(false, true) {
+		metrics.StreamError(s.protocol, s.direction)
+	}
+}
+
+func (s *meteredStream) finish() {
+	s.done.Do(func() { metrics.StreamClosed(s.protocol, s.direction, s.opened) })
+}
+
+func meterHandler(id protocol.ID, handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		handler(meterStream(s, id, "inbound"))
+	}
+}
+
+// GetValue is DHT.GetValue with its latency recorded
+func GetValue(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	data, err := DHT.GetValue(ctx, key)
+	metrics.DHTOperation("get_value", start, err)
+	return data, err
+}
+
+// PutValue is DHT.PutValue with its latency recorded
+func PutValue(ctx context.Context, key string, value []byte) error {
+	start := time.Now()
+	err := DHT.PutValue(ctx, key, value)
+	metrics.DHTOperation("put_value", start, err)
+	return err
+}
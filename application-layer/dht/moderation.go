@@ -0,0 +1,302 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// notices kept at most, the oldest are forgotten first
+const maxTakedownNotices = 1000
+
+var (
+	ModerationPath = filepath.Join(dirPath, "moderation.json")
+	Moderation     = newModerator()
+)
+
+type moderationFile struct {
+	Policy  models.ModerationPolicy `json:"Policy"`
+	Notices []models.TakedownNotice `json:"Notices"`
+}
+
+// moderator decides which peers we serve and which files we serve or list
+type moderator struct {
+	mu      sync.Mutex
+	policy  models.ModerationPolicy
+	notices map[string]models.TakedownNotice // keyed by issuer and file hash
+}
+
+func newModerator() *moderator {
+	return &moderator{notices: make(map[string]models.TakedownNotice)}
+}
+
+// read the saved policy and notices, if any
+func LoadModeration() error {
+	data, err := os.ReadFile(ModerationPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read moderation settings: %v", err)
+	}
+
+	var saved moderationFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse moderation settings: %v", err)
+	}
+
+	Moderation.mu.Lock()
+	defer Moderation.mu.Unlock()
+	Moderation.policy = saved.Policy
+	Moderation.notices = make(map[string]models.TakedownNotice)
+	for _, notice := range saved.Notices {
+		Moderation.notices[notice.Issuer+"/"+notice.FileHash] = notice
+	}
+	return nil
+}
+
+// caller holds m.mu
+func (m *moderator) save() error {
+	saved := moderationFile{Policy: m.policy, Notices: m.sortedNotices()}
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal moderation settings: %v", err)
+	}
+	if err := os.WriteFile(ModerationPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write moderation settings: %v", err)
+	}
+	return nil
+}
+
+// newest first, caller holds m.mu
+func (m *moderator) sortedNotices() []models.TakedownNotice {
+	notices := []models.TakedownNotice{}
+	for _, notice := range m.notices {
+		notice.Honoured = m.honours(notice)
+		notices = append(notices, notice)
+	}
+	sort.Slice(notices, func(i, j int) bool { return notices[i].Timestamp > notices[j].Timestamp })
+	return notices
+}
+
+func (m *moderator) Status() models.ModerationStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return models.ModerationStatus{Policy: m.policy, Notices: m.sortedNotices()}
+}
+
+func (m *moderator) SetPolicy(policy models.ModerationPolicy) error {
+	for _, list := range [][]string{policy.AllowedPeers, policy.DeniedPeers, policy.TrustedIssuers} {
+		for _, peerID := range list {
+			if _, err := peer.Decode(peerID); err != nil {
+				return fmt.Errorf("invalid peer id %q: %v", peerID, err)
+			}
+		}
+	}
+	for _, list := range [][]string{policy.AllowedHashes, policy.DeniedHashes} {
+		for _, hash := range list {
+			if !storage.ValidHash(hash) {
+				return fmt.Errorf("%w: %q", storage.ErrInvalidHash, hash)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+	return m.save()
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// caller holds m.mu
+func (m *moderator) honours(notice models.TakedownNotice) bool {
+	if notice.Issuer == PeerID {
+		return true
+	}
+	return m.policy.HonourTakedowns && contains(m.policy.TrustedIssuers, notice.Issuer)
+}
+
+// caller holds m.mu
+func (m *moderator) peerAllowed(peerID string) bool {
+	if contains(m.policy.DeniedPeers, peerID) {
+		return false
+	}
+	return len(m.policy.AllowedPeers) == 0 || contains(m.policy.AllowedPeers, peerID)
+}
+
+// caller holds m.mu, the reason is empty when the file may be served
+func (m *moderator) hashDenied(hash string) string {
+	if contains(m.policy.DeniedHashes, hash) {
+		return "file is on our deny list"
+	}
+	if len(m.policy.AllowedHashes) > 0 && !contains(m.policy.AllowedHashes, hash) {
+		return "file is not on our allow list"
+	}
+	for _, notice := range m.notices {
+		if notice.FileHash == hash && m.honours(notice) {
+			return fmt.Sprintf("file was taken down: %s", notice.Reason)
+		}
+	}
+	return ""
+}
+
+// CheckRequest says why a download request must be declined, nil when it may be served
+func (m *moderator) CheckRequest(peerID string, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.peerAllowed(peerID) {
+		return fmt.Errorf("requester is not allowed")
+	}
+	if reason := m.hashDenied(hash); reason != "" {
+		return fmt.Errorf("%s", reason)
+	}
+	return nil
+}
+
+// FilterListing drops denied files from a marketplace listing and hides denied providers
+// a file is left out altogether once none of its providers remain
+func (m *moderator) FilterListing(files []models.DHTMetadata) []models.DHTMetadata {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	listing := []models.DHTMetadata{}
+	for _, file := range files {
+		if m.hashDenied(file.Hash) != "" {
+			continue
+		}
+		providers := make(map[string]models.Provider)
+		for peerID, provider := range file.Providers {
+			if m.peerAllowed(peerID) && !Reputation.IsBlocked(peerID) {
+				providers[peerID] = provider
+			}
+		}
+		if len(file.Providers) > 0 && len(providers) == 0 {
+			continue
+		}
+		file.Providers = providers
+		listing = append(listing, file)
+	}
+	return listing
+}
+
+// the signature covers the notice with empty Signature and Honoured fields
+func noticePayload(notice models.TakedownNotice) ([]byte, error) {
+	notice.Signature = ""
+	notice.Honoured = false
+	return json.Marshal(notice)
+}
+
+// caller holds m.mu
+func (m *moderator) store(notice models.TakedownNotice) error {
+	notice.Honoured = false
+	m.notices[notice.Issuer+"/"+notice.FileHash] = notice
+	if len(m.notices) > maxTakedownNotices {
+		oldestKey, oldest := "", int64(0)
+		for key, stored := range m.notices {
+			if oldestKey == "" || stored.Timestamp < oldest {
+				oldestKey, oldest = key, stored.Timestamp
+			}
+		}
+		delete(m.notices, oldestKey)
+	}
+	return m.save()
+}
+
+// IssueTakedown reports a file: we stop serving it ourselves and send a signed notice to our peers
+func (m *moderator) IssueTakedown(hash string, reason string) (models.TakedownNotice, error) {
+	if !storage.ValidHash(hash) {
+		return models.TakedownNotice{}, storage.ErrInvalidHash
+	}
+	notice := models.TakedownNotice{
+		Issuer:    PeerID,
+		FileHash:  hash,
+		Reason:    reason,
+		Timestamp: time.Now().Unix(),
+	}
+	payload, err := noticePayload(notice)
+	if err != nil {
+		return models.TakedownNotice{}, err
+	}
+	notice.Signature, err = signPayload(payload)
+	if err != nil {
+		return models.TakedownNotice{}, err
+	}
+
+	m.mu.Lock()
+	err = m.store(notice)
+	m.mu.Unlock()
+	if err != nil {
+		return models.TakedownNotice{}, err
+	}
+
+	go broadcast(DHT.Host(), ProtocolTakedown, notice, "")
+	notice.Honoured = true
+	return notice, nil
+}
+
+// acceptNotice keeps a notice sent to us by from, whether we act on it is up to our policy
+func (m *moderator) acceptNotice(notice models.TakedownNotice, from string) error {
+	if notice.Issuer != from {
+		return fmt.Errorf("%w: notice issued by %s relayed by %s", ErrMalformedMessage, notice.Issuer, from)
+	}
+	if !storage.ValidHash(notice.FileHash) {
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, storage.ErrInvalidHash)
+	}
+	if time.Until(time.Unix(notice.Timestamp, 0)) > time.Minute {
+		return fmt.Errorf("%w: notice from the future", ErrMalformedMessage)
+	}
+	payload, err := noticePayload(notice)
+	if err != nil {
+		return err
+	}
+	if err := verifyPayload(notice.Issuer, payload, notice.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+	if Reputation.IsBlocked(notice.Issuer) {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, exists := m.notices[notice.Issuer+"/"+notice.FileHash]; exists && stored.Timestamp >= notice.Timestamp {
+		return nil
+	}
+	log.Infof("takedown notice from %s for %s: %s (honoured: %v)", notice.Issuer, notice.FileHash, notice.Reason, m.honours(notice))
+	return m.store(notice)
+}
+
+func receiveTakedownNotice(node host.Host) {
+	handleProtocol(node, ProtocolTakedown, func(s network.Stream) {
+		defer s.Close()
+
+		var notice models.TakedownNotice
+		if err := ReadMessage(s, &notice); err != nil {
+			rejectStream(s, err)
+			return
+		}
+		if err := Moderation.acceptNotice(notice, s.Conn().RemotePeer().String()); err != nil {
+			rejectStream(s, messageError(s, err))
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// go test -v -run ^TestModeration$ -count=1 application-layer/dht
+func TestModeration(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	denied, issuer := net.Nodes[1], net.Nodes[2]
+	file := net.addFile("moderated.txt", []byte("some people shouldn't get this"), 0)
+	other := net.addFile("other.txt", []byte("not on the allow list"), 0)
+
+	if err := Moderation.SetPolicy(models.ModerationPolicy{DeniedPeers: []string{"not a peer"}}); err == nil {
+		t.Errorf("policy with an invalid peer id was accepted")
+	}
+	if err := Moderation.SetPolicy(models.ModerationPolicy{DeniedPeers: []string{denied.ID()}, AllowedHashes: []string{file.Hash}}); err != nil {
+		t.Fatalf("failed to set policy: %v", err)
+	}
+	if err := Moderation.CheckRequest(issuer.ID(), file.Hash); err != nil {
+		t.Errorf("allowed request refused: %v", err)
+	}
+	if err := Moderation.CheckRequest(issuer.ID(), other.Hash); err == nil {
+		t.Errorf("file missing from the allow list was served")
+	}
+
+	// a denied peer is declined over the wire
+	declines := make(chan models.Transaction, 1)
+	net.handle(denied, ProtocolResponse, func(s network.Stream) {
+		defer s.Close()
+		var decline models.Transaction
+		if err := ReadMessage(s, &decline); err == nil {
+			declines <- decline
+		}
+	})
+	requestStream, err := denied.Host.NewStream(net.ctx, Host.ID(), ProtocolDownloadRequest)
+	if err != nil {
+		t.Fatalf("failed to open request stream: %v", err)
+	}
+	WriteMessage(requestStream, models.Transaction{TransactionID: "m1", FileHash: file.Hash, RequesterID: denied.ID(), TargetID: PeerID})
+	requestStream.Close()
+	select {
+	case decline := <-declines:
+		if decline.Status != "declined" || decline.Message != "requester is not allowed" {
+			t.Errorf("denied requester got %+v", decline)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("denied requester got no answer")
+	}
+
+	listing := Moderation.FilterListing([]models.DHTMetadata{
+		{Hash: file.Hash, Providers: map[string]models.Provider{denied.ID(): {}, issuer.ID(): {}}},
+		{Hash: other.Hash, Providers: map[string]models.Provider{issuer.ID(): {}}},
+	})
+	if len(listing) != 1 || listing[0].Hash != file.Hash || len(listing[0].Providers) != 1 {
+		t.Errorf("listing = %+v, want only %s from %s", listing, file.Hash, issuer.ID())
+	} else if _, exists := listing[0].Providers[issuer.ID()]; !exists {
+		t.Errorf("listing = %+v, want only %s from %s", listing, file.Hash, issuer.ID())
+	}
+
+	// a signed notice is kept, but only acted on once its issuer is trusted
+	if err := Moderation.SetPolicy(models.ModerationPolicy{}); err != nil {
+		t.Fatalf("failed to clear policy: %v", err)
+	}
+	notice := models.TakedownNotice{Issuer: issuer.ID(), FileHash: file.Hash, Reason: "copyright", Timestamp: time.Now().Unix()}
+	signNoticeAs(t, issuer, &notice)
+	noticeStream, err := issuer.Host.NewStream(net.ctx, Host.ID(), ProtocolTakedown)
+	if err != nil {
+		t.Fatalf("failed to open takedown stream: %v", err)
+	}
+	WriteMessage(noticeStream, notice)
+	noticeStream.Close()
+	net.waitFor("takedown notice", func() bool { return len(Moderation.Status().Notices) == 1 })
+	if Moderation.CheckRequest(issuer.ID(), file.Hash) != nil || Moderation.Status().Notices[0].Honoured {
+		t.Errorf("notice from an untrusted issuer was honoured")
+	}
+
+	if err := Moderation.SetPolicy(models.ModerationPolicy{HonourTakedowns: true, TrustedIssuers: []string{issuer.ID()}}); err != nil {
+		t.Fatalf("failed to trust issuer: %v", err)
+	}
+	if Moderation.CheckRequest(denied.ID(), file.Hash) == nil {
+		t.Errorf("file was served after a trusted takedown")
+	}
+	if listing := Moderation.FilterListing([]models.DHTMetadata{{Hash: file.Hash}}); len(listing) != 0 {
+		t.Errorf("taken down file is still listed: %+v", listing)
+	}
+
+	// notices relayed by someone else or tampered with are refused
+	if err := Moderation.acceptNotice(notice, denied.ID()); err == nil {
+		t.Errorf("notice relayed by another peer was accepted")
+	}
+	notice.Reason = "changed"
+	if err := Moderation.acceptNotice(notice, issuer.ID()); err == nil {
+		t.Errorf("tampered notice was accepted")
+	}
+}
+
+func signNoticeAs(t *testing.T, node *testNode, notice *models.TakedownNotice) {
+	t.Helper()
+	payload, err := noticePayload(*notice)
+	if err != nil {
+		t.Fatalf("failed to encode notice: %v", err)
+	}
+	signature, err := node.Host.Peerstore().PrivKey(node.Host.ID()).Sign(payload)
+	if err != nil {
+		t.Fatalf("failed to sign notice: %v", err)
+	}
+	notice.Signature = hex.EncodeToString(signature)
+}
@@ -1,14 +1,15 @@
 package dht_kad
 
 import (
+	"application-layer/metrics"
 	"bufio"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p/core/host"
@@ -23,14 +24,14 @@ import (
 func ConnectToPeer(node host.Host, peerAddr string) {
 	addr, err := multiaddr.NewMultiaddr(peerAddr)
 	if err != nil {
-		log.Printf("Failed to parse peer address: %s", err)
+		log.Errorf("Failed to parse peer address: %s", err)
 		return
 	}
-	fmt.Println("--------target peer address:", peerAddr)
+	log.Debug("--------target peer address:", peerAddr)
 
 	info, err := peer.AddrInfoFromP2pAddr(addr)
 	if err != nil {
-		log.Printf("Failed to get AddrInfo from address: %s", err)
+		log.Errorf("Failed to get AddrInfo from address: %s", err)
 		return
 	}
 	if peerAddr != Relay_node_addr {
@@ -38,11 +39,11 @@ func ConnectToPeer(node host.Host, peerAddr string) {
 	}
 	err = node.Connect(context.Background(), *info)
 	if err != nil {
-		log.Printf("ConnectToPeer: Failed to connect to peer: %s", err)
+		log.Errorf("ConnectToPeer: Failed to connect to peer: %s", err)
 		return
 	}
 
-	fmt.Println("Connected to:", info.ID)
+	log.Info("Connected to:", info.ID)
 }
 
 func ConnectToPeerUsingRelay(node host.Host, targetPeerID string) error {
@@ -50,9 +51,9 @@ func ConnectToPeerUsingRelay(node host.Host, targetPeerID string) error {
 	targetPeerID = strings.TrimSpace(targetPeerID)
 	relayAddr, err := multiaddr.NewMultiaddr(Relay_node_addr)
 	if err != nil {
-		log.Printf("Failed to create relay multiaddr: %v", err)
+		log.Errorf("Failed to create relay multiaddr: %v", err)
 	}
-	fmt.Println("--------target peer id:", targetPeerID)
+	log.Debug("--------target peer id:", targetPeerID)
 	peerMultiaddr := relayAddr.Encapsulate(multiaddr.StringCast("/p2p-circuit/p2p/" + targetPeerID))
 
 	relayedAddrInfo, err := peer.AddrInfoFromP2pAddr(peerMultiaddr)
@@ -65,60 +66,62 @@ func ConnectToPeerUsingRelay(node host.Host, targetPeerID string) error {
 		return fmt.Errorf("failed to connect to peer through relay: %w", err)
 	}
 
-	fmt.Printf("connected to peer via relay: %s\n", targetPeerID)
+	log.Infof("connected to peer via relay: %s", targetPeerID)
 	return nil
 }
 
 func ReceiveDataFromPeer(node host.Host) {
-	fmt.Println("listening for data from peer")
+	log.Info("listening for data from peer")
 	// Set a stream handler to listen for incoming streams on the "/senddata/p2p" protocol
 	node.SetStreamHandler("/senddata/p2p", func(s network.Stream) {
 		defer s.Close()
+		s.SetReadDeadline(time.Now().Add(messageTimeout))
 		// Create a buffered reader to read data from the stream
-		buf := bufio.NewReader(s)
+		buf := bufio.NewReader(io.LimitReader(s, maxMessageSize))
 		// Read data from the stream
 		data, err := buf.ReadBytes('\n') // Reads until a newline character
 		if err != nil {
 			if err == io.EOF {
-				log.Printf("Stream closed by peer: %s", s.Conn().RemotePeer())
+				log.Infof("Stream closed by peer: %s", s.Conn().RemotePeer())
 			} else {
-				log.Printf("Error reading from stream: %v", err)
+				log.Errorf("Error reading from stream: %v", err)
 			}
 			return
 		}
 		// Print the received data
-		log.Printf("Received data: %s", data)
+		log.Infof("Received data: %s", data)
 	})
 }
 
 func SendDataToPeer(node host.Host, targetpeerid string) {
-	fmt.Println("sending data to peer: ", targetpeerid)
+	log.Debug("sending data to peer: ", targetpeerid)
 	var ctx = context.Background()
 	targetPeerID := strings.TrimSpace(targetpeerid)
 	relayAddr, err := multiaddr.NewMultiaddr(Relay_node_addr)
 	if err != nil {
-		log.Printf("Failed to create relay multiaddr: %v", err)
+		log.Errorf("Failed to create relay multiaddr: %v", err)
 	}
 	peerMultiaddr := relayAddr.Encapsulate(multiaddr.StringCast("/p2p-circuit/p2p/" + targetPeerID))
 
 	peerinfo, err := peer.AddrInfoFromP2pAddr(peerMultiaddr)
 	if err != nil {
-		log.Fatalf("Failed to parse peer address: %s", err)
+		log.Errorf("Failed to parse peer address: %s", err)
+		return
 	}
 	if err := node.Connect(ctx, *peerinfo); err != nil {
-		log.Printf("Failed to connect to peer %s via relay: %v", peerinfo.ID, err)
+		log.Errorf("Failed to connect to peer %s via relay: %v", peerinfo.ID, err)
 		return
 	}
 	s, err := node.NewStream(network.WithAllowLimitedConn(ctx, "/senddata/p2p"), peerinfo.ID, "/senddata/p2p")
 	if err != nil {
-		log.Printf("Failed to open stream to %s: %s", peerinfo.ID, err)
+		log.Errorf("Failed to open stream to %s: %s", peerinfo.ID, err)
 		return
 	}
 	defer s.Close()
 
-	_, err = s.Write([]byte("sending hello to peer\n"))
+	err = writeUnframed(s, []byte("sending hello to peer\n"))
 	if err != nil {
-		log.Fatalf("Failed to write to stream: %s", err)
+		log.Errorf("Failed to write to stream: %s", err)
 	}
 }
 
@@ -127,22 +130,24 @@ func handlePeerExchange(node host.Host) {
 	node.SetStreamHandler("/orcanet/p2p", func(s network.Stream) {
 		defer s.Close()
 
-		buf := bufio.NewReader(s)
+		// sent by the relay as one line of json
+		s.SetReadDeadline(time.Now().Add(messageTimeout))
+		buf := bufio.NewReader(io.LimitReader(s, maxUnframedSize))
 		peerAddr, err := buf.ReadString('\n')
-		if err != nil {
-			if err != io.EOF {
-				fmt.Printf("error reading from stream: %v", err)
-			}
+		if err != nil && err != io.EOF {
+			rejectStream(s, messageError(s, streamError(err)))
+			return
 		}
 		peerAddr = strings.TrimSpace(peerAddr)
 		var data map[string]interface{}
 		err = json.Unmarshal([]byte(peerAddr), &data)
 		if err != nil {
-			fmt.Printf("error unmarshaling JSON: %v", err)
+			rejectStream(s, messageError(s, fmt.Errorf("%w: %v", ErrMalformedMessage, err)))
+			return
 		}
 		if knownPeers, ok := data["known_peers"].([]interface{}); ok {
 			for _, peer := range knownPeers {
-				fmt.Println("Peer:")
+				log.Info("Peer:")
 				if peerMap, ok := peer.(map[string]interface{}); ok {
 					if peerID, ok := peerMap["peer_id"].(string); ok {
 						if string(peerID) != string(relayInfo.ID) {
@@ -157,31 +162,33 @@ func handlePeerExchange(node host.Host) {
 
 // find all providers for a file
 func FindProviders(fileHash string) {
-	fmt.Printf("looking for providers for file: %v", fileHash)
+	log.Infof("looking for providers for file: %v", fileHash)
 	data := []byte(fileHash)
 	hash := sha256.Sum256(data)
 	mh, err := multihash.EncodeName(hash[:], "sha2-256")
 	if err != nil {
-		fmt.Printf("Error encoding multihash: %v\n", err)
+		log.Errorf("Error encoding multihash: %v", err)
 	}
 	c := cid.NewCidV1(cid.Raw, mh)
+	start := time.Now()
 	providers := DHT.FindProvidersAsync(GlobalCtx, c, 20)
 
-	fmt.Println("Searching for providers...")
+	log.Info("Searching for providers...")
 	for p := range providers {
 		if p.ID == peer.ID("") {
 			break
 		}
-		fmt.Printf("Found provider: %s\n", p.ID.String())
+		log.Infof("Found provider: %s", p.ID.String())
 		for _, addr := range p.Addrs {
-			fmt.Printf(" - Address: %s\n", addr.String())
+			log.Infof(" - Address: %s", addr.String())
 		}
 	}
+	metrics.DHTOperation("find_providers", start, nil)
 }
 
 // get addr for a specific provider of file
 func FindSpecificProvider(fileHash string, targetProviderID peer.ID) (*peer.AddrInfo, error) {
-	fmt.Printf("looking for providers for file: %v", fileHash)
+	log.Infof("looking for providers for file: %v", fileHash)
 	data := []byte(fileHash)
 	hash := sha256.Sum256(data)
 
@@ -195,27 +202,35 @@ func FindSpecificProvider(fileHash string, targetProviderID peer.ID) (*peer.Addr
 	c := cid.NewCidV1(cid.Raw, mh)
 
 	// Start asynchronous provider search
+	start := time.Now()
 	providers := DHT.FindProvidersAsync(GlobalCtx, c, 20)
 	targetPeerID := peer.ID(targetProviderID)
 
-	fmt.Println("Searching for specific provider...")
+	log.Info("Searching for specific provider...")
 	for p := range providers {
 		if p.ID == targetPeerID {
-			fmt.Printf("Found target provider: %s\n", p.ID.String())
+			log.Infof("Found target provider: %s", p.ID.String())
 			for _, addr := range p.Addrs {
-				fmt.Printf(" - Address: %s\n", addr.String())
+				log.Infof(" - Address: %s", addr.String())
 			}
+			metrics.DHTOperation("find_providers", start, nil)
 			// Return the matching provider's AddrInfo
 			return &p, nil
 		}
 	}
 
-	return nil, fmt.Errorf("provider with ID %s not found for file hash %s", targetProviderID, fileHash)
+	err = fmt.Errorf("provider with ID %s not found for file hash %s", targetProviderID, fileHash)
+	metrics.DHTOperation("find_providers", start, err)
+	return nil, err
 }
 
 // adapted from sendDataToPeer
-func CreateNewStream(node host.Host, targetPeerID string, streamProtocol protocol.ID) (network.Stream, error) {
-	fmt.Printf("CreateNewStream %v: sending data to peer %v\n", streamProtocol, targetPeerID)
+// when several protocols are given the first one the peer supports is used
+func CreateNewStream(node host.Host, targetPeerID string, streamProtocols ...protocol.ID) (network.Stream, error) {
+	log.Infof("CreateNewStream %v: sending data to peer %v", streamProtocols, targetPeerID)
+	if len(streamProtocols) == 0 {
+		return nil, fmt.Errorf("no protocol given")
+	}
 
 	// Create a context for connection
 	var ctx = context.Background()
@@ -224,7 +239,7 @@ func CreateNewStream(node host.Host, targetPeerID string, streamProtocol protoco
 	// Create the relay address
 	relayAddr, err := multiaddr.NewMultiaddr(Relay_node_addr)
 	if err != nil {
-		log.Printf("Failed to create relay multiaddr: %v", err)
+		log.Errorf("Failed to create relay multiaddr: %v", err)
 		return nil, fmt.Errorf("failed to create relay multiaddr: %v", err)
 	}
 
@@ -234,26 +249,26 @@ func CreateNewStream(node host.Host, targetPeerID string, streamProtocol protoco
 	// Parse the multiaddress into a PeerInfo object
 	peerinfo, err := peer.AddrInfoFromP2pAddr(peerMultiaddr)
 	if err != nil {
-		log.Printf("Failed to parse peer address: %s", err)
+		log.Errorf("Failed to parse peer address: %s", err)
 		return nil, fmt.Errorf("failed to parse peer address: %v", err)
 	}
 
 	// Connect to the target peer
 	if err := node.Connect(ctx, *peerinfo); err != nil {
-		log.Printf("Failed to connect to peer %s via relay: %v", peerinfo.ID, err)
+		log.Errorf("Failed to connect to peer %s via relay: %v", peerinfo.ID, err)
 		return nil, fmt.Errorf("failed to connect to peer %s via relay: %v", peerinfo.ID, err)
 	}
-	fmt.Printf("connected to node %v, now creating stream %v", targetPeerID, streamProtocol)
+	log.Infof("connected to node %v, now creating stream %v", targetPeerID, streamProtocols)
 
 	// Create a new stream to the target peer
 	// stream, err := node.NewStream(ctx, peerinfo.ID, streamProtocol)
-	stream, err := node.NewStream(network.WithAllowLimitedConn(ctx, string(streamProtocol)), peerinfo.ID, streamProtocol)
+	stream, err := node.NewStream(network.WithAllowLimitedConn(ctx, string(streamProtocols[0])), peerinfo.ID, streamProtocols...)
 
 	if err != nil {
-		log.Printf("Failed to open stream to %s: %s", peerinfo.ID, err)
+		log.Errorf("Failed to open stream to %s: %s", peerinfo.ID, err)
 		return nil, fmt.Errorf("failed to open stream to peer %s: %v", peerinfo.ID, err)
 	}
 
-	fmt.Printf("Successfully created stream to peer %s\n", peerinfo.ID)
+	log.Infof("Successfully created stream to peer %s using %s", peerinfo.ID, stream.Protocol())
 	return stream, nil
 }
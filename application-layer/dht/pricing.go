@@ -0,0 +1,314 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const defaultQuoteTTL = 10 * time.Minute
+
+var (
+	ErrNotForSale   = errors.New("file is not offered by us")
+	ErrUnknownQuote = errors.New("unknown quote")
+	ErrQuoteExpired = errors.New("quote expired")
+	ErrBadQuote     = errors.New("invalid quote")
+)
+
+var (
+	PricingPath = filepath.Join(dirPath, "pricing.json")
+	Pricing     = newPricer()
+)
+
+type pricingFile struct {
+	Policy    models.PricingPolicy `json:"Policy"`
+	Purchases map[string]int64     `json:"Purchases"` // paid downloads we verified, by requester
+}
+
+// pricer turns the fee we advertise into the price a requester is quoted
+type pricer struct {
+	mu        sync.Mutex
+	policy    models.PricingPolicy
+	purchases map[string]int64
+	quotes    map[string]models.Quote // quotes we gave out and that haven't expired, by id
+}
+
+func newPricer() *pricer {
+	return &pricer{purchases: make(map[string]int64), quotes: make(map[string]models.Quote)}
+}
+
+// read the saved pricing rules, if any
+func LoadPricing() error {
+	data, err := os.ReadFile(PricingPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read pricing: %v", err)
+	}
+
+	var saved pricingFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse pricing: %v", err)
+	}
+	Pricing.mu.Lock()
+	defer Pricing.mu.Unlock()
+	Pricing.policy = saved.Policy
+	for peerID, count := range saved.Purchases {
+		Pricing.purchases[peerID] = count
+	}
+	return nil
+}
+
+// caller holds p.mu
+func (p *pricer) save() error {
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(pricingFile{Policy: p.policy, Purchases: p.purchases}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pricing: %v", err)
+	}
+	if err := os.WriteFile(PricingPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write pricing: %v", err)
+	}
+	return nil
+}
+
+func (p *pricer) Policy() models.PricingPolicy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.policy
+}
+
+func (p *pricer) SetPolicy(policy models.PricingPolicy) error {
+	if policy.QuoteTTL < 0 {
+		return fmt.Errorf("quote ttl can't be negative")
+	}
+	for _, rule := range policy.Rules {
+		if rule.FileHash != "" && !storage.ValidHash(rule.FileHash) {
+			return fmt.Errorf("rule %q: %w", rule.Name, storage.ErrInvalidHash)
+		}
+		if rule.PeerID != "" {
+			if _, err := peer.Decode(rule.PeerID); err != nil {
+				return fmt.Errorf("rule %q: invalid peer id: %v", rule.Name, err)
+			}
+		}
+		if rule.Fee != nil && *rule.Fee < 0 {
+			return fmt.Errorf("rule %q: fee can't be negative", rule.Name)
+		}
+		if rule.DiscountPercent < 0 || rule.DiscountPercent > 100 {
+			return fmt.Errorf("rule %q: discount must be between 0 and 100 percent", rule.Name)
+		}
+		if rule.Starts != 0 && rule.Ends != 0 && rule.Ends < rule.Starts {
+			return fmt.Errorf("rule %q: ends before it starts", rule.Name)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policy = policy
+	return p.save()
+}
+
+// caller holds p.mu, returns the price and the rule that set it
+func (p *pricer) price(fileHash string, peerID string, base int64, now time.Time) (int64, string) {
+	fee, applied := base, ""
+	for _, rule := range p.policy.Rules {
+		switch {
+		case rule.FileHash != "" && rule.FileHash != fileHash,
+			rule.PeerID != "" && rule.PeerID != peerID,
+			p.purchases[peerID] < rule.MinPurchases,
+			rule.Starts != 0 && now.Unix() < rule.Starts,
+			rule.Ends != 0 && now.Unix() >= rule.Ends:
+			continue
+		}
+		candidate := base * (100 - rule.DiscountPercent) / 100
+		if rule.Fee != nil {
+			candidate = *rule.Fee
+		}
+		if candidate < fee {
+			fee, applied = candidate, rule.Name
+		}
+	}
+	return fee, applied
+}
+
+// the fee we put in our provider entry for the file
+func advertisedFee(fileHash string) (int64, error) {
+	metadata, err := getFileMetadata(fileHash)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrNotForSale, err)
+	}
+	provider, exists := metadata.Providers[PeerID]
+	if !exists || !provider.IsActive {
+		return 0, ErrNotForSale
+	}
+	return provider.Fee, nil
+}
+
+// the signature covers the quote with an empty Signature field
+func quotePayload(quote models.Quote) ([]byte, error) {
+	quote.Signature = ""
+	return json.Marshal(quote)
+}
+
+// Quote prices fileHash for requesterID and signs the offer, it holds until it expires
+func (p *pricer) Quote(fileHash string, requesterID string) (models.Quote, error) {
+	base, err := advertisedFee(fileHash)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	ttl := defaultQuoteTTL
+	if p.policy.QuoteTTL > 0 {
+		ttl = time.Duration(p.policy.QuoteTTL) * time.Second
+	}
+	fee, rule := p.price(fileHash, requesterID, base, now)
+	quote := models.Quote{
+		QuoteID:     uuid.New().String(),
+		FileHash:    fileHash,
+		ProviderID:  PeerID,
+		RequesterID: requesterID,
+		BaseFee:     base,
+		Fee:         fee,
+		Unit:        models.FeeUnit,
+		Rule:        rule,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(ttl).Unix(),
+	}
+	payload, err := quotePayload(quote)
+	if err != nil {
+		return models.Quote{}, err
+	}
+	if quote.Signature, err = signPayload(payload); err != nil {
+		return models.Quote{}, err
+	}
+
+	for id, old := range p.quotes {
+		if now.Unix() >= old.ExpiresAt {
+			delete(p.quotes, id)
+		}
+	}
+	p.quotes[quote.QuoteID] = quote
+	return quote, nil
+}
+
+// feeFor is what a download request costs: the quote it refers to, or our prices right now
+func (p *pricer) feeFor(request models.Transaction) (int64, error) {
+	if request.QuoteID == "" {
+		base, err := advertisedFee(request.FileHash)
+		if err != nil {
+			return 0, err
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		fee, _ := p.price(request.FileHash, request.RequesterID, base, time.Now())
+		return fee, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	quote, exists := p.quotes[request.QuoteID]
+	if !exists || quote.RequesterID != request.RequesterID || quote.FileHash != request.FileHash {
+		return 0, ErrUnknownQuote
+	}
+	if time.Now().Unix() >= quote.ExpiresAt {
+		return 0, ErrQuoteExpired
+	}
+	return quote.Fee, nil
+}
+
+// sold counts a verified payment from peerID towards its bulk pricing
+func (p *pricer) sold(peerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.purchases[peerID]++
+	if err := p.save(); err != nil {
+		log.Info("pricing:", err)
+	}
+}
+
+// RequestQuote asks a provider what fileHash costs us and checks the signed answer
+func RequestQuote(targetID string, fileHash string) (models.Quote, error) {
+	s, err := openStream(targetID, ProtocolQuote)
+	if err != nil {
+		return models.Quote{}, fmt.Errorf("error requesting quote: %v", err)
+	}
+	defer s.Close()
+
+	if err := WriteMessage(s, models.QuoteRequest{FileHash: fileHash}); err != nil {
+		return models.Quote{}, fmt.Errorf("error requesting quote: %v", err)
+	}
+	var response models.QuoteResponse
+	if err := ReadMessage(s, &response); err != nil {
+		return models.Quote{}, err
+	}
+	if response.Status != "quoted" {
+		return models.Quote{}, fmt.Errorf("quote declined: %s", response.Message)
+	}
+
+	quote := response.Quote
+	if quote.ProviderID != targetID || quote.RequesterID != PeerID || quote.FileHash != fileHash {
+		return models.Quote{}, fmt.Errorf("%w: quote is for someone else", ErrBadQuote)
+	}
+	if time.Now().Unix() >= quote.ExpiresAt {
+		return models.Quote{}, ErrQuoteExpired
+	}
+	payload, err := quotePayload(quote)
+	if err != nil {
+		return models.Quote{}, err
+	}
+	if err := verifyPayload(targetID, payload, quote.Signature); err != nil {
+		return models.Quote{}, fmt.Errorf("%w: %v", ErrBadQuote, err)
+	}
+	return quote, nil
+}
+
+func receiveQuoteRequest(node host.Host) {
+	handleProtocol(node, ProtocolQuote, func(s network.Stream) {
+		defer s.Close()
+
+		var request models.QuoteRequest
+		if err := ReadMessage(s, &request); err != nil {
+			rejectStream(s, err)
+			return
+		}
+
+		remotePeer := s.Conn().RemotePeer().String()
+		response := models.QuoteResponse{Status: "declined"}
+		FileMapMutex.Lock()
+		available := FileHashToPath[request.FileHash] != ""
+		FileMapMutex.Unlock()
+		if Reputation.IsBlocked(remotePeer) {
+			response.Message = "requester is blocked"
+		} else if err := Moderation.CheckRequest(remotePeer, request.FileHash); err != nil {
+			response.Message = err.Error()
+		} else if !available {
+			response.Message = ErrNotForSale.Error()
+		} else if quote, err := Pricing.Quote(request.FileHash, remotePeer); err != nil {
+			response.Message = err.Error()
+		} else {
+			response.Status, response.Quote = "quoted", quote
+			log.Infof("quoted %d %s for %s to %s", quote.Fee, quote.Unit, quote.FileHash, remotePeer)
+		}
+
+		if err := WriteMessage(s, response); err != nil {
+			log.Info("receiveQuoteRequest:", messageError(s, err))
+		}
+	})
+}
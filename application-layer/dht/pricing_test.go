@@ -0,0 +1,111 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// go test -v -run ^TestQuotes$ -count=1 application-layer/dht
+func TestQuotes(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	requester, provider := net.Nodes[1], net.Nodes[2]
+	file := net.addFile("priced.txt", []byte("worth ten"), 10)
+	if _, err := UpdateFileInDHT(file); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	two := int64(2)
+	free := int64(0)
+	now := time.Now().Unix()
+	err := Pricing.SetPolicy(models.PricingPolicy{Rules: []models.PricingRule{
+		{Name: "launch", DiscountPercent: 50, Ends: now + 3600},
+		{Name: "loyal", PeerID: requester.ID(), MinPurchases: 1, Fee: &two},
+		{Name: "last week", Starts: now - 7200, Ends: now - 3600, Fee: &free},
+	}})
+	if err != nil {
+		t.Fatalf("failed to set pricing: %v", err)
+	}
+	if err := Pricing.SetPolicy(models.PricingPolicy{Rules: []models.PricingRule{{DiscountPercent: 120}}}); err == nil {
+		t.Errorf("discount over 100 percent was accepted")
+	}
+
+	askForQuote := func() models.Quote {
+		t.Helper()
+		s, err := requester.Host.NewStream(net.ctx, Host.ID(), ProtocolQuote)
+		if err != nil {
+			t.Fatalf("failed to open quote stream: %v", err)
+		}
+		defer s.Close()
+		WriteMessage(s, models.QuoteRequest{FileHash: file.Hash})
+		var response models.QuoteResponse
+		if err := ReadMessage(s, &response); err != nil || response.Status != "quoted" {
+			t.Fatalf("quote: got %+v, %v", response, err)
+		}
+		return response.Quote
+	}
+
+	quote := askForQuote()
+	if quote.BaseFee != 10 || quote.Fee != 5 || quote.Rule != "launch" || quote.RequesterID != requester.ID() {
+		t.Errorf("quote = %+v, want 5 from the launch discount", quote)
+	}
+	payload, _ := quotePayload(quote)
+	if err := verifyPayload(PeerID, payload, quote.Signature); err != nil {
+		t.Errorf("quote signature: %v", err)
+	}
+
+	// the quote sets the fee whatever the requester claims, so do our prices when there is none
+	request := func(transactionID string, quoteID string) models.Transaction {
+		return models.Transaction{Type: "request", TransactionID: transactionID, FileHash: file.Hash, RequesterID: requester.ID(), TargetID: PeerID, QuoteID: quoteID}
+	}
+	if d := net.requestFile(requester, file, "q0"); d.Transaction.Fee != 5 {
+		t.Errorf("unquoted download fee = %d, want 5", d.Transaction.Fee)
+	}
+	if d, decline := net.download(requester, request("q1", quote.QuoteID)); decline != nil || d.Transaction.Fee != 5 {
+		t.Errorf("quoted download: fee %d, decline %+v", d.Transaction.Fee, decline)
+	}
+	if _, decline := net.download(requester, request("q2", "made-up")); decline == nil || decline.Message != ErrUnknownQuote.Error() {
+		t.Errorf("unknown quote: got %+v", decline)
+	}
+
+	// a paying customer gets its bulk price, quotes already out keep theirs until they expire
+	Pricing.sold(requester.ID())
+	if loyal := askForQuote(); loyal.Fee != 2 || loyal.Rule != "loyal" {
+		t.Errorf("quote after a purchase = %+v, want 2", loyal)
+	}
+	Pricing.mu.Lock()
+	expired := Pricing.quotes[quote.QuoteID]
+	expired.ExpiresAt = now - 1
+	Pricing.quotes[quote.QuoteID] = expired
+	Pricing.mu.Unlock()
+	if _, decline := net.download(requester, request("q3", quote.QuoteID)); decline == nil || decline.Message != ErrQuoteExpired.Error() {
+		t.Errorf("expired quote: got %+v", decline)
+	}
+
+	// quotes we ask for are checked against the provider's key
+	tamper := false
+	net.handle(provider, ProtocolQuote, func(s network.Stream) {
+		defer s.Close()
+		var request models.QuoteRequest
+		ReadMessage(s, &request)
+		quote := models.Quote{QuoteID: "p1", FileHash: request.FileHash, ProviderID: provider.ID(), RequesterID: PeerID, Fee: 7, ExpiresAt: time.Now().Add(time.Minute).Unix()}
+		payload, _ := quotePayload(quote)
+		signature, _ := provider.Host.Peerstore().PrivKey(provider.Host.ID()).Sign(payload)
+		quote.Signature = hex.EncodeToString(signature)
+		if tamper {
+			quote.Fee = 1
+		}
+		WriteMessage(s, models.QuoteResponse{Status: "quoted", Quote: quote})
+	})
+	if got, err := RequestQuote(provider.ID(), file.Hash); err != nil || got.Fee != 7 {
+		t.Errorf("requested quote = %+v, %v", got, err)
+	}
+	tamper = true
+	if _, err := RequestQuote(provider.ID(), file.Hash); !errors.Is(err, ErrBadQuote) {
+		t.Errorf("tampered quote: got %v", err)
+	}
+}
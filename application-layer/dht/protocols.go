@@ -0,0 +1,222 @@
+package dht_kad
+
+import (
+	"application-layer/metrics"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// protocols spoken between our own nodes, versioned as /orcanet/<name>/<semver>
+// bump the minor version for compatible additions and the major version when old peers can't follow anymore
+// streams on the versioned ids use framed messages, the unversioned ids older clients registered
+// are still served so both can talk during an upgrade
+// protocols of the cloud node and relay (/nodeFiles/p2p, /marketplaceFiles/p2p, ...) belong to those services and stay as they are
+var (
+	ProtocolDownloadRequest = registerProtocol("request", "1.0.0", "/sendRequest/p2p")
+	ProtocolResponse        = registerProtocol("response", "1.0.0", "/requestResponse/p2p") // declines and download confirmations
+	ProtocolFile            = registerProtocol("file", "1.0.0", "/sendFile/p2p")
+	ProtocolQueuePosition   = registerProtocol("queue", "1.0.0", "/queuePosition/p2p")
+	ProtocolTransferKey     = registerProtocol("key", "1.0.0", "")
+	ProtocolHistory         = registerProtocol("history", "1.0.0", "/history/p2p")
+	ProtocolReputation      = registerProtocol("reputation", "1.0.0", "") // signed reports about other peers
+	ProtocolTakedown        = registerProtocol("takedown", "1.0.0", "")   // signed takedown notices for files
+	ProtocolQuote           = registerProtocol("quote", "1.0.0", "")      // signed, expiring prices for a download
+	ProtocolInvoice         = registerProtocol("invoice", "1.0.0", "")    // invoices for what isn't a download, e.g. proxy sessions
+	ProtocolChunkTree       = registerProtocol("chunks", "1.0.0", "")     // chunk hashes of bundle members, checked as the member arrives
+)
+
+var ErrUnsupportedProtocol = errors.New("peer does not support protocol")
+
+type protocolInfo struct {
+	ID     protocol.ID
+	Legacy protocol.ID // "" when the protocol never existed unversioned
+}
+
+var (
+	protocolRegistry = make(map[protocol.ID]protocolInfo) // keyed by versioned id
+	legacyProtocols  = make(map[protocol.ID]bool)
+	registryMu       sync.RWMutex
+)
+
+func registerProtocol(name string, version string, legacy protocol.ID) protocol.ID {
+	id := protocol.ID(fmt.Sprintf("/orcanet/%s/%s", name, version))
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	protocolRegistry[id] = protocolInfo{ID: id, Legacy: legacy}
+	if legacy != "" {
+		legacyProtocols[legacy] = true
+	}
+	return id
+}
+
+func isLegacyProtocol(id protocol.ID) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return legacyProtocols[id]
+}
+
+// handleProtocol serves id and, if it has one, its unversioned predecessor with the same handler
+func handleProtocol(node host.Host, id protocol.ID, handler network.StreamHandler) {
+	registryMu.RLock()
+	info, exists := protocolRegistry[id]
+	registryMu.RUnlock()
+	if !exists {
+		panic(fmt.Sprintf("protocol %s is not registered", id))
+	}
+
+	handler = meterHandler(info.ID, handler)
+	node.SetStreamHandler(info.ID, handler)
+	if info.Legacy != "" {
+		node.SetStreamHandler(info.Legacy, handler)
+	}
+}
+
+// openStream opens a stream for a registered protocol, falling back to the unversioned id for older peers
+func openStream(targetPeerID string, id protocol.ID) (network.Stream, error) {
+	registryMu.RLock()
+	info, exists := protocolRegistry[id]
+	registryMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("protocol %s is not registered", id)
+	}
+
+	candidates := []protocol.ID{info.ID}
+	if info.Legacy != "" {
+		candidates = append(candidates, info.Legacy)
+	}
+
+	// identify tells us what the peer speaks once we've been connected, no need to try a dead end
+	if supported, known := peerSupports(targetPeerID, candidates...); known && !supported {
+		return nil, fmt.Errorf("%w: %s does not speak %s", ErrUnsupportedProtocol, targetPeerID, id)
+	}
+	s, err := CreateNewStream(DHT.Host(), targetPeerID, candidates...)
+	if err != nil {
+		metrics.StreamError(string(id), "outbound")
+		return nil, err
+	}
+	return meterStream(s, id, "outbound"), nil
+}
+
+// peerSupports reports whether the peer advertised any of ids, known is false until identify has run
+func peerSupports(targetPeerID string, ids ...protocol.ID) (supported bool, known bool) {
+	if DHT == nil {
+		return false, false
+	}
+	pid, err := peer.Decode(targetPeerID)
+	if err != nil {
+		return false, false
+	}
+	peerstore := DHT.Host().Peerstore()
+	all, err := peerstore.GetProtocols(pid)
+	if err != nil || len(all) == 0 {
+		return false, false
+	}
+	matched, err := peerstore.SupportsProtocols(pid, ids...)
+	if err != nil {
+		return false, false
+	}
+	return len(matched) > 0, true
+}
+
+// SupportsProtocol is peerSupports for a single registered protocol, counting its unversioned id as well
+func SupportsProtocol(targetPeerID string, id protocol.ID) (supported bool, known bool) {
+	registryMu.RLock()
+	info := protocolRegistry[id]
+	registryMu.RUnlock()
+	if info.Legacy != "" {
+		return peerSupports(targetPeerID, id, info.Legacy)
+	}
+	return peerSupports(targetPeerID, id)
+}
+
+// PeerCapabilities lists which of our protocols a peer speaks and in which version, as learned through identify
+func PeerCapabilities(targetPeerID string) (map[string]string, error) {
+	pid, err := peer.Decode(targetPeerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer id: %v", err)
+	}
+	if DHT == nil {
+		return nil, fmt.Errorf("dht not started")
+	}
+	spoken, err := DHT.Host().Peerstore().GetProtocols(pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer protocols: %v", err)
+	}
+	if len(spoken) == 0 {
+		return nil, fmt.Errorf("nothing known about %s yet, connect to it first", targetPeerID)
+	}
+	speaks := make(map[protocol.ID]bool)
+	for _, id := range spoken {
+		speaks[id] = true
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	capabilities := make(map[string]string)
+	for id, info := range protocolRegistry {
+		switch {
+		case speaks[id]:
+			capabilities[string(id)] = "supported"
+		case info.Legacy != "" && speaks[info.Legacy]:
+			capabilities[string(id)] = "legacy"
+		default:
+			capabilities[string(id)] = "unsupported"
+		}
+	}
+	return capabilities, nil
+}
+
+// RegisteredProtocols lists the versioned protocols this node speaks
+func RegisteredProtocols() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var ids []string
+	for id := range protocolRegistry {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// older clients send a single json object ended by a newline or by closing the stream
+func readLegacyMessage(s network.Stream) ([]byte, error) {
+	s.SetReadDeadline(time.Now().Add(messageTimeout))
+	defer s.SetReadDeadline(time.Time{})
+
+	// byte by byte so nothing after the message (like file content) is consumed
+	var data []byte
+	b := make([]byte, 1)
+	for {
+		n, err := s.Read(b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, messageError(s, streamError(err))
+		}
+		if n == 0 {
+			continue
+		}
+		if b[0] == '\n' {
+			break
+		}
+		data = append(data, b[0])
+		if len(data) > maxMessageSize {
+			return nil, messageError(s, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, maxMessageSize))
+		}
+	}
+	if len(data) == 0 {
+		return nil, messageError(s, ErrStreamClosed)
+	}
+	return data, nil
+}
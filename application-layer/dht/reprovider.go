@@ -0,0 +1,293 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// provider records expire after 48h and values after 36h, refresh well before either
+	reprovideInterval = 12 * time.Hour
+	// each file's next refresh is moved by up to this fraction of the interval so they don't all line up
+	reprovideJitter = 0.1
+	// how often the scheduler looks for files that are due
+	reprovideTick = time.Minute
+	// files refreshed at the same time, and the pause between batches
+	reprovideBatchSize  = 10
+	reprovideBatchPause = 2 * time.Second
+	// a failed refresh is retried after this, doubling with every failure up to reprovideInterval
+	reprovideRetry = 5 * time.Minute
+)
+
+var Reprovider = newReprovider()
+
+type reprovideEntry struct {
+	record models.ReprovideRecord
+	file   models.FileMetadata
+	next   time.Time
+}
+
+// reprovider keeps our provider records and file metadata alive in the dht
+type reprovider struct {
+	mu            sync.Mutex
+	entries       map[string]*reprovideEntry // keyed by file hash
+	publish       func(models.FileMetadata) error
+	running       bool
+	lastRun       time.Time
+	totalRuns     int64
+	totalFailures int64
+	trigger       chan struct{}
+}
+
+func newReprovider() *reprovider {
+	rp := &reprovider{
+		entries: make(map[string]*reprovideEntry),
+		trigger: make(chan struct{}, 1),
+	}
+	rp.publish = rp.refreshFile
+	return rp
+}
+
+// SetPublisher replaces the function used to refresh a file, e.g. one that also restores its content
+func (rp *reprovider) SetPublisher(publish func(models.FileMetadata) error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.publish = publish
+}
+
+// default refresh when no publisher is set - re-put the metadata, provide the key and map the blob
+func (rp *reprovider) refreshFile(file models.FileMetadata) error {
+	dhtMetadata, err := UpdateFileInDHT(file)
+	if err != nil {
+		return err
+	}
+	if storage.Blobs.Has(file.Hash) {
+		blobPath, _ := storage.Blobs.Path(file.Hash)
+		FileMapMutex.Lock()
+		FileHashToPath[file.Hash] = blobPath
+		FileMapMutex.Unlock()
+	}
+	return SendCloudNodeFiles(dhtMetadata)
+}
+
+// MarkProvided records a publish done outside the reprovider so the file isn't refreshed again straight away
+func (rp *reprovider) MarkProvided(file models.FileMetadata) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	entry := rp.entry(file)
+	now := time.Now()
+	entry.record.LastAttempt = now.Format("2006-01-02 15:04:05")
+	entry.record.LastSuccess = entry.record.LastAttempt
+	entry.record.Failures = 0
+	entry.record.LastError = ""
+	entry.next = now.Add(jittered(reprovideInterval))
+	entry.record.NextRun = entry.next.Format("2006-01-02 15:04:05")
+}
+
+// Forget stops refreshing a file, e.g. after it was deleted
+func (rp *reprovider) Forget(hash string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	delete(rp.entries, hash)
+}
+
+// Trigger refreshes every file now instead of waiting for its turn
+func (rp *reprovider) Trigger() {
+	rp.mu.Lock()
+	for _, entry := range rp.entries {
+		entry.next = time.Time{}
+	}
+	rp.mu.Unlock()
+
+	select {
+	case rp.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (rp *reprovider) Status() models.ReproviderStatus {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	status := models.ReproviderStatus{
+		Running:       rp.running,
+		TotalRuns:     rp.totalRuns,
+		TotalFailures: rp.totalFailures,
+		Files:         []models.ReprovideRecord{},
+	}
+	if !rp.lastRun.IsZero() {
+		status.LastRun = rp.lastRun.Format("2006-01-02 15:04:05")
+	}
+	for _, entry := range rp.entries {
+		status.Files = append(status.Files, entry.record)
+	}
+	sort.Slice(status.Files, func(i, j int) bool { return status.Files[i].Name < status.Files[j].Name })
+	return status
+}
+
+// caller holds rp.mu
+func (rp *reprovider) entry(file models.FileMetadata) *reprovideEntry {
+	entry, exists := rp.entries[file.Hash]
+	if !exists {
+		entry = &reprovideEntry{record: models.ReprovideRecord{Hash: file.Hash}}
+		rp.entries[file.Hash] = entry
+	}
+	entry.file = file
+	entry.record.Name = file.NameWithExtension
+	return entry
+}
+
+// run refreshes due files in batches until the node shuts down
+// files seen for the first time are due immediately, which republishes everything on start up
+func (rp *reprovider) run() {
+	ticker := time.NewTicker(reprovideTick)
+	defer ticker.Stop()
+
+	for {
+		rp.reprovideDue()
+
+		select {
+		case <-GlobalCtx.Done():
+			return
+		case <-ticker.C:
+		case <-rp.trigger:
+		}
+	}
+}
+
+func (rp *reprovider) reprovideDue() {
+	files, err := loadProvidedFiles()
+	if err != nil {
+		log.Info("reprovider:", err)
+		return
+	}
+
+	now := time.Now()
+	rp.mu.Lock()
+	seen := make(map[string]bool)
+	var due []models.FileMetadata
+	for _, file := range files {
+		if seen[file.Hash] {
+			continue
+		}
+		seen[file.Hash] = true
+		entry := rp.entry(file)
+		if !entry.next.After(now) {
+			due = append(due, file)
+		}
+	}
+	// files removed from the json files are no longer ours to provide
+	for hash := range rp.entries {
+		if !seen[hash] {
+			delete(rp.entries, hash)
+		}
+	}
+	if len(due) == 0 {
+		rp.mu.Unlock()
+		return
+	}
+	rp.running = true
+	publish := rp.publish
+	rp.mu.Unlock()
+
+	defer func() {
+		rp.mu.Lock()
+		rp.running = false
+		rp.lastRun = time.Now()
+		rp.totalRuns++
+		rp.mu.Unlock()
+	}()
+
+	log.Infof("reprovider: refreshing %d files", len(due))
+	for start := 0; start < len(due); start += reprovideBatchSize {
+		end := start + reprovideBatchSize
+		if end > len(due) {
+			end = len(due)
+		}
+
+		var wg sync.WaitGroup
+		for _, file := range due[start:end] {
+			wg.Add(1)
+			go func(file models.FileMetadata) {
+				defer wg.Done()
+				rp.record(file, publish(file))
+			}(file)
+		}
+		wg.Wait()
+
+		if end < len(due) {
+			select {
+			case <-GlobalCtx.Done():
+				return
+			case <-time.After(reprovideBatchPause):
+			}
+		}
+	}
+}
+
+func (rp *reprovider) record(file models.FileMetadata, err error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	entry := rp.entry(file)
+	now := time.Now()
+	entry.record.LastAttempt = now.Format("2006-01-02 15:04:05")
+	if err != nil {
+		log.Errorf("reprovider: failed to refresh %s: %v", file.Hash, err)
+		rp.totalFailures++
+		entry.record.Failures++
+		entry.record.LastError = err.Error()
+		backoff := reprovideRetry << uint(entry.record.Failures-1)
+		if backoff <= 0 || backoff > reprovideInterval {
+			backoff = reprovideInterval
+		}
+		entry.next = now.Add(jittered(backoff))
+	} else {
+		entry.record.LastSuccess = entry.record.LastAttempt
+		entry.record.Failures = 0
+		entry.record.LastError = ""
+		entry.next = now.Add(jittered(reprovideInterval))
+	}
+	entry.record.NextRun = entry.next.Format("2006-01-02 15:04:05")
+}
+
+func jittered(d time.Duration) time.Duration {
+	spread := float64(d) * reprovideJitter
+	return d + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// every file we uploaded or downloaded, both are advertised with IsActive set from IsPublished
+func loadProvidedFiles() ([]models.FileMetadata, error) {
+	var all []models.FileMetadata
+	for _, filePath := range []string{UploadedFilePath, DownloadedFilePath} {
+		files, err := loadFileList(filePath)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, files...)
+	}
+	return all, nil
+}
+
+// read files.json or downloadedFiles.json, a missing file is an empty list
+func loadFileList(filePath string) ([]models.FileMetadata, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %v", filePath, err)
+	}
+	var files []models.FileMetadata
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filePath, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,387 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// things that happen between us and another peer, recorded by the download and upload paths
+const (
+	eventSuccess         = "success"          // a download from the peer completed and verified
+	eventDecline         = "decline"          // the peer declined our download request
+	eventCorrupt         = "corrupt"          // the peer sent content that doesn't match its hash
+	eventFailedDelivery  = "failed delivery"  // the peer stalled, or took payment and never released the key
+	eventVerifiedPayment = "verified payment" // the peer paid us and the payment checked out on chain
+)
+
+const (
+	// a gossiped report counts this much of something we saw ourselves
+	gossipWeight = 0.25
+	// reports older than this are dropped, so old ones can't be replayed
+	reportMaxAge = 24 * time.Hour
+)
+
+var (
+	ReputationPath = filepath.Join(dirPath, "reputation.json")
+	Reputation     = newReputationStore()
+)
+
+type reputationFile struct {
+	Settings models.ReputationSettings `json:"Settings"`
+	Peers    []models.PeerReputation   `json:"Peers"`
+}
+
+// reputationStore keeps what we know about other peers, as providers and as requesters
+type reputationStore struct {
+	mu       sync.Mutex
+	peers    map[string]*models.PeerReputation // keyed by peer id
+	settings models.ReputationSettings
+	seen     map[string]time.Time // reporter, subject and sign of gossip already counted, until reportMaxAge has passed
+}
+
+func newReputationStore() *reputationStore {
+	return &reputationStore{
+		peers: make(map[string]*models.PeerReputation),
+		seen:  make(map[string]time.Time),
+	}
+}
+
+// read the saved reputations, if any, so scores and blocks survive restarts
+func LoadReputation() error {
+	data, err := os.ReadFile(ReputationPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read reputation store: %v", err)
+	}
+
+	var saved reputationFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse reputation store: %v", err)
+	}
+
+	Reputation.mu.Lock()
+	defer Reputation.mu.Unlock()
+	Reputation.settings = saved.Settings
+	Reputation.peers = make(map[string]*models.PeerReputation)
+	for i := range saved.Peers {
+		Reputation.peers[saved.Peers[i].PeerID] = &saved.Peers[i]
+	}
+	return nil
+}
+
+// caller holds rs.mu
+func (rs *reputationStore) save() error {
+	saved := reputationFile{Settings: rs.settings, Peers: []models.PeerReputation{}}
+	for _, rep := range rs.peers {
+		saved.Peers = append(saved.Peers, *rep)
+	}
+	sort.Slice(saved.Peers, func(i, j int) bool { return saved.Peers[i].PeerID < saved.Peers[j].PeerID })
+
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal reputation store: %v", err)
+	}
+	if err := os.WriteFile(ReputationPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write reputation store: %v", err)
+	}
+	return nil
+}
+
+// caller holds rs.mu
+func (rs *reputationStore) peer(peerID string) *models.PeerReputation {
+	rep, exists := rs.peers[peerID]
+	if !exists {
+		rep = &models.PeerReputation{PeerID: peerID, Score: 0.5}
+		rs.peers[peerID] = rep
+	}
+	return rep
+}
+
+// score starts at 0.5 for a stranger and moves with every experience,
+// a corrupt file or a payment taken for nothing weighs far more than a decline
+func score(rep *models.PeerReputation) float64 {
+	good := 1 + float64(rep.SuccessfulDownloads) + float64(rep.VerifiedPayments) + gossipWeight*float64(rep.GossipPositive)
+	bad := 1 + 0.5*float64(rep.Declines) + 3*float64(rep.CorruptDeliveries) + 2*float64(rep.FailedDeliveries) + gossipWeight*float64(rep.GossipNegative)
+	return good / (good + bad)
+}
+
+func (rs *reputationStore) Get(peerID string) models.PeerReputation {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rep, exists := rs.peers[peerID]; exists {
+		return *rep
+	}
+	return models.PeerReputation{PeerID: peerID, Score: 0.5}
+}
+
+// List returns every peer we have an opinion about, best first
+func (rs *reputationStore) List() []models.PeerReputation {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	list := []models.PeerReputation{}
+	for _, rep := range rs.peers {
+		list = append(list, *rep)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Score > list[j].Score })
+	return list
+}
+
+func (rs *reputationStore) Settings() models.ReputationSettings {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.settings
+}
+
+func (rs *reputationStore) SetSettings(settings models.ReputationSettings) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.settings = settings
+	return rs.save()
+}
+
+// Block stops us from downloading from the peer, serving it, or listening to its reports
+func (rs *reputationStore) Block(peerID string, reason string) error {
+	if _, err := peer.Decode(peerID); err != nil {
+		return fmt.Errorf("invalid peer id: %v", err)
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rep := rs.peer(peerID)
+	rep.Blocked = true
+	rep.BlockReason = reason
+	return rs.save()
+}
+
+func (rs *reputationStore) Unblock(peerID string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rep, exists := rs.peers[peerID]
+	if !exists || !rep.Blocked {
+		return fmt.Errorf("peer %s is not blocked", peerID)
+	}
+	rep.Blocked = false
+	rep.BlockReason = ""
+	return rs.save()
+}
+
+func (rs *reputationStore) IsBlocked(peerID string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rep, exists := rs.peers[peerID]
+	return exists && rep.Blocked
+}
+
+// record applies one of our own experiences with a peer and, if enabled, tells our other peers about it
+// elapsed is how long a successful download took to arrive, 0 when unknown
+func (rs *reputationStore) record(peerID string, event string, transactionID string, bytes int64, elapsed time.Duration) {
+	if peerID == "" || peerID == PeerID {
+		return
+	}
+
+	rs.mu.Lock()
+	rep := rs.peer(peerID)
+	switch event {
+	case eventSuccess:
+		rep.SuccessfulDownloads++
+		rep.BytesReceived += bytes
+		if elapsed > 0 {
+			sample := float64(bytes) / elapsed.Seconds()
+			if rep.Throughput == 0 {
+				rep.Throughput = sample
+			} else {
+				rep.Throughput = speedSmoothing*sample + (1-speedSmoothing)*rep.Throughput
+			}
+		}
+	case eventDecline:
+		rep.Declines++
+	case eventCorrupt:
+		rep.CorruptDeliveries++
+	case eventFailedDelivery:
+		rep.FailedDeliveries++
+	case eventVerifiedPayment:
+		rep.VerifiedPayments++
+	}
+	rep.Score = score(rep)
+	rep.LastSeen = time.Now().Format("2006-01-02 15:04:05")
+	if err := rs.save(); err != nil {
+		log.Info("reputation:", err)
+	}
+	gossip := rs.settings.GossipReports
+	rs.mu.Unlock()
+
+	log.Infof("reputation: %s %s (transaction %s)", peerID, event, transactionID)
+
+	// a decline is a normal answer, only gossip what tells others something about the peer
+	if gossip && event != eventDecline {
+		gossipReport(models.ReputationReport{
+			Reporter:      PeerID,
+			Subject:       peerID,
+			Event:         event,
+			TransactionID: transactionID,
+			Timestamp:     time.Now().Unix(),
+		})
+	}
+}
+
+// RankProviders orders the active providers of a file by reputation, then throughput, then fee
+// blocked peers and ourselves are left out
+func (rs *reputationStore) RankProviders(providers map[string]models.Provider) []models.RankedProvider {
+	rs.mu.Lock()
+	ranked := []models.RankedProvider{}
+	for peerID, provider := range providers {
+		if !provider.IsActive || peerID == PeerID {
+			continue
+		}
+		rep := models.PeerReputation{PeerID: peerID, Score: 0.5}
+		if known, exists := rs.peers[peerID]; exists {
+			if known.Blocked {
+				continue
+			}
+			rep = *known
+		}
+		ranked = append(ranked, models.RankedProvider{PeerID: peerID, Provider: provider, Reputation: rep})
+	}
+	rs.mu.Unlock()
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Reputation.Score != b.Reputation.Score {
+			return a.Reputation.Score > b.Reputation.Score
+		}
+		if a.Reputation.Throughput != b.Reputation.Throughput {
+			return a.Reputation.Throughput > b.Reputation.Throughput
+		}
+		if a.Provider.Fee != b.Provider.Fee {
+			return a.Provider.Fee < b.Provider.Fee
+		}
+		return a.PeerID < b.PeerID
+	})
+	return ranked
+}
+
+// ProvidersForFile looks the file up in the dht and ranks its providers
+func ProvidersForFile(fileHash string) ([]models.RankedProvider, error) {
+	data, err := GetValue(GlobalCtx, "/orcanet/"+fileHash)
+	if err != nil {
+		return nil, fmt.Errorf("file %s not found in dht: %v", fileHash, err)
+	}
+	var metadata models.DHTMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode file metadata: %v", err)
+	}
+	return Reputation.RankProviders(metadata.Providers), nil
+}
+
+// the signature covers the report with an empty Signature field
+func reportPayload(report models.ReputationReport) ([]byte, error) {
+	report.Signature = ""
+	return json.Marshal(report)
+}
+
+func signReport(report *models.ReputationReport) error {
+	payload, err := reportPayload(*report)
+	if err != nil {
+		return err
+	}
+	report.Signature, err = signPayload(payload)
+	return err
+}
+
+func verifyReport(report models.ReputationReport) error {
+	payload, err := reportPayload(report)
+	if err != nil {
+		return err
+	}
+	return verifyPayload(report.Reporter, payload, report.Signature)
+}
+
+// send a signed report to every connected peer that takes them, except the one it is about
+func gossipReport(report models.ReputationReport) {
+	if err := signReport(&report); err != nil {
+		log.Info("reputation: not gossiping report:", err)
+		return
+	}
+	go broadcast(DHT.Host(), ProtocolReputation, report, report.Subject)
+}
+
+// acceptReport counts a report gossiped to us by from, if we take reports at all
+func (rs *reputationStore) acceptReport(report models.ReputationReport, from string) error {
+	if report.Reporter != from {
+		return fmt.Errorf("%w: report signed by %s relayed by %s", ErrMalformedMessage, report.Reporter, from)
+	}
+	age := time.Since(time.Unix(report.Timestamp, 0))
+	if age > reportMaxAge || age < -time.Minute {
+		return fmt.Errorf("%w: report from %s is too old or in the future", ErrMalformedMessage, from)
+	}
+	if err := verifyReport(report); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+
+	positive := report.Event == eventSuccess || report.Event == eventVerifiedPayment
+	negative := report.Event == eventCorrupt || report.Event == eventFailedDelivery
+	if !positive && !negative {
+		return fmt.Errorf("%w: unknown event %q", ErrMalformedMessage, report.Event)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	// what others say about us isn't for us to count
+	if !rs.settings.AcceptReports || report.Subject == PeerID {
+		return nil
+	}
+	if reporter, exists := rs.peers[report.Reporter]; exists && reporter.Blocked {
+		return nil
+	}
+	// the reporter makes up the transaction id, so it can't tell reports apart: each reporter
+	// gets one good and one bad word about a subject per reportMaxAge, however many it sends
+	for oldKey, at := range rs.seen {
+		if time.Since(at) > reportMaxAge {
+			delete(rs.seen, oldKey)
+		}
+	}
+	key := report.Reporter + "/" + report.Subject + "/" + strconv.FormatBool(positive)
+	if _, counted := rs.seen[key]; counted {
+		return nil
+	}
+	rs.seen[key] = time.Now()
+
+	rep := rs.peer(report.Subject)
+	if positive {
+		rep.GossipPositive++
+	} else {
+		rep.GossipNegative++
+	}
+	rep.Score = score(rep)
+	return rs.save()
+}
+
+func receiveReputationReport(node host.Host) {
+	handleProtocol(node, ProtocolReputation, func(s network.Stream) {
+		defer s.Close()
+
+		var report models.ReputationReport
+		if err := ReadMessage(s, &report); err != nil {
+			rejectStream(s, err)
+			return
+		}
+		if err := Reputation.acceptReport(report, s.Conn().RemotePeer().String()); err != nil {
+			rejectStream(s, messageError(s, err))
+		}
+	})
+}
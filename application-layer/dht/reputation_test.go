@@ -0,0 +1,188 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// go test -v -run ^TestReputation$ -count=1 application-layer/dht
+func TestReputation(t *testing.T) {
+	net := newTestNetwork(t, 4)
+	observer, badProvider, other := net.Nodes[1], net.Nodes[2], net.Nodes[3]
+
+	// our own experiences are gossiped, signed, to everyone but the peer they are about
+	if err := Reputation.SetSettings(models.ReputationSettings{GossipReports: true, AcceptReports: true}); err != nil {
+		t.Fatalf("failed to enable gossip: %v", err)
+	}
+	reports := make(chan models.ReputationReport, 4)
+	for _, node := range []*testNode{observer, badProvider} {
+		net.handle(node, ProtocolReputation, func(s network.Stream) {
+			defer s.Close()
+			var report models.ReputationReport
+			if err := ReadMessage(s, &report); err == nil {
+				reports <- report
+			}
+		})
+	}
+	Reputation.record(badProvider.ID(), eventCorrupt, "t1", 0, 0)
+
+	select {
+	case report := <-reports:
+		if report.Subject != badProvider.ID() || report.Event != eventCorrupt {
+			t.Errorf("gossiped report = %+v", report)
+		}
+		if err := verifyReport(report); err != nil {
+			t.Errorf("gossiped report doesn't verify: %v", err)
+		}
+		report.Event = eventSuccess
+		if verifyReport(report) == nil {
+			t.Errorf("tampered report verified")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no report gossiped")
+	}
+	select {
+	case report := <-reports:
+		t.Errorf("unexpected second report %+v", report)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// reports from others count once, and only when signed by the peer sending them
+	report := models.ReputationReport{Reporter: observer.ID(), Subject: other.ID(), Event: eventFailedDelivery, TransactionID: "t2", Timestamp: time.Now().Unix()}
+	signAs(t, observer, &report)
+	for i := 0; i < 2; i++ {
+		if err := Reputation.acceptReport(report, observer.ID()); err != nil {
+			t.Fatalf("report rejected: %v", err)
+		}
+	}
+	// nor do made up transaction ids and other bad events
+	for i, event := range []string{eventCorrupt, eventFailedDelivery} {
+		more := models.ReputationReport{Reporter: observer.ID(), Subject: other.ID(), Event: event, TransactionID: fmt.Sprintf("t%d", i+3), Timestamp: time.Now().Unix()}
+		signAs(t, observer, &more)
+		if err := Reputation.acceptReport(more, observer.ID()); err != nil {
+			t.Fatalf("report rejected: %v", err)
+		}
+	}
+	if rep := Reputation.Get(other.ID()); rep.GossipNegative != 1 {
+		t.Errorf("gossip negative = %d, want 1", rep.GossipNegative)
+	}
+	if err := Reputation.acceptReport(report, badProvider.ID()); err == nil {
+		t.Errorf("report relayed by another peer was accepted")
+	}
+
+	// providers are ranked by what we know of them, blocked ones are left out
+	stranger := "12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"
+	if err := Reputation.Block(observer.ID(), "spam"); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+	ranked := Reputation.RankProviders(map[string]models.Provider{
+		observer.ID():    {IsActive: true},
+		badProvider.ID(): {IsActive: true},
+		other.ID():       {IsActive: true},
+		stranger:         {IsActive: true},
+	})
+	var order []string
+	for _, provider := range ranked {
+		order = append(order, provider.PeerID)
+	}
+	if len(order) != 3 || order[0] != stranger || order[1] != other.ID() || order[2] != badProvider.ID() {
+		t.Errorf("ranking = %v, want stranger, %s, %s", order, other.ID(), badProvider.ID())
+	}
+
+	// and a blocked peer can't download from us
+	declines := make(chan models.Transaction, 1)
+	net.handle(observer, ProtocolResponse, func(s network.Stream) {
+		defer s.Close()
+		var decline models.Transaction
+		if err := ReadMessage(s, &decline); err == nil {
+			declines <- decline
+		}
+	})
+	file := net.addFile("blocked.txt", []byte("not for blocked peers"), 0)
+	requestStream, err := observer.Host.NewStream(net.ctx, Host.ID(), ProtocolDownloadRequest)
+	if err != nil {
+		t.Fatalf("failed to open request stream: %v", err)
+	}
+	WriteMessage(requestStream, models.Transaction{TransactionID: "t3", FileHash: file.Hash, RequesterID: observer.ID(), TargetID: PeerID})
+	requestStream.Close()
+	select {
+	case decline := <-declines:
+		if decline.Status != "declined" {
+			t.Errorf("blocked requester got %+v", decline)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("blocked requester got no answer")
+	}
+}
+
+func signAs(t *testing.T, node *testNode, report *models.ReputationReport) {
+	t.Helper()
+	payload, err := reportPayload(*report)
+	if err != nil {
+		t.Fatalf("failed to encode report: %v", err)
+	}
+	signature, err := node.Host.Peerstore().PrivKey(node.Host.ID()).Sign(payload)
+	if err != nil {
+		t.Fatalf("failed to sign report: %v", err)
+	}
+	report.Signature = hex.EncodeToString(signature)
+}
+
+// go test -v -run ^TestForgedFileStreams$ -count=1 application-layer/dht
+func TestForgedFileStreams(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	attacker, victim := net.Nodes[1], net.Nodes[2]
+	garbage := []byte("not what anyone asked for")
+
+	// a download we really asked the victim for
+	Transfers.Add(models.Transaction{TransactionID: "real", FileHash: hashOf([]byte("asked for")), RequesterID: PeerID, TargetID: victim.ID()})
+
+	push := func(sender *testNode, transaction models.Transaction) {
+		t.Helper()
+		s, err := sender.Host.NewStream(net.ctx, Host.ID(), ProtocolFile)
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		defer s.Close()
+		WriteMessage(s, transaction)
+		WriteMessage(s, models.FileMetadata{Name: "x", NameWithExtension: "x.bin", Size: int64(len(garbage)), Hash: hashOf([]byte("claimed"))})
+		s.Write(garbage)
+		s.CloseWrite()
+		buf := make([]byte, 1)
+		s.SetReadDeadline(time.Now().Add(5 * time.Second))
+		s.Read(buf) // wait for us to close or reset
+	}
+
+	// claiming to be the victim, for the real transfer and for one we never made
+	push(attacker, models.Transaction{TransactionID: "real", RequesterID: PeerID, TargetID: victim.ID()})
+	push(attacker, models.Transaction{TransactionID: "made-up", RequesterID: PeerID, TargetID: victim.ID()})
+	// as itself, for a transfer it wasn't asked for
+	push(attacker, models.Transaction{TransactionID: "real", RequesterID: PeerID, TargetID: attacker.ID()})
+	push(attacker, models.Transaction{TransactionID: "made-up-2", RequesterID: PeerID, TargetID: attacker.ID()})
+
+	for _, peerID := range []string{victim.ID(), attacker.ID()} {
+		if rep := Reputation.Get(peerID); rep.CorruptDeliveries != 0 || rep.SuccessfulDownloads != 0 || rep.FailedDeliveries != 0 {
+			t.Errorf("forged file recorded against %s: %+v", peerID, rep)
+		}
+	}
+	if transfer, _ := Transfers.Get("real"); transfer.State != "pending" {
+		t.Errorf("forged file touched the real transfer: %+v", transfer)
+	}
+	if _, exists := Transfers.Get("made-up"); exists {
+		t.Errorf("forged file created a transfer")
+	}
+
+	// the provider we asked can't send another file in place of the one we asked for
+	push(victim, models.Transaction{TransactionID: "real", RequesterID: PeerID, TargetID: victim.ID()})
+	if transfer, _ := Transfers.Get("real"); transfer.State != "failed" {
+		t.Errorf("a different file was taken for the real transfer: %+v", transfer)
+	}
+	if rep := Reputation.Get(victim.ID()); rep.CorruptDeliveries != 1 {
+		t.Errorf("different file not recorded as corrupt: %+v", rep)
+	}
+}
@@ -0,0 +1,154 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	SeedingPath = filepath.Join(dirPath, "seeding.json")
+	Seeding     = newSeedingManager()
+)
+
+// seedingManager decides which downloaded files we provide to others, and at what fee
+type seedingManager struct {
+	mu     sync.Mutex // also held while downloadedFiles.json is updated, so two downloads can't both take the last bytes
+	policy models.SeedingPolicy
+}
+
+func newSeedingManager() *seedingManager {
+	return &seedingManager{}
+}
+
+// read the saved seeding policy, if any
+func LoadSeedingPolicy() error {
+	data, err := os.ReadFile(SeedingPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read seeding policy: %v", err)
+	}
+
+	var policy models.SeedingPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("failed to parse seeding policy: %v", err)
+	}
+	Seeding.mu.Lock()
+	Seeding.policy = policy
+	Seeding.mu.Unlock()
+	return nil
+}
+
+func (sm *seedingManager) SetPolicy(policy models.SeedingPolicy) error {
+	if policy.MaxBytes < 0 {
+		return fmt.Errorf("storage limit can't be negative")
+	}
+	if policy.Fee != nil && *policy.Fee < 0 {
+		return fmt.Errorf("fee can't be negative")
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal seeding policy: %v", err)
+	}
+	if err := os.WriteFile(SeedingPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write seeding policy: %v", err)
+	}
+	sm.policy = policy
+	return nil
+}
+
+func (sm *seedingManager) Status() (models.SeedingStatus, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	status := models.SeedingStatus{Policy: sm.policy}
+	downloads, err := loadFileList(DownloadedFilePath)
+	if err != nil {
+		return status, err
+	}
+	for _, file := range downloads {
+		if file.IsPublished {
+			status.SeededFiles++
+			status.SeededBytes += file.Size
+		}
+	}
+	return status, nil
+}
+
+// caller holds sm.mu, publishes file when the policy lets us and it fits next to what we seed already
+func (sm *seedingManager) admit(file *models.FileMetadata, paidFee int64, seededBytes int64) bool {
+	if !sm.policy.AutoSeed || file.IsPublished {
+		return false
+	}
+	if sm.policy.MaxBytes > 0 && seededBytes+file.Size > sm.policy.MaxBytes {
+		log.Infof("seeding: not providing %s, it would take seeded files over %d bytes", file.Name, sm.policy.MaxBytes)
+		return false
+	}
+	file.IsPublished = true
+	file.Fee = paidFee
+	if sm.policy.Fee != nil {
+		file.Fee = *sm.policy.Fee
+	}
+	return true
+}
+
+// storeDownload adds a finished download to downloadedFiles.json, published if we are going to seed it
+func (sm *seedingManager) storeDownload(file *models.FileMetadata, paidFee int64) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	var seeded int64
+	if downloads, err := loadFileList(DownloadedFilePath); err == nil {
+		for _, download := range downloads {
+			if download.IsPublished && download.Hash != file.Hash {
+				seeded += download.Size
+			}
+		}
+	}
+	// keep what we paid, it's the fee the file is seeded at later if the policy doesn't set one
+	file.Fee = paidFee
+	sm.admit(file, paidFee, seeded)
+	_, err := utils.SaveOrUpdateFile(*file, dirPath, DownloadedFilePath)
+	return err
+}
+
+// SeedExisting applies the policy to downloads from before it was turned on,
+// the files it returns are marked published and still have to be announced
+func (sm *seedingManager) SeedExisting() ([]models.FileMetadata, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	downloads, err := loadFileList(DownloadedFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var seeded int64
+	for _, download := range downloads {
+		if download.IsPublished {
+			seeded += download.Size
+		}
+	}
+
+	admitted := []models.FileMetadata{}
+	for _, download := range downloads {
+		// downloads carry the fee we paid for them
+		if !sm.admit(&download, download.Fee, seeded) {
+			continue
+		}
+		if _, err := utils.SaveOrUpdateFile(download, dirPath, DownloadedFilePath); err != nil {
+			return admitted, err
+		}
+		seeded += download.Size
+		admitted = append(admitted, download)
+	}
+	return admitted, nil
+}
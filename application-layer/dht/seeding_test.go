@@ -0,0 +1,79 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"testing"
+)
+
+// go test -v -run ^TestSeedingAndEarnings$ -count=1 application-layer/dht
+func TestSeedingAndEarnings(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	requester := net.Nodes[1]
+
+	// downloads are only provided while they fit in the storage limit
+	three := int64(3)
+	if err := Seeding.SetPolicy(models.SeedingPolicy{AutoSeed: true, Fee: &three, MaxBytes: 100}); err != nil {
+		t.Fatalf("failed to set seeding policy: %v", err)
+	}
+	small := models.FileMetadata{Hash: "small", Name: "small.txt", Size: 60}
+	large := models.FileMetadata{Hash: "large", Name: "large.txt", Size: 60}
+	if err := Seeding.storeDownload(&small, 1); err != nil || !small.IsPublished || small.Fee != 3 {
+		t.Errorf("small download: published %v at %d, %v", small.IsPublished, small.Fee, err)
+	}
+	if err := Seeding.storeDownload(&large, 1); err != nil || large.IsPublished {
+		t.Errorf("download over the limit: published %v, %v", large.IsPublished, err)
+	}
+	if status, err := Seeding.Status(); err != nil || status.SeededFiles != 1 || status.SeededBytes != 60 {
+		t.Errorf("status = %+v, %v", status, err)
+	}
+
+	// raising the limit seeds what was left out
+	if err := Seeding.SetPolicy(models.SeedingPolicy{AutoSeed: true, MaxBytes: 200}); err != nil {
+		t.Fatalf("failed to set seeding policy: %v", err)
+	}
+	seeded, err := Seeding.SeedExisting()
+	if err != nil || len(seeded) != 1 || seeded[0].Hash != "large" || seeded[0].Fee != 1 {
+		t.Errorf("seeding existing downloads: %+v, %v", seeded, err)
+	}
+
+	// earnings follow the payments that unlocked our transfers
+	file := net.addFile("earning.txt", []byte("pays for itself"), 5)
+	if _, err := UpdateFileInDHT(file); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if err := Uploads.SetPolicy(models.UploadPolicy{EncryptTransfers: true}); err != nil {
+		t.Fatalf("failed to set upload policy: %v", err)
+	}
+	first := net.requestFile(requester, file, "earn-1")
+	net.requestFile(requester, file, "earn-2")
+
+	report, err := Earnings.Report("")
+	if err != nil || len(report.Files) != 1 || report.Files[0].Downloads != 2 || report.Files[0].AwaitingPayment != 2 || report.Earned != 0 {
+		t.Fatalf("report before payment = %+v, %v", report, err)
+	}
+
+	paid := net.pay(5)
+	if response := net.askForKey(requester, first.Transaction, paid); response.Status != "released" {
+		t.Fatalf("paid in full: got %+v", response)
+	}
+	report, err = Earnings.Report(file.Hash)
+	if err != nil || report.Earned != 5 || report.Unit != models.FeeUnit {
+		t.Fatalf("report after payment = %+v, %v", report, err)
+	}
+	earned := report.Files[0]
+	if earned.Name != file.Name || earned.Payments != 1 || earned.AwaitingPayment != 1 || earned.LastPaidAt == "" {
+		t.Errorf("file earnings = %+v", earned)
+	}
+	if len(report.Payments) != 1 || report.Payments[0].PaymentTxID != paid || report.Payments[0].TransactionID != "earn-1" || report.Payments[0].RequesterID != requester.ID() {
+		t.Errorf("payments = %+v", report.Payments)
+	}
+
+	// the ledger survives a restart
+	Earnings = newEarningsLedger()
+	if err := LoadEarnings(); err != nil {
+		t.Fatalf("failed to load earnings: %v", err)
+	}
+	if reloaded, _ := Earnings.Report(""); reloaded.Earned != 5 {
+		t.Errorf("reloaded earnings = %+v", reloaded)
+	}
+}
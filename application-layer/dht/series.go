@@ -0,0 +1,333 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"application-layer/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// series records live next to file metadata in the dht, under their own prefix
+const seriesPrefix = "/orcanet/series/"
+
+var (
+	ErrSeriesNotFound = errors.New("series not found")
+	ErrNotSeriesOwner = errors.New("series is owned by another peer")
+	ErrBadSeries      = errors.New("invalid series record")
+)
+
+var (
+	SeriesPath = filepath.Join(dirPath, "series.json")
+	Series     = newSeriesStore()
+)
+
+// seriesStore keeps the series we own, so we can keep publishing versions after a restart
+type seriesStore struct {
+	mu    sync.Mutex
+	owned map[string]models.Series
+}
+
+func newSeriesStore() *seriesStore {
+	return &seriesStore{owned: make(map[string]models.Series)}
+}
+
+// read the series we own, if any
+func LoadSeries() error {
+	data, err := os.ReadFile(SeriesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read series: %v", err)
+	}
+
+	var owned []models.Series
+	if err := json.Unmarshal(data, &owned); err != nil {
+		return fmt.Errorf("failed to parse series: %v", err)
+	}
+	Series.mu.Lock()
+	defer Series.mu.Unlock()
+	for _, series := range owned {
+		Series.owned[series.ID] = series
+	}
+	return nil
+}
+
+// caller holds ss.mu
+func (ss *seriesStore) save() error {
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(ss.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal series: %v", err)
+	}
+	if err := os.WriteFile(SeriesPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write series: %v", err)
+	}
+	return nil
+}
+
+// caller holds ss.mu
+func (ss *seriesStore) sorted() []models.Series {
+	owned := []models.Series{}
+	for _, series := range ss.owned {
+		owned = append(owned, series)
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].Name < owned[j].Name })
+	return owned
+}
+
+// Owned lists the series published with our key
+func (ss *seriesStore) Owned() []models.Series {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.sorted()
+}
+
+// seriesID ties a series to its owner, the same name under another key is a different series
+func seriesID(owner string, name string) string {
+	sum := sha256.Sum256([]byte(owner + "/" + name))
+	return hex.EncodeToString(sum[:])
+}
+
+// the signature covers the record with an empty Signature field
+func seriesPayload(series models.Series) ([]byte, error) {
+	series.Signature = ""
+	return json.Marshal(series)
+}
+
+func verifySeries(series models.Series) error {
+	if series.ID != seriesID(series.Owner, series.Name) {
+		return fmt.Errorf("%w: id does not belong to %s", ErrBadSeries, series.Owner)
+	}
+	payload, err := seriesPayload(series)
+	if err != nil {
+		return err
+	}
+	if err := verifyPayload(series.Owner, payload, series.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSeries, err)
+	}
+	return nil
+}
+
+// validateSeriesRecord is what the dht validator runs on values stored under seriesPrefix
+func validateSeriesRecord(key string, value []byte) error {
+	var series models.Series
+	if err := json.Unmarshal(value, &series); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSeries, err)
+	}
+	if key != seriesPrefix+series.ID {
+		return fmt.Errorf("%w: stored under %s", ErrBadSeries, key)
+	}
+	return verifySeries(series)
+}
+
+// selectSeriesRecord picks the newest valid record, the owner bumps Sequence on every change
+func selectSeriesRecord(key string, values [][]byte) (int, error) {
+	best, bestSequence := -1, int64(-1)
+	for i, value := range values {
+		if validateSeriesRecord(key, value) != nil {
+			continue
+		}
+		var series models.Series
+		json.Unmarshal(value, &series)
+		if series.Sequence > bestSequence {
+			best, bestSequence = i, series.Sequence
+		}
+	}
+	if best < 0 {
+		return 0, ErrBadSeries
+	}
+	return best, nil
+}
+
+// caller holds ss.mu, signs and stores the record locally and in the dht
+func (ss *seriesStore) publish(series models.Series) (models.Series, error) {
+	series.Sequence++
+	series.UpdatedAt = time.Now().Unix()
+	payload, err := seriesPayload(series)
+	if err != nil {
+		return models.Series{}, err
+	}
+	series.Signature, err = signPayload(payload)
+	if err != nil {
+		return models.Series{}, err
+	}
+	data, err := json.Marshal(series)
+	if err != nil {
+		return models.Series{}, fmt.Errorf("failed to marshal series: %v", err)
+	}
+	if err := PutValue(GlobalCtx, seriesPrefix+series.ID, data); err != nil {
+		return models.Series{}, fmt.Errorf("failed to put series in dht: %v", err)
+	}
+
+	ss.owned[series.ID] = series
+	if err := ss.save(); err != nil {
+		log.Info("series:", err)
+	}
+	return series, nil
+}
+
+// Create starts a new, empty series owned by our key
+func (ss *seriesStore) Create(name string, description string) (models.Series, error) {
+	if strings.TrimSpace(name) == "" {
+		return models.Series{}, fmt.Errorf("%w: name is empty", ErrBadSeries)
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	id := seriesID(PeerID, name)
+	if _, exists := ss.owned[id]; exists {
+		return models.Series{}, fmt.Errorf("%w: we already own a series called %q", ErrBadSeries, name)
+	}
+	return ss.publish(models.Series{
+		ID:          id,
+		Owner:       PeerID,
+		Name:        name,
+		Description: description,
+		Versions:    []models.SeriesVersion{},
+	})
+}
+
+// AddVersion appends a published file to one of our series and points every earlier version at it
+func (ss *seriesStore) AddVersion(id string, hash string, changelog string) (models.Series, error) {
+	if !storage.ValidHash(hash) {
+		return models.Series{}, storage.ErrInvalidHash
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	series, exists := ss.owned[id]
+	if !exists {
+		if _, err := GetSeries(id); err == nil {
+			return models.Series{}, ErrNotSeriesOwner
+		}
+		return models.Series{}, ErrSeriesNotFound
+	}
+	for _, version := range series.Versions {
+		if version.FileHash == hash {
+			return models.Series{}, fmt.Errorf("%w: %s is already version %d", ErrBadSeries, hash, version.Version)
+		}
+	}
+
+	version := models.SeriesVersion{
+		Version:     int64(len(series.Versions)) + 1,
+		FileHash:    hash,
+		Changelog:   changelog,
+		PublishedAt: time.Now().Unix(),
+	}
+	if _, err := setSeriesFields(hash, id, version.Version, hash); err != nil {
+		return models.Series{}, fmt.Errorf("publish the file before adding it to a series: %v", err)
+	}
+	series.Versions = append(append([]models.SeriesVersion{}, series.Versions...), version)
+	series, err := ss.publish(series)
+	if err != nil {
+		return models.Series{}, err
+	}
+
+	// older records only tell downloaders where to look, a stale one is no worse than before
+	for _, older := range series.Versions[:len(series.Versions)-1] {
+		if _, err := setSeriesFields(older.FileHash, id, older.Version, hash); err != nil {
+			log.Errorf("series: failed to point version %d at %s: %v", older.Version, hash, err)
+		}
+	}
+	return series, nil
+}
+
+// annotate fills in the series fields of metadata for files in one of our series,
+// so republishing an expired record doesn't lose them
+func (ss *seriesStore) annotate(metadata *models.DHTMetadata) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, series := range ss.owned {
+		for _, version := range series.Versions {
+			if version.FileHash == metadata.Hash {
+				metadata.SeriesID = series.ID
+				metadata.Version = version.Version
+				metadata.LatestHash = series.Versions[len(series.Versions)-1].FileHash
+				return
+			}
+		}
+	}
+}
+
+// rewrite the series fields of a file's metadata in the dht and let the cloud node know
+func setSeriesFields(hash string, id string, version int64, latest string) (models.DHTMetadata, error) {
+	metadata, err := getFileMetadata(hash)
+	if err != nil {
+		return models.DHTMetadata{}, err
+	}
+	metadata.SeriesID, metadata.Version, metadata.LatestHash = id, version, latest
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return models.DHTMetadata{}, fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+	if err := PutValue(GlobalCtx, "/orcanet/"+hash, data); err != nil {
+		return models.DHTMetadata{}, fmt.Errorf("failed to update file in dht: %v", err)
+	}
+	if err := SendCloudNodeFiles(metadata); err != nil {
+		log.Info("series:", err)
+	}
+	return metadata, nil
+}
+
+func getFileMetadata(hash string) (models.DHTMetadata, error) {
+	data, err := GetValue(GlobalCtx, "/orcanet/"+hash)
+	if err != nil {
+		return models.DHTMetadata{}, fmt.Errorf("file %s not found in dht: %v", hash, err)
+	}
+	var metadata models.DHTMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return models.DHTMetadata{}, fmt.Errorf("failed to decode metadata: %v", err)
+	}
+	return metadata, nil
+}
+
+// GetSeries looks a series up in the dht, records that don't verify never make it this far
+func GetSeries(id string) (models.Series, error) {
+	data, err := GetValue(GlobalCtx, seriesPrefix+id)
+	if err != nil {
+		return models.Series{}, fmt.Errorf("%w: %v", ErrSeriesNotFound, err)
+	}
+	if err := validateSeriesRecord(seriesPrefix+id, data); err != nil {
+		return models.Series{}, err
+	}
+	var series models.Series
+	json.Unmarshal(data, &series)
+	return series, nil
+}
+
+// GetSeriesListing is a series with its newest version and the ratings of all its versions
+func GetSeriesListing(id string) (models.SeriesListing, error) {
+	series, err := GetSeries(id)
+	if err != nil {
+		return models.SeriesListing{}, err
+	}
+	listing := models.SeriesListing{Series: series}
+	for _, version := range series.Versions {
+		metadata, err := getFileMetadata(version.FileHash)
+		if err != nil {
+			log.Infof("series %s: version %d: %v", id, version.Version, err)
+			continue
+		}
+		listing.Rating += metadata.Rating
+		listing.NumRaters += metadata.NumRaters
+		listing.Upvote += metadata.Upvote
+		listing.Downvote += metadata.Downvote
+		if version.Version == int64(len(series.Versions)) {
+			listing.Latest = metadata
+		}
+	}
+	return listing, nil
+}
@@ -0,0 +1,89 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// go test -v -run ^TestSeries$ -count=1 application-layer/dht
+func TestSeries(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	remote, impostor := net.Nodes[1], net.Nodes[2]
+
+	v1 := net.addFile("dataset-v1.csv", []byte("a,b\n1,2\n"), 0)
+	v2 := net.addFile("dataset-v2.csv", []byte("a,b\n1,2\n3,4\n"), 0)
+	for _, file := range []models.FileMetadata{v1, v2} {
+		if _, err := UpdateFileInDHT(file); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	series, err := Series.Create("dataset", "numbers")
+	if err != nil {
+		t.Fatalf("failed to create series: %v", err)
+	}
+	if _, err := Series.Create("dataset", "again"); err == nil {
+		t.Errorf("created the same series twice")
+	}
+	if _, err := Series.AddVersion(series.ID, v1.Hash, "first cut"); err != nil {
+		t.Fatalf("failed to add v1: %v", err)
+	}
+	if series, err = Series.AddVersion(series.ID, v2.Hash, "more rows"); err != nil {
+		t.Fatalf("failed to add v2: %v", err)
+	}
+	if len(series.Versions) != 2 || series.Versions[1].Version != 2 || series.Sequence != 3 {
+		t.Errorf("series = %+v, want two versions at sequence 3", series)
+	}
+
+	// another node finds the newest record and sees v1 pointing at v2
+	found, err := remote.DHT.GetValue(net.ctx, seriesPrefix+series.ID)
+	if err != nil {
+		t.Fatalf("series not found from remote node: %v", err)
+	}
+	var remoteSeries models.Series
+	json.Unmarshal(found, &remoteSeries)
+	if remoteSeries.Sequence != series.Sequence || len(remoteSeries.Versions) != 2 {
+		t.Errorf("remote node got %+v", remoteSeries)
+	}
+	listing, err := GetSeriesListing(series.ID)
+	if err != nil {
+		t.Fatalf("failed to get listing: %v", err)
+	}
+	if listing.Latest.Hash != v2.Hash || listing.Latest.Version != 2 {
+		t.Errorf("latest = %+v, want version 2", listing.Latest)
+	}
+	old, err := getFileMetadata(v1.Hash)
+	if err != nil || old.SeriesID != series.ID || old.Version != 1 || old.LatestHash != v2.Hash {
+		t.Errorf("v1 metadata = %+v (%v), want it pointing at %s", old, err, v2.Hash)
+	}
+
+	// a record for the same series signed by anyone but the owner is refused,
+	// and the impostor's own series can't be stored under the owner's id
+	forged := remoteSeries
+	forged.Sequence++
+	forged.Versions = forged.Versions[:1]
+	sign := func(series *models.Series) []byte {
+		payload, _ := seriesPayload(*series)
+		signature, err := impostor.Host.Peerstore().PrivKey(impostor.Host.ID()).Sign(payload)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		series.Signature = hex.EncodeToString(signature)
+		data, _ := json.Marshal(series)
+		return data
+	}
+	if err := impostor.DHT.PutValue(net.ctx, seriesPrefix+series.ID, sign(&forged)); !errors.Is(err, ErrBadSeries) {
+		t.Errorf("forged series record: got %v", err)
+	}
+	forged.Owner, forged.ID = impostor.ID(), seriesID(impostor.ID(), forged.Name)
+	data := sign(&forged)
+	if err := validateSeriesRecord(seriesPrefix+series.ID, data); !errors.Is(err, ErrBadSeries) {
+		t.Errorf("record under another owner's id: got %v", err)
+	}
+	if err := validateSeriesRecord(seriesPrefix+forged.ID, data); err != nil {
+		t.Errorf("impostor's own series refused: %v", err)
+	}
+}
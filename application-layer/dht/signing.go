@@ -0,0 +1,78 @@
+package dht_kad
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// notes we pass around about peers and files (reputation reports, takedown notices) are signed
+// with the node's identity key, so anyone can check them against the signer's peer id
+
+// signPayload signs payload with our identity key and returns the hex signature
+func signPayload(payload []byte) (string, error) {
+	privKey := DHT.Host().Peerstore().PrivKey(DHT.Host().ID())
+	if privKey == nil {
+		return "", fmt.Errorf("no private key for %s", DHT.Host().ID())
+	}
+	signature, err := privKey.Sign(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign: %v", err)
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// verifyPayload checks a hex signature of payload against the key in signer's peer id
+func verifyPayload(signer string, payload []byte, signatureHex string) error {
+	signerID, err := peer.Decode(signer)
+	if err != nil {
+		return fmt.Errorf("invalid signer: %v", err)
+	}
+	pubKey, err := signerID.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("no public key in signer id: %v", err)
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	valid, err := pubKey.Verify(payload, signature)
+	if err != nil || !valid {
+		return fmt.Errorf("bad signature from %s", signer)
+	}
+	return nil
+}
+
+// broadcast sends msg from node to every connected peer that speaks id, except the peer given in except
+// node is passed in rather than read from DHT since broadcasts run in the background
+func broadcast(node host.Host, id protocol.ID, msg interface{}, except string) {
+	ids := []protocol.ID{id}
+	registryMu.RLock()
+	if legacy := protocolRegistry[id].Legacy; legacy != "" {
+		ids = append(ids, legacy)
+	}
+	registryMu.RUnlock()
+
+	for _, pid := range node.Network().Peers() {
+		peerID := pid.String()
+		if peerID == except {
+			continue
+		}
+		if matched, err := node.Peerstore().SupportsProtocols(pid, ids...); err != nil || len(matched) == 0 {
+			continue
+		}
+		s, err := node.NewStream(network.WithAllowLimitedConn(GlobalCtx, string(id)), pid, id)
+		if err != nil {
+			log.Errorf("broadcast %s: failed to reach %s: %v", id, peerID, err)
+			continue
+		}
+		if err := WriteMessage(s, msg); err != nil {
+			log.Errorf("broadcast %s: failed to send to %s: %v", id, peerID, err)
+		}
+		s.Close()
+	}
+}
@@ -2,8 +2,6 @@ package dht_kad
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"time"
 )
 
@@ -12,7 +10,7 @@ func StartDHTService() {
 	node, dht, err := createNode()
 	PeerID = node.ID().String()
 	if err != nil {
-		log.Fatalf("Failed to create node: %s", err)
+		fatalf("Failed to create node: %s", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -32,15 +30,40 @@ func StartDHTService() {
 	// ConnectToPeer(node, Cloud_node_addr)
 
 	// ReceiveDataFromPeer(node) //listen on stream /senddata/p2p
+	if err := LoadUploadPolicy(); err != nil {
+		log.Errorf("Failed to load upload policy, serving without limits: %v", err)
+	}
+	if err := LoadReputation(); err != nil {
+		log.Errorf("Failed to load peer reputations, starting without: %v", err)
+	}
+	if err := LoadModeration(); err != nil {
+		log.Errorf("Failed to load moderation settings, serving everything: %v", err)
+	}
+	if err := LoadSeries(); err != nil {
+		log.Errorf("Failed to load series, starting without: %v", err)
+	}
+	if err := LoadBundles(); err != nil {
+		log.Errorf("Failed to load bundles, starting without: %v", err)
+	}
+	if err := LoadPricing(); err != nil {
+		log.Errorf("Failed to load pricing rules, charging advertised fees: %v", err)
+	}
+	if err := LoadSeedingPolicy(); err != nil {
+		log.Errorf("Failed to load seeding policy, not seeding downloads: %v", err)
+	}
+	if err := LoadEarnings(); err != nil {
+		log.Errorf("Failed to load earnings, starting a new ledger: %v", err)
+	}
 	setupStreams(node)
+	go Reprovider.run() // republishes our files now and keeps them fresh from then on
 
-	fmt.Println("My Node MULTIADDRESS:", node.Addrs())
-	fmt.Println("MY NODE PEER ID:", PeerID)
+	log.Info("My Node MULTIADDRESS:", node.Addrs())
+	log.Info("MY NODE PEER ID:", PeerID)
 	My_node_addr = node.Addrs()[0].String() + "/p2p/" + PeerID
-	fmt.Println("MY NODE ADDR: ", My_node_addr)
-	fmt.Println("Supported protocols:", node.Mux().Protocols())
+	log.Info("MY NODE ADDR: ", My_node_addr)
+	log.Info("Supported protocols:", node.Mux().Protocols())
+	log.Info("Orcanet protocols:", RegisteredProtocols())
 
-	go handleInput(ctx, dht)
 	Host = node
 
 	defer node.Close()
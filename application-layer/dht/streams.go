@@ -3,13 +3,13 @@ package dht_kad
 import (
 	"application-layer/models"
 	"application-layer/services"
+	"application-layer/storage"
 	"application-layer/utils"
 	"bufio"
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -21,12 +21,11 @@ import (
 )
 
 var (
-	PendingRequests = make(map[string]models.Transaction) // all requests made by host node
+	PendingRequests = make(map[string]models.Transaction) // all requests made by host node, keyed by transaction id
 	FileHashToPath  = make(map[string]string)             // file paths of files uploaded by host node
 	Mutex           = &sync.Mutex{}
 	FileMapMutex    = &sync.Mutex{}
 
-	dir             = filepath.Join("..", "..", "squidcoinFiles")
 	RefreshResponse []models.FileMetadata
 	ProxyResponse   []models.Proxy
 
@@ -39,73 +38,61 @@ var (
 	dirPath            = filepath.Join("..", "..", "utils")
 	UploadedFilePath   = filepath.Join(dirPath, "files.json")
 	DownloadedFilePath = filepath.Join(dirPath, "downloadedFiles.json")
+
+	// where our wallet address comes from, tests running without btcd swap it out
+	walletAddress = func() (string, error) {
+		return services.NewBtcService().GetMiningAddressFromTempMayukh()
+	}
 )
 
 // SENDING FUNCTIONS
 
 func SendDownloadRequest(requestMetadata models.Transaction) error {
 	// create stream to send the download request
-	fmt.Println("Sending download request via stream /sendRequest/p2p")
-	requestStream, err := CreateNewStream(DHT.Host(), requestMetadata.TargetID, "/sendRequest/p2p")
+	log.Debug("Sending download request via stream", ProtocolDownloadRequest)
+	requestStream, err := openStream(requestMetadata.TargetID, ProtocolDownloadRequest)
 	if err != nil {
 		return fmt.Errorf("error sending download request: %v", err)
 	}
 	defer requestStream.Close()
 
-	walletAddr, err := services.NewBtcService().GetMiningAddressFromTempMayukh()
+	walletAddr, err := walletAddress()
 	if err != nil {
-		fmt.Println("error getting wallet address")
+		log.Error("error getting wallet address")
 	}
 	requestMetadata.RequesterWallet = walletAddr
 
-	// Marshal the request metadata to JSON
-	requestData, err := json.Marshal(requestMetadata)
-	if err != nil {
-		return fmt.Errorf("error marshaling download request data: %v", err)
-	}
-
-	// send JSON data over the stream
-	_, err = requestStream.Write(requestData)
-	if err != nil {
+	if err := WriteMessage(requestStream, requestMetadata); err != nil {
 		return fmt.Errorf("error sending download request data: %v", err)
 	}
 
-	fmt.Printf("Sent download request for file hash %s to target peer %s\n", requestMetadata.FileHash, requestMetadata.TargetID)
+	log.Infof("Sent download request for file hash %s to target peer %s", requestMetadata.FileHash, requestMetadata.TargetID)
 	return nil
 }
 
 func sendDecline(transaction models.Transaction) {
 	transaction.Status = "declined"
 
-	transactionJson, err := json.Marshal(transaction)
-	if err != nil {
-		log.Printf("sendDecline: error encoding metadata to data: %v", err)
-		return
-	}
-
 	// Send decline to the target peer
-	requestStream, err := CreateNewStream(DHT.Host(), transaction.RequesterID, "/requestResponse/p2p")
+	requestStream, err := openStream(transaction.RequesterID, ProtocolResponse)
 	if err != nil {
-		log.Printf("Error creating stream to target peer %s: %v", transaction.RequesterID, err)
+		log.Errorf("Error creating stream to target peer %s: %v", transaction.RequesterID, err)
 		return
 	}
 	defer requestStream.Close()
 
-	// Write data with a newline as a delimiter
-	transactionJson = append(transactionJson, '\n')
-	_, err = requestStream.Write(transactionJson)
-	if err != nil {
-		log.Printf("Error writing to stream: %v", err)
+	if err := WriteMessage(requestStream, transaction); err != nil {
+		log.Errorf("Error writing to stream: %v", err)
 		return
 	}
 
-	log.Printf("Decline message sent to peer %s for file hash %s", transaction.RequesterID, transaction.FileHash)
+	log.Infof("Decline message sent to peer %s for file hash %s", transaction.RequesterID, transaction.FileHash)
 }
 
 // send metadata before sending file content
 func sendMetadata(stream network.Stream, fileHash string) error {
 	// Retrieve the file data from the DHT using the file hash
-	data, err := DHT.GetValue(GlobalCtx, "/orcanet/"+fileHash)
+	data, err := GetValue(GlobalCtx, "/orcanet/"+fileHash)
 	if err != nil {
 		return fmt.Errorf("sendMetadata: file hash not found in DHT: %w", err)
 	}
@@ -118,7 +105,7 @@ func sendMetadata(stream network.Stream, fileHash string) error {
 		return fmt.Errorf("sendMetadata: error decoding file metadata: %w", err)
 	}
 
-	fmt.Println("sending metadata for file: ", metadata.NameWithExtension)
+	log.Debug("sending metadata for file: ", metadata.NameWithExtension)
 	var fileMetadata = models.FileMetadata{
 		Name:              metadata.Name,
 		NameWithExtension: metadata.NameWithExtension,
@@ -126,77 +113,79 @@ func sendMetadata(stream network.Stream, fileHash string) error {
 		Size:              metadata.Size,
 		Description:       metadata.Description,
 		Hash:              fileHash,
+		ChunkRoot:         metadata.ChunkRoot,
 		OriginalUploader:  false,
 		IsPublished:       true, //automatically become provider when you download file
 	}
 
-	fileMetadataJSON, err := json.Marshal(fileMetadata)
-	if err != nil {
-		return fmt.Errorf("sendMetadata: error encoding metadata to data: %w", err)
-	}
-
-	// newline signifies end of metadata
-	fileMetadataJSON = append(fileMetadataJSON, '\n')
-
-	// Write metadata to stream
-	_, err = stream.Write(fileMetadataJSON)
-	if err != nil {
-		log.Fatalf("sendMetadata: failed to write metadata to stream: %s", err)
+	if err := WriteMessage(stream, fileMetadata); err != nil {
+		return fmt.Errorf("sendMetadata: failed to write metadata to stream: %w", err)
 	}
 
-	fmt.Println("sendMetadata: metadata sent successfully: ", fileMetadataJSON)
+	log.Debug("sendMetadata: metadata sent successfully: ", fileMetadata.NameWithExtension)
 	return nil
 }
 
 func sendFile(host host.Host, request models.Transaction) {
 	requesterID, fileHash := request.RequesterID, request.FileHash
 
-	fmt.Printf("Sending file %s to requester %s...\n", fileHash, requesterID)
+	log.Infof("Sending file %s to requester %s...", fileHash, requesterID)
 
 	filePath := FileHashToPath[request.FileHash]
-	fmt.Println("sendFile: filePath: ", filePath)
+	if request.BundleHash != "" {
+		filePath, _ = storage.Blobs.Path(request.FileHash)
+	}
+	log.Debug("sendFile: filePath: ", filePath)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fmt.Printf("error: file %s not found in %s\n", fileHash, filePath)
+		log.Errorf("error: file %s not found in %s", fileHash, filePath)
 		return
 	}
 
-	fmt.Printf("sending file %s to requester %s \n", request.FileName, requesterID)
+	log.Infof("sending file %s to requester %s", request.FileName, requesterID)
 
 	// create stream to send the file
-	fileStream, err := CreateNewStream(host, request.RequesterID, "/sendFile/p2p")
+	fileStream, err := openStream(request.RequesterID, ProtocolFile)
 	if err != nil {
-		fmt.Println("Error creating file stream:", err)
+		log.Error("Error creating file stream:", err)
 		return
 	}
 	defer fileStream.Close()
 
-	// sending transaction details before file metadata and content
-	transactionData, err := json.Marshal(request)
-	if err != nil {
-		fmt.Printf("error marshaling transaction data: %v\n", err)
-		return
+	// when encrypting, the content is useless to the requester (and any relay) until they pay for the key
+	// members of a bundle were paid for with the bundle, so a priced manifest is always encrypted
+	writer := Uploads.throttle(fileStream, requesterID)
+	paidBundle := request.Fee > 0 && Bundles.has(request.FileHash)
+	if request.BundleHash == "" && (request.Encrypted || Uploads.Policy().EncryptTransfers || paidBundle) {
+		writer, err = newTransferKey(&request, writer)
+		if err != nil {
+			log.Errorf("error setting up encryption for %s: %v", request.TransactionID, err)
+			return
+		}
 	}
 
-	transactionData = append(transactionData, '\n')
-
-	_, err = fileStream.Write(transactionData)
-	if err != nil {
-		fmt.Printf("error sending transaction data: %v\n", err)
+	// sending transaction details before file metadata and content
+	if err := WriteMessage(fileStream, request); err != nil {
+		log.Errorf("error sending transaction data: %v", err)
 		return
 	}
-	fmt.Printf("Sent transaction data sent for %s\n", request.TransactionID)
+	log.Infof("Sent transaction data sent for %s", request.TransactionID)
 
 	// send metadata next
-	err = sendMetadata(fileStream, fileHash)
+	if request.BundleHash != "" {
+		err = sendBundleMemberMetadata(fileStream, request)
+	} else {
+		err = sendMetadata(fileStream, fileHash)
+	}
 	if err != nil {
-		fmt.Println("error sending file metadata")
+		log.Error("error sending file metadata:", err)
+		fileStream.Reset()
 		return
 	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		fmt.Printf("error opening file %s: %v", filePath, err)
+		log.Errorf("error opening file %s: %v", filePath, err)
 		return
 	}
 	defer file.Close()
@@ -204,28 +193,54 @@ func sendFile(host host.Host, request models.Transaction) {
 	reader := bufio.NewReader(file)
 	buffer := make([]byte, 4096)
 
+	sent := 0
 	for {
 		n, err := reader.Read(buffer)
 		if err != nil {
 			if err == io.EOF {
-				fmt.Println("all of file sent")
+				log.Infof("sent all %d bytes of %s to requester %s", sent, fileHash, requesterID)
 				break
 			}
-			fmt.Printf("error reading file %s: %v\n", filePath, err)
+			log.Errorf("error reading file %s: %v", filePath, err)
 			return
 		}
 
-		_, err = fileStream.Write(buffer[:n])
+		_, err = writer.Write(buffer[:n])
 		if err != nil {
-			fmt.Printf("error sending chunk to requester %s: %v\n", requesterID, err)
+			log.Errorf("error sending chunk to requester %s: %v", requesterID, err)
 			return
 		}
-		fmt.Printf("sent %d bytes to requester %s\n", n, requesterID)
+		sent += n
+		log.Tracef("sent %d bytes to requester %s", n, requesterID)
+	}
+
+	Earnings.served(request)
+	if request.Encrypted {
+		request.Status = "awaiting payment"
+		utils.AddOrUpdateTransaction(request)
 	}
 }
 
+// tell the requester where its download request sits in our upload queue
+func sendQueuePosition(transaction models.Transaction) {
+	utils.AddOrUpdateTransaction(transaction)
+
+	queueStream, err := openStream(transaction.RequesterID, ProtocolQueuePosition)
+	if err != nil {
+		log.Errorf("Error creating stream to target peer %s: %v", transaction.RequesterID, err)
+		return
+	}
+	defer queueStream.Close()
+
+	if err := WriteMessage(queueStream, transaction); err != nil {
+		log.Errorf("Error writing to stream: %v", err)
+		return
+	}
+	log.Infof("Sent queue position %d for transaction %s", transaction.QueuePosition, transaction.TransactionID)
+}
+
 func SendMarketFilesRequest(nodeID string) error {
-	fmt.Println("Requesting marketplace files data from cloud node ", nodeID)
+	log.Info("Requesting marketplace files data from cloud node ", nodeID)
 
 	// refreshResponse = []model.FileMetadata{}
 	requestStream, err := CreateNewStream(DHT.Host(), nodeID, "/sendRefreshRequest/p2p")
@@ -234,15 +249,13 @@ func SendMarketFilesRequest(nodeID string) error {
 	}
 	defer requestStream.Close()
 
-	requestData := []byte(PeerID)
-
-	// send JSON data over the stream
-	_, err = requestStream.Write(requestData)
+	// the cloud node expects just our peer id
+	err = writeUnframed(requestStream, []byte(PeerID))
 	if err != nil {
 		return fmt.Errorf("error sending refresh request: %v", err)
 	}
 
-	fmt.Printf("Sent refresh request to cloud node %s\n", nodeID)
+	log.Infof("Sent refresh request to cloud node %s", nodeID)
 	return nil
 }
 
@@ -258,32 +271,25 @@ func SendCloudNodeFiles(fileMetadata models.DHTMetadata) error {
 		return fmt.Errorf("sendCloudNodeFiles: failed to marshal file metadata: %v", err)
 	}
 
-	_, err = stream.Write(fileData)
+	err = writeUnframed(stream, fileData)
 	if err != nil {
-		return fmt.Errorf("sendCloudNodeFiles: failed to send file metadata to cloud node")
+		return fmt.Errorf("sendCloudNodeFiles: failed to send file metadata to cloud node: %v", err)
 	}
 
-	fmt.Printf("Sent file metadata to cloud node %s\n", Cloud_node_id)
+	log.Infof("Sent file metadata to cloud node %s", Cloud_node_id)
 	return nil
 }
 
 func sendMessageConfirmation(transaction models.Transaction) {
-	confirmationStream, err := CreateNewStream(DHT.Host(), transaction.TargetID, "/requestResponse/p2p")
+	confirmationStream, err := openStream(transaction.TargetID, ProtocolResponse)
 	if err != nil {
-		log.Printf("Error creating stream to target peer %s: %v", transaction.TargetID, err)
+		log.Errorf("Error creating stream to target peer %s: %v", transaction.TargetID, err)
 		return
 	}
 	defer confirmationStream.Close()
 
-	transactionData, err := json.Marshal(transaction)
-	if err != nil {
-		fmt.Printf("error marshaling download request data: %v\n", err)
-		return
-	}
-
-	_, err = confirmationStream.Write(transactionData)
-	if err != nil {
-		log.Printf("Error writing to stream: %v", err)
+	if err := WriteMessage(confirmationStream, transaction); err != nil {
+		log.Errorf("Error writing to stream: %v", err)
 		return
 	}
 }
@@ -301,7 +307,7 @@ func SendProxyRequest(peerID string, wg *sync.WaitGroup) {
 	// Open a new stream to the peer
 	stream, err := CreateNewStream(DHT.Host(), peerID, "/proxy/metadata/1.0.0")
 	if err != nil {
-		fmt.Printf("SendProxyRequest: Failed to create stream to peer %s: %v\n", peerID, err)
+		log.Errorf("SendProxyRequest: Failed to create stream to peer %s: %v", peerID, err)
 		return
 	}
 	defer stream.Close()
@@ -315,36 +321,27 @@ func SendProxyRequest(peerID string, wg *sync.WaitGroup) {
 
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
-		fmt.Printf("SendProxyRequest: Failed to marshal request for peer %s: %v\n", peerID, err)
+		log.Errorf("SendProxyRequest: Failed to marshal request for peer %s: %v", peerID, err)
 		return
 	}
 
-	_, err = stream.Write(requestBytes)
+	err = writeUnframed(stream, requestBytes)
 	if err != nil {
-		fmt.Printf("SendProxyRequest: Failed to send request to peer %s: %v\n", peerID, err)
+		log.Errorf("SendProxyRequest: Failed to send request to peer %s: %v", peerID, err)
 		return
 	}
+	stream.CloseWrite()
 
 	// Read the response
-	responseBytes := make([]byte, 4096)
-	stream.SetReadDeadline(time.Now().Add(10 * time.Second))
-	n, err := stream.Read(responseBytes)
-	if err != nil {
-		fmt.Printf("SendProxyRequest: Failed to read response from peer %s: %v\n", peerID, err)
-		return
-	}
-
-	// Unmarshal the response into a Proxy object
 	var proxy models.Proxy
-	err = json.Unmarshal(responseBytes[:n], &proxy)
-	if err != nil {
-		fmt.Printf("SendProxyRequest: Failed to unmarshal response from peer %s: %v\n", peerID, err)
+	if err := readUnframed(stream, &proxy); err != nil {
+		log.Infof("SendProxyRequest: bad response from peer %s: %v", peerID, err)
 		return
 	}
 
 	// Append the proxy metadata to ProxyResponse
 	ProxyResponse = append(ProxyResponse, proxy)
-	fmt.Printf("SendProxyRequest: Successfully received proxy metadata from peer %s\n", peerID)
+	log.Infof("SendProxyRequest: Successfully received proxy metadata from peer %s", peerID)
 }
 
 func SendHistoryToHost(hostPeerIDStr string, proxyHistory models.ProxyHistoryEntry) error {
@@ -353,347 +350,472 @@ func SendHistoryToHost(hostPeerIDStr string, proxyHistory models.ProxyHistoryEnt
 	if err != nil {
 		return fmt.Errorf("failed to decode peer ID: %v", err)
 	}
-	fmt.Printf("DECODED PEER ID: %s\n", hostPeerID)
+	log.Infof("DECODED PEER ID: %s", hostPeerID)
 
 	// Attempt to create a stream
-	fmt.Printf("Attempting to create a stream to peer %s using protocol %s\n", hostPeerID, "/history/p2p")
-	stream, err := CreateNewStream(DHT.Host(), hostPeerIDStr, "/history/p2p")
+	log.Infof("Attempting to create a stream to peer %s using protocol %s", hostPeerID, ProtocolHistory)
+	stream, err := openStream(hostPeerIDStr, ProtocolHistory)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to create stream to peer %s: %v\n", hostPeerID, err)
+		log.Errorf("ERROR: Failed to create stream to peer %s: %v", hostPeerID, err)
 		return fmt.Errorf("failed to create stream: %v", err)
 	}
 	defer stream.Close()
-	fmt.Printf("Stream successfully opened to peer %s\n", hostPeerID)
+	log.Infof("Stream successfully opened to peer %s", hostPeerID)
 
 	// Send the proxy history
-	fmt.Printf("Sending proxy history to peer %s\n", hostPeerID)
-	encoder := json.NewEncoder(stream)
-	fmt.Printf("Sending data: %+v\n", proxyHistory)
+	log.Infof("Sending proxy history to peer %s", hostPeerID)
+	log.Debugf("sending proxy history entry: %+v", proxyHistory)
 
-	if err := encoder.Encode(proxyHistory); err != nil {
-		fmt.Printf("ERROR: Failed to encode and send history: %v\n", err)
+	if err := WriteMessage(stream, proxyHistory); err != nil {
+		log.Errorf("ERROR: Failed to encode and send history: %v", err)
 		return fmt.Errorf("failed to encode and send history: %v", err)
 	}
-	fmt.Println("Proxy history sent successfully")
+	log.Info("Proxy history sent successfully")
 
 	return nil
 }
 
 // RECEIVING FUNCTIONS
 func receivedHistory(node host.Host) {
-	node.SetStreamHandler("/history/p2p", func(stream network.Stream) {
-		fmt.Println("Received a stream for /history/p2p")
+	handleProtocol(node, ProtocolHistory, func(stream network.Stream) {
+		log.Info("Received a stream for", stream.Protocol())
 		defer stream.Close()
 
-		decoder := json.NewDecoder(stream)
 		var receivedHistory models.ProxyHistoryEntry // Update YourHistoryType accordingly
-		if err := decoder.Decode(&receivedHistory); err != nil {
-			fmt.Printf("Error decoding received history: %v\n", err)
+		if err := ReadMessage(stream, &receivedHistory); err != nil {
+			rejectStream(stream, err)
 			return
 		}
 
-		fmt.Println("Received history:", receivedHistory)
+		log.Debug("Received history:", receivedHistory)
 		// utils.AddOrUpdateProxyHistory(receivedHistory)
-		fmt.Println("added")
+		log.Info("added")
 	})
 }
 func receiveDownloadRequest(node host.Host) {
-	fmt.Println("listening for download requests")
-	// listen for streams on "/sendRequest/p2p"
-	node.SetStreamHandler("/sendRequest/p2p", func(s network.Stream) {
+	log.Info("listening for download requests")
+	handleProtocol(node, ProtocolDownloadRequest, func(s network.Stream) {
 		defer s.Close()
-		// Create a buffered reader to read data from the stream
-		buf := bufio.NewReader(s)
-		// Read data from the stream
-		data, err := io.ReadAll(buf) // everything - should just be a transaction struct
 
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("Stream closed by peer: %s", s.Conn().RemotePeer())
-			} else {
-				log.Printf("Error reading from stream: %v", err)
-			}
+		var request models.Transaction
+		if err := ReadMessage(s, &request); err != nil {
+			rejectStream(s, err)
 			return
 		}
 
-		var request models.Transaction
-		err = json.Unmarshal(data, &request)
-		if err != nil {
-			fmt.Printf("error unmarshalling file request: %v", err)
+		// the request is answered on a new stream to RequesterID, don't let one peer send it to another
+		remotePeer := s.Conn().RemotePeer().String()
+		if request.RequesterID != remotePeer {
+			rejectStream(s, messageError(s, fmt.Errorf("%w: request for %s sent by %s", ErrMalformedMessage, request.RequesterID, remotePeer)))
+			return
+		}
+		// whatever fee the requester put in is ignored, ours is set below from our provider entry
+		// and pricing, newTransferKey only releases the key once that much was paid
+		request.Fee = 0
+		if Reputation.IsBlocked(remotePeer) {
+			log.Info("receivedownloadrequest: decline, requester is blocked")
+			request.Message = "requester is blocked"
+			sendDecline(request)
+			return
+		}
+		if err := Moderation.CheckRequest(remotePeer, request.FileHash); err != nil {
+			log.Info("receivedownloadrequest: decline,", err)
+			request.Message = err.Error()
+			sendDecline(request)
 			return
 		}
 
-		walletAddr, err := services.NewBtcService().GetMiningAddressFromTempMayukh()
+		walletAddr, err := walletAddress()
 		if err != nil {
-			fmt.Println("error getting wallet address")
+			log.Error("error getting wallet address")
 			return
 		}
 		request.TargetWallet = walletAddr
 
-		log.Println("receieveDownloadRequest: files in FileHashToPath: ", FileHashToPath)
-		fmt.Print("FILEHASHTOPATH", FileHashToPath)
-		fmt.Print("Request.FileHash", request.FileHash)
+		log.Debugf("receieveDownloadRequest: %d files shared, requested %s", len(FileHashToPath), request.FileHash)
 
 		utils.AddOrUpdateTransaction(request)
 
-		// send file to requester if it exists
-		if FileHashToPath[request.FileHash] != "" {
-			fmt.Println("receivedownloadrequest: sending file")
-			sendFile(node, request)
+		// members of a bundle are only served to peers that got the bundle from us
+		available := FileHashToPath[request.FileHash] != ""
+		if request.BundleHash != "" {
+			err := Moderation.CheckRequest(remotePeer, request.BundleHash)
+			if err == nil {
+				_, err = Bundles.authorize(remotePeer, request.BundleHash, request.FileHash)
+			}
+			if err != nil {
+				log.Info("receivedownloadrequest: decline,", err)
+				request.Message = err.Error()
+				sendDecline(request)
+				return
+			}
+			available = true
+		}
+
+		// the fee is ours to set, from the quote the requester refers to or our prices right now
+		if available && request.BundleHash == "" {
+			fee, err := Pricing.feeFor(request)
+			if err != nil {
+				log.Info("receivedownloadrequest: decline,", err)
+				request.Message = err.Error()
+				sendDecline(request)
+				return
+			}
+			request.Fee = fee
+		}
+
+		// send file to requester if it exists, waiting for a free upload slot if needed
+		if available {
+			log.Info("receivedownloadrequest: sending file")
+			if err := Uploads.Enqueue(node, request); err != nil {
+				log.Info("receivedownloadrequest: decline:", err)
+				request.Message = err.Error()
+				sendDecline(request)
+			}
 		} else {
-			fmt.Println("receivedownloadrequest: decline")
+			log.Info("receivedownloadrequest: decline")
 			sendDecline(request)
 		}
 
 	})
 }
 
-func receiveDecline(node host.Host) {
-	node.SetStreamHandler("/requestResponse/p2p", func(s network.Stream) {
+// declines come from the provider we asked, confirmations from a requester we served
+// both used to share /requestResponse/p2p with two handlers, so only the last one registered ever ran
+func receiveResponse(node host.Host) {
+	handleProtocol(node, ProtocolResponse, func(s network.Stream) {
 		defer s.Close()
-		buf := bufio.NewReader(s)
 
-		// Read data until a newline character
-		data, err := buf.ReadBytes('\n')
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("Stream closed by peer: %s", s.Conn().RemotePeer())
-			} else {
-				log.Printf("Error reading from stream: %v", err)
-			}
+		var message models.Transaction
+		if err := ReadMessage(s, &message); err != nil {
+			rejectStream(s, err)
 			return
 		}
 
-		log.Printf("Raw data received: %s", data)
-
-		var declineMessage models.Transaction
-		err = json.Unmarshal(data, &declineMessage)
-		if err != nil {
-			fmt.Printf("error unmarshalling file request: %v", err)
-			return
+		remotePeer := s.Conn().RemotePeer().String()
+		switch {
+		case remotePeer == message.TargetID && message.RequesterID == PeerID:
+			receiveDecline(message)
+		case remotePeer == message.RequesterID:
+			receiveMessageConfirmation(message)
+		default:
+			rejectStream(s, messageError(s, fmt.Errorf("%w: response for a transaction between other peers", ErrMalformedMessage)))
 		}
-		declineMessage.Status = "declined"
+	})
+}
 
-		utils.AddOrUpdateTransaction(declineMessage)
+func receiveDecline(declineMessage models.Transaction) {
+	declineMessage.Status = "declined"
 
-		// message := "Failed to download file from" + declineMessage.TargetID
-		// websocket.SendMessage(message)
-		sendMessageConfirmation(declineMessage)
+	utils.AddOrUpdateTransaction(declineMessage)
+	Transfers.SetState(declineMessage, "declined")
+	Reputation.record(declineMessage.TargetID, eventDecline, declineMessage.TransactionID, 0, 0)
 
-	})
+	// message := "Failed to download file from" + declineMessage.TargetID
+	// websocket.SendMessage(message)
+	sendMessageConfirmation(declineMessage)
 }
 
 func receiveFile(node host.Host) error {
-	fmt.Println("listening for file data")
-	// listen for streams on "/sendFile/p2p"
-	node.SetStreamHandler("/sendFile/p2p", func(s network.Stream) {
+	log.Info("listening for file data")
+	handleProtocol(node, ProtocolFile, func(s network.Stream) {
 		defer s.Close()
 
-		// read metadata - use metadata struct later
-		buf := bufio.NewReader(s)
-
 		// read in transaction details first
-		transactionJSON, err := buf.ReadBytes('\n') // Read until newline
-		if err != nil {
-			log.Fatalf("Failed to read metadata: %v", err)
-		}
-
-		// Parse JSON metadata
 		var transaction models.Transaction
-
-		err = json.Unmarshal(transactionJSON, &transaction)
-		if err != nil {
-			log.Fatalf("Failed to unmarshal metadata: %v", err)
+		if err := ReadMessage(s, &transaction); err != nil {
+			rejectStream(s, err)
+			return
 		}
 
-		fmt.Printf("Received metadata: transactionID=%s\n", transaction.TransactionID)
+		log.Infof("Received metadata: transactionID=%s", transaction.TransactionID)
 
-		// Read metadata
-		metadataJSON, err := buf.ReadBytes('\n') // Read until newline
-		if err != nil {
-			log.Fatalf("Failed to read metadata: %v", err)
+		// reputation events go to TargetID, only the provider itself may claim to be it
+		remotePeer := s.Conn().RemotePeer().String()
+		if transaction.TargetID != remotePeer || transaction.RequesterID != PeerID {
+			rejectStream(s, messageError(s, fmt.Errorf("%w: file from %s for a transfer between %s and %s", ErrMalformedMessage, remotePeer, transaction.TargetID, transaction.RequesterID)))
+			return
 		}
 
-		// Parse JSON metadata
+		// then the file metadata, the content follows unframed
 		var metadata models.FileMetadata
-
-		err = json.Unmarshal(metadataJSON, &metadata)
-		if err != nil {
-			log.Fatalf("Failed to unmarshal metadata: %v", err)
+		if err := ReadMessage(s, &metadata); err != nil {
+			rejectStream(s, err)
+			return
 		}
 
 		// when downloading new file, user is not initially a provider
 		// go to files page to set self as provider of file
 		metadata.IsPublished = false
 
-		fmt.Printf("Received metadata: FileName=%s\n", metadata.NameWithExtension)
+		log.Infof("Received metadata: FileName=%s", metadata.NameWithExtension)
 
-		// check if squidcoinFiles directory exists
-		err = os.MkdirAll(dir, os.ModePerm)
+		// files we never asked this peer for are refused, as is a cancelled download as soon as the provider starts sending
+		request, _, err := Transfers.start(transaction, metadata.Size)
 		if err != nil {
-			log.Fatalf("Failed to create directory %s: %v", dir, err)
+			rejectStream(s, messageError(s, err))
+			return
+		}
+		if metadata.Hash != request.FileHash {
+			err := fmt.Errorf("%w: got %s instead of %s", ErrUnknownTransfer, metadata.Hash, request.FileHash)
+			log.Infof("receiveFile: %v", err)
+			Transfers.finish(transaction.TransactionID, err)
+			Reputation.record(transaction.TargetID, eventCorrupt, transaction.TransactionID, 0, 0)
+			rejectStream(s, messageError(s, err))
+			return
 		}
 
-		// open file for writing
-		outputPath := filepath.Join(dir, metadata.NameWithExtension)
-		fmt.Println("receiveFile: outputPath", outputPath)
-		file, err := os.Create(outputPath)
-		if err != nil {
-			log.Printf("error creating file %s: %v\n", outputPath, err)
+		// content goes to a temp file first and only enters the blob store if it matches the advertised hash
+		if !storage.ValidHash(metadata.Hash) {
+			log.Infof("receiveFile: rejecting file with invalid hash %q", metadata.Hash)
+			Transfers.finish(transaction.TransactionID, storage.ErrInvalidHash)
+			s.Reset()
+			return
+		}
+		metadata.NameWithExtension = storage.SanitizeName(metadata.NameWithExtension)
+
+		// encrypted content can't be hashed yet, it is kept aside until the provider releases the key
+		var out io.Writer
+		var blob *storage.BlobWriter
+		var chunks *storage.ChunkVerifier
+		keepEncrypted := false
+		if transaction.Encrypted {
+			encrypted, err := createEncryptedDownload(transaction)
+			if err != nil {
+				log.Errorf("error creating encrypted download for %s: %v", metadata.Hash, err)
+				Transfers.finish(transaction.TransactionID, err)
+				s.Reset()
+				return
+			}
+			defer func() {
+				encrypted.Close()
+				if !keepEncrypted {
+					discardEncryptedDownload(transaction.TransactionID)
+				}
+			}()
+			out = encrypted
+		} else {
+			blob, err = storage.Blobs.Create(metadata.NameWithExtension)
+			if err != nil {
+				log.Errorf("error creating blob for %s: %v", metadata.Hash, err)
+				Transfers.finish(transaction.TransactionID, err)
+				s.Reset()
+				return
+			}
+			defer blob.Abort()
+			out = blob
+
+			// bundle members are checked chunk by chunk against the root in our manifest,
+			// sellers that can't send the chunk hashes are checked on the whole file as before
+			if request.BundleHash != "" {
+				tree, err := RequestChunkTree(remotePeer, request.BundleHash, request.FileHash)
+				if errors.Is(err, storage.ErrHashMismatch) {
+					log.Infof("receiveFile: %v", err)
+					Transfers.finish(transaction.TransactionID, err)
+					Reputation.record(transaction.TargetID, eventCorrupt, transaction.TransactionID, 0, 0)
+					s.Reset()
+					return
+				} else if err != nil {
+					log.Debugf("receiveFile: no chunk tree for %s, verifying the whole file: %v", request.FileHash, err)
+				} else {
+					chunks = storage.NewChunkVerifier(tree, blob)
+					out = chunks
+				}
+			}
 		}
-		defer file.Close()
 
 		// read and write chunks of data
 		buffer := make([]byte, 4086)
 		for {
-			n, err := buf.Read(buffer)
+			// stop reading while paused - the provider blocks once the stream window fills up
+			if err := Transfers.waitIfPaused(transaction.TransactionID); err != nil {
+				log.Infof("download %s cancelled, discarding partial file", transaction.TransactionID)
+				s.Reset()
+				return
+			}
+
+			// a provider that stops sending without closing the stream doesn't hold the download forever
+			s.SetReadDeadline(time.Now().Add(transferIdleTimeout))
+			n, err := s.Read(buffer)
 			if err != nil {
 				if err == io.EOF {
-					log.Printf("file %s received and saved to %s\n", metadata.Name, outputPath)
-
 					break
 				}
-				log.Printf("Ererrorror reading file chunk: %v\n", err)
+				err = messageError(s, streamError(err))
+				log.Errorf("error reading file chunk: %v", err)
+				Transfers.finish(transaction.TransactionID, err)
+				Reputation.record(transaction.TargetID, eventFailedDelivery, transaction.TransactionID, 0, 0)
+				s.Reset()
 				return
 			}
 
-			_, writeErr := file.Write(buffer[:n])
-			if writeErr != nil {
-				log.Printf("error writing to file %s: %v\n", outputPath, writeErr)
+			_, writeErr := out.Write(buffer[:n])
+			if errors.Is(writeErr, storage.ErrHashMismatch) {
+				log.Infof("receiveFile: discarding %s: %v", metadata.Name, writeErr)
+				Transfers.finish(transaction.TransactionID, writeErr)
+				Reputation.record(transaction.TargetID, eventCorrupt, transaction.TransactionID, 0, 0)
+				s.Reset()
+				return
+			} else if writeErr != nil {
+				log.Errorf("error writing blob %s: %v", metadata.Hash, writeErr)
+				Transfers.finish(transaction.TransactionID, writeErr)
 				return
 			}
 
-			log.Printf("receieved and wrote %d bytes of file %s\n", n, metadata.Name)
+			Transfers.progress(transaction.TransactionID, n)
 		}
+		Transfers.received(transaction.TransactionID)
 
-		// add file to downloadedFiles.json
-		utils.SaveOrUpdateFile(metadata, dirPath, DownloadedFilePath)
-
-		FileMapMutex.Lock()
-
-		fmt.Println("file name with extension: ", metadata.NameWithExtension)
-		FileHashToPath[metadata.Hash] = filepath.Join(dir, metadata.NameWithExtension) // add file and its path to the map
-		FileMapMutex.Unlock()
-
-		transaction.Status = "complete"
-		fmt.Println("receiveFile: transaction", transaction)
-		utils.AddOrUpdateTransaction(transaction)
-
-		// ProvideKey(GlobalCtx, DHT, metadata.Hash) // must be published - update dht with new provider
-		updatedMetadata, err := UpdateFileInDHT(metadata)
-		if err != nil {
-			// is it a failure if the user receives the file but cannot be added to the dht?
-			log.Println("failed to update dht metadata:", err)
+		if transaction.Encrypted {
+			if err := awaitPayment(request, transaction, metadata); err != nil {
+				log.Infof("receiveFile: %v", err)
+				Transfers.finish(transaction.TransactionID, err)
+				return
+			}
+			keepEncrypted = true
 			return
 		}
 
-		sendMessageConfirmation(transaction)
-		// message := "Successfully downloaded file from " + transaction.TargetID
-		// websocket.SendMessage(message)
-
-		err = SendCloudNodeFiles(updatedMetadata)
+		entry, err := commitDownload(blob, chunks, metadata.Hash)
 		if err != nil {
-			log.Println("failed to send updated metadata to cloud node:", err)
+			log.Infof("receiveFile: discarding %s: %v", metadata.Name, err)
+			Transfers.finish(transaction.TransactionID, err)
+			if errors.Is(err, storage.ErrHashMismatch) {
+				Reputation.record(transaction.TargetID, eventCorrupt, transaction.TransactionID, 0, 0)
+			}
+			transaction.Status = "failed"
+			utils.AddOrUpdateTransaction(transaction)
+			return
 		}
+		completeDownload(request, transaction, metadata, entry)
 	})
 	return nil
 }
 
-func receiveMarketplaceFiles(node host.Host) {
-	fmt.Println("Listening for refresh response")
+// commitDownload checks the last chunk of a member verified chunk by chunk, then moves the content into the blob store
+func commitDownload(blob *storage.BlobWriter, chunks *storage.ChunkVerifier, hash string) (models.BlobEntry, error) {
+	if chunks != nil {
+		if err := chunks.Close(); err != nil {
+			return models.BlobEntry{}, err
+		}
+	}
+	return blob.Commit(hash)
+}
 
-	node.SetStreamHandler("/marketplaceFiles/p2p", func(s network.Stream) {
-		defer s.Close()
+// the verified content is in the blob store, record the download and become a provider of it
+// the blob was pinned by Commit and is only collectable again once it's listed
+// request is our copy of what we asked for, transaction is what the provider sent back
+func completeDownload(request models.Transaction, transaction models.Transaction, metadata models.FileMetadata, entry models.BlobEntry) {
+	defer storage.Blobs.Unpin(entry.Hash)
+	if transaction.BundleHash != "" {
+		completeBundleMember(transaction, metadata, entry)
+		return
+	}
+	metadata.ChunkRoot = entry.ChunkRoot
+	outputPath, _ := storage.Blobs.Path(metadata.Hash)
+	log.Infof("file %s received and saved to %s", metadata.Name, outputPath)
+	Transfers.finish(transaction.TransactionID, nil)
+	Reputation.record(transaction.TargetID, eventSuccess, transaction.TransactionID, entry.Size, Transfers.receiveTime(transaction.TransactionID))
 
-		// Use a buffer to read the incoming data
-		var receivedData bytes.Buffer
-		buf := make([]byte, 4096) // Chunk size should match sender's buffer
+	// add file to downloadedFiles.json, published straight away if our seeding policy says so
+	// the fee is the one we agreed to, not whatever the provider wrote into its reply
+	if err := Seeding.storeDownload(&metadata, request.Fee); err != nil {
+		log.Error("failed to record download:", err)
+	}
 
-		for {
-			n, err := s.Read(buf)
-			if err != nil {
-				if err == io.EOF {
-					fmt.Println("All data received from sender")
-					break
-				}
-				log.Fatalf("Failed to read data: %v", err)
-			}
-			receivedData.Write(buf[:n])
+	FileMapMutex.Lock()
+	FileHashToPath[metadata.Hash] = outputPath // add file and its path to the map
+	FileMapMutex.Unlock()
+
+	if metadata.Type == models.BundleType {
+		if err := Bundles.adopt(metadata.Hash, transaction.TargetID); err != nil {
+			log.Infof("downloaded bundle %s is unusable: %v", metadata.Hash, err)
 		}
+	}
+
+	transaction.Status = "complete"
+	log.Debug("receiveFile: transaction", transaction)
+	utils.AddOrUpdateTransaction(transaction)
+
+	// ProvideKey(GlobalCtx, DHT, metadata.Hash) // must be published - update dht with new provider
+	updatedMetadata, err := UpdateFileInDHT(metadata)
+	if err != nil {
+		// is it a failure if the user receives the file but cannot be added to the dht?
+		log.Error("failed to update dht metadata:", err)
+		return
+	}
+
+	sendMessageConfirmation(transaction)
+	// message := "Successfully downloaded file from " + transaction.TargetID
+	// websocket.SendMessage(message)
 
-		// Parse the accumulated JSON data
+	err = SendCloudNodeFiles(updatedMetadata)
+	if err != nil {
+		log.Error("failed to send updated metadata to cloud node:", err)
+	}
+}
+
+func receiveMarketplaceFiles(node host.Host) {
+	log.Info("Listening for refresh response")
+
+	node.SetStreamHandler("/marketplaceFiles/p2p", func(s network.Stream) {
+		defer s.Close()
+
+		// the cloud node sends the whole listing as one json array and then closes the stream
 		var fileData []models.DHTMetadata
-		err := json.Unmarshal(receivedData.Bytes(), &fileData)
-		fmt.Println("file data received from refresh", fileData)
-		if err != nil {
-			log.Fatalf("Error unmarshaling received data: %v", err)
+		if err := readUnframed(s, &fileData); err != nil {
+			rejectStream(s, err)
+			return
 		}
+		log.Trace("file data received from refresh", fileData)
 
 		Mutex.Lock()
 		MarketplaceFiles = append(MarketplaceFiles[:0], fileData...)
 		Mutex.Unlock()
 
 		MarketplaceFilesSignal <- struct{}{}
-		fmt.Println("Received files for marketplace:", MarketplaceFiles)
+		log.Debugf("received %d files for marketplace", len(MarketplaceFiles))
+		log.Trace("marketplace files:", MarketplaceFiles)
 	})
 }
 
-func receiveMessageConfirmation(node host.Host) {
-	node.SetStreamHandler("/requestResponse/p2p", func(s network.Stream) {
+func receiveMessageConfirmation(message models.Transaction) {
+	utils.AddOrUpdateTransaction(message)
+	if message.Status == "declined" {
+		Transfers.SetState(message, "declined")
+	}
+}
+
+func receiveQueuePosition(node host.Host) {
+	handleProtocol(node, ProtocolQueuePosition, func(s network.Stream) {
 		defer s.Close()
-		buf := bufio.NewReader(s)
 
-		// Read data until a newline character
-		data, err := io.ReadAll(buf)
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("Stream closed by peer: %s", s.Conn().RemotePeer())
-			} else {
-				log.Printf("Error reading from stream: %v", err)
-			}
+		var transaction models.Transaction
+		if err := ReadMessage(s, &transaction); err != nil {
+			rejectStream(s, err)
 			return
 		}
-		log.Printf("Raw data received: %s", data)
 
-		var message models.Transaction
-		err = json.Unmarshal(data, &message)
-		if err != nil {
-			fmt.Printf("error unmarshalling file request: %v", err)
-			return
-		}
-		utils.AddOrUpdateTransaction(message)
+		log.Infof("download %s is at position %d in the provider's queue", transaction.TransactionID, transaction.QueuePosition)
+		utils.AddOrUpdateTransaction(transaction)
+		Transfers.SetState(transaction, "queued")
 	})
 }
 
 func receiveProxies(node host.Host) {
-	fmt.Println("Listening for proxy data")
+	log.Info("Listening for proxy data")
 
 	node.SetStreamHandler("/proxies/p2p", func(s network.Stream) {
 		defer s.Close()
 
-		// Use a buffer to read the incoming data
-		var receivedData bytes.Buffer
-		buf := make([]byte, 4096) // Chunk size should match sender's buffer
-
-		for {
-			n, err := s.Read(buf)
-			if err != nil {
-				if err == io.EOF {
-					fmt.Println("All data received from sender")
-					break
-				}
-				log.Fatalf("Failed to read data: %v", err)
-			}
-			receivedData.Write(buf[:n])
-		}
-
-		// Assuming proxies are serialized as JSON, we will parse them
-		var proxies []models.Proxy // Replace ProxyData with the actual struct type for proxies
-		err := json.Unmarshal(receivedData.Bytes(), &proxies)
-		fmt.Println("Proxy data received:", proxies)
-		if err != nil {
-			log.Fatalf("Error unmarshaling received proxy data: %v", err)
+		// sent by the cloud node as one json array
+		var proxies []models.Proxy
+		if err := readUnframed(s, &proxies); err != nil {
+			rejectStream(s, err)
+			return
 		}
+		log.Debugf("received %d proxies", len(proxies))
+		log.Trace("proxies:", proxies)
 
 		// Assuming you have a global variable to store proxies
 		Mutex.Lock()
@@ -702,16 +824,22 @@ func receiveProxies(node host.Host) {
 
 		// Notify other parts of your system that proxies have been received
 		ProxiesSignal <- struct{}{}
-		fmt.Println("Received proxies:", Proxies)
+		log.Trace("Received proxies:", Proxies)
 	})
 }
 
 // listen on streams
 func setupStreams(node host.Host) {
 	receiveDownloadRequest(node)
-	receiveDecline(node)
+	receiveResponse(node)
 	receiveFile(node)
 	receivedHistory(node)
 	receiveMarketplaceFiles(node)
-	receiveMessageConfirmation(node)
+	receiveQueuePosition(node)
+	receiveKeyRequest(node)
+	receiveReputationReport(node)
+	receiveTakedownNotice(node)
+	receiveQuoteRequest(node)
+	receiveInvoiceRequest(node)
+	receiveChunkTreeRequest(node)
 }
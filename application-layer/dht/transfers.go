@@ -0,0 +1,379 @@
+package dht_kad
+
+import (
+	"application-layer/metrics"
+	"application-layer/models"
+	"application-layer/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// how often progress is recalculated and pushed to the UI
+	progressInterval = 500 * time.Millisecond
+	// weight of the newest sample in the moving average of the download speed
+	speedSmoothing = 0.3
+	// how long finished, cancelled, declined and failed transfers stay listed
+	transferRetention = 24 * time.Hour
+)
+
+var (
+	Transfers = newTransferManager()
+
+	ErrUnknownTransfer = errors.New("no such download was requested")
+)
+
+type transfer struct {
+	info      models.Transfer
+	request   models.Transaction // as we sent it, arriving files are checked against this copy
+	ctx       context.Context
+	cancel    context.CancelFunc
+	resume    chan struct{} // closed when a paused transfer may continue
+	lastBytes int64
+	lastTime  time.Time
+	started   time.Time     // when the file stream arrived
+	took      time.Duration // how long the content took to arrive, set once the stream ends
+	finished  time.Time     // when the transfer reached a final state, zero while it is running
+}
+
+// transferManager keeps track of every download started by this node
+type transferManager struct {
+	mu        sync.Mutex
+	transfers map[string]*transfer // keyed by transaction id
+}
+
+func newTransferManager() *transferManager {
+	return &transferManager{transfers: make(map[string]*transfer)}
+}
+
+func timestamp() string {
+	return time.Now().Format("2006-01-02 15:04:05")
+}
+
+func isFinished(state string) bool {
+	return state == "complete" || state == "cancelled" || state == "declined" || state == "failed"
+}
+
+// Add registers a download request that was just sent to a provider
+func (tm *transferManager) Add(request models.Transaction) models.Transfer {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &transfer{
+		info: models.Transfer{
+			TransactionID: request.TransactionID,
+			FileHash:      request.FileHash,
+			FileName:      request.FileName,
+			TargetID:      request.TargetID,
+			State:         "pending",
+			TotalBytes:    request.Size,
+			ETA:           -1,
+			CreatedAt:     request.CreatedAt,
+			UpdatedAt:     timestamp(),
+		},
+		request: request,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	tm.mu.Lock()
+	tm.prune(time.Now())
+	tm.transfers[request.TransactionID] = t
+	info := t.info
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+	return info
+}
+
+func (tm *transferManager) Get(transactionID string) (models.Transfer, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, exists := tm.transfers[transactionID]
+	if !exists {
+		return models.Transfer{}, false
+	}
+	return t.info, true
+}
+
+// List returns all transfers, newest first
+func (tm *transferManager) List() []models.Transfer {
+	tm.mu.Lock()
+	tm.prune(time.Now())
+	transfers := make([]models.Transfer, 0, len(tm.transfers))
+	for _, t := range tm.transfers {
+		transfers = append(transfers, t.info)
+	}
+	tm.mu.Unlock()
+
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].CreatedAt > transfers[j].CreatedAt
+	})
+	return transfers
+}
+
+// Pause stops reading from the file stream, which stalls the provider until the transfer is resumed
+func (tm *transferManager) Pause(transactionID string) (models.Transfer, error) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transactionID]
+	if !exists {
+		tm.mu.Unlock()
+		return models.Transfer{}, fmt.Errorf("transfer %s not found", transactionID)
+	}
+	if isFinished(t.info.State) {
+		tm.mu.Unlock()
+		return models.Transfer{}, fmt.Errorf("transfer %s is already %s", transactionID, t.info.State)
+	}
+	if t.resume == nil {
+		t.resume = make(chan struct{})
+	}
+	t.info.State = "paused"
+	t.info.Speed = 0
+	t.info.ETA = -1
+	t.info.UpdatedAt = timestamp()
+	info := t.info
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+	return info, nil
+}
+
+func (tm *transferManager) Resume(transactionID string) (models.Transfer, error) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transactionID]
+	if !exists {
+		tm.mu.Unlock()
+		return models.Transfer{}, fmt.Errorf("transfer %s not found", transactionID)
+	}
+	if t.info.State != "paused" {
+		tm.mu.Unlock()
+		return models.Transfer{}, fmt.Errorf("transfer %s is not paused", transactionID)
+	}
+	close(t.resume)
+	t.resume = nil
+	if t.info.BytesReceived > 0 {
+		t.info.State = "downloading"
+	} else {
+		t.info.State = "pending"
+	}
+	t.lastTime = time.Now()
+	t.lastBytes = t.info.BytesReceived
+	t.info.UpdatedAt = timestamp()
+	info := t.info
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+	return info, nil
+}
+
+// Cancel aborts the transfer, the receiving goroutine resets the stream and removes the partial file
+func (tm *transferManager) Cancel(transactionID string) (models.Transfer, error) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transactionID]
+	if !exists {
+		tm.mu.Unlock()
+		return models.Transfer{}, fmt.Errorf("transfer %s not found", transactionID)
+	}
+	if isFinished(t.info.State) {
+		tm.mu.Unlock()
+		return models.Transfer{}, fmt.Errorf("transfer %s is already %s", transactionID, t.info.State)
+	}
+	t.cancel()
+	if t.resume != nil {
+		close(t.resume)
+		t.resume = nil
+	}
+	t.info.State = "cancelled"
+	t.finished = time.Now()
+	t.info.Speed = 0
+	t.info.ETA = -1
+	t.info.UpdatedAt = timestamp()
+	info := t.info
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+	return info, nil
+}
+
+// SetState records provider responses such as "queued" or "declined"
+func (tm *transferManager) SetState(transaction models.Transaction, state string) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transaction.TransactionID]
+	if !exists || isFinished(t.info.State) || t.info.State == "paused" {
+		tm.mu.Unlock()
+		return
+	}
+	t.info.State = state
+	t.info.QueuePosition = transaction.QueuePosition
+	if state == "declined" {
+		t.info.Error = transaction.Message
+		t.finished = time.Now()
+		t.cancel()
+	}
+	t.info.UpdatedAt = timestamp()
+	info := t.info
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+}
+
+// start is called when the file stream arrives and returns the request as we sent it,
+// the returned context is done once the transfer is cancelled
+// only files for a download we requested from transaction.TargetID that hasn't started yet are taken,
+// the caller checks TargetID is the peer on the other end of the stream
+func (tm *transferManager) start(transaction models.Transaction, totalBytes int64) (models.Transaction, context.Context, error) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transaction.TransactionID]
+	if !exists {
+		tm.mu.Unlock()
+		return models.Transaction{}, nil, fmt.Errorf("%w: %s", ErrUnknownTransfer, transaction.TransactionID)
+	}
+	if t.request.TargetID != transaction.TargetID {
+		tm.mu.Unlock()
+		return models.Transaction{}, nil, fmt.Errorf("%w: %s was requested from %s, not %s", ErrUnknownTransfer, transaction.TransactionID, t.request.TargetID, transaction.TargetID)
+	}
+	if isFinished(t.info.State) {
+		tm.mu.Unlock()
+		return models.Transaction{}, nil, fmt.Errorf("transfer %s was %s", transaction.TransactionID, t.info.State)
+	}
+	if !t.started.IsZero() {
+		tm.mu.Unlock()
+		return models.Transaction{}, nil, fmt.Errorf("transfer %s is already being received", transaction.TransactionID)
+	}
+	if t.info.State != "paused" {
+		t.info.State = "downloading"
+	}
+	t.info.QueuePosition = 0
+	t.info.TotalBytes = totalBytes
+	t.lastTime = time.Now()
+	t.started = t.lastTime
+	t.info.UpdatedAt = timestamp()
+	ctx, info, request := t.ctx, t.info, t.request
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+	return request, ctx, nil
+}
+
+// waitIfPaused blocks while the transfer is paused and fails once it is cancelled
+func (tm *transferManager) waitIfPaused(transactionID string) error {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transactionID]
+	if !exists {
+		tm.mu.Unlock()
+		return nil
+	}
+	resume, ctx := t.resume, t.ctx
+	tm.mu.Unlock()
+
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+func (tm *transferManager) progress(transactionID string, n int) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transactionID]
+	if !exists {
+		tm.mu.Unlock()
+		return
+	}
+	t.info.BytesReceived += int64(n)
+
+	elapsed := time.Since(t.lastTime)
+	if elapsed < progressInterval {
+		tm.mu.Unlock()
+		return
+	}
+
+	sample := float64(t.info.BytesReceived-t.lastBytes) / elapsed.Seconds()
+	if t.info.Speed == 0 {
+		t.info.Speed = sample
+	} else {
+		t.info.Speed = speedSmoothing*sample + (1-speedSmoothing)*t.info.Speed
+	}
+	t.info.ETA = -1
+	if t.info.Speed > 0 && t.info.TotalBytes > 0 {
+		remaining := t.info.TotalBytes - t.info.BytesReceived
+		if remaining < 0 {
+			remaining = 0
+		}
+		t.info.ETA = int64(float64(remaining) / t.info.Speed)
+	}
+	t.lastBytes = t.info.BytesReceived
+	t.lastTime = time.Now()
+	t.info.UpdatedAt = timestamp()
+	info := t.info
+	tm.mu.Unlock()
+
+	publishTransfer(info)
+}
+
+// received notes that all content has arrived, before it is verified or decrypted
+func (tm *transferManager) received(transactionID string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if t, exists := tm.transfers[transactionID]; exists && !t.started.IsZero() {
+		t.took = time.Since(t.started)
+	}
+}
+
+// receiveTime is how long the content took to arrive, 0 when unknown (e.g. after a restart)
+func (tm *transferManager) receiveTime(transactionID string) time.Duration {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if t, exists := tm.transfers[transactionID]; exists {
+		return t.took
+	}
+	return 0
+}
+
+// Fail ends a transfer whose request never reached the provider
+func (tm *transferManager) Fail(transactionID string, err error) {
+	tm.finish(transactionID, err)
+}
+
+func (tm *transferManager) finish(transactionID string, err error) {
+	tm.mu.Lock()
+	t, exists := tm.transfers[transactionID]
+	if !exists || t.info.State == "cancelled" {
+		tm.mu.Unlock()
+		return
+	}
+	if err != nil {
+		t.info.State = "failed"
+		t.info.Error = err.Error()
+	} else {
+		t.info.State = "complete"
+		t.info.ETA = 0
+	}
+	t.info.UpdatedAt = timestamp()
+	t.finished = time.Now()
+	t.cancel()
+	info := t.info
+	tm.mu.Unlock()
+
+	metrics.TransferFinished("download", err)
+	publishTransfer(info)
+}
+
+// prune forgets transfers that finished more than transferRetention ago
+// callers hold tm.mu
+func (tm *transferManager) prune(now time.Time) {
+	for transactionID, t := range tm.transfers {
+		if !t.finished.IsZero() && now.Sub(t.finished) > transferRetention {
+			t.cancel()
+			delete(tm.transfers, transactionID)
+		}
+	}
+}
+
+func publishTransfer(info models.Transfer) {
+	websocket.SendEvent(models.TransferEvent{Event: "transfer", Transfer: info})
+}
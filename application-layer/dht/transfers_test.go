@@ -0,0 +1,34 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+// go test -v -run ^TestTransferPruning$ -count=1 application-layer/dht
+func TestTransferPruning(t *testing.T) {
+	tm := newTransferManager()
+	tm.Add(models.Transaction{TransactionID: "done"})
+	tm.Add(models.Transaction{TransactionID: "running"})
+	tm.Add(models.Transaction{TransactionID: "recent"})
+	tm.finish("done", nil)
+	tm.finish("recent", errors.New("broken stream"))
+
+	tm.mu.Lock()
+	done := tm.transfers["done"]
+	done.finished = done.finished.Add(-transferRetention - time.Minute)
+	tm.mu.Unlock()
+
+	transfers := tm.List()
+	if len(transfers) != 2 {
+		t.Fatalf("listed %d transfers, want running and recent", len(transfers))
+	}
+	if _, exists := tm.Get("done"); exists {
+		t.Errorf("transfer finished a day ago is still kept")
+	}
+	if done.ctx.Err() == nil {
+		t.Errorf("pruned transfer's context is still live")
+	}
+}
@@ -0,0 +1,363 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+var (
+	UploadPolicyPath = filepath.Join(dirPath, "uploadPolicy.json")
+	Uploads          = newUploadManager(models.UploadPolicy{})
+)
+
+// per-peer limiters that have been idle this long with a full bucket are dropped
+const limiterIdleTimeout = 5 * time.Minute
+
+// token bucket limiting the number of bytes written per second
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64 // bytes per second, 0 = unlimited
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+func (rl *rateLimiter) setRate(rate int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = rate
+	if rl.tokens > float64(rate) {
+		rl.tokens = float64(rate)
+	}
+}
+
+// reserve n bytes and return how long the caller has to wait before sending them
+func (rl *rateLimiter) reserve(n int) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * float64(rl.rate)
+	if rl.tokens > float64(rl.rate) {
+		rl.tokens = float64(rl.rate)
+	}
+	rl.last = now
+
+	rl.tokens -= float64(n)
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / float64(rl.rate) * float64(time.Second))
+}
+
+// idle reports whether nothing was reserved for at least timeout and the bucket has refilled,
+// at which point a fresh limiter would behave the same and this one can be thrown away
+func (rl *rateLimiter) idle(now time.Time, timeout time.Duration) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	elapsed := now.Sub(rl.last)
+	if elapsed < timeout {
+		return false
+	}
+	return rl.rate <= 0 || rl.tokens+elapsed.Seconds()*float64(rl.rate) >= float64(rl.rate)
+}
+
+func (rl *rateLimiter) wait(ctx context.Context, n int) error {
+	delay := rl.reserve(n)
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writer that waits on every limiter before passing bytes through
+type throttledWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*rateLimiter
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	for _, limiter := range tw.limiters {
+		if err := limiter.wait(tw.ctx, len(p)); err != nil {
+			return 0, err
+		}
+	}
+	return tw.w.Write(p)
+}
+
+type queuedUpload struct {
+	node    host.Host
+	request models.Transaction
+}
+
+// transaction ids are picked by the requester, two peers may well use the same one
+type uploadKey struct {
+	peerID        string
+	transactionID string
+}
+
+func keyOf(request models.Transaction) uploadKey {
+	return uploadKey{peerID: request.RequesterID, transactionID: request.TransactionID}
+}
+
+// uploadManager decides when incoming download requests are served
+// requests over the concurrency limit wait in a FIFO queue and the requester is told its position
+type uploadManager struct {
+	mu      sync.Mutex
+	policy  models.UploadPolicy
+	active  map[uploadKey]models.Transaction
+	queue   []queuedUpload
+	global  *rateLimiter
+	perPeer map[string]*rateLimiter
+
+	// how uploads are sent and queued requesters told their position, nil uses sendFile
+	// and sendQueuePosition, tests swap them out
+	send   func(node host.Host, request models.Transaction)
+	notify func(request models.Transaction)
+}
+
+func newUploadManager(policy models.UploadPolicy) *uploadManager {
+	return &uploadManager{
+		policy:  policy,
+		active:  make(map[uploadKey]models.Transaction),
+		global:  newRateLimiter(policy.GlobalRateLimit),
+		perPeer: make(map[string]*rateLimiter),
+	}
+}
+
+func (um *uploadManager) Policy() models.UploadPolicy {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.policy
+}
+
+// SetPolicy applies new limits immediately, running uploads pick up the new rates on their next write
+func (um *uploadManager) SetPolicy(policy models.UploadPolicy) error {
+	if policy.MaxConcurrentUploads < 0 || policy.MaxQueueLength < 0 || policy.GlobalRateLimit < 0 || policy.PerPeerRateLimit < 0 {
+		return fmt.Errorf("upload limits cannot be negative")
+	}
+
+	um.mu.Lock()
+	um.policy = policy
+	um.global.setRate(policy.GlobalRateLimit)
+	for _, limiter := range um.perPeer {
+		limiter.setRate(policy.PerPeerRateLimit)
+	}
+	um.mu.Unlock()
+
+	// a higher concurrency limit may free slots for queued requests
+	um.startQueued()
+	return nil
+}
+
+func (um *uploadManager) Status() models.UploadStatus {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	status := models.UploadStatus{
+		Policy:        um.policy,
+		ActiveUploads: []models.Transaction{},
+		QueuedUploads: []models.Transaction{},
+	}
+	for _, transaction := range um.active {
+		status.ActiveUploads = append(status.ActiveUploads, transaction)
+	}
+	for _, queued := range um.queue {
+		status.QueuedUploads = append(status.QueuedUploads, queued.request)
+	}
+	return status
+}
+
+func (um *uploadManager) hasFreeSlot() bool {
+	return um.policy.MaxConcurrentUploads == 0 || len(um.active) < um.policy.MaxConcurrentUploads
+}
+
+// Enqueue starts sending the requested file or queues the request when all upload slots are busy
+func (um *uploadManager) Enqueue(node host.Host, request models.Transaction) error {
+	key := keyOf(request)
+	um.mu.Lock()
+	if um.busy(key) {
+		um.mu.Unlock()
+		return fmt.Errorf("upload %s to %s is already running or queued", request.TransactionID, request.RequesterID)
+	}
+	if um.hasFreeSlot() && len(um.queue) == 0 {
+		um.active[key] = request
+		um.mu.Unlock()
+		go um.run(node, request)
+		return nil
+	}
+
+	if um.policy.MaxQueueLength > 0 && len(um.queue) >= um.policy.MaxQueueLength {
+		um.mu.Unlock()
+		return fmt.Errorf("upload queue is full")
+	}
+
+	request.Status = "queued"
+	request.QueuePosition = len(um.queue) + 1
+	um.queue = append(um.queue, queuedUpload{node: node, request: request})
+	um.mu.Unlock()
+
+	log.Infof("upload of %s to %s queued at position %d", request.FileHash, request.RequesterID, request.QueuePosition)
+	go um.notifyQueued(request)
+	return nil
+}
+
+// busy reports whether the upload is running or waiting, caller holds um.mu
+func (um *uploadManager) busy(key uploadKey) bool {
+	if _, exists := um.active[key]; exists {
+		return true
+	}
+	for _, queued := range um.queue {
+		if keyOf(queued.request) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (um *uploadManager) run(node host.Host, request models.Transaction) {
+	defer um.finish(keyOf(request))
+	if um.send != nil {
+		um.send(node, request)
+		return
+	}
+	sendFile(node, request)
+}
+
+func (um *uploadManager) notifyQueued(request models.Transaction) {
+	if um.notify != nil {
+		um.notify(request)
+		return
+	}
+	sendQueuePosition(request)
+}
+
+func (um *uploadManager) finish(key uploadKey) {
+	um.mu.Lock()
+	delete(um.active, key)
+	um.mu.Unlock()
+	um.startQueued()
+}
+
+// move queued requests into free slots and tell everyone still waiting their new position
+func (um *uploadManager) startQueued() {
+	um.mu.Lock()
+	var started []queuedUpload
+	for len(um.queue) > 0 && um.hasFreeSlot() {
+		next := um.queue[0]
+		um.queue = um.queue[1:]
+		next.request.QueuePosition = 0
+		um.active[keyOf(next.request)] = next.request
+		started = append(started, next)
+	}
+
+	var moved []models.Transaction
+	if len(started) > 0 {
+		for i := range um.queue {
+			um.queue[i].request.QueuePosition = i + 1
+			moved = append(moved, um.queue[i].request)
+		}
+	}
+	um.mu.Unlock()
+
+	for _, upload := range started {
+		go um.run(upload.node, upload.request)
+	}
+	for _, request := range moved {
+		go um.notifyQueued(request)
+	}
+}
+
+// wrap a stream so writes respect the global and per-peer rate limits
+func (um *uploadManager) throttle(w io.Writer, peerID string) io.Writer {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	um.evictIdleLimiters(time.Now())
+	limiter, exists := um.perPeer[peerID]
+	if !exists {
+		limiter = newRateLimiter(um.policy.PerPeerRateLimit)
+		um.perPeer[peerID] = limiter
+	}
+	ctx := GlobalCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &throttledWriter{ctx: ctx, w: w, limiters: []*rateLimiter{um.global, limiter}}
+}
+
+// drop limiters of peers we haven't sent to in a while so the map doesn't grow with every peer ever served.
+// a peer with an upload running or queued keeps its limiter, a paused upload writes nothing for a while
+// but must not come back to a fresh bucket. callers hold um.mu
+func (um *uploadManager) evictIdleLimiters(now time.Time) {
+	inUse := make(map[string]bool)
+	for key := range um.active {
+		inUse[key.peerID] = true
+	}
+	for _, queued := range um.queue {
+		inUse[queued.request.RequesterID] = true
+	}
+	for peerID, limiter := range um.perPeer {
+		if !inUse[peerID] && limiter.idle(now, limiterIdleTimeout) {
+			delete(um.perPeer, peerID)
+		}
+	}
+}
+
+// read the saved upload policy, if any, so limits survive restarts
+func LoadUploadPolicy() error {
+	data, err := os.ReadFile(UploadPolicyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read upload policy: %v", err)
+	}
+
+	var policy models.UploadPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("failed to parse upload policy: %v", err)
+	}
+	return Uploads.SetPolicy(policy)
+}
+
+func SaveUploadPolicy(policy models.UploadPolicy) error {
+	if err := Uploads.SetPolicy(policy); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create utils directory: %v", err)
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload policy: %v", err)
+	}
+	if err := os.WriteFile(UploadPolicyPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write upload policy: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package dht_kad
+
+import (
+	"application-layer/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// go test -v -run ^TestRateLimiter$ -count=1 application-layer/dht
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(1000)
+	if delay := rl.reserve(1000); delay != 0 {
+		t.Errorf("a full bucket made us wait %v", delay)
+	}
+	// the bucket is empty now, 500 more bytes take about half a second to earn
+	delay := rl.reserve(500)
+	if delay < 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Errorf("waited %v for 500 bytes at 1000 B/s, want about 500ms", delay)
+	}
+
+	// tokens refill with time but never past one second's worth
+	rl.last = rl.last.Add(-10 * time.Second)
+	if delay := rl.reserve(1000); delay != 0 {
+		t.Errorf("a refilled bucket made us wait %v", delay)
+	}
+	if delay := rl.reserve(1); delay == 0 {
+		t.Errorf("bucket held more than one second of tokens")
+	}
+
+	rl.setRate(0)
+	if delay := rl.reserve(1 << 20); delay != 0 {
+		t.Errorf("unlimited rate made us wait %v", delay)
+	}
+
+	// idle only once nothing was reserved for the timeout and the bucket is full again
+	rl = newRateLimiter(100)
+	rl.reserve(100)
+	now := time.Now()
+	if rl.idle(now, time.Minute) {
+		t.Errorf("limiter idle right after use")
+	}
+	if !rl.idle(now.Add(2*time.Minute), time.Minute) {
+		t.Errorf("limiter not idle after two minutes")
+	}
+	rl.reserve(1000) // 9 seconds in debt
+	if rl.idle(rl.last.Add(5*time.Second), time.Second) {
+		t.Errorf("limiter idle while still refilling")
+	}
+}
+
+// go test -v -run ^TestLimiterEviction$ -count=1 application-layer/dht
+func TestLimiterEviction(t *testing.T) {
+	um := newUploadManager(models.UploadPolicy{PerPeerRateLimit: 100})
+	um.throttle(nil, "old")
+	um.throttle(nil, "busy")
+	um.perPeer["old"].last = time.Now().Add(-2 * limiterIdleTimeout)
+	um.perPeer["busy"].reserve(100)
+
+	// a paused upload writes nothing for a while, its peer keeps the limiter
+	um.throttle(nil, "paused")
+	um.perPeer["paused"].reserve(100)
+	um.perPeer["paused"].last = time.Now().Add(-2 * limiterIdleTimeout)
+	um.active[uploadKey{peerID: "paused", transactionID: "p"}] = models.Transaction{TransactionID: "p", RequesterID: "paused"}
+
+	um.throttle(nil, "new")
+	if _, exists := um.perPeer["old"]; exists {
+		t.Errorf("idle limiter was kept")
+	}
+	if _, exists := um.perPeer["paused"]; !exists {
+		t.Errorf("limiter of a paused upload was dropped")
+	}
+	if len(um.perPeer) != 3 {
+		t.Errorf("have %d limiters, want busy, paused and new", len(um.perPeer))
+	}
+}
+
+// go test -v -run ^TestUploadQueue$ -count=1 application-layer/dht
+func TestUploadQueue(t *testing.T) {
+	um := newUploadManager(models.UploadPolicy{MaxConcurrentUploads: 1, MaxQueueLength: 2})
+
+	var mu sync.Mutex
+	positions := make(map[string]int)
+	release := make(chan struct{})
+	started := make(chan string, 3)
+	notified := make(chan struct{}, 10)
+	um.send = func(node host.Host, request models.Transaction) {
+		started <- request.TransactionID
+		<-release
+	}
+	um.notify = func(request models.Transaction) {
+		mu.Lock()
+		positions[request.TransactionID] = request.QueuePosition
+		mu.Unlock()
+		notified <- struct{}{}
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := um.Enqueue(nil, models.Transaction{TransactionID: id}); err != nil {
+			t.Fatalf("failed to enqueue %s: %v", id, err)
+		}
+	}
+	if err := um.Enqueue(nil, models.Transaction{TransactionID: "d"}); err == nil {
+		t.Errorf("enqueued past the queue length")
+	}
+	if id := <-started; id != "a" {
+		t.Fatalf("started %s first", id)
+	}
+	<-notified
+	<-notified
+
+	status := um.Status()
+	if len(status.ActiveUploads) != 1 || len(status.QueuedUploads) != 2 {
+		t.Fatalf("status = %+v", status)
+	}
+	mu.Lock()
+	if positions["b"] != 1 || positions["c"] != 2 {
+		t.Errorf("positions = %v, want b at 1 and c at 2", positions)
+	}
+	mu.Unlock()
+
+	// finishing a starts b, c moves up to the front
+	release <- struct{}{}
+	if id := <-started; id != "b" {
+		t.Fatalf("started %s after a", id)
+	}
+	<-notified
+	mu.Lock()
+	if positions["c"] != 1 {
+		t.Errorf("c at position %d after b started", positions["c"])
+	}
+	mu.Unlock()
+
+	// raising the limit starts c without waiting for b
+	if err := um.SetPolicy(models.UploadPolicy{MaxConcurrentUploads: 2}); err != nil {
+		t.Fatalf("failed to set policy: %v", err)
+	}
+	if id := <-started; id != "c" {
+		t.Fatalf("started %s after raising the limit", id)
+	}
+
+	// the same transaction id from another peer is another upload, from the same peer it is a repeat
+	if err := um.Enqueue(nil, models.Transaction{TransactionID: "c", RequesterID: "other"}); err != nil {
+		t.Errorf("upload to another peer with the same id refused: %v", err)
+	}
+	if err := um.Enqueue(nil, models.Transaction{TransactionID: "c"}); err == nil {
+		t.Errorf("enqueued a running upload again")
+	}
+	close(release)
+}
@@ -1,11 +1,19 @@
 package dht_kad
 
+import "strings"
+
 type CustomValidator struct{}
 
 func (v *CustomValidator) Validate(key string, value []byte) error {
+	if strings.HasPrefix(key, seriesPrefix) {
+		return validateSeriesRecord(key, value)
+	}
 	return nil
 }
 
 func (v *CustomValidator) Select(key string, values [][]byte) (int, error) {
+	if strings.HasPrefix(key, seriesPrefix) {
+		return selectSeriesRecord(key, values)
+	}
 	return 0, nil
 }
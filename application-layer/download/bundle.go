@@ -0,0 +1,89 @@
+package download
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// which files of a downloaded bundle we have, e.g. GET /download/bundle?bundleHash=...
+func handleGetBundle(w http.ResponseWriter, r *http.Request) {
+	status, err := dht_kad.Bundles.Status(r.URL.Query().Get("bundleHash"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// fetch files of a bundle whose manifest we downloaded, all of them or the comma separated paths given
+// e.g. POST /download/bundle?bundleHash=...&paths=src/main.go,README.md
+func handleDownloadBundle(w http.ResponseWriter, r *http.Request) {
+	bundleHash := r.URL.Query().Get("bundleHash")
+	if bundleHash == "" {
+		http.Error(w, "bundle hash not provided", http.StatusBadRequest)
+		return
+	}
+	var paths []string
+	if value := r.URL.Query().Get("paths"); value != "" {
+		paths = strings.Split(value, ",")
+	}
+
+	requests, err := dht_kad.Bundles.MemberRequests(bundleHash, paths)
+	if errors.Is(err, dht_kad.ErrUnknownBundle) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(requests) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "nothing to download", "transactionIDs": []string{}})
+		return
+	}
+
+	// members are only handed out by the provider we got the manifest from
+	targetID := requests[0].TargetID
+	if targetID == "" {
+		http.Error(w, "Error: this is our own bundle", http.StatusBadRequest)
+		return
+	}
+	if err := dht_kad.ConnectToPeerUsingRelay(dht_kad.DHT.Host(), targetID); err != nil {
+		http.Error(w, "Failed to connect to target peer", http.StatusInternalServerError)
+		log.Debug(err)
+		return
+	}
+
+	transactionIDs := []string{}
+	for _, request := range requests {
+		request.RequesterID = dht_kad.PeerID
+		request.TransactionID = uuid.New().String()
+		request.Status = "pending"
+		request.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+
+		dht_kad.Transfers.Add(request)
+		if err := dht_kad.SendDownloadRequest(request); err != nil {
+			dht_kad.Transfers.Fail(request.TransactionID, err)
+			log.Debug(err)
+			http.Error(w, fmt.Sprintf("Failed to request %s, %d of %d requests sent", request.FileName, len(transactionIDs), len(requests)), http.StatusInternalServerError)
+			return
+		}
+		dht_kad.Mutex.Lock()
+		dht_kad.PendingRequests[request.TransactionID] = request
+		dht_kad.Mutex.Unlock()
+		utils.AddOrUpdateTransaction(request)
+		transactionIDs = append(transactionIDs, request.TransactionID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "requests sent", "transactionIDs": transactionIDs})
+}
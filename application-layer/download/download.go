@@ -5,8 +5,6 @@ import (
 	"application-layer/models"
 	"application-layer/utils"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -22,20 +20,38 @@ func handleDownloadRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request data", http.StatusBadRequest)
 		return
 	}
-	fmt.Println("handling download request for", request.FileHash)
+	log.Info("handling download request for", request.FileHash)
 	request.RequesterID = dht_kad.PeerID
 	request.TransactionID = uuid.New().String()
+
+	// without a provider picked by the user we go with the one we trust most
+	if request.TargetID == "" {
+		providers, err := dht_kad.ProvidersForFile(request.FileHash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if len(providers) == 0 {
+			http.Error(w, "Error: no usable provider for this file", http.StatusNotFound)
+			return
+		}
+		request.TargetID = providers[0].PeerID
+		request.Fee = providers[0].Provider.Fee
+	} else if dht_kad.Reputation.IsBlocked(request.TargetID) {
+		http.Error(w, "Error: provider is blocked", http.StatusForbidden)
+		return
+	}
 	// Log the requester and provider IDs
-	fmt.Printf("Requesting file download: Requester: %v | Provider: %v\n", request.RequesterID, request.TargetID)
+	log.Infof("Requesting file download: Requester: %v | Provider: %v", request.RequesterID, request.TargetID)
 
 	// handles when user tries to download a file they uploaded
 	// or redownload a file
 	if request.RequesterID == request.TargetID {
-		fmt.Println("handleDownloadRequest: attempting to download from self")
+		log.Info("handleDownloadRequest: attempting to download from self")
 		http.Error(w, "Error: You cannot download your own file", http.StatusBadRequest)
 		return
 	} else if dht_kad.FileHashToPath[request.FileHash] != "" {
-		fmt.Println("handleDownloadRequest: you already have this file")
+		log.Info("handleDownloadRequest: you already have this file")
 		http.Error(w, "Error: You have already downloaded this file", http.StatusBadRequest)
 		return
 	}
@@ -47,25 +63,48 @@ func handleDownloadRequest(w http.ResponseWriter, r *http.Request) {
 	// Connect to the target peer and send the download request via P2P
 	if err := dht_kad.ConnectToPeerUsingRelay(dht_kad.DHT.Host(), request.TargetID); err != nil {
 		http.Error(w, "Failed to connect to target peer", http.StatusInternalServerError)
-		log.Println(err)
+		log.Debug(err)
 		return
 	}
 
+	// encrypted downloads need the provider to hand out keys, which older clients can't
+	if request.Encrypted {
+		if supported, known := dht_kad.SupportsProtocol(request.TargetID, dht_kad.ProtocolTransferKey); known && !supported {
+			http.Error(w, "Error: provider does not support encrypted transfers", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// a quote fixes the price for a while, providers price requests without one themselves
+	if request.QuoteID == "" {
+		if supported, _ := dht_kad.SupportsProtocol(request.TargetID, dht_kad.ProtocolQuote); supported {
+			if quote, err := dht_kad.RequestQuote(request.TargetID, request.FileHash); err != nil {
+				log.Info("handleDownloadRequest: no quote, going with the listed fee:", err)
+			} else {
+				request.QuoteID, request.Fee = quote.QuoteID, quote.Fee
+			}
+		}
+	}
+
+	// the transfer is registered first, files only arrive for downloads we know about
+	dht_kad.Transfers.Add(request)
+
 	// actually send the download request
 	if err := dht_kad.SendDownloadRequest(request); err != nil {
+		dht_kad.Transfers.Fail(request.TransactionID, err)
 		http.Error(w, "Failed to send download request", http.StatusInternalServerError)
-		log.Println(err)
+		log.Debug(err)
 		return
 	}
 
 	// Store request in pending requests map (thread-safe)
 	dht_kad.Mutex.Lock()
-	dht_kad.PendingRequests[request.FileHash] = request
+	dht_kad.PendingRequests[request.TransactionID] = request
 	dht_kad.Mutex.Unlock()
 
 	utils.AddOrUpdateTransaction(request)
 
 	// Send acknowledgment back to the requester
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "request sent"})
+	json.NewEncoder(w).Encode(map[string]string{"status": "request sent", "transactionID": request.TransactionID})
 }
@@ -1,13 +1,30 @@
 package download
 
 import (
+	"application-layer/metrics"
 	"github.com/gorilla/mux"
 )
 
 func InitDownloadRoutes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(metrics.Middleware)
 
 	r.HandleFunc("/download/request", handleDownloadRequest).Methods("POST")
+	r.HandleFunc("/download/transfers", handleGetTransfers).Methods("GET")
+	r.HandleFunc("/download/pause", handlePauseTransfer).Methods("POST")
+	r.HandleFunc("/download/resume", handleResumeTransfer).Methods("POST")
+	r.HandleFunc("/download/cancel", handleCancelTransfer).Methods("POST")
+	r.HandleFunc("/download/pay", handlePayForTransfer).Methods("POST")
+	r.HandleFunc("/download/capabilities", handleGetPeerCapabilities).Methods("GET")
+	r.HandleFunc("/download/providers", handleGetRankedProviders).Methods("GET")
+	r.HandleFunc("/download/reputation", handleGetReputation).Methods("GET")
+	r.HandleFunc("/download/reputation/block", handleBlockPeer).Methods("POST")
+	r.HandleFunc("/download/reputation/unblock", handleUnblockPeer).Methods("POST")
+	r.HandleFunc("/download/reputation/settings", handleGetReputationSettings).Methods("GET")
+	r.HandleFunc("/download/reputation/settings", handleUpdateReputationSettings).Methods("POST")
+	r.HandleFunc("/download/bundle", handleGetBundle).Methods("GET")
+	r.HandleFunc("/download/bundle", handleDownloadBundle).Methods("POST")
+	r.HandleFunc("/download/quote", handleRequestQuote).Methods("POST")
 	// r.HandleFunc("/download/getRequests", handleGetPendingRequests).Methods("GET")
 	return r
 }
@@ -0,0 +1,5 @@
+package download
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("DWNL")
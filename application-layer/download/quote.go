@@ -0,0 +1,32 @@
+package download
+
+import (
+	dht_kad "application-layer/dht"
+	"encoding/json"
+	"net/http"
+)
+
+// ask a provider what a file costs us, e.g. POST /download/quote?targetID=...&fileHash=...
+// the quote's id can be passed as QuoteID to /download/request until it expires
+func handleRequestQuote(w http.ResponseWriter, r *http.Request) {
+	targetID := r.URL.Query().Get("targetID")
+	fileHash := r.URL.Query().Get("fileHash")
+	if targetID == "" || fileHash == "" {
+		http.Error(w, "target id and file hash are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.ConnectToPeerUsingRelay(dht_kad.DHT.Host(), targetID); err != nil {
+		http.Error(w, "Failed to connect to target peer", http.StatusInternalServerError)
+		log.Debug(err)
+		return
+	}
+	quote, err := dht_kad.RequestQuote(targetID, fileHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,97 @@
+package download
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// providers of a file best first, e.g. GET /download/providers?fileHash=...
+func handleGetRankedProviders(w http.ResponseWriter, r *http.Request) {
+	fileHash := r.URL.Query().Get("fileHash")
+	if fileHash == "" {
+		http.Error(w, "file hash not provided", http.StatusBadRequest)
+		return
+	}
+
+	providers, err := dht_kad.ProvidersForFile(fileHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(providers)
+}
+
+// reputation of every peer we know, or of a single one when peerID is given
+func handleGetReputation(w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peerID")
+
+	w.Header().Set("Content-Type", "application/json")
+	if peerID == "" {
+		json.NewEncoder(w).Encode(dht_kad.Reputation.List())
+		return
+	}
+	json.NewEncoder(w).Encode(dht_kad.Reputation.Get(peerID))
+}
+
+// e.g. POST /download/reputation/block?peerID=...&reason=...
+func handleBlockPeer(w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peerID")
+	if peerID == "" {
+		http.Error(w, "peer id not provided", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.Reputation.Block(peerID, r.URL.Query().Get("reason")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Info("blocked peer", peerID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dht_kad.Reputation.Get(peerID))
+}
+
+func handleUnblockPeer(w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peerID")
+	if peerID == "" {
+		http.Error(w, "peer id not provided", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.Reputation.Unblock(peerID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Info("unblocked peer", peerID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dht_kad.Reputation.Get(peerID))
+}
+
+func handleGetReputationSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dht_kad.Reputation.Settings())
+}
+
+// turn gossiping of signed reports on or off
+func handleUpdateReputationSettings(w http.ResponseWriter, r *http.Request) {
+	var settings models.ReputationSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.Reputation.SetSettings(settings); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update reputation settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("reputation settings updated: %+v", settings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,103 @@
+package download
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// progress of all downloads, or of a single one when transactionID is given
+func handleGetTransfers(w http.ResponseWriter, r *http.Request) {
+	transactionID := r.URL.Query().Get("transactionID")
+
+	w.Header().Set("Content-Type", "application/json")
+	if transactionID == "" {
+		json.NewEncoder(w).Encode(dht_kad.Transfers.List())
+		return
+	}
+
+	transfer, exists := dht_kad.Transfers.Get(transactionID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("transfer %s not found", transactionID), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func handlePauseTransfer(w http.ResponseWriter, r *http.Request) {
+	updateTransfer(w, r, dht_kad.Transfers.Pause)
+}
+
+func handleResumeTransfer(w http.ResponseWriter, r *http.Request) {
+	updateTransfer(w, r, dht_kad.Transfers.Resume)
+}
+
+func handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	updateTransfer(w, r, dht_kad.Transfers.Cancel)
+}
+
+func updateTransfer(w http.ResponseWriter, r *http.Request, action func(string) (models.Transfer, error)) {
+	transactionID := r.URL.Query().Get("transactionID")
+	if transactionID == "" {
+		http.Error(w, "transaction id not provided", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := action(transactionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// hand the provider proof of payment for an encrypted download so it releases the key
+// e.g. POST /download/pay?transactionID=...&paymentTxID=...
+// without a paymentTxID, a passphrase form value pays the provider's invoice from our wallet first
+func handlePayForTransfer(w http.ResponseWriter, r *http.Request) {
+	transactionID := r.URL.Query().Get("transactionID")
+	paymentTxID := r.URL.Query().Get("paymentTxID")
+	passphrase := r.FormValue("passphrase")
+	if transactionID == "" {
+		http.Error(w, "transaction id not provided", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if paymentTxID == "" && passphrase != "" {
+		_, err = dht_kad.PayTransferInvoice(transactionID, passphrase)
+	} else {
+		err = dht_kad.PayForTransfer(transactionID, paymentTxID)
+	}
+	if err != nil {
+		log.Info("handlePayForTransfer:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfer, _ := dht_kad.Transfers.Get(transactionID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// which of our stream protocols a provider speaks, e.g. before asking for an encrypted download
+func handleGetPeerCapabilities(w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peerID")
+	if peerID == "" {
+		http.Error(w, "peer id not provided", http.StatusBadRequest)
+		return
+	}
+
+	capabilities, err := dht_kad.PeerCapabilities(peerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(capabilities)
+}
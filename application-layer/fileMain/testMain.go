@@ -2,24 +2,41 @@
 package main
 
 import (
+	"application-layer/contacts"
 	dht_kad "application-layer/dht"
 	"application-layer/download"
 	"application-layer/files"
-	"fmt"
+	"application-layer/logging"
+	"application-layer/metrics"
+	"application-layer/websocket"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/rs/cors"
 )
 
 func main() {
-	fmt.Println("Main server started")
+	if err := logging.Init("files"); err != nil {
+		log.Fatal(err)
+	}
+	defer logging.Close()
+	mainLog := logging.Subsystem("MAIN")
+
+	mainLog.Info("Main server started")
+	if err := contacts.LoadAddressBook(); err != nil {
+		mainLog.Errorf("Failed to load address book, showing peers unlabeled: %v", err)
+	}
 
 	// Initialize additional routers
 	fileRouter := files.InitFileRoutes()
 	downloadRouter := download.InitDownloadRoutes()
+	contactsRouter := contacts.InitContactsRoutes()
 	// proxyRouter := proxyService.InitProxyRoutes()
+	dht_kad.Reprovider.SetPublisher(files.PublishFile) // republishing also moves old squidcoinFiles content into the blob store
 	go dht_kad.StartDHTService()
+	go websocket.BroadcastMessages()
+	go files.RunGarbageCollector(time.Hour)
 
 	// CORS handler
 	c := cors.New(cors.Options{
@@ -30,16 +47,30 @@ func main() {
 	})
 
 	// Combine both routers on the same port
-	http.Handle("/files/", c.Handler(fileRouter))        // File routes under /files
-	http.Handle("/download/", c.Handler(downloadRouter)) // Download routes under /download
+	http.Handle("/files/", c.Handler(fileRouter))             // File routes under /files
+	http.Handle("/download/", c.Handler(downloadRouter))      // Download routes under /download
+	http.Handle("/contacts", c.Handler(contactsRouter))       // the address book
+	http.Handle("/contacts/", c.Handler(contactsRouter))      // and its export and import
+	http.Handle("/ws", http.HandlerFunc(websocket.WsHandler)) // transfer progress events
+	http.Handle("/metrics", metrics.Handler())                // streams, dht and transfers for prometheus
+	http.Handle("/admin/loglevel", logging.Handler())         // get or change log levels per subsystem
 	// http.Handle("/proxy-data/", c.Handler(proxyRouter))
 	// http.Handle("/connect-proxy/", c.Handler(proxyRouter))
 	// http.Handle("/proxy-history/", c.Handler(proxyRouter))
 	// http.Handle("/disconnect-from-proxy/", c.Handler(proxyRouter))
 	// http.Handle("/stop-hosting/", c.Handler(proxyRouter))
 
+	// dht inspection and record changes for orcactl, never reachable from other hosts
+	adminAddress := "127.0.0.1:8083"
+	go func() {
+		mainLog.Infof("Starting dht admin server on %s...", adminAddress)
+		if err := http.ListenAndServe(adminAddress, files.InitDHTAdminRoutes()); err != nil {
+			mainLog.Errorf("DHT admin server stopped: %v", err)
+		}
+	}()
+
 	port := ":8081"
 
-	fmt.Printf("Starting server for files and proxy on port %s...\n", port)
+	mainLog.Infof("Starting server for files and proxy on port %s...", port)
 	log.Fatal(http.ListenAndServe(port, nil))
 }
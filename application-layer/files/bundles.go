@@ -0,0 +1,137 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"application-layer/storage"
+	"application-layer/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// publish a local directory as one bundle, e.g. POST /files/bundle with {"Directory": "...", "Fee": 10}
+// every file is added to the blob store, only the manifest is listed and priced
+func publishBundleHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.BundleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.Directory == "" || request.Fee < 0 {
+		http.Error(w, "a directory and a fee of at least 0 are required", http.StatusBadRequest)
+		return
+	}
+
+	status, err := publishBundle(request)
+	if errors.Is(err, dht_kad.ErrBadManifest) || errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to publish bundle: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func publishBundle(request models.BundleRequest) (models.BundleStatus, error) {
+	root, err := filepath.Abs(request.Directory)
+	if err != nil {
+		return models.BundleStatus{}, err
+	}
+	if request.Name == "" {
+		request.Name = filepath.Base(root)
+	}
+
+	manifest := models.BundleManifest{
+		Name:        request.Name,
+		Description: request.Description,
+		Entries:     []models.BundleEntry{},
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	// members are only kept by GC once the bundle is added below
+	var pinned []string
+	defer func() {
+		for _, hash := range pinned {
+			storage.Blobs.Unpin(hash)
+		}
+	}()
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// symlinks could point anywhere on the machine, only regular files are shared
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry, err := storage.Blobs.Import(path, d.Name(), "")
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %v", rel, err)
+		}
+		pinned = append(pinned, entry.Hash)
+		manifest.Entries = append(manifest.Entries, models.BundleEntry{
+			Path:      filepath.ToSlash(rel),
+			Hash:      entry.Hash,
+			Size:      entry.Size,
+			ChunkRoot: entry.ChunkRoot,
+		})
+		return nil
+	})
+	if err != nil {
+		return models.BundleStatus{}, err
+	}
+
+	data, err := dht_kad.EncodeManifest(manifest)
+	if err != nil {
+		return models.BundleStatus{}, err
+	}
+	entry, err := storage.Blobs.Put(bytes.NewReader(data), request.Name+".bundle.json", "")
+	if err != nil {
+		return models.BundleStatus{}, fmt.Errorf("failed to store manifest: %v", err)
+	}
+	pinned = append(pinned, entry.Hash)
+	if err := dht_kad.Bundles.Add(entry.Hash, manifest, ""); err != nil {
+		return models.BundleStatus{}, err
+	}
+
+	metadata := models.FileMetadata{
+		Name:              request.Name,
+		NameWithExtension: entry.Name,
+		Type:              models.BundleType,
+		Size:              entry.Size,
+		Description:       request.Description,
+		Hash:              entry.Hash,
+		IsPublished:       true,
+		Fee:               request.Fee,
+		CreatedAt:         manifest.CreatedAt,
+		OriginalUploader:  true,
+		ChunkRoot:         entry.ChunkRoot,
+	}
+	if _, err := utils.SaveOrUpdateFile(metadata, dirPath, UploadedFilePath); err != nil {
+		return models.BundleStatus{}, err
+	}
+	if err := PublishFile(metadata); err != nil {
+		return models.BundleStatus{}, err
+	}
+	log.Infof("published bundle %s with %d files as %s", request.Name, len(manifest.Entries), entry.Hash)
+	return dht_kad.Bundles.Status(entry.Hash)
+}
+
+// every bundle we published or downloaded the manifest of
+func getBundles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Bundles.List()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,107 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// dht inspection for orcactl, what used to be typed into the server's stdin
+
+func writeDHTJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func dhtErrorStatus(err error) int {
+	if errors.Is(err, dht_kad.ErrDHTNotStarted) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// our peer id, addresses and routing table size
+func getDHTStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := dht_kad.Status()
+	if err != nil {
+		http.Error(w, err.Error(), dhtErrorStatus(err))
+		return
+	}
+	writeDHTJSON(w, status)
+}
+
+// the peers we're connected to
+func getDHTPeers(w http.ResponseWriter, r *http.Request) {
+	peers, err := dht_kad.ConnectedPeers()
+	if err != nil {
+		http.Error(w, err.Error(), dhtErrorStatus(err))
+		return
+	}
+	writeDHTJSON(w, peers)
+}
+
+// e.g. GET /admin/dht/record?key=<file hash>, the key is without the /orcanet/ namespace
+func getDHTRecord(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key not provided", http.StatusBadRequest)
+		return
+	}
+	record, err := dht_kad.GetRecord(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeDHTJSON(w, record)
+}
+
+func putDHTRecord(w http.ResponseWriter, r *http.Request) {
+	var record models.DHTRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if record.Key == "" {
+		http.Error(w, "key not provided", http.StatusBadRequest)
+		return
+	}
+	if err := dht_kad.PutRecord(record.Key, record.Value); err != nil {
+		http.Error(w, err.Error(), dhtErrorStatus(err))
+		return
+	}
+	writeDHTJSON(w, record)
+}
+
+// e.g. GET /admin/dht/providers?key=<file hash>
+func getDHTProviders(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key not provided", http.StatusBadRequest)
+		return
+	}
+	providers, err := dht_kad.LookupProviders(key)
+	if err != nil {
+		http.Error(w, err.Error(), dhtErrorStatus(err))
+		return
+	}
+	writeDHTJSON(w, providers)
+}
+
+// e.g. POST /admin/dht/provide?key=<file hash> announces us as a provider
+func provideDHTKey(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key not provided", http.StatusBadRequest)
+		return
+	}
+	if err := dht_kad.ProvideRecord(key); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to provide %s: %v", key, err), dhtErrorStatus(err))
+		return
+	}
+	writeDHTJSON(w, map[string]string{"status": "providing", "key": key})
+}
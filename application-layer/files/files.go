@@ -1,43 +1,39 @@
 package files
 
 import (
+	"application-layer/contacts"
 	dht_kad "application-layer/dht"
 	"application-layer/models"
+	"application-layer/storage"
 	"application-layer/utils"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 )
 
 var (
-	dirPath               = filepath.Join("..", "..", "utils")
-	UploadedFilePath      = filepath.Join(dirPath, "files.json")
-	DownloadedFilePath    = filepath.Join(dirPath, "downloadedFiles.json")
-	transactionFilePath   = filepath.Join(dirPath, "transactionFiles.json")
-	FileCopyPath          = filepath.Join("..", "..", "squidcoinFiles")
-	republishMutex        sync.Mutex
-	republishedUploaded   = false
-	republishedDownloaded = false
+	dirPath             = filepath.Join("..", "..", "utils")
+	UploadedFilePath    = filepath.Join(dirPath, "files.json")
+	DownloadedFilePath  = filepath.Join(dirPath, "downloadedFiles.json")
+	transactionFilePath = filepath.Join(dirPath, "transactionFiles.json")
+	FileCopyPath        = storage.FileCopyPath
 )
 
 // fetch all uploaded files from JSON file
 func getFiles(w http.ResponseWriter, r *http.Request) {
 	fileType := r.URL.Query().Get("file")
-	fmt.Printf("trying to fetch user's %v files \n", fileType)
+	log.Infof("trying to fetch user's %v files", fileType)
 
 	var filePath string
 	if fileType == "uploaded" {
-		fmt.Println("getting uploaded files")
+		log.Info("getting uploaded files")
 		filePath = UploadedFilePath
 	} else {
-		fmt.Println("getting downloaded files")
+		log.Info("getting downloaded files")
 		filePath = DownloadedFilePath
 	}
 
@@ -45,7 +41,7 @@ func getFiles(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			fmt.Printf("No %s files found for user\n", fileType)
+			log.Infof("No %s files found for user", fileType)
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]models.FileMetadata{}) // Return empty array
 			return
@@ -60,22 +56,7 @@ func getFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	republishMutex.Lock()
-	defer republishMutex.Unlock()
-	fmt.Printf("republishedUploaded: %v | republishedDownloaded: %v\n ", republishedUploaded, republishedDownloaded)
-	if !republishedUploaded || !republishedDownloaded {
-		if fileType == "uploaded" {
-			fmt.Println("republishing uploaded files")
-			republishFiles(UploadedFilePath)
-			republishedUploaded = true
-		} else {
-			fmt.Println("republishing downloaded files")
-			republishFiles(DownloadedFilePath)
-			republishedDownloaded = true
-		}
-	}
-
-	fmt.Println("fileHashToPath:", dht_kad.FileHashToPath)
+	log.Trace("fileHashToPath:", dht_kad.FileHashToPath)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(files); err != nil {
@@ -85,8 +66,10 @@ func getFiles(w http.ResponseWriter, r *http.Request) {
 }
 
 // add new file or update existing file
+// the content must already be in the blob store or saved under its name in squidcoinFiles,
+// new uploads should prefer /files/ingest which takes the content itself
 func uploadFileHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("uploadFileHandler")
+	log.Info("uploadFileHandler")
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -94,33 +77,42 @@ func uploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	isNewFile := r.URL.Query().Get("val")
-	fmt.Println("isNewFile:", isNewFile)
+	log.Debug("isNewFile:", isNewFile)
 	var requestBody models.FileMetadata
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		fmt.Println("invalid request body", err)
+		log.Warn("invalid request body", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	data, _ := dht_kad.DHT.GetValue(dht_kad.GlobalCtx, "/orcanet/"+requestBody.Hash)
-	fmt.Println("file already in dht: ", data)
+
+	// the hash and size the client sent are only claims, take them from the content itself
+	if err := verifyUploadContent(&requestBody); err != nil {
+		log.Info("uploadFileHandler: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer storage.Blobs.Unpin(requestBody.Hash)
+
+	data, _ := dht_kad.GetValue(dht_kad.GlobalCtx, "/orcanet/"+requestBody.Hash)
+	log.Debug("file already in dht: ", data)
 	if data != nil && isNewFile == "true" {
 		w.WriteHeader(http.StatusBadRequest) // 400 for client error
 		json.NewEncoder(w).Encode(map[string]string{"error": "File already uploaded"})
 		return
 	}
 
-	fmt.Println("UPLOAD FILE HANDLER: FILEHASH ", requestBody.Hash)
+	log.Debug("UPLOAD FILE HANDLER: FILEHASH ", requestBody.Hash)
 
 	var filePath string
-	fmt.Println("original uploader: ", requestBody.OriginalUploader)
+	log.Debug("original uploader: ", requestBody.OriginalUploader)
 	if requestBody.OriginalUploader {
-		fmt.Println("updating uploaded file path")
+		log.Info("updating uploaded file path")
 		filePath = UploadedFilePath
 	} else {
-		fmt.Println("updating downloaded file path")
+		log.Info("updating downloaded file path")
 		filePath = DownloadedFilePath
 	}
-	fmt.Println("filePath: ", filePath)
+	log.Debug("filePath: ", filePath)
 	action, err := utils.SaveOrUpdateFile(requestBody, dirPath, filePath)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -132,37 +124,41 @@ func uploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	responseMsg := fmt.Sprintf("File %s successfully: %s", action, requestBody.Name)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(responseMsg))
-	fmt.Println(responseMsg)
+	log.Debug(responseMsg)
 }
 
-func PublishFile(requestBody models.FileMetadata) {
-	fmt.Println("publishing new file")
+// also used by the reprovider to refresh files in the background
+func PublishFile(requestBody models.FileMetadata) error {
+	log.Info("publishing new file")
 
 	dhtMetadata, err := dht_kad.UpdateFileInDHT(requestBody)
 	if err != nil {
-		fmt.Printf("unable to update file in the dht %v\n", err)
-		return
+		log.Errorf("unable to update file in the dht %v", err)
+		return err
 	}
 
-	currentDir, err := os.Getwd()
+	newPath, err := storeFileContent(requestBody)
 	if err != nil {
-		fmt.Printf("error getting currentDir %v\n", err)
-		return
+		log.Errorf("unable to add %s to the blob store: %v", requestBody.Hash, err)
+		return err
 	}
-
-	newPath := filepath.Join(currentDir, "../../squidcoinFiles", requestBody.NameWithExtension)
 	dht_kad.FileMapMutex.Lock()
 	dht_kad.FileHashToPath[requestBody.Hash] = newPath
-	fmt.Println("PublishFile: fileHashToPath: ", dht_kad.FileHashToPath)
+	log.Trace("PublishFile: fileHashToPath:", dht_kad.FileHashToPath)
 	dht_kad.FileMapMutex.Unlock()
 
-	dht_kad.SendCloudNodeFiles(dhtMetadata)
+	// the cloud node only feeds the marketplace, the file is provided either way
+	if err := dht_kad.SendCloudNodeFiles(dhtMetadata); err != nil {
+		log.Info("PublishFile:", err)
+	}
+	dht_kad.Reprovider.MarkProvided(requestBody)
+	return nil
 }
 
 // bug
 func handleGetFileByHash(w http.ResponseWriter, r *http.Request) {
 	fileHash := r.URL.Query().Get("val")
-	fmt.Println("handleGetFileByHash: filehash:", fileHash)
+	log.Debug("handleGetFileByHash: filehash:", fileHash)
 
 	if fileHash == "" {
 		http.Error(w, "File hash not provided", http.StatusBadRequest)
@@ -170,7 +166,7 @@ func handleGetFileByHash(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve the file data from the DHT using the file hash
-	data, err := dht_kad.DHT.GetValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash)
+	data, err := dht_kad.GetValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving file data: %v", err), http.StatusInternalServerError)
 		return
@@ -187,7 +183,7 @@ func handleGetFileByHash(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Println("file requested metadata: ", metadata)
+	log.Debug("file requested metadata: ", metadata)
 
 	// Send the entire metadata (including providers) as JSON response
 	w.Header().Set("Content-Type", "application/json")
@@ -214,14 +210,14 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "did not specify is user uplaoded the file or downloaded it", http.StatusBadRequest)
 		return
 	}
-	fmt.Println("user is original uploader?", originalUploader)
+	log.Debug("user is original uploader?", originalUploader)
 
 	name := r.URL.Query().Get("name")
 	if name == "" {
 		http.Error(w, "file name not provided", http.StatusBadRequest)
 		return
 	}
-	fmt.Println("trying to delete file", name)
+	log.Info("trying to delete file", name)
 
 	var filePath string
 	if originalUploader == "true" {
@@ -230,23 +226,25 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 		filePath = DownloadedFilePath
 	}
 
-	err := deleteFileContent(name) // currently using file name but we should switch to hash
+	// unlist the file first, the content is only removed once nothing else refers to it
+	// update so it works for both uploaded and downloaded files
+	action, err := deleteFileFromJSON(hash, filePath)
 	if err != nil {
-		http.Error(w, fmt.Sprint("failed to delete file from squidcoinFiles", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprint("failed to delete file json file", err), http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("successfully deleted file content from squidcoin files")
 
 	dht_kad.FileMapMutex.Lock()
 	delete(dht_kad.FileHashToPath, hash) // delete from map of file hash to file path
 	dht_kad.FileMapMutex.Unlock()
+	dht_kad.Reprovider.Forget(hash)
 
-	// update so it works for both uploaded and downloaded files
-	action, err := deleteFileFromJSON(hash, filePath)
-	if err != nil { // will still show up but will not be able to provide
-		http.Error(w, fmt.Sprint("failed to delete file json file", err), http.StatusInternalServerError)
+	err = deleteFileContent(hash, name)
+	if err != nil { // unlisted already, the next garbage collection picks up the content
+		http.Error(w, fmt.Sprint("failed to delete file from squidcoinFiles", err), http.StatusInternalServerError)
 		return
 	}
+	log.Info("successfully deleted file content from squidcoin files")
 
 	// remove provider bc we deleted file
 	err = removeProvider(hash, true)
@@ -266,34 +264,34 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 }
 
 func removeProvider(hash string, isDelete bool) error {
-	fmt.Println("removing provider from dht - deleting from dht: ", isDelete)
+	log.Debug("removing provider from dht - deleting from dht: ", isDelete)
 	var metadata models.DHTMetadata
 
-	data, err := dht_kad.DHT.GetValue(dht_kad.GlobalCtx, "/orcanet/"+hash)
-	fmt.Println("removeProvider: data after dht getvalue:", data)
+	data, err := dht_kad.GetValue(dht_kad.GlobalCtx, "/orcanet/"+hash)
+	log.Debug("removeProvider: data after dht getvalue:", data)
 	if err != nil {
-		fmt.Println("dht error: ", err)
+		log.Error("dht error: ", err)
 		return fmt.Errorf("failed to get file from dht for provider updating: %v", err)
 	}
 
 	err = json.Unmarshal(data, &metadata)
-	fmt.Println("removeProvider: updating", metadata)
+	log.Debug("removeProvider: updating", metadata)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal data: %v", err)
 	}
 
 	// delete the provider
 	if isDelete {
-		fmt.Println("before deleting provider:", metadata.Providers)
+		log.Debug("before deleting provider:", metadata.Providers)
 		delete(metadata.Providers, dht_kad.PeerID)
-		fmt.Println("after deleting provider:", metadata.Providers)
+		log.Debug("after deleting provider:", metadata.Providers)
 	} else {
 		// mark unavailable
-		fmt.Println("before marking provider as inactive:", metadata.Providers)
+		log.Debug("before marking provider as inactive:", metadata.Providers)
 		if value, exists := metadata.Providers[dht_kad.PeerID]; exists {
 			value.IsActive = false
 			metadata.Providers[dht_kad.PeerID] = value // Reassign after modification
-			fmt.Println("after marking provider as inactive:", metadata.Providers)
+			log.Debug("after marking provider as inactive:", metadata.Providers)
 		}
 	}
 	return nil
@@ -302,7 +300,7 @@ func removeProvider(hash string, isDelete bool) error {
 // removeFileFromJSON removes the file entry with the given hash from the JSON file
 func deleteFileFromJSON(fileHash string, filePath string) (string, error) {
 	// Read the JSON file
-	fmt.Println("deleting file from JSON:", filePath)
+	log.Info("deleting file from JSON:", filePath)
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read files.json: %v", err)
@@ -338,35 +336,143 @@ func deleteFileFromJSON(fileHash string, filePath string) (string, error) {
 		return "", fmt.Errorf("failed to write updated data to files.json: %v", err)
 	}
 
-	fmt.Println("successfully deleted file from json")
+	log.Info("successfully deleted file from json")
 	return "deleted", nil
 }
 
-// currently using file name but user can download files of the same name
-// from different providers so we have to switch to file hash
-func deleteFileContent(hash string) error {
-	filePath := filepath.Join(FileCopyPath, hash)
+// make sure the content of a published file is in the blob store and return its path
+// files copied into squidcoinFiles by name are moved into the store the first time they are published
+func storeFileContent(file models.FileMetadata) (string, error) {
+	blobPath, err := storage.Blobs.Path(file.Hash)
+	if err != nil {
+		return "", err
+	}
+	if storage.Blobs.Has(file.Hash) {
+		return blobPath, nil
+	}
 
-	// Attempt to delete the file
-	err := os.Remove(filePath)
+	legacyPath := filepath.Join(FileCopyPath, storage.SanitizeName(file.NameWithExtension))
+	if _, err := storage.Blobs.Import(legacyPath, file.NameWithExtension, file.Hash); err != nil {
+		return "", fmt.Errorf("failed to import %s: %w", legacyPath, err)
+	}
+	// already listed in files.json, nothing to protect it from
+	storage.Blobs.Unpin(file.Hash)
+	if err := os.Remove(legacyPath); err != nil {
+		log.Errorf("imported %s but could not remove the original: %v", legacyPath, err)
+	}
+	return blobPath, nil
+}
+
+// remove the blob for hash, and any copy still stored under its name from before the blob store
+// the blob stays while the other files list, a bundle or the serving map still refers to it
+func deleteFileContent(hash string, name string) error {
+	keep, err := referencedBlobs()
 	if err != nil {
-		fmt.Printf("Failed to delete file: %v\n", err)
 		return err
 	}
+	if keep[hash] {
+		log.Infof("keeping content of %s, it is still in use", hash)
+		return nil
+	}
 
-	fmt.Println("File deleted successfully")
+	err = storage.Blobs.Remove(hash)
+	if errors.Is(err, storage.ErrPinned) {
+		log.Infof("keeping content of %s, it is being added again", hash)
+		return nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Errorf("Failed to delete file: %v", err)
+		return err
+	}
+
+	legacyPath := filepath.Join(FileCopyPath, storage.SanitizeName(name))
+	legacyErr := os.Remove(legacyPath)
+	if errors.Is(err, storage.ErrNotFound) && legacyErr != nil {
+		log.Errorf("Failed to delete file: %v", legacyErr)
+		return legacyErr
+	}
+
+	log.Info("File deleted successfully")
 	return nil
 }
 
+// remove blobs that are no longer listed in files.json, downloadedFiles.json or a bundle we hold
+func collectGarbage() (models.GCReport, error) {
+	keep, err := referencedBlobs()
+	if err != nil {
+		return models.GCReport{}, err
+	}
+	return storage.Blobs.GC(keep)
+}
+
+// hashes of every blob listed in files.json, downloadedFiles.json, a bundle we hold or being served
+func referencedBlobs() (map[string]bool, error) {
+	keep := make(map[string]bool)
+	for _, filePath := range []string{UploadedFilePath, DownloadedFilePath} {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %v", filePath, err)
+		}
+
+		var files []models.FileMetadata
+		if err := json.Unmarshal(data, &files); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", filePath, err)
+		}
+		for _, file := range files {
+			keep[file.Hash] = true
+		}
+	}
+
+	// bundle members aren't listed in either file
+	for hash := range dht_kad.Bundles.Keep() {
+		keep[hash] = true
+	}
+
+	// never collect a file that is being served right now
+	dht_kad.FileMapMutex.Lock()
+	for hash := range dht_kad.FileHashToPath {
+		keep[hash] = true
+	}
+	dht_kad.FileMapMutex.Unlock()
+
+	return keep, nil
+}
+
+func handleGarbageCollection(w http.ResponseWriter, r *http.Request) {
+	report, err := collectGarbage()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("garbage collection failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("garbage collection removed %d blobs and %d temp files", len(report.RemovedBlobs), report.RemovedTemp)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RunGarbageCollector cleans up orphaned blobs on a fixed interval
+func RunGarbageCollector(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := collectGarbage(); err != nil {
+			log.Errorf("garbage collection failed: %v", err)
+		}
+	}
+}
+
 // functions below are used in marketplace to get all dht files
 func getMarketplaceFiles(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("getting marketplace files")
+	log.Info("getting marketplace files")
 	initialFetch := r.URL.Query().Get("val")
 
 	if initialFetch == "true" && dht_kad.MarketplaceFiles != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(dht_kad.MarketplaceFiles); err != nil {
+		if err := json.NewEncoder(w).Encode(contacts.LabelListings(dht_kad.Moderation.FilterListing(dht_kad.MarketplaceFiles))); err != nil {
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		}
 		return
@@ -378,66 +484,31 @@ func getMarketplaceFiles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Wait for the response on the channel
-	fmt.Println("Waiting for marketplace files response...")
+	log.Info("Waiting for marketplace files response...")
 	select {
-	case receivedFiles := <-dht_kad.MarketplaceFilesSignal:
-		fmt.Println(receivedFiles)
-		fmt.Printf("getMarketplaceFiles: RECEIVED FILES: \n\n %v \n", dht_kad.MarketplaceFiles)
+	case <-dht_kad.MarketplaceFilesSignal:
+		log.Debugf("getMarketplaceFiles: received %d files", len(dht_kad.MarketplaceFiles))
+		log.Trace("getMarketplaceFiles:", dht_kad.MarketplaceFiles)
 		// Send response to the frontend
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(dht_kad.MarketplaceFiles); err != nil {
+		if err := json.NewEncoder(w).Encode(contacts.LabelListings(dht_kad.Moderation.FilterListing(dht_kad.MarketplaceFiles))); err != nil {
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		}
 	case <-time.After(5 * time.Second): // Timeout to avoid blocking indefinitely
 		http.Error(w, "Timed out waiting for response", http.StatusGatewayTimeout)
 	}
-	fmt.Println("getMarketplaceFiles: Finished processing")
-}
-
-// republish files in the dht incase the TTL expired - called upon successful login
-func republishFiles(filePath string) {
-	fmt.Println("republishing files in ", filePath)
-	// Open the JSON file
-	file, err := os.Open(filePath) // Replace "files.json" with your file name
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("No files to republish, node has not uploaded any files.")
-			return
-		}
-		log.Fatalf("Failed to open file: %v", err)
-	}
-	defer file.Close()
-
-	// Read file content
-	byteValue, err := io.ReadAll(file)
-	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
-	}
-
-	// Parse JSON into structs
-	var files []models.FileMetadata
-	err = json.Unmarshal(byteValue, &files)
-	if err != nil {
-		log.Fatalf("Failed to unmarshal JSON: %v", err)
-	}
-
-	// Print parsed structs
-	for _, file := range files {
-		fmt.Printf("Republishing File: %+v\n", file)
-		PublishFile(file)
-	}
-
+	log.Info("getMarketplaceFiles: Finished processing")
 }
 
 // transactions page
 func getTransactions(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("getting transaction history")
+	log.Info("getting transaction history")
 	transactionFile, err := os.ReadFile(transactionFilePath)
 
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			fmt.Println("transactionFiles.json could not be found")
+			log.Error("transactionFiles.json could not be found")
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]models.Transaction{}) // Return empty array
 			return
@@ -453,7 +524,7 @@ func getTransactions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(transactions); err != nil {
+	if err := json.NewEncoder(w).Encode(contacts.LabelTransactions(transactions)); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
@@ -1,13 +1,16 @@
 package files
 
 import (
+	"application-layer/metrics"
 	"github.com/gorilla/mux"
 )
 
 func InitFileRoutes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(metrics.Middleware)
 
 	r.HandleFunc("/files/upload", uploadFileHandler).Methods("POST")
+	r.HandleFunc("/files/ingest", ingestFileHandler).Methods("POST")
 	r.HandleFunc("/files/fetch", getFiles).Methods("GET")
 	r.HandleFunc("/files/getFile", handleGetFileByHash).Methods("GET")
 	r.HandleFunc("/files/delete", deleteFile).Methods("DELETE")
@@ -15,6 +18,40 @@ func InitFileRoutes() *mux.Router {
 	r.HandleFunc("/files/getTransactions", getTransactions).Methods("GET")
 	r.HandleFunc("/files/vote", handleVote).Methods("POST")
 	r.HandleFunc("/files/getRating", handleGetRating).Methods("GET")
+	r.HandleFunc("/files/uploadPolicy", getUploadStatus).Methods("GET")
+	r.HandleFunc("/files/uploadPolicy", updateUploadPolicy).Methods("PUT")
+	r.HandleFunc("/files/gc", handleGarbageCollection).Methods("POST")
+	r.HandleFunc("/files/reprovider", getReproviderStatus).Methods("GET")
+	r.HandleFunc("/files/reprovider", triggerReprovide).Methods("POST")
+	r.HandleFunc("/files/moderation", getModeration).Methods("GET")
+	r.HandleFunc("/files/moderation", updateModerationPolicy).Methods("PUT")
+	r.HandleFunc("/files/report", reportFile).Methods("POST")
+	r.HandleFunc("/files/takedowns", getTakedowns).Methods("GET")
+	r.HandleFunc("/files/series", getSeries).Methods("GET")
+	r.HandleFunc("/files/series", createSeries).Methods("POST")
+	r.HandleFunc("/files/series/version", addSeriesVersion).Methods("POST")
+	r.HandleFunc("/files/bundle", publishBundleHandler).Methods("POST")
+	r.HandleFunc("/files/bundles", getBundles).Methods("GET")
+	r.HandleFunc("/files/pricing", getPricingPolicy).Methods("GET")
+	r.HandleFunc("/files/pricing", updatePricingPolicy).Methods("PUT")
+	r.HandleFunc("/files/seeding", getSeedingStatus).Methods("GET")
+	r.HandleFunc("/files/seeding", updateSeedingPolicy).Methods("PUT")
+	r.HandleFunc("/files/earnings", getEarnings).Methods("GET")
 	// r.HandleFunc("/files/searchByName", handleGetFilesByName).Methods("GET")
 	return r
 }
+
+// InitDHTAdminRoutes has the dht inspection orcactl uses, putrecord and provide change what we publish,
+// so these are served on their own listener on localhost only, see fileMain/testMain.go
+func InitDHTAdminRoutes() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(metrics.Middleware)
+
+	r.HandleFunc("/admin/dht/status", getDHTStatus).Methods("GET")
+	r.HandleFunc("/admin/dht/peers", getDHTPeers).Methods("GET")
+	r.HandleFunc("/admin/dht/record", getDHTRecord).Methods("GET")
+	r.HandleFunc("/admin/dht/record", putDHTRecord).Methods("PUT")
+	r.HandleFunc("/admin/dht/providers", getDHTProviders).Methods("GET")
+	r.HandleFunc("/admin/dht/provide", provideDHTKey).Methods("POST")
+	return r
+}
@@ -0,0 +1,223 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"application-layer/storage"
+	"application-layer/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ingestFileHandler receives the file content itself, hashes it on the server and publishes it
+// accepts multipart/form-data with a "file" part (plus optional "description", "fee", "name" fields)
+// or a raw body with the same values as query params, e.g. POST /files/ingest?name=notes.txt&fee=10
+func ingestFileHandler(w http.ResponseWriter, r *http.Request) {
+	log.Info("ingestFileHandler")
+
+	var (
+		blob   *storage.BlobWriter
+		fields = map[string]string{}
+		ctype  string
+		err    error
+	)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		blob, ctype, err = readMultipartUpload(r, fields)
+	} else {
+		for key := range r.URL.Query() {
+			fields[key] = r.URL.Query().Get(key)
+		}
+		ctype = mediaType
+		blob, err = readRawUpload(r.Body, fields["name"])
+	}
+	if err != nil {
+		log.Info("ingestFileHandler: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fee, err := parseFee(fields["fee"])
+	if err != nil {
+		blob.Abort()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// only the first upload of some content counts as new
+	alreadyStored := storage.Blobs.Has(blob.Hash())
+	data, _ := dht_kad.GetValue(dht_kad.GlobalCtx, "/orcanet/"+blob.Hash())
+	if data != nil {
+		log.Info("file already in dht: ", blob.Hash())
+		blob.Abort()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "File already uploaded", "hash": blob.Hash()})
+		return
+	}
+
+	entry, err := blob.Commit("")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to store file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if ctype == "" || ctype == "application/octet-stream" {
+		if guessed := mime.TypeByExtension(filepath.Ext(entry.Name)); guessed != "" {
+			ctype = guessed
+		}
+	}
+
+	metadata := models.FileMetadata{
+		Name:              strings.TrimSuffix(entry.Name, filepath.Ext(entry.Name)),
+		NameWithExtension: entry.Name,
+		Type:              ctype,
+		Size:              entry.Size,
+		Description:       fields["description"],
+		Hash:              entry.Hash,
+		IsPublished:       true,
+		Fee:               fee,
+		CreatedAt:         time.Now().Format(time.RFC3339),
+		OriginalUploader:  true,
+		ChunkRoot:         entry.ChunkRoot,
+	}
+
+	_, err = utils.SaveOrUpdateFile(metadata, dirPath, UploadedFilePath)
+	storage.Blobs.Unpin(entry.Hash)
+	if err != nil {
+		if !alreadyStored {
+			storage.Blobs.Remove(entry.Hash)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	PublishFile(metadata)
+
+	log.Infof("ingested %s (%d bytes) as %s", metadata.NameWithExtension, metadata.Size, metadata.Hash)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// streams the "file" part into the blob store, any other parts are collected as form fields
+func readMultipartUpload(r *http.Request, fields map[string]string) (*storage.BlobWriter, string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid multipart body: %v", err)
+	}
+
+	var (
+		blob  *storage.BlobWriter
+		ctype string
+	)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if blob != nil {
+				blob.Abort()
+			}
+			return nil, "", fmt.Errorf("failed to read multipart body: %v", err)
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 64*1024))
+			part.Close()
+			if err != nil {
+				if blob != nil {
+					blob.Abort()
+				}
+				return nil, "", fmt.Errorf("failed to read field %s: %v", part.FormName(), err)
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		if blob != nil {
+			blob.Abort()
+			return nil, "", fmt.Errorf("only one file can be uploaded per request")
+		}
+		name := part.FileName()
+		if fields["name"] != "" {
+			name = fields["name"]
+		}
+		ctype = part.Header.Get("Content-Type")
+		blob, err = readRawUpload(part, name)
+		part.Close()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if blob == nil {
+		return nil, "", fmt.Errorf("missing file part")
+	}
+	return blob, ctype, nil
+}
+
+func readRawUpload(body io.Reader, name string) (*storage.BlobWriter, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing file name")
+	}
+	blob, err := storage.Blobs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(blob, body); err != nil {
+		blob.Abort()
+		return nil, fmt.Errorf("failed to receive file: %v", err)
+	}
+	return blob, nil
+}
+
+func parseFee(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	fee, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || fee < 0 {
+		return 0, fmt.Errorf("invalid fee: %s", value)
+	}
+	return fee, nil
+}
+
+// verifyUploadContent fills in the hash, size and chunk root of a file from its content rather than the client
+// content saved by name in squidcoinFiles is hashed and moved into the blob store,
+// a hash we already hold is trusted as the blob store checked it on the way in
+// on success the blob is pinned until the caller has listed it and calls Unpin
+func verifyUploadContent(metadata *models.FileMetadata) error {
+	if metadata.Hash != "" && !storage.ValidHash(metadata.Hash) {
+		return fmt.Errorf("invalid file hash %q", metadata.Hash)
+	}
+	alreadyStored := storage.Blobs.Has(metadata.Hash)
+	legacyPath := filepath.Join(FileCopyPath, storage.SanitizeName(metadata.NameWithExtension))
+	entry, err := storage.Blobs.Import(legacyPath, metadata.NameWithExtension, metadata.Hash)
+	if errors.Is(err, storage.ErrHashMismatch) {
+		return fmt.Errorf("content of %s does not match its hash: %v", metadata.NameWithExtension, err)
+	} else if err != nil {
+		return fmt.Errorf("content of %s not found, upload it to /files/ingest instead: %v", metadata.NameWithExtension, err)
+	}
+	if !alreadyStored {
+		if err := os.Remove(legacyPath); err != nil {
+			log.Errorf("imported %s but could not remove the original: %v", legacyPath, err)
+		}
+	}
+
+	metadata.Hash = entry.Hash
+	metadata.Size = entry.Size
+	metadata.ChunkRoot = entry.ChunkRoot
+	return nil
+}
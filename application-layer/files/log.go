@@ -0,0 +1,5 @@
+package files
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("FILE")
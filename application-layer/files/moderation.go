@@ -0,0 +1,72 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"application-layer/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// allow and deny lists together with the takedown notices we know of
+func getModeration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Moderation.Status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// replace the allow and deny lists, empty allow lists allow everything
+func updateModerationPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.ModerationPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.Moderation.SetPolicy(policy); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update moderation policy: %v", err), http.StatusBadRequest)
+		return
+	}
+	log.Infof("moderation policy updated: %+v", policy)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Moderation.Status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// report a file, e.g. POST /files/report?hash=...&reason=...
+// we stop serving and listing it and send a signed takedown notice to our peers
+func reportFile(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	reason := r.URL.Query().Get("reason")
+	if hash == "" || reason == "" {
+		http.Error(w, "hash and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	notice, err := dht_kad.Moderation.IssueTakedown(hash, reason)
+	if errors.Is(err, storage.ErrInvalidHash) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to report file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("reported file %s: %s", hash, reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(notice); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func getTakedowns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Moderation.Status().Notices); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
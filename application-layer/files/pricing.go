@@ -0,0 +1,37 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// the rules our quotes are made from
+func getPricingPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Pricing.Policy()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// replace the pricing rules, quotes already given out keep their price until they expire
+func updatePricingPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.PricingPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.Pricing.SetPolicy(policy); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update pricing: %v", err), http.StatusBadRequest)
+		return
+	}
+	log.Infof("pricing updated: %d rules", len(policy.Rules))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Pricing.Policy()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
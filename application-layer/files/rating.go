@@ -5,7 +5,6 @@ import (
 	"application-layer/models"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"sync"
@@ -19,11 +18,11 @@ var fileMutex sync.Mutex // used by cloud-node
 
 // Handle voting for both upvotes and downvotes
 func handleVote(w http.ResponseWriter, r *http.Request) {
-	log.Println("in handleVote")
+	log.Info("in handleVote")
 
 	fileHash := r.URL.Query().Get("fileHash")
 	voteType := r.URL.Query().Get("voteType")
-	log.Printf("file hash: %s | vote type: %s\n", fileHash, voteType)
+	log.Infof("file hash: %s | vote type: %s", fileHash, voteType)
 
 	if fileHash == "" || voteType == "" {
 		http.Error(w, `{"error": "File hash or vote type not provided"}`, http.StatusBadRequest)
@@ -31,12 +30,12 @@ func handleVote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := votingHelper(fileHash, voteType); err != nil {
-		log.Printf("handleVote error: %v", err)
+		log.Errorf("handleVote error: %v", err)
 		http.Error(w, fmt.Sprintf(`{"error": "Voting failed: %v"}`, err), http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("handleVote: successfully voted!")
+	log.Info("handleVote: successfully voted!")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"message": "Vote '%s' recorded for file %s"}`, voteType, fileHash)
@@ -44,12 +43,12 @@ func handleVote(w http.ResponseWriter, r *http.Request) {
 
 func votingHelper(fileHash string, voteType string) error {
 	// Retrieve metadata from DHT
-	fmt.Println("in voting helper")
+	log.Info("in voting helper")
 
 	// check if user has already voted
-	data, err := dht_kad.DHT.GetValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash)
+	data, err := dht_kad.GetValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash)
 	if err != nil {
-		fmt.Println("error retrieving file data from dht")
+		log.Error("error retrieving file data from dht")
 		return fmt.Errorf("failed to retrieve file data: %v", err)
 	}
 
@@ -58,35 +57,35 @@ func votingHelper(fileHash string, voteType string) error {
 		return fmt.Errorf("failed to decode metadata: %v", err)
 	}
 
-	fmt.Printf("votingHelper: file metadata from dht: %v\n", metadata)
+	log.Infof("votingHelper: file metadata from dht: %v", metadata)
 
 	// Validate vote type
 	if voteType != "upvote" && voteType != "downvote" {
-		fmt.Println("votingHelper: vote type:", voteType)
+		log.Debug("votingHelper: vote type:", voteType)
 		return fmt.Errorf("invalid vote type: %s", voteType)
 	}
 
 	// Check if the user is a provider
 	provider, exists := metadata.Providers[dht_kad.PeerID]
 	if !exists {
-		fmt.Println("user is not a provider")
+		log.Info("user is not a provider")
 		return fmt.Errorf("user is not a provider and cannot vote")
 	}
 
 	// Ensure the user hasn't already voted
 	if provider.Rating != "" {
-		fmt.Println("user has already voted")
+		log.Info("user has already voted")
 		return fmt.Errorf("user has already voted")
 	}
 
 	// Apply vote logic
-	fmt.Println("voting helper: vote type:", voteType)
+	log.Debug("voting helper: vote type:", voteType)
 	if voteType == "upvote" {
-		fmt.Println("votingHelper: upvoting")
+		log.Info("votingHelper: upvoting")
 		metadata.Upvote++
 		metadata.Rating++
 	} else if voteType == "downvote" {
-		fmt.Println("votingHelper: downvoting")
+		log.Info("votingHelper: downvoting")
 		metadata.Rating--
 		metadata.Downvote++
 	}
@@ -101,13 +100,13 @@ func votingHelper(fileHash string, voteType string) error {
 	if err != nil {
 		return fmt.Errorf("failed to encode updated metadata: %v", err)
 	}
-	fmt.Println("votingHelper: metadata after updating vote: ", metadata)
+	log.Debug("votingHelper: metadata after updating vote: ", metadata)
 
-	err = dht_kad.DHT.PutValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash, updatedData)
+	err = dht_kad.PutValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash, updatedData)
 	if err != nil {
-		fmt.Println("votingHelper: error publishing file to DHT", err)
+		log.Error("votingHelper: error publishing file to DHT", err)
 	}
-	fmt.Println("just updated metadata in DHT")
+	log.Info("just updated metadata in DHT")
 	updateRatingLocally(fileHash, voteType)
 	dht_kad.SendCloudNodeFiles(metadata)
 	return nil
@@ -121,7 +120,7 @@ func handleGetRating(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := dht_kad.DHT.GetValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash)
+	data, err := dht_kad.GetValue(dht_kad.GlobalCtx, "/orcanet/"+fileHash)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving file data: %v", err), http.StatusInternalServerError)
 		return
@@ -133,7 +132,7 @@ func handleGetRating(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Println("rating for file hash: ", fileHash, metadata.Rating)
+	log.Info("rating for file hash: ", fileHash, metadata.Rating)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(metadata.Rating); err != nil {
 		http.Error(w, "Failed to encode file rating", http.StatusInternalServerError)
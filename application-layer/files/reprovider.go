@@ -0,0 +1,26 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"encoding/json"
+	"net/http"
+)
+
+// when each file was last refreshed in the dht and which refreshes keep failing
+func getReproviderStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Reprovider.Status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// refresh every file now instead of waiting for the schedule
+func triggerReprovide(w http.ResponseWriter, r *http.Request) {
+	dht_kad.Reprovider.Trigger()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(dht_kad.Reprovider.Status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// whether downloads are seeded and how much of them
+func getSeedingStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := dht_kad.Seeding.Status()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read seeded files: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// change the seeding policy, turning it on also provides what we downloaded before
+func updateSeedingPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.SeedingPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.Seeding.SetPolicy(policy); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update seeding policy: %v", err), http.StatusBadRequest)
+		return
+	}
+	log.Infof("seeding policy updated: %+v", policy)
+
+	if policy.AutoSeed {
+		seeded, err := dht_kad.Seeding.SeedExisting()
+		if err != nil {
+			log.Info("updateSeedingPolicy:", err)
+		}
+		for _, file := range seeded {
+			if err := PublishFile(file); err != nil {
+				log.Errorf("updateSeedingPolicy: failed to provide %s: %v", file.Hash, err)
+			}
+		}
+	}
+
+	getSeedingStatus(w, r)
+}
+
+// what our files earned, e.g. GET /files/earnings or /files/earnings?fileHash=... for the payments of one file
+func getEarnings(w http.ResponseWriter, r *http.Request) {
+	report, err := dht_kad.Earnings.Report(r.URL.Query().Get("fileHash"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read earnings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,79 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+func seriesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, dht_kad.ErrSeriesNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, dht_kad.ErrNotSeriesOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, dht_kad.ErrBadSeries), errors.Is(err, storage.ErrInvalidHash):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// a series with its newest version, e.g. GET /files/series?id=...
+// without an id, the series we own
+func getSeries(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	w.Header().Set("Content-Type", "application/json")
+	if id == "" {
+		json.NewEncoder(w).Encode(dht_kad.Series.Owned())
+		return
+	}
+
+	listing, err := dht_kad.GetSeriesListing(id)
+	if err != nil {
+		seriesError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(listing)
+}
+
+// start a series owned by our key, e.g. POST /files/series?name=...&description=...
+func createSeries(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name not provided", http.StatusBadRequest)
+		return
+	}
+
+	series, err := dht_kad.Series.Create(name, r.URL.Query().Get("description"))
+	if err != nil {
+		seriesError(w, err)
+		return
+	}
+	log.Infof("created series %s (%s)", series.Name, series.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// publish an uploaded file as the next version, e.g. POST /files/series/version?id=...&hash=...&changelog=...
+func addSeriesVersion(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	hash := r.URL.Query().Get("hash")
+	if id == "" || hash == "" {
+		http.Error(w, "series id and file hash are required", http.StatusBadRequest)
+		return
+	}
+
+	series, err := dht_kad.Series.AddVersion(id, hash, r.URL.Query().Get("changelog"))
+	if err != nil {
+		seriesError(w, err)
+		return
+	}
+	log.Infof("series %s: version %d is %s", series.Name, len(series.Versions), hash)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
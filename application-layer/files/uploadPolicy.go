@@ -0,0 +1,37 @@
+package files
+
+import (
+	dht_kad "application-layer/dht"
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// current upload limits together with the uploads running and waiting right now
+func getUploadStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Uploads.Status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// change upload limits at runtime - takes effect for running uploads as well
+func updateUploadPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.UploadPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := dht_kad.SaveUploadPolicy(policy); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update upload policy: %v", err), http.StatusBadRequest)
+		return
+	}
+	log.Infof("upload policy updated: %+v", policy)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dht_kad.Uploads.Status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
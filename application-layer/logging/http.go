@@ -0,0 +1,42 @@
+// application-layer/logging/http.go
+package logging
+
+import (
+	"application-layer/models"
+	"encoding/json"
+	"net/http"
+)
+
+// Handler is the admin endpoint for log levels: GET lists them, PUT or POST a LogLevelRequest changes one
+// it's meant for the local servers only, like the rest of our api it isn't authenticated
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var request models.LogLevelRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := SetLevel(request.Subsystem, request.Level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			Subsystem("MAIN").Infof("log level of %s set to %s", subsystemOrAll(request.Subsystem), request.Level)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.LogLevelResponse{Levels: Levels()})
+	})
+}
+
+func subsystemOrAll(subsystem string) string {
+	if subsystem == "" {
+		return "all subsystems"
+	}
+	return subsystem
+}
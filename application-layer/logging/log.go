@@ -0,0 +1,194 @@
+// application-layer/logging/log.go
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btclog"
+	"github.com/jrick/logrotate/rotator"
+)
+
+// set up like btcd's log.go: one backend writing to stdout and a rotated file,
+// and a tagged logger per package whose level can be changed while running
+// everything written goes through Redact first so secrets never reach the terminal or the file
+
+const (
+	logFileSizeKB = 10 * 1024 // rotate once the file passes 10 MB
+	maxLogRolls   = 3         // rotated files kept next to the current one
+)
+
+// logWriter sends backend output to stdout and to the rotator once InitLogRotator has run
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (n int, err error) {
+	redacted := []byte(Redact(string(p)))
+	os.Stdout.Write(redacted)
+	rotatorMu.Lock()
+	if logRotator != nil {
+		logRotator.Write(redacted)
+	}
+	rotatorMu.Unlock()
+	return len(p), nil
+}
+
+var (
+	backendLog = btclog.NewBackend(logWriter{})
+
+	logRotator *rotator.Rotator
+	rotatorMu  sync.Mutex
+
+	subsystemLoggers = make(map[string]btclog.Logger)
+	subsystemsMu     sync.RWMutex
+)
+
+// Subsystem returns the logger tagged with name, creating it at info level the first time
+// packages keep it in a package level var, e.g. var log = logging.Subsystem("DHT")
+func Subsystem(name string) btclog.Logger {
+	subsystemsMu.Lock()
+	defer subsystemsMu.Unlock()
+	if logger, exists := subsystemLoggers[name]; exists {
+		return logger
+	}
+	logger := backendLog.Logger(name)
+	logger.SetLevel(btclog.LevelInfo)
+	subsystemLoggers[name] = logger
+	return logger
+}
+
+// InitLogRotator starts writing to logFile as well, rotating it by size
+func InitLogRotator(logFile string) error {
+	if err := os.MkdirAll(filepath.Dir(logFile), 0700); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	r, err := rotator.New(logFile, logFileSizeKB, false, maxLogRolls)
+	if err != nil {
+		return fmt.Errorf("failed to create file rotator: %w", err)
+	}
+
+	rotatorMu.Lock()
+	defer rotatorMu.Unlock()
+	if logRotator != nil {
+		logRotator.Close()
+	}
+	logRotator = r
+	return nil
+}
+
+// Close flushes and closes the log file, output keeps going to stdout
+func Close() {
+	rotatorMu.Lock()
+	defer rotatorMu.Unlock()
+	if logRotator != nil {
+		logRotator.Close()
+		logRotator = nil
+	}
+}
+
+// Init sets up logging for one of our servers from the environment:
+// LOG_DIR (default "logs") holds <name>.log, LOG_LEVEL takes the same form as ParseLevels
+func Init(name string) error {
+	dir := os.Getenv("LOG_DIR")
+	if dir == "" {
+		dir = "logs"
+	}
+	if err := InitLogRotator(filepath.Join(dir, name+".log")); err != nil {
+		return err
+	}
+	if spec := os.Getenv("LOG_LEVEL"); spec != "" {
+		return ParseLevels(spec)
+	}
+	return nil
+}
+
+var levelNames = map[btclog.Level]string{
+	btclog.LevelTrace:    "trace",
+	btclog.LevelDebug:    "debug",
+	btclog.LevelInfo:     "info",
+	btclog.LevelWarn:     "warn",
+	btclog.LevelError:    "error",
+	btclog.LevelCritical: "critical",
+	btclog.LevelOff:      "off",
+}
+
+func parseLevel(level string) (btclog.Level, error) {
+	lvl, ok := btclog.LevelFromString(strings.ToLower(strings.TrimSpace(level)))
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q, use trace, debug, info, warn, error, critical or off", level)
+	}
+	return lvl, nil
+}
+
+// SetLevel changes the level of one subsystem, or of all of them when subsystem is ""
+func SetLevel(subsystem string, level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	subsystemsMu.RLock()
+	defer subsystemsMu.RUnlock()
+	if subsystem == "" {
+		for _, logger := range subsystemLoggers {
+			logger.SetLevel(lvl)
+		}
+		return nil
+	}
+	logger, exists := subsystemLoggers[strings.ToUpper(subsystem)]
+	if !exists {
+		return fmt.Errorf("unknown subsystem %q, have %s", subsystem, strings.Join(subsystemNames(), ", "))
+	}
+	logger.SetLevel(lvl)
+	return nil
+}
+
+// ParseLevels takes btcd's debuglevel form: a single level for everything,
+// or comma separated subsystem=level pairs like "info,DHT=debug,PRXY=trace"
+func ParseLevels(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		subsystem, level, found := strings.Cut(part, "=")
+		if !found {
+			subsystem, level = "", part
+		}
+		if err := SetLevel(strings.TrimSpace(subsystem), level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Levels maps each subsystem to its current level
+func Levels() map[string]string {
+	subsystemsMu.RLock()
+	defer subsystemsMu.RUnlock()
+	levels := make(map[string]string, len(subsystemLoggers))
+	for name, logger := range subsystemLoggers {
+		levels[name] = levelNames[logger.Level()]
+	}
+	return levels
+}
+
+// Subsystems lists the subsystem tags in use, sorted
+func Subsystems() []string {
+	subsystemsMu.RLock()
+	defer subsystemsMu.RUnlock()
+	return subsystemNames()
+}
+
+// callers hold subsystemsMu
+func subsystemNames() []string {
+	names := make([]string, 0, len(subsystemLoggers))
+	for name := range subsystemLoggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
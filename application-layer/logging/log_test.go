@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// go test -v -run ^TestRedact$ -count=1 application-layer/logging
+func TestRedact(t *testing.T) {
+	entropy, _ := bip39.NewEntropy(128)
+	mnemonic, _ := bip39.NewMnemonic(entropy)
+
+	secrets := map[string]string{
+		"Passphrase: hunter2":                                           "hunter2",
+		`{"passphrase":"hunter2","amount":1}`:                           "hunter2",
+		`{"passphrase":"correct horse battery","amount":1}`:             "horse battery",
+		`restoring with mnemonic: "abandon ability able"`:               "ability able",
+		"[--rpcuser=user --rpcpass=hunter2 getinfo]":                    "hunter2",
+		"walletpassphrase hunter2 60":                                   "hunter2",
+		"{TransactionID:tx1 Key:deadbeef Fee:5}":                        "deadbeef",
+		"restoring from " + mnemonic + " now":                           mnemonic,
+		"imported KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn": "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn",
+	}
+	for line, secret := range secrets {
+		if got := Redact(line); strings.Contains(got, secret) {
+			t.Errorf("Redact(%q) = %q, still has the secret", line, got)
+		}
+	}
+
+	// things that only look a bit like secrets stay readable
+	for _, line := range []string{
+		"Found proxy for key: /orcanet/proxy/abc with value: 1",
+		"connected to 12D3KooWEyoppNCUx8Yx66oV9fJnriXwCcXwDDUA2kj6vnc6iDEp",
+		"Wallet restored from seed phrase, btcwallet is rescanning the chain.",
+	} {
+		if got := Redact(line); got != line {
+			t.Errorf("Redact(%q) = %q", line, got)
+		}
+	}
+}
+
+// go test -v -run ^TestLevels$ -count=1 application-layer/logging
+func TestLevels(t *testing.T) {
+	dht := Subsystem("TDHT")
+	Subsystem("TPRX")
+	if Subsystem("TDHT") != dht {
+		t.Fatal("Subsystem made a second logger for the same tag")
+	}
+
+	if err := ParseLevels("warn,TDHT=debug"); err != nil {
+		t.Fatal(err)
+	}
+	if levels := Levels(); levels["TDHT"] != "debug" || levels["TPRX"] != "warn" {
+		t.Errorf("levels = %v", levels)
+	}
+	if err := SetLevel("tprx", "trace"); err != nil || Levels()["TPRX"] != "trace" {
+		t.Errorf("SetLevel lowercase subsystem: %v, %v", err, Levels())
+	}
+	if err := SetLevel("NOPE", "info"); err == nil {
+		t.Error("SetLevel took an unknown subsystem")
+	}
+	if err := SetLevel("TDHT", "loud"); err == nil {
+		t.Error("SetLevel took an unknown level")
+	}
+
+	// the admin endpoint changes levels the same way
+	body := strings.NewReader(`{"Subsystem":"TDHT","Level":"error"}`)
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/loglevel", body))
+	if w.Code != http.StatusOK || Levels()["TDHT"] != "error" {
+		t.Errorf("PUT /admin/loglevel = %d %s, levels %v", w.Code, w.Body.String(), Levels())
+	}
+	w = httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(`{"Level":"loud"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a bad level = %d", w.Code)
+	}
+}
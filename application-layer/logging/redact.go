@@ -0,0 +1,72 @@
+// application-layer/logging/redact.go
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+const redacted = "[redacted]"
+
+// field names whose values are secret
+const secretNames = `(?:passphrase|password|passwd|rpcpass(?:word)?|mnemonic|seed ?phrase|priv(?:ate)?_? ?key|(?:transfer|decryption|encryption)_? ?key|secret)`
+
+var (
+	// "name":"value" as printed by json and name: "value" by %q, the value runs to the closing quote so spaces in it are covered
+	quotedSecret = regexp.MustCompile(`(?i)("?\b` + secretNames + `"?\s*[:=]\s*")(?:[^"\\]|\\.)*"`)
+	// name: value and name=value as printed by Printf and %+v, up to the first space or separator
+	namedSecret = regexp.MustCompile(`(?i)("?\b` + secretNames + `"?\s*[:=]\s*"?)([^\s",}\]]+)`)
+	// the aes key of a TransferKey, only the exact field name so "key: <dht key>" stays readable
+	keyField = regexp.MustCompile(`("?\bKey"?\s*[:=]\s*"?)([^\s",}\]]+)`)
+	// btcctl and btcwallet commands that take a secret as a positional argument
+	secretArgument = regexp.MustCompile(`(?i)(\b(?:walletpassphrase|walletpassphrasechange|importprivkey)\s+)(\S+)`)
+	// wif private keys, base58 starting with 5, K, L (mainnet) or 9, c (testnet)
+	wifKey        = regexp.MustCompile(`\b[59KLc][1-9A-HJ-NP-Za-km-z]{50,51}\b`)
+	lowercaseWord = regexp.MustCompile(`\b[a-z]{3,8}\b`)
+)
+
+// the shortest seed phrase we make or restore
+const minMnemonicWords = 12
+
+// Redact masks passphrases, private keys, transfer keys and seed phrases in a log line
+func Redact(line string) string {
+	line = quotedSecret.ReplaceAllString(line, "${1}"+redacted+`"`)
+	line = namedSecret.ReplaceAllString(line, "${1}"+redacted)
+	line = keyField.ReplaceAllString(line, "${1}"+redacted)
+	line = secretArgument.ReplaceAllString(line, "${1}"+redacted)
+	line = wifKey.ReplaceAllString(line, redacted)
+	return redactMnemonics(line)
+}
+
+// redactMnemonics masks runs of twelve or more bip39 words separated only by spaces
+func redactMnemonics(line string) string {
+	words := lowercaseWord.FindAllStringIndex(line, -1)
+	if len(words) < minMnemonicWords {
+		return line
+	}
+
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && isMnemonicWord(line[words[j][0]:words[j][1]]) &&
+			(j == i || strings.TrimSpace(line[words[j-1][1]:words[j][0]]) == "") {
+			j++
+		}
+		if j-i >= minMnemonicWords {
+			out.WriteString(line[last:words[i][0]])
+			out.WriteString(redacted)
+			last = words[j-1][1]
+		}
+		i = max(j, i+1)
+	}
+	out.WriteString(line[last:])
+	return out.String()
+}
+
+func isMnemonicWord(word string) bool {
+	_, ok := bip39.GetWordIndex(word)
+	return ok
+}
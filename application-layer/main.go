@@ -3,9 +3,10 @@ package main
 
 import (
 	"application-layer/controllers"
+	"application-layer/logging"
+	"application-layer/metrics"
 	"application-layer/routes"
 	"application-layer/services"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -28,10 +29,21 @@ func main() {
 		log.Fatal("RPC_USER and RPC_PASS environment variables are required")
 	}
 
-	fmt.Println("Main server started")
+	// LOG_LEVEL and LOG_DIR from .env, e.g. LOG_LEVEL=info,SRVC=debug
+	if err := logging.Init("btc"); err != nil {
+		log.Fatal(err)
+	}
+	defer logging.Close()
+	mainLog := logging.Subsystem("MAIN")
+
+	mainLog.Info("Main server started")
 
 	btcService := services.NewBtcService()
 	btcController := controllers.NewBtcController(btcService)
+	go btcService.WatchMinedBlocks() // records the blocks we mine
+	go btcService.WatchInvoices()    // marks invoices paid
+
+	metrics.Registry.MustRegister(services.NewBtcdCollector()) // btcd's network stats on /metrics
 
 	router := mux.NewRouter()
 	routes.RegisterRoutes(router, btcController) // Register Btc and Auth routes
@@ -67,7 +79,7 @@ func main() {
 	handler := c.Handler(router)
 	// go dht_kad.StartDHTService()
 
-	fmt.Printf("Starting server for file routes and DHT on port %s...\n", port)
+	mainLog.Infof("Starting server for file routes and DHT on port %s...", port)
 	log.Fatal(http.ListenAndServe(port, handler))
 }
 
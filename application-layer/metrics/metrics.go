@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// everything the application layer exports on /metrics, under the orcanet_ namespace
+// packages record through the helpers below so label values stay the same everywhere
+const namespace = "orcanet"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	streamsOpened = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "stream", Name: "opened_total",
+		Help: "Streams of our protocols, by protocol, direction (inbound or outbound) and transport (direct or relay).",
+	}, []string{"protocol", "direction", "transport"})
+	streamBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "stream", Name: "bytes_total",
+		Help: "Bytes read and written on streams of our protocols, by protocol and operation (read or write).",
+	}, []string{"protocol", "operation"})
+	streamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "stream", Name: "duration_seconds",
+		Help:    "How long streams of our protocols stayed open, by protocol and direction.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"protocol", "direction"})
+	streamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "stream", Name: "errors_total",
+		Help: "Streams that failed to open, were reset or hit a read or write error, by protocol and direction.",
+	}, []string{"protocol", "direction"})
+
+	dhtOperations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "operation_duration_seconds",
+		Help:    "Latency of DHT operations, by operation (get_value, put_value, provide, find_providers) and result.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"operation", "result"})
+
+	transfers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "transfer", Name: "finished_total",
+		Help: "Downloads and uploads that finished, by direction and result (complete or failed).",
+	}, []string{"direction", "result"})
+
+	proxySessions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "proxy", Name: "sessions_total",
+		Help: "Proxy sessions, by role (host or client) and event (started or stopped).",
+	}, []string{"role", "event"})
+	proxyActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "proxy", Name: "sessions_active",
+		Help: "Proxy sessions running now, by role.",
+	}, []string{"role"})
+
+	rpcCalls = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "btc", Name: "rpc_duration_seconds",
+		Help:    "btcctl calls made by the wallet service, by server (btcd or btcwallet), method and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"server", "method", "result"})
+
+	httpRequests = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+		Help:    "Requests to our http routers, by route template, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		streamsOpened, streamBytes, streamDuration, streamErrors,
+		dhtOperations,
+		transfers,
+		proxySessions, proxyActive,
+		rpcCalls,
+		httpRequests,
+	)
+}
+
+// Handler serves the registry in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func StreamOpened(protocol string, direction string, relayed bool) {
+	transport := "direct"
+	if relayed {
+		transport = "relay"
+	}
+	streamsOpened.WithLabelValues(protocol, direction, transport).Inc()
+}
+
+func StreamBytes(protocol string, operation string, n int) {
+	if n > 0 {
+		streamBytes.WithLabelValues(protocol, operation).Add(float64(n))
+	}
+}
+
+func StreamClosed(protocol string, direction string, opened time.Time) {
+	streamDuration.WithLabelValues(protocol, direction).Observe(time.Since(opened).Seconds())
+}
+
+func StreamError(protocol string, direction string) {
+	streamErrors.WithLabelValues(protocol, direction).Inc()
+}
+
+// DHTOperation records one DHT call started at start, e.g. defer-free after GetValue returns
+func DHTOperation(operation string, start time.Time, err error) {
+	dhtOperations.WithLabelValues(operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+func TransferFinished(direction string, err error) {
+	outcome := "complete"
+	if err != nil {
+		outcome = "failed"
+	}
+	transfers.WithLabelValues(direction, outcome).Inc()
+}
+
+func ProxySessionStarted(role string) {
+	proxySessions.WithLabelValues(role, "started").Inc()
+	proxyActive.WithLabelValues(role).Inc()
+}
+
+func ProxySessionStopped(role string) {
+	proxySessions.WithLabelValues(role, "stopped").Inc()
+	proxyActive.WithLabelValues(role).Dec()
+}
+
+func RPCCall(server string, method string, start time.Time, err error) {
+	rpcCalls.WithLabelValues(server, method, result(err)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// go test -v -run ^TestMetrics$ -count=1 application-layer/metrics
+// TestMetrics checks that requests are labelled by route template and that recorded values show up on /metrics.
+func TestMetrics(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/files/getFile", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "file not found", http.StatusNotFound)
+	}).Methods("GET")
+	router.Handle("/metrics", Handler()).Methods("GET")
+
+	for _, hash := range []string{"a", "b", "c"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/files/getFile?hash="+hash, nil))
+	}
+	StreamBytes("/orcanet/file/1.0.0", "write", 4096)
+	DHTOperation("get_value", time.Now(), io.EOF)
+	ProxySessionStarted("client")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`orcanet_http_request_duration_seconds_count{code="404",method="GET",route="/files/getFile"} 3`,
+		`orcanet_stream_bytes_total{operation="write",protocol="/orcanet/file/1.0.0"} 4096`,
+		`orcanet_dht_operation_duration_seconds_count{operation="get_value",result="error"} 1`,
+		`orcanet_proxy_sessions_active{role="client"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in the metrics", want)
+		}
+	}
+}
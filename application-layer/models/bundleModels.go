@@ -0,0 +1,49 @@
+package models
+
+// the mime type bundle manifests are published with
+const BundleType = "application/x-orcanet-bundle"
+
+// one file of a bundle, its chunks are checked against ChunkRoot as they arrive
+type BundleEntry struct {
+	Path      string `json:"Path"` // slash separated, relative to the bundle root
+	Hash      string `json:"Hash"`
+	Size      int64  `json:"Size"`
+	ChunkRoot string `json:"ChunkRoot"`
+}
+
+// a tree of paths to content hashes, published and priced as a single file
+// the manifest's own hash is the bundle's hash
+type BundleManifest struct {
+	Name        string        `json:"Name"`
+	Description string        `json:"Description"`
+	Entries     []BundleEntry `json:"Entries"` // sorted by path
+	CreatedAt   string        `json:"CreatedAt"`
+}
+
+// what publishing a directory as a bundle takes, e.g. POST /files/bundle
+type BundleRequest struct {
+	Directory   string `json:"Directory"` // local directory to publish, read recursively
+	Name        string `json:"Name"`      // defaults to the directory name
+	Description string `json:"Description"`
+	Fee         int64  `json:"Fee"` // price of the whole bundle
+}
+
+// asks the seller of a bundle for the chunk hashes of one member, e.g. over /orcanet/chunks/1.0.0
+type ChunkTreeRequest struct {
+	BundleHash string `json:"BundleHash"`
+	FileHash   string `json:"FileHash"`
+}
+
+type ChunkTreeResponse struct {
+	Status  string    `json:"Status"` // "ok" or "declined"
+	Message string    `json:"Message"`
+	Tree    ChunkTree `json:"Tree"`
+}
+
+// a bundle we hold the manifest of, and which of its files we have
+type BundleStatus struct {
+	Hash     string          `json:"Hash"`
+	Manifest BundleManifest  `json:"Manifest"`
+	Have     map[string]bool `json:"Have"` // by path
+	Complete bool            `json:"Complete"`
+}
@@ -0,0 +1,52 @@
+package models
+
+// an address book entry naming a counterparty by its peer id, its wallet addresses or both
+type Contact struct {
+	ID              string   `json:"ID"`
+	Label           string   `json:"Label"`
+	PeerID          string   `json:"PeerID"`
+	WalletAddresses []string `json:"WalletAddresses"`
+	Notes           string   `json:"Notes"`
+	Trust           string   `json:"Trust"` // "trusted", "neutral" or "untrusted"
+	CreatedAt       string   `json:"CreatedAt"`
+	UpdatedAt       string   `json:"UpdatedAt"`
+}
+
+// what a response shows next to a peer id or wallet address that is in the address book
+type ContactLabel struct {
+	ContactID string `json:"ContactID"`
+	Label     string `json:"Label"`
+	Trust     string `json:"Trust"`
+}
+
+// the address book as exported, and as accepted by an import
+type AddressBookExport struct {
+	Version    int       `json:"Version"`
+	ExportedAt string    `json:"ExportedAt"`
+	Contacts   []Contact `json:"Contacts"`
+}
+
+// the result of an import
+type AddressBookImport struct {
+	Added   int      `json:"Added"`
+	Updated int      `json:"Updated"`
+	Skipped []string `json:"Skipped"` // why an entry wasn't taken, one line per entry
+}
+
+// the responses below are the usual records with the address book labels of the peer ids
+// and wallet addresses in them, keyed by that peer id or address
+
+type LabeledTransaction struct {
+	Transaction
+	Labels map[string]ContactLabel `json:"Labels,omitempty"`
+}
+
+type LabeledListing struct {
+	DHTMetadata
+	Labels map[string]ContactLabel `json:"Labels,omitempty"`
+}
+
+type LabeledProxy struct {
+	Proxy
+	Labels map[string]ContactLabel `json:"Labels,omitempty"`
+}
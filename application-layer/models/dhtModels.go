@@ -0,0 +1,31 @@
+package models
+
+// a value stored in the dht under /orcanet/<Key>
+type DHTRecord struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// a peer providing a key, as found through the dht
+type DHTProvider struct {
+	PeerID string   `json:"PeerID"`
+	Addrs  []string `json:"Addrs"`
+}
+
+// a peer we have an open connection to
+type DHTPeer struct {
+	PeerID    string                  `json:"PeerID"`
+	Addrs     []string                `json:"Addrs"`
+	Direction string                  `json:"Direction"` // "inbound" or "outbound"
+	Relayed   bool                    `json:"Relayed"`   // reached through the relay
+	Labels    map[string]ContactLabel `json:"Labels,omitempty"`
+}
+
+// what our node looks like on the dht
+type DHTStatus struct {
+	PeerID           string   `json:"PeerID"`
+	Addrs            []string `json:"Addrs"`
+	ConnectedPeers   int      `json:"ConnectedPeers"`
+	RoutingTableSize int      `json:"RoutingTableSize"`
+	Protocols        []string `json:"Protocols"`
+}
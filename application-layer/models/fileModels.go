@@ -14,6 +14,7 @@ type FileMetadata struct {
 	OriginalUploader  bool   `json:"OriginalUploader"`
 	VoteType          string `json:"Rating"` // either "", upvote, or downvote
 	HasVoted          bool   `json:"HasVoted"`
+	ChunkRoot         string `json:"ChunkRoot"` // merkle root of the file's chunk hashes, set when the server hashed the content
 }
 
 type DHTMetadata struct {
@@ -29,6 +30,10 @@ type DHTMetadata struct {
 	Upvote            int64
 	Downvote          int64
 	Hash              string
+	ChunkRoot         string
+	SeriesID          string // series the file is a version of, if any
+	Version           int64  // version number within the series, from 1
+	LatestHash        string // newest version of the series as far as this record knows
 }
 
 type Provider struct {
@@ -45,13 +50,41 @@ type Transaction struct {
 	RequesterWallet string `json:"RequesterWallet"`
 	TargetID        string `json:"TargetID"` // ID of the target node
 	TargetWallet    string `json:"TargetWallet"`
-	Status          string `json:"Status"`  // "pending", "accepted", "declined"
+	Status          string `json:"Status"`  // "pending", "queued", "accepted", "declined", "awaiting payment", "paid", "complete", "failed"
 	Message         string `json:"Message"` // Additional info
 	CreatedAt       string `json:"CreatedAt"`
 	FileName        string `json:"FileName"`
 	TransactionID   string `json:"TransactionID"`
 	Size            int64  `json:"Size"`
 	Fee             int64  `json:"Fee"`
+	QueuePosition   int    `json:"QueuePosition"` // position in the provider's upload queue, 0 once sending starts
+	Encrypted       bool   `json:"Encrypted"`     // content is sent encrypted, the key is released once paid
+	EncryptionIV    string `json:"EncryptionIV"`  // hex iv of the aes-ctr stream, the key itself never goes over /sendFile
+	PaymentTxID     string `json:"PaymentTxID"`   // wallet transaction the requester paid the fee with
+	BundleHash      string `json:"BundleHash"`    // set when FileHash is requested as a member of this bundle
+	QuoteID         string `json:"QuoteID"`       // quote the provider gave us for this download, it sets Fee
+	InvoiceURI      string `json:"InvoiceURI"`    // BIP21 uri of the provider's invoice for Fee, paying it pays TargetWallet
+}
+
+// per-transfer key kept by the provider until the requester has paid
+type TransferKey struct {
+	TransactionID string `json:"TransactionID"`
+	RequesterID   string `json:"RequesterID"`
+	TargetWallet  string `json:"TargetWallet"`
+	FileHash      string `json:"FileHash"`
+	Fee           int64  `json:"Fee"`
+	Key           string `json:"Key"`         // hex aes-256 key
+	PaymentTxID   string `json:"PaymentTxID"` // set once the key has been released
+	InvoiceID     string `json:"InvoiceID"`   // invoice the fee is paid to, empty when there was no wallet to make one
+	CreatedAt     string `json:"CreatedAt"`
+}
+
+// provider's answer to a key request
+type KeyResponse struct {
+	TransactionID string `json:"TransactionID"`
+	Status        string `json:"Status"` // "released" or "declined"
+	Key           string `json:"Key"`
+	Message       string `json:"Message"`
 }
 
 type RefreshRequest struct {
@@ -0,0 +1,43 @@
+package models
+
+// a payment request with its own receiving address, paid through its BIP21 uri
+type Invoice struct {
+	ID          string           `json:"ID"`
+	Address     string           `json:"Address"` // fresh from getnewaddress, only this invoice is paid to it
+	Amount      int64            `json:"Amount"`  // satoshis, the uri has it in BTC
+	Memo        string           `json:"Memo"`
+	Purpose     string           `json:"Purpose"`     // "file", "proxy" or "" for invoices made by hand
+	Reference   string           `json:"Reference"`   // what is paid for, the transfer id of a download or the client peer of a proxy session
+	URI         string           `json:"URI"`         // bitcoin:<address>?amount=...&label=...&message=...
+	Status      string           `json:"Status"`      // "open", "pending" once a payment is seen unconfirmed, "paid" or "expired"
+	Received    int64            `json:"Received"`    // satoshis
+	PaymentTxID string           `json:"PaymentTxID"` // first transaction that paid to the address
+	Payments    []InvoicePayment `json:"Payments"`
+	CreatedAt   string           `json:"CreatedAt"`
+	ExpiresAt   string           `json:"ExpiresAt"`
+	PaidAt      string           `json:"PaidAt"`
+}
+
+type InvoicePayment struct {
+	TxID      string `json:"TxID"`
+	Amount    int64  `json:"Amount"` // satoshis
+	Confirmed bool   `json:"Confirmed"`
+}
+
+// pushed to the UI over the websocket when an invoice changes
+type InvoiceEvent struct {
+	Event   string  `json:"event"` // always "invoice"
+	Invoice Invoice `json:"invoice"`
+}
+
+// asks a peer to invoice us, e.g. for a proxy session
+type InvoiceRequest struct {
+	Purpose   string `json:"Purpose"`
+	Reference string `json:"Reference"`
+}
+
+type InvoiceResponse struct {
+	Status  string  `json:"Status"` // "invoiced" or "declined"
+	Message string  `json:"Message"`
+	Invoice Invoice `json:"Invoice"`
+}
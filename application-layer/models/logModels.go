@@ -0,0 +1,12 @@
+package models
+
+// changes the level of one logging subsystem, or of all of them when Subsystem is empty
+type LogLevelRequest struct {
+	Subsystem string `json:"Subsystem"`
+	Level     string `json:"Level"` // trace, debug, info, warn, error, critical or off
+}
+
+// the current level of every logging subsystem, keyed by its tag (DHT, FILE, PRXY, ...)
+type LogLevelResponse struct {
+	Levels map[string]string `json:"Levels"`
+}
@@ -0,0 +1,64 @@
+package models
+
+// how we mine, kept in the btcd temp file
+type MiningSettings struct {
+	Miner   string `json:"Miner"`   // "btcd" for btcd's own cpu miner, "cpuminer" for an external cpuminer on btcd's block templates
+	Threads int    `json:"Threads"` // 0 uses every cpu
+	Address string `json:"Address"` // where block rewards go, btcd can't switch it while running so a new address moves mining to cpuminer
+}
+
+// what the miner is doing, from getgenerate, gethashespersec and getmininginfo
+type MiningStatus struct {
+	Generating       bool    `json:"Generating"`
+	Miner            string  `json:"Miner"`
+	Threads          int     `json:"Threads"`
+	Address          string  `json:"Address"`
+	HashesPerSec     float64 `json:"HashesPerSec"`
+	Blocks           int64   `json:"Blocks"`
+	Difficulty       float64 `json:"Difficulty"`
+	NetworkHashesPS  float64 `json:"NetworkHashesPS"`
+	PooledTx         int64   `json:"PooledTx"`
+	CurrentBlockSize int64   `json:"CurrentBlockSize"`
+	Error            string  `json:"Error"` // last error of the miner, e.g. cpuminer exiting
+	UpdatedAt        string  `json:"UpdatedAt"`
+}
+
+// message pushed to the UI over the websocket while mining
+type MiningEvent struct {
+	Event  string       `json:"event"` // always "mining"
+	Status MiningStatus `json:"status"`
+}
+
+// a block whose coinbase paid one of our mining addresses
+type MinedBlock struct {
+	Height        int64   `json:"Height"`
+	Hash          string  `json:"Hash"`
+	Address       string  `json:"Address"`       // mining address the coinbase paid
+	CoinbaseValue float64 `json:"CoinbaseValue"` // BTC paid to our addresses, subsidy plus fees
+	Confirmations int64   `json:"Confirmations"`
+	Maturity      string  `json:"Maturity"` // "immature", "mature" or "orphaned"
+	MinedAt       string  `json:"MinedAt"`  // block timestamp
+}
+
+// totals over the blocks we mined
+type MiningStats struct {
+	Unit            string  `json:"Unit"`
+	Blocks          int     `json:"Blocks"` // not counting orphaned blocks
+	Mature          int     `json:"Mature"`
+	Immature        int     `json:"Immature"`
+	Orphaned        int     `json:"Orphaned"`
+	TotalReward     float64 `json:"TotalReward"`
+	MatureReward    float64 `json:"MatureReward"` // spendable
+	ImmatureReward  float64 `json:"ImmatureReward"`
+	BlocksLastDay   int     `json:"BlocksLastDay"`
+	BlocksPerDay    float64 `json:"BlocksPerDay"` // average since our first block
+	HashesPerSec    float64 `json:"HashesPerSec"`
+	NetworkHashesPS float64 `json:"NetworkHashesPS"` // getnetworkhashps
+	EstimatedShare  float64 `json:"EstimatedShare"`  // our hash rate over the network's, 0 to 1
+	ScannedHeight   int64   `json:"ScannedHeight"`
+}
+
+type MiningHistory struct {
+	Stats  MiningStats  `json:"Stats"`
+	Blocks []MinedBlock `json:"Blocks"` // newest first
+}
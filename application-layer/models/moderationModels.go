@@ -0,0 +1,28 @@
+package models
+
+// which peers we serve and which files we serve or show in the marketplace
+// deny lists always win, allow lists are ignored while empty
+type ModerationPolicy struct {
+	AllowedPeers    []string `json:"AllowedPeers"`    // when set, only these peers may download from us
+	DeniedPeers     []string `json:"DeniedPeers"`     // never served and hidden as providers in the marketplace
+	AllowedHashes   []string `json:"AllowedHashes"`   // when set, only these files are served
+	DeniedHashes    []string `json:"DeniedHashes"`    // never served and hidden from the marketplace
+	HonourTakedowns bool     `json:"HonourTakedowns"` // treat files with a takedown notice from a trusted issuer as denied
+	TrustedIssuers  []string `json:"TrustedIssuers"`  // peers whose takedown notices we honour, our own always count
+}
+
+// a peer asking everyone to stop serving a file, signed by the issuer
+type TakedownNotice struct {
+	Issuer    string `json:"Issuer"`
+	FileHash  string `json:"FileHash"`
+	Reason    string `json:"Reason"`
+	Timestamp int64  `json:"Timestamp"` // unix seconds
+	Signature string `json:"Signature"` // hex signature of the notice without this field and Honoured
+	Honoured  bool   `json:"Honoured"`  // set locally, whether our policy acts on the notice
+}
+
+// moderation settings together with the notices we know about
+type ModerationStatus struct {
+	Policy  ModerationPolicy `json:"Policy"`
+	Notices []TakedownNotice `json:"Notices"`
+}
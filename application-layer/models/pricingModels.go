@@ -0,0 +1,47 @@
+package models
+
+// fees are whole satoshis, payments are converted with btcutil.Amount before they are compared
+const FeeUnit = "satoshi"
+
+// one pricing rule, a rule only applies while all of its conditions hold
+type PricingRule struct {
+	Name            string `json:"Name"`
+	FileHash        string `json:"FileHash"`        // empty for every file
+	PeerID          string `json:"PeerID"`          // empty for every requester
+	MinPurchases    int64  `json:"MinPurchases"`    // bulk pricing, files the requester already bought from us
+	Starts          int64  `json:"Starts"`          // unix seconds, 0 for no start
+	Ends            int64  `json:"Ends"`            // unix seconds, 0 for no end
+	Fee             *int64 `json:"Fee"`             // fixed price, nil keeps the advertised fee
+	DiscountPercent int64  `json:"DiscountPercent"` // taken off the advertised fee when Fee is nil
+}
+
+// how we price our files, the fee advertised in the dht is the price before any rule
+type PricingPolicy struct {
+	QuoteTTL int64         `json:"QuoteTTL"` // seconds a quote stays valid, 10 minutes when 0
+	Rules    []PricingRule `json:"Rules"`    // the cheapest applicable rule wins
+}
+
+type QuoteRequest struct {
+	FileHash string `json:"FileHash"`
+}
+
+// a price offered by a provider, signed with its key and binding until ExpiresAt
+type Quote struct {
+	QuoteID     string `json:"QuoteID"`
+	FileHash    string `json:"FileHash"`
+	ProviderID  string `json:"ProviderID"`
+	RequesterID string `json:"RequesterID"`
+	BaseFee     int64  `json:"BaseFee"` // advertised fee
+	Fee         int64  `json:"Fee"`     // what the download will cost
+	Unit        string `json:"Unit"`
+	Rule        string `json:"Rule"` // name of the rule that set Fee, empty for the advertised fee
+	IssuedAt    int64  `json:"IssuedAt"`
+	ExpiresAt   int64  `json:"ExpiresAt"`
+	Signature   string `json:"Signature"` // hex signature of the quote without this field
+}
+
+type QuoteResponse struct {
+	Status  string `json:"Status"` // "quoted" or "declined"
+	Message string `json:"Message"`
+	Quote   Quote  `json:"Quote"`
+}
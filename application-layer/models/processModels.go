@@ -0,0 +1,13 @@
+package models
+
+// a btcd or btcwallet process as the supervisor sees it
+type ProcessStatus struct {
+	Name      string   `json:"Name"`
+	State     string   `json:"State"` // "stopped", "starting", "running", "restarting", "failed", or "external" when one we didn't start answers on its port
+	PID       int      `json:"PID"`
+	Args      []string `json:"Args"`
+	Restarts  int      `json:"Restarts"` // after crashes, since it was started through us
+	StartedAt string   `json:"StartedAt"`
+	LastExit  string   `json:"LastExit"` // how the last run ended
+	LogFile   string   `json:"LogFile"`
+}
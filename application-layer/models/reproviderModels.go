@@ -0,0 +1,21 @@
+package models
+
+// refresh state of one file we provide
+type ReprovideRecord struct {
+	Hash        string `json:"Hash"`
+	Name        string `json:"Name"`
+	LastAttempt string `json:"LastAttempt"`
+	LastSuccess string `json:"LastSuccess"`
+	NextRun     string `json:"NextRun"`
+	Failures    int    `json:"Failures"` // consecutive failures, reset after a successful refresh
+	LastError   string `json:"LastError"`
+}
+
+// snapshot of the background reprovider returned by the REST api
+type ReproviderStatus struct {
+	Running       bool              `json:"Running"` // a batch is being refreshed right now
+	LastRun       string            `json:"LastRun"`
+	TotalRuns     int64             `json:"TotalRuns"`
+	TotalFailures int64             `json:"TotalFailures"`
+	Files         []ReprovideRecord `json:"Files"`
+}
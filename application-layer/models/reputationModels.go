@@ -0,0 +1,42 @@
+package models
+
+// what we have seen of another peer, kept locally and used to pick providers
+type PeerReputation struct {
+	PeerID              string  `json:"PeerID"`
+	SuccessfulDownloads int64   `json:"SuccessfulDownloads"`
+	Declines            int64   `json:"Declines"`
+	CorruptDeliveries   int64   `json:"CorruptDeliveries"` // content didn't match the advertised hash
+	FailedDeliveries    int64   `json:"FailedDeliveries"`  // stalled, or took payment and never released the key
+	VerifiedPayments    int64   `json:"VerifiedPayments"`  // payments from this peer we confirmed on chain
+	BytesReceived       int64   `json:"BytesReceived"`
+	Throughput          float64 `json:"Throughput"`     // bytes per second of successful downloads, smoothed like transfer speeds
+	GossipPositive      int64   `json:"GossipPositive"` // signed reports of other peers
+	GossipNegative      int64   `json:"GossipNegative"`
+	Score               float64 `json:"Score"` // 0 to 1, 0.5 for a peer we know nothing about
+	Blocked             bool    `json:"Blocked"`
+	BlockReason         string  `json:"BlockReason"`
+	LastSeen            string  `json:"LastSeen"`
+}
+
+// reputation options, saved with the reputation store
+type ReputationSettings struct {
+	GossipReports bool `json:"GossipReports"` // send signed reports of our own experiences to connected peers
+	AcceptReports bool `json:"AcceptReports"` // let reports of other peers count towards scores
+}
+
+// one experience with a peer, signed by the reporter when gossiped
+type ReputationReport struct {
+	Reporter      string `json:"Reporter"`
+	Subject       string `json:"Subject"`
+	Event         string `json:"Event"` // "success", "decline", "corrupt", "failed delivery", "verified payment"
+	TransactionID string `json:"TransactionID"`
+	Timestamp     int64  `json:"Timestamp"` // unix seconds
+	Signature     string `json:"Signature"` // hex signature of the report without this field
+}
+
+// provider of a file as offered to the user, best first
+type RankedProvider struct {
+	PeerID     string         `json:"PeerID"`
+	Provider   Provider       `json:"Provider"`
+	Reputation PeerReputation `json:"Reputation"`
+}
@@ -0,0 +1,43 @@
+package models
+
+// what happens to files once we downloaded them
+type SeedingPolicy struct {
+	AutoSeed bool   `json:"AutoSeed"` // provide downloaded files straight away instead of waiting for the user to publish them
+	Fee      *int64 `json:"Fee"`      // fee to seed at, nil for the fee we paid
+	MaxBytes int64  `json:"MaxBytes"` // total size of downloaded files we seed, 0 for no limit
+}
+
+type SeedingStatus struct {
+	Policy      SeedingPolicy `json:"Policy"`
+	SeededFiles int64         `json:"SeededFiles"`
+	SeededBytes int64         `json:"SeededBytes"`
+}
+
+// a payment to our wallet matched to the download it paid for
+type Payment struct {
+	TransactionID string `json:"TransactionID"`
+	FileHash      string `json:"FileHash"`
+	RequesterID   string `json:"RequesterID"`
+	PaymentTxID   string `json:"PaymentTxID"`
+	Fee           int64  `json:"Fee"`    // what we asked
+	Amount        int64  `json:"Amount"` // satoshis the wallet transaction paid us
+	PaidAt        string `json:"PaidAt"`
+}
+
+// what one of our files has earned
+type FileEarnings struct {
+	FileHash        string `json:"FileHash"`
+	Name            string `json:"Name"`
+	Downloads       int64  `json:"Downloads"`       // times we sent the file in full
+	Payments        int64  `json:"Payments"`        // of those, how many were paid for
+	AwaitingPayment int64  `json:"AwaitingPayment"` // sent encrypted, key not bought yet
+	Earned          int64  `json:"Earned"`          // satoshis
+	LastPaidAt      string `json:"LastPaidAt"`
+}
+
+type EarningsReport struct {
+	Unit     string         `json:"Unit"`
+	Earned   int64          `json:"Earned"`
+	Files    []FileEarnings `json:"Files"`    // best earning first
+	Payments []Payment      `json:"Payments"` // only when asked about a single file
+}
@@ -0,0 +1,32 @@
+package models
+
+// one published version of a series
+type SeriesVersion struct {
+	Version     int64  `json:"Version"` // from 1, in publishing order
+	FileHash    string `json:"FileHash"`
+	Changelog   string `json:"Changelog"`
+	PublishedAt int64  `json:"PublishedAt"` // unix seconds
+}
+
+// a mutable record pointing at the versions of a file, owned and signed by the uploader's key
+// the id is derived from the owner and name, so nobody else can publish under it
+type Series struct {
+	ID          string          `json:"ID"`
+	Owner       string          `json:"Owner"` // peer id of the uploader
+	Name        string          `json:"Name"`
+	Description string          `json:"Description"`
+	Versions    []SeriesVersion `json:"Versions"` // oldest first
+	Sequence    int64           `json:"Sequence"` // bumped on every change, the highest wins in the dht
+	UpdatedAt   int64           `json:"UpdatedAt"`
+	Signature   string          `json:"Signature"` // hex signature of the record without this field
+}
+
+// a series as shown to downloaders, ratings are summed over every version
+type SeriesListing struct {
+	Series    Series      `json:"Series"`
+	Latest    DHTMetadata `json:"Latest"`
+	Rating    int64       `json:"Rating"`
+	NumRaters int64       `json:"NumRaters"`
+	Upvote    int64       `json:"Upvote"`
+	Downvote  int64       `json:"Downvote"`
+}
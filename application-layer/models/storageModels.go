@@ -0,0 +1,24 @@
+package models
+
+// entry in the blob store index - the blob itself is stored under its hash
+type BlobEntry struct {
+	Hash      string `json:"Hash"`
+	Name      string `json:"Name"` // sanitised file name shown to the user
+	Size      int64  `json:"Size"`
+	ChunkRoot string `json:"ChunkRoot"` // merkle root of the chunk hashes
+	CreatedAt string `json:"CreatedAt"`
+}
+
+// per-chunk sha-256 hashes of a file and the merkle root over them
+type ChunkTree struct {
+	ChunkSize int64    `json:"ChunkSize"`
+	Chunks    []string `json:"Chunks"`
+	Root      string   `json:"Root"`
+}
+
+// result of a garbage collection run over the blob store
+type GCReport struct {
+	RemovedBlobs []string `json:"RemovedBlobs"`
+	RemovedTemp  int      `json:"RemovedTemp"`
+	FreedBytes   int64    `json:"FreedBytes"`
+}
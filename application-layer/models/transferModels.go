@@ -0,0 +1,24 @@
+package models
+
+// progress of a single download, keyed by the transaction id of the request
+type Transfer struct {
+	TransactionID string  `json:"TransactionID"`
+	FileHash      string  `json:"FileHash"`
+	FileName      string  `json:"FileName"`
+	TargetID      string  `json:"TargetID"`
+	State         string  `json:"State"` // "pending", "queued", "downloading", "paused", "complete", "cancelled", "declined", "failed"
+	QueuePosition int     `json:"QueuePosition"`
+	BytesReceived int64   `json:"BytesReceived"`
+	TotalBytes    int64   `json:"TotalBytes"`
+	Speed         float64 `json:"Speed"` // bytes per second
+	ETA           int64   `json:"ETA"`   // seconds left, -1 when unknown
+	Error         string  `json:"Error"`
+	CreatedAt     string  `json:"CreatedAt"`
+	UpdatedAt     string  `json:"UpdatedAt"`
+}
+
+// message pushed to the UI over the websocket
+type TransferEvent struct {
+	Event    string   `json:"event"` // always "transfer"
+	Transfer Transfer `json:"transfer"`
+}
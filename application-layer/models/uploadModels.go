@@ -0,0 +1,18 @@
+package models
+
+// provider-side limits applied to files we serve to other peers
+// a value of 0 means "no limit" for every field
+type UploadPolicy struct {
+	MaxConcurrentUploads int   `json:"MaxConcurrentUploads"` // number of files sent at the same time
+	MaxQueueLength       int   `json:"MaxQueueLength"`       // requests waiting for a free upload slot
+	GlobalRateLimit      int64 `json:"GlobalRateLimit"`      // bytes per second across all uploads
+	PerPeerRateLimit     int64 `json:"PerPeerRateLimit"`     // bytes per second for a single requester
+	EncryptTransfers     bool  `json:"EncryptTransfers"`     // encrypt every upload and only release the key once paid
+}
+
+// snapshot of the upload manager returned by the REST api
+type UploadStatus struct {
+	Policy        UploadPolicy  `json:"Policy"`
+	ActiveUploads []Transaction `json:"ActiveUploads"`
+	QueuedUploads []Transaction `json:"QueuedUploads"`
+}
@@ -0,0 +1,28 @@
+package models
+
+// a copy of wallet.db kept in the wallet backups directory
+type WalletBackup struct {
+	Name      string `json:"Name"` // file name, used to pick the backup to restore
+	Size      int64  `json:"Size"`
+	Encrypted bool   `json:"Encrypted"` // false only for copies taken by a delete without a passphrase
+	CreatedAt string `json:"CreatedAt"`
+}
+
+// a named wallet, each one lives in its own btcwallet data directory
+type WalletInfo struct {
+	Name          string `json:"Name"`
+	Active        bool   `json:"Active"`        // the wallet btcwallet runs with
+	Exists        bool   `json:"Exists"`        // wallet.db is there
+	Account       string `json:"Account"`       // account new receiving addresses come from
+	MiningAddress string `json:"MiningAddress"` // where this wallet's block rewards go
+	AppDataDir    string `json:"AppDataDir"`
+	CreatedAt     string `json:"CreatedAt"`
+}
+
+// an account inside the active wallet, from listaccounts and getaddressesbyaccount
+type WalletAccount struct {
+	Name      string   `json:"Name"`
+	Balance   float64  `json:"Balance"`
+	Addresses []string `json:"Addresses"`
+	Active    bool     `json:"Active"`
+}
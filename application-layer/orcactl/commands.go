@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// request is what a command turns its arguments into
+type request struct {
+	Server string      // overrides the command's server when set
+	Method string      // overrides the command's method when set
+	Path   string      // overrides the command's path when set
+	Query  url.Values  // added to the url
+	Body   interface{} // sent as json when set
+	Form   url.Values  // sent form encoded when set
+}
+
+// command maps an orcactl command to one of the servers' endpoints
+type command struct {
+	Name     string
+	Category string
+	Server   string // "btc", "files", "proxy" or "admin"
+	Method   string
+	Path     string
+	Args     []string // optional ones are in brackets
+	Help     string
+	build    func(args []string) (request, error)
+}
+
+func (c command) usage() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+func (c command) requiredArgs() int {
+	required := 0
+	for _, arg := range c.Args {
+		if !strings.HasPrefix(arg, "[") {
+			required++
+		}
+	}
+	return required
+}
+
+// noArgs is for commands that send nothing
+func noArgs(args []string) (request, error) {
+	return request{}, nil
+}
+
+// queryArgs puts the positional arguments into the query under names, in order
+func queryArgs(names ...string) func(args []string) (request, error) {
+	return func(args []string) (request, error) {
+		query := url.Values{}
+		for i, arg := range args {
+			if i < len(names) && arg != "" {
+				query.Set(names[i], arg)
+			}
+		}
+		return request{Query: query}, nil
+	}
+}
+
+// jsonArg passes a json argument on as the body, it's checked here so typos don't reach the server
+func jsonArg(args []string) (request, error) {
+	var body json.RawMessage
+	if err := json.Unmarshal([]byte(args[0]), &body); err != nil {
+		return request{}, fmt.Errorf("argument is not valid json: %v", err)
+	}
+	return request{Body: body}, nil
+}
+
+func parseAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+var commands = []command{
+	// dht
+	{Name: "dhtstatus", Category: "DHT", Server: "admin", Method: http.MethodGet, Path: "/admin/dht/status",
+		Help: "our peer id, addresses, routing table size and protocols", build: noArgs},
+	{Name: "listpeers", Category: "DHT", Server: "admin", Method: http.MethodGet, Path: "/admin/dht/peers",
+		Help: "peers we are connected to", build: noArgs},
+	{Name: "getrecord", Category: "DHT", Server: "admin", Method: http.MethodGet, Path: "/admin/dht/record",
+		Args: []string{"<key>"}, Help: "value stored under /orcanet/<key>", build: queryArgs("key")},
+	{Name: "putrecord", Category: "DHT", Server: "admin", Method: http.MethodPut, Path: "/admin/dht/record",
+		Args: []string{"<key>", "<value>"}, Help: "store a value under /orcanet/<key>",
+		build: func(args []string) (request, error) {
+			return request{Body: map[string]string{"Key": args[0], "Value": args[1]}}, nil
+		}},
+	{Name: "getproviders", Category: "DHT", Server: "admin", Method: http.MethodGet, Path: "/admin/dht/providers",
+		Args: []string{"<key>"}, Help: "peers providing a key", build: queryArgs("key")},
+	{Name: "provide", Category: "DHT", Server: "admin", Method: http.MethodPost, Path: "/admin/dht/provide",
+		Args: []string{"<key>"}, Help: "announce us as a provider of a key", build: queryArgs("key")},
+	{Name: "peercapabilities", Category: "DHT", Server: "files", Method: http.MethodGet, Path: "/download/capabilities",
+		Args: []string{"<peerid>"}, Help: "which of our protocols a peer speaks", build: queryArgs("peerID")},
+	{Name: "reputation", Category: "DHT", Server: "files", Method: http.MethodGet, Path: "/download/reputation",
+		Args: []string{"[peerid]"}, Help: "reputation of all peers or of one", build: queryArgs("peerID")},
+	{Name: "blockpeer", Category: "DHT", Server: "files", Method: http.MethodPost, Path: "/download/reputation/block",
+		Args: []string{"<peerid>", "[reason]"}, Help: "stop dealing with a peer", build: queryArgs("peerID", "reason")},
+	{Name: "unblockpeer", Category: "DHT", Server: "files", Method: http.MethodPost, Path: "/download/reputation/unblock",
+		Args: []string{"<peerid>"}, Help: "deal with a blocked peer again", build: queryArgs("peerID")},
+
+	// files
+	{Name: "listfiles", Category: "Files", Server: "files", Method: http.MethodGet, Path: "/files/fetch",
+		Args: []string{"[uploaded|downloaded]"}, Help: "our uploaded or downloaded files", build: queryArgs("file")},
+	{Name: "getfile", Category: "Files", Server: "files", Method: http.MethodGet, Path: "/files/getFile",
+		Args: []string{"<hash>"}, Help: "metadata of a file in the dht", build: queryArgs("val")},
+	{Name: "publish", Category: "Files", Server: "files", Method: http.MethodPost, Path: "/files/upload",
+		Args: []string{"<metadata json>"}, Help: "publish a stored file from its FileMetadata json, hash and size come from the content",
+		build: func(args []string) (request, error) {
+			req, err := jsonArg(args)
+			req.Query = url.Values{"val": {"true"}}
+			return req, err
+		}},
+	{Name: "deletefile", Category: "Files", Server: "files", Method: http.MethodDelete, Path: "/files/delete",
+		Args: []string{"<hash>", "<name>", "<uploaded true|false>"}, Help: "stop sharing a file",
+		build: queryArgs("hash", "name", "originalUploader")},
+	{Name: "marketplace", Category: "Files", Server: "files", Method: http.MethodGet, Path: "/files/refresh",
+		Help: "files on the marketplace", build: noArgs},
+	{Name: "transactions", Category: "Files", Server: "files", Method: http.MethodGet, Path: "/files/getTransactions",
+		Help: "history of our downloads and uploads", build: noArgs},
+	{Name: "earnings", Category: "Files", Server: "files", Method: http.MethodGet, Path: "/files/earnings",
+		Args: []string{"[filehash]"}, Help: "what our files earned", build: queryArgs("fileHash")},
+
+	// downloads
+	{Name: "download", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/request",
+		Args: []string{"<filehash>", "[provider peerid]"}, Help: "download a file, from the best ranked provider unless one is given",
+		build: func(args []string) (request, error) {
+			body := map[string]string{"FileHash": args[0]}
+			if len(args) > 1 {
+				body["TargetID"] = args[1]
+			}
+			return request{Body: body}, nil
+		}},
+	{Name: "providers", Category: "Downloads", Server: "files", Method: http.MethodGet, Path: "/download/providers",
+		Args: []string{"<filehash>"}, Help: "providers of a file ranked by reputation", build: queryArgs("fileHash")},
+	{Name: "quote", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/quote",
+		Args: []string{"<provider peerid>", "<filehash>"}, Help: "ask a provider for a signed price", build: queryArgs("targetID", "fileHash")},
+	{Name: "listtransfers", Category: "Downloads", Server: "files", Method: http.MethodGet, Path: "/download/transfers",
+		Args: []string{"[transactionid]"}, Help: "progress of all downloads or of one", build: queryArgs("transactionID")},
+	{Name: "pausetransfer", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/pause",
+		Args: []string{"<transactionid>"}, Help: "pause a download", build: queryArgs("transactionID")},
+	{Name: "resumetransfer", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/resume",
+		Args: []string{"<transactionid>"}, Help: "resume a paused download", build: queryArgs("transactionID")},
+	{Name: "canceltransfer", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/cancel",
+		Args: []string{"<transactionid>"}, Help: "cancel a download", build: queryArgs("transactionID")},
+	{Name: "paytransfer", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/pay",
+		Args: []string{"<transactionid>", "<passphrase>"}, Help: "pay the provider's invoice for a download from our wallet",
+		build: func(args []string) (request, error) {
+			return request{Query: url.Values{"transactionID": {args[0]}}, Form: url.Values{"passphrase": {args[1]}}}, nil
+		}},
+	{Name: "submitpayment", Category: "Downloads", Server: "files", Method: http.MethodPost, Path: "/download/pay",
+		Args: []string{"<transactionid>", "<payment txid>"}, Help: "hand the provider proof of a payment made elsewhere",
+		build: queryArgs("transactionID", "paymentTxID")},
+
+	// proxy
+	{Name: "listproxies", Category: "Proxy", Server: "proxy", Method: http.MethodGet, Path: "/proxy-data/",
+		Help: "proxies on the network", build: noArgs},
+	{Name: "hostproxy", Category: "Proxy", Server: "proxy", Method: http.MethodPost, Path: "/proxy-data/",
+		Args: []string{"<proxy json>"}, Help: "host a proxy, e.g. '{\"name\":\"home\",\"price\":\"0.01\"}'", build: jsonArg},
+	{Name: "stophosting", Category: "Proxy", Server: "proxy", Method: http.MethodPost, Path: "/stop-hosting/",
+		Help: "stop hosting our proxy", build: noArgs},
+	{Name: "connectproxy", Category: "Proxy", Server: "proxy", Method: http.MethodPost, Path: "/connect-proxy/",
+		Args: []string{"<connect json>"}, Help: "connect through a proxy, e.g. '{\"hostPeerID\":\"...\",\"proxyIP\":\"...\",\"passphrase\":\"...\"}'",
+		build: jsonArg},
+	{Name: "disconnectproxy", Category: "Proxy", Server: "proxy", Method: http.MethodPost, Path: "/disconnect-from-proxy/",
+		Help: "stop using the proxy we are connected to", build: noArgs},
+	{Name: "proxyhistory", Category: "Proxy", Server: "proxy", Method: http.MethodGet, Path: "/proxy-history/",
+		Help: "proxies we used", build: noArgs},
+
+	// wallet
+	{Name: "getbalance", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/balance",
+		Help: "wallet balance", build: noArgs},
+	{Name: "getnewaddress", Category: "Wallet", Server: "btc", Method: http.MethodPost, Path: "/api/btc/newaddress",
+		Help: "a fresh receiving address", build: noArgs},
+	{Name: "currentaddress", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/currentaddress",
+		Help: "the address we mine to", build: noArgs},
+	{Name: "getreceivedbyaddress", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/getreceivedbyaddress",
+		Args: []string{"<address>"}, Help: "total received by an address", build: queryArgs("walletAddress")},
+	{Name: "listreceivedbyaddress", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/listreceivedbyaddress",
+		Help: "what each address received", build: noArgs},
+	{Name: "listunspent", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/listunspent",
+		Help: "unspent outputs", build: noArgs},
+	{Name: "getblockcount", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/getblockcount",
+		Help: "height of the chain", build: noArgs},
+	{Name: "send", Category: "Wallet", Server: "btc", Method: http.MethodPost, Path: "/api/btc/transaction",
+		Args: []string{"<passphrase>", "<utxo txid>", "<address>", "<amount>"}, Help: "send coins from an unspent output",
+		build: func(args []string) (request, error) {
+			amount, err := parseAmount(args[3])
+			if err != nil {
+				return request{}, err
+			}
+			return request{Body: map[string]interface{}{"passphrase": args[0], "txid": args[1], "dst": args[2], "amount": amount}}, nil
+		}},
+	{Name: "listwallets", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/wallets",
+		Help: "our named wallets", build: noArgs},
+	{Name: "createwallet", Category: "Wallet", Server: "btc", Method: http.MethodPost, Path: "/api/btc/wallets",
+		Args: []string{"<name>", "<passphrase>"}, Help: "create a named wallet, the answer has its seed phrase",
+		build: func(args []string) (request, error) {
+			return request{Body: map[string]string{"name": args[0], "passphrase": args[1]}}, nil
+		}},
+	{Name: "switchwallet", Category: "Wallet", Server: "btc", Method: http.MethodPost, Path: "/api/btc/wallets/switch",
+		Args: []string{"<name>", "[passphrase]"}, Help: "make another wallet the active one",
+		build: func(args []string) (request, error) {
+			body := map[string]string{"name": args[0]}
+			if len(args) > 1 {
+				body["passphrase"] = args[1]
+			}
+			return request{Body: body}, nil
+		}},
+	{Name: "listaccounts", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/accounts",
+		Help: "accounts of the active wallet", build: noArgs},
+	{Name: "createinvoice", Category: "Wallet", Server: "btc", Method: http.MethodPost, Path: "/api/btc/invoices",
+		Args: []string{"<amount>", "[memo]", "[expiry seconds]"}, Help: "invoice with a bip21 uri to get paid",
+		build: func(args []string) (request, error) {
+			amount, err := parseAmount(args[0])
+			if err != nil {
+				return request{}, err
+			}
+			body := map[string]interface{}{"amount": amount}
+			if len(args) > 1 {
+				body["memo"] = args[1]
+			}
+			if len(args) > 2 {
+				expiry, err := strconv.ParseInt(args[2], 10, 64)
+				if err != nil || expiry < 0 {
+					return request{}, fmt.Errorf("invalid expiry %q", args[2])
+				}
+				body["expiry"] = expiry
+			}
+			return request{Body: body}, nil
+		}},
+	{Name: "listinvoices", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/invoices",
+		Args: []string{"[open|pending|paid|expired]"}, Help: "our invoices", build: queryArgs("status")},
+	{Name: "getinvoice", Category: "Wallet", Server: "btc", Method: http.MethodGet, Path: "/api/btc/invoice",
+		Args: []string{"<id>"}, Help: "one invoice", build: queryArgs("id")},
+	{Name: "payuri", Category: "Wallet", Server: "btc", Method: http.MethodPost, Path: "/api/btc/payuri",
+		Args: []string{"<bitcoin: uri>", "<passphrase>"}, Help: "pay a bip21 uri",
+		build: func(args []string) (request, error) {
+			return request{Body: map[string]string{"uri": args[0], "passphrase": args[1]}}, nil
+		}},
+
+	// mining and processes
+	{Name: "startmining", Category: "Mining", Server: "btc", Method: http.MethodPost, Path: "/api/btc/startmining",
+		Args: []string{"[threads]"}, Help: "start mining to the current address",
+		build: func(args []string) (request, error) {
+			if len(args) == 0 {
+				return request{}, nil
+			}
+			threads, err := strconv.Atoi(args[0])
+			if err != nil || threads < 0 {
+				return request{}, fmt.Errorf("invalid thread count %q", args[0])
+			}
+			return request{Body: map[string]int{"threads": threads}}, nil
+		}},
+	{Name: "stopmining", Category: "Mining", Server: "btc", Method: http.MethodPost, Path: "/api/btc/stopmining",
+		Help: "stop mining", build: noArgs},
+	{Name: "getminingstatus", Category: "Mining", Server: "btc", Method: http.MethodGet, Path: "/api/btc/getminingstatus",
+		Help: "whether we are mining", build: noArgs},
+	{Name: "mininginfo", Category: "Mining", Server: "btc", Method: http.MethodGet, Path: "/api/btc/mininginfo",
+		Help: "btcd's mining info", build: noArgs},
+	{Name: "mininghistory", Category: "Mining", Server: "btc", Method: http.MethodGet, Path: "/api/btc/mininghistory",
+		Args: []string{"[limit]"}, Help: "blocks we mined", build: queryArgs("limit")},
+	{Name: "processes", Category: "Mining", Server: "btc", Method: http.MethodGet, Path: "/api/btc/processes",
+		Help: "state of btcd and btcwallet", build: noArgs},
+
+	// admin
+	{Name: "loglevel", Category: "Admin", Method: http.MethodGet, Path: "/admin/loglevel",
+		Args: []string{"<btc|files|proxy>", "[subsystem]", "[level]"}, Help: "show log levels, or change those of one subsystem or all of them",
+		build: func(args []string) (request, error) {
+			req := request{Server: args[0]}
+			switch len(args) {
+			case 2:
+				req.Method = http.MethodPut
+				req.Body = map[string]string{"Subsystem": "", "Level": args[1]}
+			case 3:
+				req.Method = http.MethodPut
+				req.Body = map[string]string{"Subsystem": args[1], "Level": args[2]}
+			}
+			return req, nil
+		}},
+	{Name: "call", Category: "Admin", Args: []string{"<btc|files|proxy>", "<method>", "<path>", "[json body]"},
+		Help: "call any endpoint, e.g. call files GET /files/pricing",
+		build: func(args []string) (request, error) {
+			req := request{Server: args[0], Method: strings.ToUpper(args[1]), Path: args[2]}
+			if len(args) > 3 {
+				body, err := jsonArg(args[3:])
+				if err != nil {
+					return request{}, err
+				}
+				req.Body = body.Body
+			}
+			return req, nil
+		}},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// where the servers listen by default, see main.go, fileMain/testMain.go and proxyMain.go
+// the dht admin endpoints are served by the files server on localhost only
+const (
+	defaultBtcServer   = "http://localhost:8080"
+	defaultFilesServer = "http://localhost:8081"
+	defaultProxyServer = "http://localhost:8082"
+	defaultAdminServer = "http://127.0.0.1:8083"
+)
+
+type config struct {
+	Servers     map[string]string // "btc", "files", "proxy" and "admin" to their base url
+	Timeout     time.Duration
+	Compact     bool
+	ListCommand bool
+}
+
+// loadConfig parses the flags, servers can also be set with ORCACTL_BTC, ORCACTL_FILES, ORCACTL_PROXY and ORCACTL_ADMIN
+func loadConfig() (*config, []string) {
+	cfg := &config{Servers: make(map[string]string)}
+
+	btc := flag.String("btc", envOr("ORCACTL_BTC", defaultBtcServer), "url of the wallet and mining server")
+	files := flag.String("files", envOr("ORCACTL_FILES", defaultFilesServer), "url of the file, download and dht server")
+	proxy := flag.String("proxy", envOr("ORCACTL_PROXY", defaultProxyServer), "url of the proxy server")
+	admin := flag.String("admin", envOr("ORCACTL_ADMIN", defaultAdminServer), "url of the dht admin endpoints, only served on localhost")
+	flag.DurationVar(&cfg.Timeout, "timeout", 2*time.Minute, "how long to wait for an answer")
+	flag.BoolVar(&cfg.Compact, "compact", false, "print json on a single line")
+	flag.BoolVar(&cfg.ListCommand, "l", false, "list all commands and exit")
+	flag.Usage = usage
+	flag.Parse()
+
+	cfg.Servers["btc"] = strings.TrimRight(*btc, "/")
+	cfg.Servers["files"] = strings.TrimRight(*files, "/")
+	cfg.Servers["proxy"] = strings.TrimRight(*proxy, "/")
+	cfg.Servers["admin"] = strings.TrimRight(*admin, "/")
+	return cfg, flag.Args()
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  orcactl [OPTIONS] <command> <args...>")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Options:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Specify -l to list available commands.")
+	fmt.Fprintln(os.Stderr, "An argument of - is read from stdin, e.g. to keep a passphrase out of the shell history.")
+}
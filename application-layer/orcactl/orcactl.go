@@ -0,0 +1,211 @@
+// orcactl talks to a running node over its http api, in the spirit of btcd's btcctl
+// e.g. orcactl getbalance, orcactl getproviders <file hash>, orcactl loglevel files DHT debug
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+func main() {
+	cfg, args := loadConfig()
+	if cfg.ListCommand {
+		listCommands()
+		return
+	}
+	if len(args) < 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	cmd, exists := findCommand(args[0])
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Unrecognized command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "Specify -l to list available commands.")
+		os.Exit(1)
+	}
+	params, err := readStdinArgs(args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(params) < cmd.requiredArgs() || len(params) > len(cmd.Args) {
+		fmt.Fprintf(os.Stderr, "Usage: orcactl %s\n", cmd.usage())
+		os.Exit(1)
+	}
+
+	req, err := cmd.build(params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.Name, err)
+		os.Exit(1)
+	}
+	status, body, err := send(cfg, cmd, req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	output, ok := formatAnswer(status, body, cfg.Compact)
+	if !ok {
+		fmt.Fprintln(os.Stderr, output)
+		os.Exit(1)
+	}
+	fmt.Println(output)
+}
+
+// readStdinArgs replaces each argument of "-" with a line read from stdin
+func readStdinArgs(args []string) ([]string, error) {
+	var reader *bufio.Reader
+	params := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "-" {
+			params[i] = arg
+			continue
+		}
+		if reader == nil {
+			reader = bufio.NewReader(os.Stdin)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read argument %d from stdin: %v", i+1, err)
+		}
+		params[i] = strings.TrimRight(line, "\r\n")
+	}
+	return params, nil
+}
+
+// send makes the request and returns the status and body of the answer
+func send(cfg *config, cmd command, req request) (int, []byte, error) {
+	server, method, path := cmd.Server, cmd.Method, cmd.Path
+	if req.Server != "" {
+		server = req.Server
+	}
+	if req.Method != "" {
+		method = req.Method
+	}
+	if req.Path != "" {
+		path = req.Path
+	}
+	base, exists := cfg.Servers[server]
+	if !exists {
+		return 0, nil, fmt.Errorf("unknown server %q, use btc, files, proxy or admin", server)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	target := base + path
+	if len(req.Query) > 0 {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		target += separator + req.Query.Encode()
+	}
+
+	var body io.Reader
+	contentType := ""
+	switch {
+	case req.Form != nil:
+		body = strings.NewReader(req.Form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case req.Body != nil:
+		data, err := json.Marshal(req.Body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	httpReq, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+
+	client := &http.Client{Timeout: cfg.Timeout}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to reach the %s server at %s: %v", server, base, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read the answer: %v", err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// formatAnswer is the json to print for an answer and whether the request succeeded
+// plain text errors from http.Error are wrapped so the output stays json
+func formatAnswer(status int, body []byte, compact bool) (string, bool) {
+	if status >= 200 && status <= 299 {
+		return formatJSON(body, compact), true
+	}
+	if !json.Valid(bytes.TrimSpace(body)) {
+		body = mustMarshal(map[string]interface{}{"Status": status, "Error": strings.TrimSpace(string(body))})
+	}
+	return formatJSON(body, compact), false
+}
+
+// formatJSON indents json answers, anything else is printed as a json string
+func formatJSON(data []byte, compact bool) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "{}"
+	}
+	if !json.Valid(data) {
+		data = mustMarshal(string(data))
+	}
+
+	var out bytes.Buffer
+	if compact {
+		json.Compact(&out, data)
+	} else {
+		json.Indent(&out, data, "", "  ")
+	}
+	return out.String()
+}
+
+func mustMarshal(value interface{}) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// listCommands prints the commands by category, like btcctl -l
+func listCommands() {
+	byCategory := make(map[string][]command)
+	var categories []string
+	for _, cmd := range commands {
+		if _, seen := byCategory[cmd.Category]; !seen {
+			categories = append(categories, cmd.Category)
+		}
+		byCategory[cmd.Category] = append(byCategory[cmd.Category], cmd)
+	}
+
+	for i, category := range categories {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", category)
+		cmds := byCategory[category]
+		sort.Slice(cmds, func(a, b int) bool { return cmds[a].Name < cmds[b].Name })
+		for _, cmd := range cmds {
+			fmt.Printf("  %-50s %s\n", cmd.usage(), cmd.Help)
+		}
+	}
+}
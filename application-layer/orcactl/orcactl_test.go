@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// go test -v -run ^TestCommands$ -count=1 application-layer/orcactl
+func TestCommands(t *testing.T) {
+	var got struct {
+		Method, Path, Query, ContentType, Body string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.Method, got.Path, got.Query, got.ContentType, got.Body = r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), string(body)
+		if r.URL.Path == "/admin/dht/record" && r.Method == http.MethodGet {
+			http.Error(w, "failed to get record: routing: not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	cfg := &config{Servers: map[string]string{"btc": server.URL, "files": server.URL, "proxy": server.URL, "admin": server.URL}, Timeout: 5 * time.Second}
+
+	run := func(args ...string) (int, []byte) {
+		cmd, exists := findCommand(args[0])
+		if !exists {
+			t.Fatalf("no command %s", args[0])
+		}
+		req, err := cmd.build(args[1:])
+		if err != nil {
+			t.Fatalf("%s: %v", args[0], err)
+		}
+		status, body, err := send(cfg, cmd, req)
+		if err != nil {
+			t.Fatalf("%s: %v", args[0], err)
+		}
+		return status, body
+	}
+
+	run("getproviders", "abc")
+	if got.Method != http.MethodGet || got.Path != "/admin/dht/providers" || got.Query != "key=abc" {
+		t.Errorf("getproviders sent %+v", got)
+	}
+
+	run("paytransfer", "tx1", "secret")
+	if got.Path != "/download/pay" || got.Query != "transactionID=tx1" || got.Body != "passphrase=secret" ||
+		got.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("paytransfer sent %+v", got)
+	}
+
+	run("loglevel", "proxy", "PRXY", "debug")
+	var level map[string]string
+	json.Unmarshal([]byte(got.Body), &level)
+	if got.Method != http.MethodPut || got.Path != "/admin/loglevel" || level["Subsystem"] != "PRXY" || level["Level"] != "debug" {
+		t.Errorf("loglevel sent %+v", got)
+	}
+
+	run("send", "secret", "txid", "addr", "0.5")
+	var payment map[string]interface{}
+	json.Unmarshal([]byte(got.Body), &payment)
+	if got.Path != "/api/btc/transaction" || payment["amount"] != 0.5 || payment["dst"] != "addr" {
+		t.Errorf("send sent %+v", got)
+	}
+	sendCmd, _ := findCommand("send")
+	if _, err := sendCmd.build([]string{"p", "t", "a", "lots"}); err == nil {
+		t.Error("send took an amount that isn't a number")
+	}
+
+	// plain text errors come out as json too
+	status, body := run("getrecord", "missing")
+	if status != http.StatusNotFound {
+		t.Errorf("getrecord status = %d", status)
+	}
+	output, ok := formatAnswer(status, body, true)
+	var wrapped map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &wrapped); ok || err != nil || wrapped["Error"] != "failed to get record: routing: not found" {
+		t.Errorf("error output = %s, %v", output, err)
+	}
+}
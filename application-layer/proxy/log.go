@@ -0,0 +1,5 @@
+package proxyService
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("PRXY")
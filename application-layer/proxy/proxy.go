@@ -1,13 +1,14 @@
 package proxyService
 
 import (
+	"application-layer/contacts"
 	dht_kad "application-layer/dht"
+	"application-layer/metrics"
 	"application-layer/models"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"os"
@@ -20,6 +21,7 @@ import (
 
 	services "application-layer/services"
 
+	"github.com/btcsuite/btcd/btcutil"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -42,8 +44,26 @@ var (
 	contextCancel        context.CancelFunc
 	dirPath              = filepath.Join("..", "..", "utils")
 	proxyHistoryFilePath = filepath.Join(dirPath, "proxyHistory.json")
+	hostedProxy          models.Proxy // what we advertise while hosting, its price is what clients are invoiced
 )
 
+// clients ask for an invoice before connecting, the session costs the hosted proxy's price
+func init() {
+	dht_kad.RegisterInvoicePricer("proxy", func(reference string, remotePeer string) (float64, string, error) {
+		proxyUpdateMutex.Lock()
+		proxy, hosted := hostedProxy, hosting
+		proxyUpdateMutex.Unlock()
+		if !hosted {
+			return 0, "", fmt.Errorf("not hosting a proxy")
+		}
+		price, err := strconv.ParseFloat(proxy.Price, 64)
+		if err != nil || price <= 0 {
+			return 0, "", fmt.Errorf("proxy has no price")
+		}
+		return price, fmt.Sprintf("proxy session on %s", proxy.Name), nil
+	})
+}
+
 const (
 	bootstrapNode = "/ip4/35.222.31.85/tcp/61000/p2p/12D3KooWAZv5dC3xtzos2KiJm2wDqiLGJ5y4gwC7WSKU5DvmCLEL"
 
@@ -76,6 +96,23 @@ func getProxyFromDHT(dht *dht.IpfsDHT, peerID peer.ID) (string, error) {
 	return string(value), nil
 }
 
+// advertisedPrice is the price hostPeerID lists its proxy at in the dht
+func advertisedPrice(hostPeerID string) (float64, error) {
+	peerID, err := peer.Decode(hostPeerID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid host peer id: %v", err)
+	}
+	value, err := getProxyFromDHT(dht_kad.DHT, peerID)
+	if err != nil {
+		return 0, err
+	}
+	var proxy models.Proxy
+	if err := json.Unmarshal([]byte(value), &proxy); err != nil {
+		return 0, fmt.Errorf("failed to parse proxy info: %v", err)
+	}
+	return strconv.ParseFloat(proxy.Price, 64)
+}
+
 func getKnownProxyKeys() []string {
 	var keys []string
 	prefix := "/orcanet/proxy/"
@@ -92,11 +129,11 @@ func getKnownProxyKeys() []string {
 		key := prefix + peerID.String()
 
 		// Check if the key exists in the DHT
-		value, err := dht_kad.DHT.GetValue(context.Background(), key)
+		value, err := dht_kad.GetValue(context.Background(), key)
 		if err == nil {
 			keys = append(keys, key)
 			// Optionally, log the value associated with the key
-			fmt.Println("Found proxy for key:", key, "with value:", string(value))
+			log.Info("Found proxy for key:", key, "with value:", string(value))
 		}
 	}
 
@@ -122,17 +159,17 @@ func getAllProxiesFromDHT(dht *dht.IpfsDHT, localPeerID peer.ID, localProxy mode
 	for _, key := range proxyKeys {
 		go func(k string) {
 			defer wg.Done()
-			log.Printf("Debug: Retrieving proxy info for key: %s", k)
+			log.Debugf("Retrieving proxy info for key: %s", k)
 			value, err := dht.GetValue(ctx, k)
 			if err != nil {
-				log.Printf("Debug: Error retrieving proxy info for key %s: %v", k, err)
+				log.Debugf("Error retrieving proxy info for key %s: %v", k, err)
 				return
 			}
 
 			var proxy models.Proxy
 			err = json.Unmarshal(value, &proxy)
 			if err != nil {
-				log.Printf("Debug: Error unmarshalling proxy data for key %s: %v", k, err)
+				log.Debugf("Error unmarshalling proxy data for key %s: %v", k, err)
 				return
 			}
 
@@ -168,7 +205,7 @@ func getAllProxiesFromDHT(dht *dht.IpfsDHT, localPeerID peer.ID, localProxy mode
 func pollPeerAddresses(ProxyIsHost bool, ip string) {
 	node := dht_kad.Host
 	if ProxyIsHost {
-		fmt.Println("IN HOST", ip)
+		log.Debug("IN HOST", ip)
 		for {
 			if hosting {
 				httpHostToClient(node)
@@ -177,9 +214,9 @@ func pollPeerAddresses(ProxyIsHost bool, ip string) {
 		}
 		// httpHostToClient(node)
 	} else {
-		fmt.Println("IN CLIENT")
-		fmt.Println("IP: ", ip)
-		fmt.Println("IP", ip)
+		log.Info("IN CLIENT")
+		log.Debug("IP: ", ip)
+		log.Debug("IP", ip)
 		var script string
 		var args []string
 		script = "proxy/client.py"
@@ -209,7 +246,7 @@ func pollPeerAddresses(ProxyIsHost bool, ip string) {
 		go tar(contextCancel)
 		// Try running with `python`
 		if err := runCommand(globalCtxC, "python"); err != nil {
-			fmt.Println("`python` not found or failed, trying `python3`...")
+			log.Error("`python` not found or failed, trying `python3`...")
 			// If `python` fails, try `python3`
 			if err := runCommand(globalCtxC, "python3"); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to run %s with both `python` and `python3`: %v\n", script, err)
@@ -225,7 +262,7 @@ func getAdjacentNodeProxiesMetadata(w http.ResponseWriter, r *http.Request) {
 
 	// Retrieve connected peers
 	adjacentNodes := dht_kad.Host.Network().Peers()
-	fmt.Println("Connected peers:", adjacentNodes)
+	log.Debug("Connected peers:", adjacentNodes)
 
 	var sendWG sync.WaitGroup
 	var responseWG sync.WaitGroup
@@ -265,7 +302,7 @@ func nodeSupportRefreshStreams(peerID peer.ID) bool {
 	supportSendRefreshResponse := false
 
 	protocols, _ := dht_kad.Host.Peerstore().GetProtocols(peerID)
-	fmt.Printf("protocols supported by peer %v: %v\n", peerID, protocols)
+	log.Infof("protocols supported by peer %v: %v", peerID, protocols)
 
 	for _, protocol := range protocols {
 		if protocol == "/sendRefreshRequest/p2p" {
@@ -284,6 +321,7 @@ func handleProxyData(w http.ResponseWriter, r *http.Request) {
 	// go dht_kad.ConnectToPeer(node, Cloud_node_addr)
 	globalCtx = context.Background()
 	if r.Method == "POST" {
+		wasHosting := hosting
 		isHost = true
 		hosting = true
 		var newProxy models.Proxy
@@ -297,32 +335,38 @@ func handleProxyData(w http.ResponseWriter, r *http.Request) {
 		newProxy.Address = node.Addrs()[0].String()
 		newProxy.PeerID = node.ID().String()
 		newProxy.IsHost = true
-		log.Print("Debug: New proxy  info", newProxy)
+		log.Debug("New proxy  info", newProxy)
+		proxyUpdateMutex.Lock()
+		hostedProxy = newProxy
+		proxyUpdateMutex.Unlock()
+		if !wasHosting {
+			metrics.ProxySessionStarted("host")
+		}
 
 		if err := saveProxyToDHT(newProxy); err != nil {
-			log.Printf("Debug: Failed to save proxy to DHT: %v", err)
+			log.Debugf("Failed to save proxy to DHT: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Debug: Proxy saved to DHT successfully")
+		log.Debugf("Proxy saved to DHT successfully")
 
 		proxyInfo, err := getAllProxiesFromDHT(dht_kad.DHT, node.ID(), newProxy)
 		if err != nil {
-			log.Printf("Debug: Error retrieving proxies from DHT: %v", err)
+			log.Debugf("Error retrieving proxies from DHT: %v", err)
 		} else {
-			log.Printf("Debug: Retrieved %d proxies from DHT", len(proxyInfo))
+			log.Debugf("Retrieved %d proxies from DHT", len(proxyInfo))
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(proxyInfo); err != nil {
-			log.Printf("Debug: Error encoding proxy data: %v", err)
+		if err := json.NewEncoder(w).Encode(contacts.LabelProxies(proxyInfo)); err != nil {
+			log.Debugf("Error encoding proxy data: %v", err)
 			http.Error(w, fmt.Sprintf("Error encoding proxy data: %v", err), http.StatusInternalServerError)
 		}
 
 		return
 	}
 
-	log.Printf("Debug: Connecting to bootstrap node")
+	log.Debugf("Connecting to bootstrap node")
 	getAdjacentNodeProxiesMetadata(w, r)
 
 	if r.Method == "GET" {
@@ -344,10 +388,10 @@ func handleProxyData(w http.ResponseWriter, r *http.Request) {
 			responseData = proxyInfo
 		}
 		ip, _ := getPrivateIP()
-		fmt.Println("BEFORE POLLING", ip)
+		log.Debug("BEFORE POLLING", ip)
 		go pollPeerAddresses(true, ip)
 
-		if err := json.NewEncoder(w).Encode(responseData); err != nil {
+		if err := json.NewEncoder(w).Encode(contacts.LabelProxies(responseData)); err != nil {
 			http.Error(w, fmt.Sprintf("Error encoding proxy data: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -357,18 +401,24 @@ func handleProxyData(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleDisconnectFromProxy(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("INSIDE DISCONNECT PAGE")
+	log.Info("INSIDE DISCONNECT PAGE")
 	if r.Method != "GET" {
-		fmt.Println("R method isn't get for some reason")
+		log.Info("R method isn't get for some reason")
+	}
+	if clientconnect {
+		metrics.ProxySessionStopped("client")
 	}
 	clientconnect = false
 	w.WriteHeader(http.StatusOK)
 }
 
 func stopHosting(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("INSIDE DISCONNECT PAGE")
+	log.Info("INSIDE DISCONNECT PAGE")
 	if r.Method != "GET" {
-		fmt.Println("R method isn't get for some reason")
+		log.Info("R method isn't get for some reason")
+	}
+	if hosting {
+		metrics.ProxySessionStopped("host")
 	}
 	hosting = false
 	w.WriteHeader(http.StatusOK)
@@ -381,14 +431,14 @@ func updateProxyConnections(hostPeerID string, clientPeerID string) {
 	// Retrieve the current proxy information for the host
 	proxyInfo, err := getProxyFromDHT(dht_kad.DHT, peer.ID(hostPeerID))
 	if err != nil {
-		log.Printf("Error retrieving proxy info: %v", err)
+		log.Errorf("Error retrieving proxy info: %v", err)
 		return
 	}
 
 	var proxy models.Proxy
 	err = json.Unmarshal([]byte(proxyInfo), &proxy)
 	if err != nil {
-		log.Printf("Error unmarshalling proxy info: %v", err)
+		log.Errorf("Error unmarshalling proxy info: %v", err)
 		return
 	}
 
@@ -400,17 +450,17 @@ func updateProxyConnections(hostPeerID string, clientPeerID string) {
 	// Save the updated proxy information back to the DHT
 	updatedProxyJSON, err := json.Marshal(proxy)
 	if err != nil {
-		log.Printf("Error marshalling updated proxy info: %v", err)
+		log.Errorf("Error marshalling updated proxy info: %v", err)
 		return
 	}
 
-	err = dht_kad.DHT.PutValue(context.Background(), "/orcanet/proxy/"+hostPeerID, updatedProxyJSON)
+	err = dht_kad.PutValue(context.Background(), "/orcanet/proxy/"+hostPeerID, updatedProxyJSON)
 	if err != nil {
-		log.Printf("Error saving updated proxy info to DHT: %v", err)
+		log.Errorf("Error saving updated proxy info to DHT: %v", err)
 		return
 	}
 
-	log.Printf("Updated host proxy info with new connected peer: %s", clientPeerID)
+	log.Infof("Updated host proxy info with new connected peer: %s", clientPeerID)
 }
 
 // Helper function to check if a slice contains a string
@@ -452,7 +502,7 @@ func handleUpdateHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Process the history data (e.g., store in a database, etc.)
-	fmt.Printf("Received proxy history: %v\n", history)
+	log.Infof("Received proxy history: %v", history)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -479,7 +529,7 @@ func findTransactionWithAmountGreaterThan(utxos []map[string]interface{}, x floa
 func handleCheckBalance(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		log.Errorf("Error reading request body: %v", err)
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
 		return
 	}
@@ -490,7 +540,7 @@ func handleCheckBalance(w http.ResponseWriter, r *http.Request) {
 
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		log.Printf("Error parsing JSON: %v", err)
+		log.Errorf("Error parsing JSON: %v", err)
 		http.Error(w, "Error parsing JSON", http.StatusBadRequest)
 		return
 	}
@@ -511,7 +561,7 @@ func handleCheckBalance(w http.ResponseWriter, r *http.Request) {
 func handleConnectMethod(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		log.Errorf("Error reading request body: %v", err)
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
 		return
 	}
@@ -529,33 +579,27 @@ func handleConnectMethod(w http.ResponseWriter, r *http.Request) {
 	}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		log.Printf("Error parsing JSON: %v", err)
+		log.Errorf("Error parsing JSON: %v", err)
 		http.Error(w, "Error parsing JSON", http.StatusBadRequest)
 		return
 	}
 
 	if data.HostPeerID == dht_kad.Host.ID().String() {
-		log.Println("The peer ID matches the current node ID.")
+		log.Info("The peer ID matches the current node ID.")
 		http.Error(w, "Cannot connect to self.", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Host Name: %s", data.HostName)
-	log.Printf("Host Location: %s", data.HostLocation)
-	log.Printf("Host Peer ID: %s", data.HostPeerID)
-	log.Printf("Proxy IP: %s", data.ProxyIP)
-	log.Printf("Timestamp: %s", data.Timestamp)
-	log.Printf("Passphrase: %s", data.Passphrase)
-	log.Printf("Transaction ID: %s", data.TransactionID)
-	log.Printf("Destination Address: %s", data.DestinationAddress)
-	log.Printf("Amount: %f", data.Amount)
+	log.Infof("connecting to proxy %s (%s) at %s", data.HostName, data.HostPeerID, data.ProxyIP)
+	log.Debugf("proxy connect: location %s, timestamp %s, transaction %s, paying %f to %s",
+		data.HostLocation, data.Timestamp, data.TransactionID, data.Amount, data.DestinationAddress)
 
-	log.Println("Relaying data between client and peer...")
+	log.Info("Relaying data between client and peer...")
 	go pollPeerAddresses(false, data.ProxyIP)
-	fmt.Println("BEFORE addProxyHistory Entry HISTORY", data.HostPeerID)
+	log.Debug("BEFORE addProxyHistory Entry HISTORY", data.HostPeerID)
 
 	addProxyHistoryEntry(data.HostPeerID, data.ProxyIP)
-	fmt.Println("BEFORE SENDING HISTORY", data.HostPeerID)
+	log.Debug("BEFORE SENDING HISTORY", data.HostPeerID)
 	historyMutex.Lock()
 	defer historyMutex.Unlock()
 	newEntry := models.ProxyHistoryEntry{
@@ -564,7 +608,7 @@ func handleConnectMethod(w http.ResponseWriter, r *http.Request) {
 	}
 	err = dht_kad.SendHistoryToHost(data.HostPeerID, newEntry)
 	if err != nil {
-		log.Printf("Error sending history to host: %v", err)
+		log.Errorf("Error sending history to host: %v", err)
 		http.Error(w, "Failed to send history to host.", http.StatusInternalServerError)
 		return
 	}
@@ -575,10 +619,37 @@ func handleConnectMethod(w http.ResponseWriter, r *http.Request) {
 	}
 	b := findTransactionWithAmountGreaterThan(a, data.Amount)
 
-	log.Println("Successfully connected to the peer.")
+	log.Info("Successfully connected to the peer.")
 	w.WriteHeader(http.StatusOK)
+	if !clientconnect {
+		metrics.ProxySessionStarted("client")
+	}
 	clientconnect = true
 
+	// pay the host's invoice so it sees the payment arrive, hosts without invoices get the amount sent to their address
+	invoice, err := dht_kad.RequestInvoice(data.HostPeerID, "proxy", "")
+	if err == nil {
+		// the invoice is written by the host, never pay more than the user agreed to
+		agreed := data.Amount
+		if agreed <= 0 {
+			if agreed, err = advertisedPrice(data.HostPeerID); err != nil {
+				log.Errorf("Not paying proxy invoice %s, no agreed amount to check it against: %v", invoice.ID, err)
+				return
+			}
+		}
+		limit, _ := btcutil.NewAmount(agreed)
+		if asked := btcutil.Amount(invoice.Amount); asked > limit {
+			log.Errorf("Not paying proxy invoice %s for %v, the agreed price is %v", invoice.ID, asked, limit)
+			return
+		}
+		if txid, err := services.NewBtcService().PayURI(invoice.URI, data.Passphrase); err != nil {
+			log.Errorf("Error paying proxy invoice %s: %v", invoice.ID, err)
+		} else {
+			log.Infof("Paid proxy invoice %s with %s", invoice.ID, txid)
+		}
+		return
+	}
+	log.Infof("No invoice from %s, paying %s directly: %v", data.HostPeerID, data.DestinationAddress, err)
 	services.NewBtcService().Transaction(data.Passphrase, b, data.DestinationAddress, data.Amount)
 
 	// Log the incoming request method and URL
@@ -617,7 +688,6 @@ func handleConnectMethod(w http.ResponseWriter, r *http.Request) {
 	// 	}
 
 	// 	// Now you can access the values
-	// 	log.Printf("Passphrase: %s", data.Passphrase)
 	// 	log.Printf("Transaction ID: %s", data.TransactionID)
 	// 	log.Printf("Destination Address: %s", data.DestinationAddress)
 	// 	log.Printf("Amount: %s", data.Amount)
@@ -653,7 +723,7 @@ func handleConnectMethod(w http.ResponseWriter, r *http.Request) {
 
 func handleGetProxyHistory(w http.ResponseWriter, r *http.Request) {
 	// Debug: Log the incoming request method
-	fmt.Println("Received request method:", r.Method)
+	log.Debug("Received request method:", r.Method)
 
 	// Ensure the method is GET
 	if r.Method != http.MethodGet {
@@ -662,54 +732,54 @@ func handleGetProxyHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Debug: Log checking for the proxy history file
-	fmt.Println("Checking if proxy history file exists:", proxyHistoryFilePath)
+	log.Debug("Checking if proxy history file exists:", proxyHistoryFilePath)
 
 	// Check if the proxyHistory file exists
 	if _, err := os.Stat(proxyHistoryFilePath); os.IsNotExist(err) {
 		http.Error(w, "Proxy history file not found", http.StatusNotFound)
 		// Debug: Log when the file is not found
-		fmt.Println("Proxy history file not found:", proxyHistoryFilePath)
+		log.Info("Proxy history file not found:", proxyHistoryFilePath)
 		return
 	}
 
 	// Debug: Log that we are about to read the proxy history file
-	fmt.Println("Reading proxy history file:", proxyHistoryFilePath)
+	log.Debug("Reading proxy history file:", proxyHistoryFilePath)
 
 	// Read the proxyHistory file
 	data, err := os.ReadFile(proxyHistoryFilePath)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error reading proxy history file: %v", err), http.StatusInternalServerError)
 		// Debug: Log the error encountered while reading the file
-		fmt.Println("Error reading proxy history file:", err)
+		log.Error("Error reading proxy history file:", err)
 		return
 	}
 
 	// Debug: Log the size of the data read from the file
-	fmt.Println("Data read from proxy history file, length:", len(data))
+	log.Info("Data read from proxy history file, length:", len(data))
 
 	// Unmarshal the data into a slice of ProxyHistoryEntry
 	var proxyHistory []models.ProxyHistoryEntry
 	if err := json.Unmarshal(data, &proxyHistory); err != nil {
 		http.Error(w, fmt.Sprintf("Error unmarshalling proxy history: %v", err), http.StatusInternalServerError)
 		// Debug: Log the error encountered while unmarshalling
-		fmt.Println("Error unmarshalling proxy history:", err)
+		log.Error("Error unmarshalling proxy history:", err)
 		return
 	}
 
 	// Debug: Log the number of history entries retrieved
-	fmt.Printf("Successfully unmarshalled proxy history, number of entries: %d\n", len(proxyHistory))
+	log.Infof("Successfully unmarshalled proxy history, number of entries: %d", len(proxyHistory))
 
 	// Set the response header to application/json
 	w.Header().Set("Content-Type", "application/json")
 
 	// Debug: Log before sending the response
-	fmt.Println("Sending proxy history as JSON response")
+	log.Info("Sending proxy history as JSON response")
 
 	// Return the proxy history as a JSON response
 	if err := json.NewEncoder(w).Encode(proxyHistory); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding proxy history to JSON: %v", err), http.StatusInternalServerError)
 		// Debug: Log the error encountered while encoding
-		fmt.Println("Error encoding proxy history to JSON:", err)
+		log.Error("Error encoding proxy history to JSON:", err)
 	}
 }
 
@@ -748,7 +818,7 @@ func saveProxyToDHT(proxy models.Proxy) error {
 	key := "/orcanet/proxy/" + proxy.PeerID
 
 	// Check if the proxy already exists
-	existingValue, err := dht_kad.DHT.GetValue(ctx, key)
+	existingValue, err := dht_kad.GetValue(ctx, key)
 	if err == nil {
 		// Proxy exists, update it
 		var existingProxy models.Proxy
@@ -762,7 +832,7 @@ func saveProxyToDHT(proxy models.Proxy) error {
 			existingProxy.Name = proxy.Name
 			existingProxy.Location = proxy.Location
 			existingProxy.Address, _ = getPrivateIP()
-			fmt.Println("PRXOYS PRIVATE IP:", existingProxy.Address)
+			log.Debug("PRXOYS PRIVATE IP:", existingProxy.Address)
 			existingProxy.Price = proxy.Price
 			existingProxy.Statistics = proxy.Statistics
 			existingProxy.Bandwidth = proxy.Bandwidth
@@ -775,32 +845,32 @@ func saveProxyToDHT(proxy models.Proxy) error {
 				return fmt.Errorf("failed to serialize updated proxy data: %v", err)
 			}
 
-			err = dht_kad.DHT.PutValue(ctx, key, updatedProxyJSON)
+			err = dht_kad.PutValue(ctx, key, updatedProxyJSON)
 			if err != nil {
 				return fmt.Errorf("failed to update proxy in DHT: %v", err)
 			}
 
-			fmt.Printf("Proxy updated successfully in DHT for PeerID: %s\n", proxy.PeerID)
+			log.Infof("Proxy updated successfully in DHT for PeerID: %s", proxy.PeerID)
 		}
 	} else {
 		// Proxy doesn't exist, add it as a new entry
 		proxy.IsHost = isHost
 		proxy.Address, _ = getPrivateIP()
 		proxy.WalletAddressToSend, _ = services.NewBtcService().GetMiningAddressFromTempMayukh()
-		fmt.Println("Proxy wallet address", proxy.WalletAddressToSend)
+		log.Debug("Proxy wallet address", proxy.WalletAddressToSend)
 
-		fmt.Println("PRXOYS PRIVATE IP:", proxy.Address)
+		log.Debug("PRXOYS PRIVATE IP:", proxy.Address)
 		proxyJSON, err := json.Marshal(proxy)
 		if err != nil {
 			return fmt.Errorf("failed to serialize new proxy data: %v", err)
 		}
 
-		err = dht_kad.DHT.PutValue(ctx, key, proxyJSON)
+		err = dht_kad.PutValue(ctx, key, proxyJSON)
 		if err != nil {
 			return fmt.Errorf("failed to store new proxy in DHT: %v", err)
 		}
 
-		fmt.Printf("New proxy added successfully to DHT for PeerID: %s\n", proxy.PeerID)
+		log.Infof("New proxy added successfully to DHT for PeerID: %s", proxy.PeerID)
 	}
 	return nil
 }
@@ -841,7 +911,7 @@ func httpHostToClient(node host.Host) {
 	tar := func(cancel context.CancelFunc) {
 		for {
 			if !hosting {
-				fmt.Println("Stopping Proxy")
+				log.Info("Stopping Proxy")
 				cancel()
 				break
 			}
@@ -852,7 +922,7 @@ func httpHostToClient(node host.Host) {
 	go tar(contextCancel)
 	// Try running with `python`
 	if err := runCommand(globalCtxC, "python"); err != nil {
-		fmt.Println("`python` not found or failed, trying `python3`...")
+		log.Error("`python` not found or failed, trying `python3`...")
 		// If `python` fails, try `python3`
 		if err := runCommand(globalCtxC, "python3"); err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to run %s with both `python` and `python3`: %v\n", script, err)
@@ -870,15 +940,15 @@ func clearAllProxies() {
 		emptyProxy := models.Proxy{}
 		emptyProxyJSON, err := json.Marshal(emptyProxy)
 		if err != nil {
-			log.Printf("Failed to marshal empty proxy: %v", err)
+			log.Errorf("Failed to marshal empty proxy: %v", err)
 			continue
 		}
 
-		err = dht_kad.DHT.PutValue(ctx, key, emptyProxyJSON)
+		err = dht_kad.PutValue(ctx, key, emptyProxyJSON)
 		if err != nil {
-			log.Printf("Failed to clear proxy for key %s: %v", key, err)
+			log.Errorf("Failed to clear proxy for key %s: %v", key, err)
 		} else {
-			log.Printf("Proxy for key %s cleared", key)
+			log.Infof("Proxy for key %s cleared", key)
 		}
 	}
 }
@@ -1,8 +1,7 @@
 package proxyService
 
 import (
-	"fmt"
-	"log"
+	"application-layer/metrics"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -10,44 +9,45 @@ import (
 
 func InitProxyRoutes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(metrics.Middleware)
 	r.HandleFunc("/proxy-data/", handleProxyData).Methods("GET")
 	r.HandleFunc("/proxy-data/", handleProxyData).Methods("POST")
 
 	r.HandleFunc("/disconnect-from-proxy/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("\n\n\nRecieved request for /disconnect-proxy/")
+		log.Info("Recieved request for /disconnect-proxy/")
 		handleDisconnectFromProxy(w, r)
 	}).Methods("GET")
 	r.HandleFunc("/disconnect-from-proxy/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("\n\n\nRecieved request for /disconnect-proxy/")
+		log.Info("Recieved request for /disconnect-proxy/")
 		handleDisconnectFromProxy(w, r)
 	}).Methods("POST")
 
 	r.HandleFunc("/stop-hosting/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("\n\n\nRecieved request for /disconnect-proxy/")
+		log.Info("Recieved request for /disconnect-proxy/")
 		stopHosting(w, r)
 	}).Methods("GET")
 	r.HandleFunc("/stop-hosting/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("\n\n\nRecieved request for /disconnect-proxy/")
+		log.Info("Recieved request for /disconnect-proxy/")
 		stopHosting(w, r)
 	}).Methods("POST")
 
 	//Fetchiing history
 	r.HandleFunc("/proxy-history/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Received request for /proxy-history/")
+		log.Info("Received request for /proxy-history/")
 		handleGetProxyHistory(w, r)
 	}).Methods("POST", "GET")
 
 	r.HandleFunc("/connect-proxy/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Received request for /connect-proxy/")
+		log.Info("Received request for /connect-proxy/")
 		handleConnectMethod(w, r)
 	}).Methods("POST")
 	r.HandleFunc("/connect-proxy/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Received request for /connect-proxy/")
+		log.Info("Received request for /connect-proxy/")
 		handleConnectMethod(w, r)
 	}).Methods("GET")
 
 	r.HandleFunc("/check-balance/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Check balance")
+		log.Info("Check balance")
 		handleCheckBalance(w, r)
 	}).Methods("POST", "GET")
 	return r
@@ -2,9 +2,11 @@
 package main
 
 import (
+	"application-layer/contacts"
 	dht_kad "application-layer/dht"
+	"application-layer/logging"
+	"application-layer/metrics"
 	proxyService "application-layer/proxy"
-	"fmt"
 	"log"
 	"net/http"
 
@@ -12,7 +14,16 @@ import (
 )
 
 func main() {
-	fmt.Println("Main server started")
+	if err := logging.Init("proxy"); err != nil {
+		log.Fatal(err)
+	}
+	defer logging.Close()
+	mainLog := logging.Subsystem("MAIN")
+
+	mainLog.Info("Main server started")
+	if err := contacts.LoadAddressBook(); err != nil {
+		mainLog.Errorf("Failed to load address book, showing peers unlabeled: %v", err)
+	}
 
 	// Initialize additional routers
 	proxyRouter := proxyService.InitProxyRoutes()
@@ -32,9 +43,11 @@ func main() {
 	http.Handle("/proxy-history/", c.Handler(proxyRouter))
 	http.Handle("/disconnect-from-proxy/", c.Handler(proxyRouter))
 	http.Handle("/stop-hosting/", c.Handler(proxyRouter))
+	http.Handle("/metrics", metrics.Handler()) // streams, dht and proxy sessions for prometheus
+	http.Handle("/admin/loglevel", logging.Handler())
 
 	port := ":8082"
 
-	fmt.Printf("Starting server for files and proxy on port %s...\n", port)
+	mainLog.Infof("Starting server for files and proxy on port %s...", port)
 	log.Fatal(http.ListenAndServe(port, nil))
 }
@@ -4,7 +4,6 @@ package routes
 import (
 	"application-layer/controllers"
 
-	"fmt"
 	"github.com/gorilla/mux"
 )
 
@@ -12,13 +11,22 @@ func RegisterBtcRoutes(router *mux.Router, controller *controllers.BtcController
 	btcRouter := router.PathPrefix("/api/btc").Subrouter()
 
 	// Debug log
-	fmt.Println("Registering BTC routes...")
+	log.Info("Registering BTC routes...")
 
 	btcRouter.HandleFunc("/login", controller.LoginHandler).Methods("POST")
 	btcRouter.HandleFunc("/transaction", controller.TransactionHandler).Methods("POST")
 	btcRouter.HandleFunc("/newaddress", controller.GetNewAddressHandler).Methods("POST")
 	btcRouter.HandleFunc("/startmining", controller.StartMiningHandler).Methods("POST")
 	btcRouter.HandleFunc("/stopmining", controller.StopMiningHandler).Methods("POST")
+	btcRouter.HandleFunc("/miningsettings", controller.UpdateMiningSettingsHandler).Methods("PUT")
+	btcRouter.HandleFunc("/walletbackup", controller.BackupWalletHandler).Methods("POST")
+	btcRouter.HandleFunc("/walletrestore", controller.RestoreWalletBackupHandler).Methods("POST")
+	btcRouter.HandleFunc("/wallets", controller.CreateNamedWalletHandler).Methods("POST")
+	btcRouter.HandleFunc("/wallets/switch", controller.SwitchWalletHandler).Methods("POST")
+	btcRouter.HandleFunc("/accounts", controller.CreateAccountHandler).Methods("POST")
+	btcRouter.HandleFunc("/accounts/select", controller.SelectAccountHandler).Methods("POST")
+	btcRouter.HandleFunc("/invoices", controller.CreateInvoiceHandler).Methods("POST")
+	btcRouter.HandleFunc("/payuri", controller.PayURIHandler).Methods("POST")
 
 	btcRouter.HandleFunc("/init", controller.InitHandler).Methods("GET")
 	btcRouter.HandleFunc("/balance", controller.GetBalanceHandler).Methods("GET")
@@ -29,5 +37,14 @@ func RegisterBtcRoutes(router *mux.Router, controller *controllers.BtcController
 	btcRouter.HandleFunc("/getminingstatus", controller.GetMiningStatusHandler).Methods("GET")
 	btcRouter.HandleFunc("/currentaddress", controller.GetCurrentAddressHandler).Methods("GET")
 	btcRouter.HandleFunc("/miningdashboard", controller.GetMiningDashboardHandler).Methods("GET")
+	btcRouter.HandleFunc("/mininginfo", controller.GetMiningInfoHandler).Methods("GET")
+	btcRouter.HandleFunc("/mininghistory", controller.GetMiningHistoryHandler).Methods("GET")
+	btcRouter.HandleFunc("/processes", controller.GetProcessStatusHandler).Methods("GET")
+	btcRouter.HandleFunc("/miningsettings", controller.GetMiningSettingsHandler).Methods("GET")
+	btcRouter.HandleFunc("/walletbackups", controller.ListWalletBackupsHandler).Methods("GET")
+	btcRouter.HandleFunc("/wallets", controller.ListWalletsHandler).Methods("GET")
+	btcRouter.HandleFunc("/accounts", controller.ListAccountsHandler).Methods("GET")
+	btcRouter.HandleFunc("/invoices", controller.ListInvoicesHandler).Methods("GET")
+	btcRouter.HandleFunc("/invoice", controller.GetInvoiceHandler).Methods("GET")
 
 }
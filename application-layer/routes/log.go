@@ -0,0 +1,5 @@
+package routes
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("CTRL")
@@ -3,12 +3,17 @@ package routes
 
 import (
 	"application-layer/controllers"
+	"application-layer/logging"
+	"application-layer/metrics"
 
 	"github.com/gorilla/mux"
 )
 
 // RegisterRoutes는 모든 주요 라우트를 등록합니다.
 func RegisterRoutes(router *mux.Router, btcController *controllers.BtcController) {
+	router.Use(metrics.Middleware)
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	router.Handle("/admin/loglevel", logging.Handler()).Methods("GET", "PUT", "POST")
 	RegisterBtcRoutes(router, btcController)  // /api/btc 라우트 등록
 	RegisterAuthRoutes(router, btcController) // /api/auth 라우트 등록
 
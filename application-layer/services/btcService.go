@@ -1,6 +1,7 @@
 package services
 
 import (
+	"application-layer/models"
 	"application-layer/utils"
 	"bytes"
 	"encoding/json"
@@ -10,7 +11,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -53,7 +53,7 @@ func CheckDirectoryContents(parentDir string) string {
 	// parentDir := "../../btcd"
 	_, err := utils.CheckDirectoryContents(parentDir)
 	if err != nil {
-		fmt.Printf("Error checking directory: %v\n", err)
+		log.Errorf("Error checking directory: %v", err)
 		return "Failed to check directory"
 	}
 	return "successed to check directory"
@@ -86,15 +86,15 @@ func SetupTempFilePath() {
 	} else {
 		tempFilePath = "/tmp/btcd_temp.json"
 	}
-	fmt.Printf("Temporary file path set to: %s\n", tempFilePath)
+	log.Infof("Temporary file path set to: %s", tempFilePath)
 
 	// Check if the file exists, and initialize it if it doesn't
 	if _, err := os.Stat(tempFilePath); os.IsNotExist(err) {
-		fmt.Println("Temp file not found. Initializing...")
+		log.Info("Temp file not found. Initializing...")
 		if err := initializeTempFile(); err != nil {
-			fmt.Printf("Failed to initialize temp file: %v\n", err)
+			log.Errorf("Failed to initialize temp file: %v", err)
 		} else {
-			fmt.Println("Temp file initialized successfully.")
+			log.Info("Temp file initialized successfully.")
 		}
 	}
 }
@@ -163,41 +163,6 @@ func updateTempFile(key, value string) error {
 	return nil
 }
 
-// isProcessRunning is a helper function to check if a process is running
-func isProcessRunning(processName string) bool {
-	var cmd *exec.Cmd
-
-	if runtime.GOOS == "windows" {
-		// Windows: Use PowerShell to check processes
-		cmd = exec.Command("powershell", "-Command", fmt.Sprintf("Get-Process | Where-Object {$_.Name -eq '%s'}", processName))
-	} else if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
-		// macOS/Linux: Use pgrep to check processes
-		cmd = exec.Command("pgrep", "-f", processName) // Use -f to match full command
-	} else {
-		fmt.Printf("Unsupported OS: %s\n", runtime.GOOS)
-		return false
-	}
-
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-
-	err := cmd.Run()
-	if err != nil {
-		// Log error for debugging
-		fmt.Printf("Error checking process: %v\n", err)
-		if output.String() == "" {
-			return false
-		}
-	}
-
-	// Log output for debugging
-	// fmt.Printf("isProcessRunning output: %s\n", output.String())
-
-	// Return true if output is not empty
-	return strings.TrimSpace(output.String()) != ""
-}
-
 func (bs *BtcService) getMiningAddressMay() string {
 	content, err := ioutil.ReadFile(tempFilePath)
 	if err != nil {
@@ -270,171 +235,87 @@ func getMiningAddressFromTemp() (string, error) {
 // if an argument is provided, btcd is started with the mining address
 // if more than one argument is provided, an error is returned
 // cannot start another instance of btcd if it is already running
-func (bs *BtcService) StartBtcd(walletAddress ...string) string {
-	// Check if btcd is already running
-	if isProcessRunning("btcd") {
-		fmt.Println("btcd is already running. Cannot start another instance.")
-		return "btcd is already running"
-	}
-
-	var cmd *exec.Cmd
-
-	// no argument provided
-	if len(walletAddress) == 0 {
-		cmd = exec.Command(
-			btcdPath,
-			"--rpcuser=user",
-			"--rpcpass=password",
-			"--notls",
-		)
-	} else if len(walletAddress) == 1 {
-		// one argument provided
-		cmd = exec.Command(
-			btcdPath,
-			"--rpcuser=user",
-			"--rpcpass=password",
-			"--notls",
-			fmt.Sprintf("--miningaddr=%s", walletAddress[0]),
-		)
-	} else {
+// returns once btcd answers rpc, the supervisor restarts it if it crashes later
+func (bs *BtcService) StartBtcd(walletAddress ...string) (models.ProcessStatus, error) {
+	if len(walletAddress) > 1 {
 		// more than one argument provided
-		fmt.Println("Invalid number of arguments. Only 0 or 1 argument is allowed.")
-		return "Invalid number of arguments"
+		log.Warn("Invalid number of arguments. Only 0 or 1 argument is allowed.")
+		return btcdProcess.Status(), fmt.Errorf("invalid number of arguments, only 0 or 1 wallet address is allowed")
 	}
 
-	// Detached mode with OS-specific handling
-	if runtime.GOOS == "windows" {
-		cmd.SysProcAttr = &syscall.SysProcAttr{}
-	} else if runtime.GOOS == "darwin" {
-		// macOS specific adjustments
-		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
+	args := []string{
+		"--rpcuser=user",
+		"--rpcpass=password",
+		"--notls",
 	}
-
-	// Standard output and error
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Start btcd process
-	if err := cmd.Start(); err != nil {
-		fmt.Printf("Error starting btcd: %v\n", err)
-		return "Error starting btcd"
+	if len(walletAddress) == 1 {
+		args = append(args, fmt.Sprintf("--miningaddr=%s", walletAddress[0]))
 	}
 
-	fmt.Printf("btcd started with PID: %d\n", cmd.Process.Pid)
-
-	// Check if btcd process is running
-	if !isProcessRunning("btcd") {
-		fmt.Println("btcd process not found after starting.")
-		return "btcd process not found"
+	status, err := btcdProcess.start(args)
+	if err != nil {
+		log.Errorf("Error starting btcd: %v", err)
+		return status, err
 	}
-
-	fmt.Println("btcd is running")
+	log.Info("btcd is running")
 
 	// Update temp file with mining address
 	if len(walletAddress) == 0 {
 		// clear mining address from temp file
 		if err := deleteFromTempFile("miningaddr"); err != nil {
-			fmt.Printf("Failed to delete miningaddr from temp file: %v\n", err)
-			return "btcd started but failed to clear mining address from temp file"
+			log.Errorf("Failed to delete miningaddr from temp file: %v", err)
+			return status, fmt.Errorf("btcd started but failed to clear mining address from temp file: %w", err)
 		}
-		fmt.Println("Mining address cleared from temporary file.")
-	} else if len(walletAddress) == 1 {
+		log.Info("Mining address cleared from temporary file.")
+	} else {
 		// update temp file with mining address
 		if err := updateTempFile("miningaddr", walletAddress[0]); err != nil {
-			fmt.Printf("Failed to update temp file: %v\n", err)
-			return "btcd started but failed to update temp file"
+			log.Errorf("Failed to update temp file: %v", err)
+			return status, fmt.Errorf("btcd started but failed to update temp file: %w", err)
 		}
-		fmt.Println("Temporary file updated successfully.")
+		log.Info("Temporary file updated successfully.")
 	}
 
-	return "btcd started successfully"
+	return status, nil
 }
 
-// StopBtcd stops the btcd process.
+// StopBtcd stops the btcd process we started, one started outside of the app is left alone.
 // go test -v -run ^TestStopBtcd$ -count=1 application-layer/services
 // use -count=1 to avoid caching
-func (bs *BtcService) StopBtcd() string {
-	var checkProcessCmd *exec.Cmd
-	var killCmd *exec.Cmd
-
-	if runtime.GOOS == "windows" {
-		// Check if btcd is running
-		checkProcessCmd = exec.Command("powershell", "-Command", "Get-Process | Where-Object {$_.Name -eq 'btcd'}")
-		killCmd = exec.Command("taskkill", "/IM", "btcd.exe", "/F")
-	} else if runtime.GOOS == "darwin" {
-		// macOS implementation
-		checkProcessCmd = exec.Command("pgrep", "btcd")
-		killCmd = exec.Command("pkill", "-f", "btcd") // Use -f for full path match
-	}
-
-	// Check if btcd is running
-	var checkOutput bytes.Buffer
-	checkProcessCmd.Stdout = &checkOutput
-	checkProcessCmd.Stderr = &checkOutput
-
-	fmt.Println("Checking for running btcd process...")
-	err := checkProcessCmd.Run()
-	if err != nil || checkOutput.String() == "" {
-		fmt.Println("btcd is not running. Cannot stop.")
-		return "btcd is not running"
-	}
-
-	// Stop btcd process
-	fmt.Println("Stopping btcd process...")
-	var killOutput bytes.Buffer
-	killCmd.Stdout = &killOutput
-	killCmd.Stderr = &killOutput
-
-	err = killCmd.Run()
-	if err != nil {
-		fmt.Printf("Error stopping btcd: %v\n", err)
-		return fmt.Sprintf("Error stopping btcd: %s", killOutput.String())
-	}
-
-	fmt.Println("btcd stopped successfully")
-	return "btcd stopped successfully"
+func (bs *BtcService) StopBtcd() (models.ProcessStatus, error) {
+	log.Info("Stopping btcd process...")
+	return btcdProcess.stop()
 }
 
+// WalletExists reports whether the active wallet has a wallet.db
 func (bs *BtcService) WalletExists() bool {
-	var walletDBPath string
-
-	// OS별 지갑 경로 설정
-	if runtime.GOOS == "windows" {
-		userProfile := os.Getenv("USERPROFILE")
-		if userProfile == "" {
-			return false
-		}
-		walletDBPath = filepath.Join(userProfile, "AppData", "Local", "Btcwallet", "mainnet", "wallet.db")
-	} else if runtime.GOOS == "darwin" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return false
-		}
-		walletDBPath = filepath.Join(homeDir, "Library", "Application Support", "Btcwallet", "mainnet", "wallet.db")
-	} else {
-		// 지원하지 않는 OS의 경우 false 반환
+	walletDBPath, err := walletDBPath()
+	if err != nil {
 		return false
 	}
 
 	// 지갑 파일 존재 여부 확인
-	_, err := os.Stat(walletDBPath)
+	_, err = os.Stat(walletDBPath)
 	return !os.IsNotExist(err)
 }
 
 // BtcwalletCreate creates a new wallet, replacing any existing wallet database.
-func (bs *BtcService) BtcwalletCreate(passphrase string) error {
-	// Define the path to the wallet database
-	var walletDBPath string
-	if runtime.GOOS == "windows" {
-		walletDBPath = fmt.Sprintf(`%s\AppData\Local\Btcwallet\mainnet\wallet.db`, os.Getenv("USERPROFILE"))
-	} else if runtime.GOOS == "darwin" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get home directory: %v", err)
-		}
-		walletDBPath = filepath.Join(homeDir, "Library", "Application Support", "Btcwallet", "mainnet", "wallet.db")
-	} else {
-		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+// seed is the hex wallet seed to create it from, btcwallet generates one when it is empty
+// birthday is where btcwallet starts looking for the wallet's transactions (see btcwallet --birthday),
+// empty for a new seed and restoredWalletBirthday for one that may already have funds on chain
+func (bs *BtcService) BtcwalletCreate(passphrase, seed, birthday string) error {
+	// Define the path to the wallet database, the active wallet's
+	walletDBPath, err := walletDBPath()
+	if err != nil {
+		return err
+	}
+	var createArgs []string
+	if name := activeWallet(); name != defaultWalletName {
+		appData, _ := walletAppData(name)
+		createArgs = append(createArgs, "--appdata="+appData)
+	}
+	if birthday != "" {
+		createArgs = append(createArgs, "--birthday="+birthday)
 	}
 
 	// Check if the wallet database exists
@@ -456,10 +337,10 @@ func (bs *BtcService) BtcwalletCreate(passphrase string) error {
 			"-WindowStyle", "Hidden",
 			"-File", btcwalletScriptPath,
 		)
-		cmd.Env = append(os.Environ(), "BTCWALLET_PASSPHRASE="+passphrase)
+		cmd.Env = append(os.Environ(), "BTCWALLET_PASSPHRASE="+passphrase, "BTCWALLET_SEED="+seed, "BTCWALLET_ARGS="+quoteArgs(createArgs))
 		cmd.SysProcAttr = &syscall.SysProcAttr{}
 	} else if runtime.GOOS == "darwin" {
-		cmd = exec.Command(btcwalletPath, "--create")
+		cmd = exec.Command(btcwalletPath, append([]string{"--create"}, createArgs...)...)
 
 		// Create a pseudo-terminal
 		ptmx, err := pty.Start(cmd)
@@ -473,8 +354,13 @@ func (bs *BtcService) BtcwalletCreate(passphrase string) error {
 			fmt.Fprintf(ptmx, "%s\n", passphrase) // Enter passphrase
 			fmt.Fprintf(ptmx, "%s\n", passphrase) // Confirm passphrase
 			fmt.Fprintf(ptmx, "no\n")             // No encryption for public data
-			fmt.Fprintf(ptmx, "no\n")             // No existing wallet seed
-			fmt.Fprintf(ptmx, "OK\n")             // Confirm seed saved
+			if seed == "" {
+				fmt.Fprintf(ptmx, "no\n") // No existing wallet seed
+				fmt.Fprintf(ptmx, "OK\n") // Confirm seed saved
+			} else {
+				fmt.Fprintf(ptmx, "yes\n")      // Existing wallet seed
+				fmt.Fprintf(ptmx, "%s\n", seed) // The seed from the seed phrase
+			}
 		}()
 
 		// Capture output for debugging
@@ -489,7 +375,7 @@ func (bs *BtcService) BtcwalletCreate(passphrase string) error {
 			return fmt.Errorf("failed to execute btcwallet: %v\noutput: %s", err, output.String())
 		}
 
-		fmt.Printf("btcwallet output:\n%s\n", output.String())
+		log.Info("btcwallet created the wallet")
 		return nil
 	} else {
 		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
@@ -501,96 +387,39 @@ func (bs *BtcService) BtcwalletCreate(passphrase string) error {
 	cmd.Stderr = &stderr
 
 	// Run the command and capture errors
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		return fmt.Errorf("failed to execute btcwallet: %v\nstdout: %s\nstderr: %s", err, stdout.String(), stderr.String())
 	}
 
-	fmt.Printf("btcwallet output:\n%s\n", stdout.String())
+	log.Info("btcwallet created the wallet")
 	return nil
 }
 
-// StartBtcwallet is a function to start the btcwallet process
-func (bs *BtcService) StartBtcwallet() string {
-	// Check if btcwallet is already running
-	if isProcessRunning("btcwallet") {
-		fmt.Println("btcwallet is already running. Cannot start another instance.")
-		return "btcwallet is already running"
+// quoteArgs joins args for a windows command line, paths under the user profile can have spaces
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = `"` + arg + `"`
 	}
-
-	// btcwallet command
-	cmd := exec.Command(
-		btcwalletPath,
-		"--btcdusername=user",
-		"--btcdpassword=password",
-		"--rpcconnect=127.0.0.1:8334",
-		"--noclienttls",
-		"--noservertls",
-		"--username=user",
-		"--password=password",
-	)
-
-	// Handle environment-specific configurations
-	if runtime.GOOS == "darwin" {
-		// macOS-specific environment adjustments
-		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
-	}
-
-	// Standard output and error
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Start btcwallet process
-	if err := cmd.Start(); err != nil {
-		fmt.Printf("Error starting btcwallet: %v\n", err)
-		return "Error starting btcwallet"
-	}
-
-	fmt.Printf("btcwallet started with PID: %d\n", cmd.Process.Pid)
-
-	// Check if btcwallet process is running
-	if !isProcessRunning("btcwallet") {
-		fmt.Println("btcwallet process not found after starting.")
-		return "btcwallet process not found"
-	}
-
-	fmt.Println("btcwallet is running")
-	return "btcwallet started successfully"
+	return strings.Join(quoted, " ")
 }
 
-// StopBtcwallet is a function to stop the btcwallet process
-func (bs *BtcService) StopBtcwallet() string {
-	// Check if btcwallet is running
-	if !isProcessRunning("btcwallet") {
-		fmt.Println("btcwallet is not running. Cannot stop.")
-		return "btcwallet is not running"
-	}
-
-	var cmd *exec.Cmd
-
-	if runtime.GOOS == "windows" {
-		// Use taskkill on Windows
-		cmd = exec.Command("taskkill", "/IM", "btcwallet.exe", "/F")
-	} else if runtime.GOOS == "darwin" {
-		// Use pkill on macOS
-		cmd = exec.Command("pkill", "-f", "btcwallet")
-	} else {
-		fmt.Printf("Unsupported OS: %s\n", runtime.GOOS)
-		return "Unsupported OS"
-	}
-
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-
-	// Stop btcwallet process
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error stopping btcwallet: %v\n", err)
-		return fmt.Sprintf("Error stopping btcwallet: %s", output.String())
+// StartBtcwallet is a function to start the btcwallet process, it returns once btcwallet answers rpc
+func (bs *BtcService) StartBtcwallet() (models.ProcessStatus, error) {
+	status, err := btcwalletProcess.start(btcwalletArgs())
+	if err != nil {
+		log.Errorf("Error starting btcwallet: %v", err)
+		return status, err
 	}
+	log.Info("btcwallet is running")
+	return status, nil
+}
 
-	fmt.Println("btcwallet stopped successfully")
-	return "btcwallet stopped successfully"
+// StopBtcwallet is a function to stop the btcwallet process we started
+func (bs *BtcService) StopBtcwallet() (models.ProcessStatus, error) {
+	log.Info("Stopping btcwallet process...")
+	return btcwalletProcess.stop()
 }
 
 // SetupMainnetDirectoryForMac ensures that the mainnet directory is properly set up on macOS.
@@ -606,96 +435,89 @@ func SetupMainnetDirectoryForMac() error {
 	mainnetPath := filepath.Join(btcdPath, "data", "mainnet")
 
 	// Remove the mainnet directory if it exists
-	fmt.Printf("Removing mainnet directory: %s\n", mainnetPath)
+	log.Infof("Removing mainnet directory: %s", mainnetPath)
 	err = os.RemoveAll(mainnetPath)
 	if err != nil {
 		return fmt.Errorf("failed to remove mainnet directory: %w", err)
 	}
-	fmt.Println("Mainnet directory removed successfully.")
+	log.Info("Mainnet directory removed successfully.")
 
 	// Recreate the mainnet directory
-	fmt.Printf("Creating mainnet directory: %s\n", mainnetPath)
+	log.Infof("Creating mainnet directory: %s", mainnetPath)
 	err = os.MkdirAll(mainnetPath, 0777)
 	if err != nil {
 		return fmt.Errorf("failed to create mainnet directory: %w", err)
 	}
-	fmt.Println("Mainnet directory created successfully.")
+	log.Info("Mainnet directory created successfully.")
 
 	// Ensure correct permissions for the Btcd directory
-	fmt.Printf("Setting permissions for Btcd directory: %s\n", btcdPath)
+	log.Infof("Setting permissions for Btcd directory: %s", btcdPath)
 	err = os.Chmod(btcdPath, 0777)
 	if err != nil {
 		return fmt.Errorf("failed to set permissions for Btcd directory: %w", err)
 	}
-	fmt.Println("Permissions for Btcd directory set successfully.")
+	log.Info("Permissions for Btcd directory set successfully.")
 
 	return nil
 }
 
 // CreateWallet creates a new wallet by starting btcd, creating the wallet, starting btcwallet, generating a new address, stopping btcd and btcwallet, and returning the new address.
 // CreateWallet creates a new wallet, generates a new address, and ensures proper cleanup of btcd and btcwallet processes.
-func (bs *BtcService) CreateWallet(passphrase string) (string, error) {
-	// Step 1: Start btcd without a wallet address
-	btcdResult := bs.StartBtcd()
-	if btcdResult != "btcd started successfully" {
-		return "", fmt.Errorf("failed to start btcd: %s", btcdResult)
+// The wallet seed comes from a new BIP39 seed phrase, which is returned with the address so the user can write it down.
+func (bs *BtcService) CreateWallet(passphrase string) (string, string, error) {
+	mnemonic, seed, err := newMnemonic()
+	if err != nil {
+		return "", "", err
 	}
-	fmt.Println("btcd started successfully.")
 
-	// Allow btcd to stabilize
-	time.Sleep(2 * time.Second)
+	// Step 1: Start btcd without a wallet address
+	if _, err := bs.StartBtcd(); err != nil {
+		return "", "", fmt.Errorf("failed to start btcd: %w", err)
+	}
+	log.Info("btcd started successfully.")
 
 	// Step 2: Create the wallet if it doesn't already exist
-	err := bs.BtcwalletCreate(passphrase)
+	err = bs.BtcwalletCreate(passphrase, seed, "")
 	if err != nil {
 		bs.StopBtcd() // Ensure btcd is stopped in case of failure
-		return "", fmt.Errorf("%w", err)
+		return "", "", fmt.Errorf("%w", err)
 	}
-	fmt.Println("Wallet created successfully.")
+	log.Info("Wallet created successfully.")
 
 	// Allow time for wallet creation to stabilize
 	time.Sleep(2 * time.Second)
 
 	// Step 3: Start btcwallet
-	btcwalletResult := bs.StartBtcwallet()
-	if btcwalletResult != "btcwallet started successfully" {
+	if _, err := bs.StartBtcwallet(); err != nil {
 		bs.StopBtcd()
-		return "", fmt.Errorf("failed to start btcwallet: %s", btcwalletResult)
+		return "", "", fmt.Errorf("failed to start btcwallet: %w", err)
 	}
-	fmt.Println("btcwallet started successfully.")
-
-	// Allow btcwallet to stabilize
-	time.Sleep(2 * time.Second)
+	log.Info("btcwallet started successfully.")
 
 	// Step 4: Generate a new address
 	newAddress, err := bs.GetNewAddress()
 	if err != nil {
 		bs.StopBtcd()
 		bs.StopBtcwallet()
-		return "", fmt.Errorf("failed to generate new address: %w", err)
+		return "", "", fmt.Errorf("failed to generate new address: %w", err)
 	}
-	fmt.Printf("New address generated: %s\n", newAddress)
+	log.Infof("New address generated: %s", newAddress)
 
 	// Step 5: Stop btcwallet
-	btcwalletStopResult := bs.StopBtcwallet()
-	if btcwalletStopResult != "btcwallet stopped successfully" {
+	if _, err := bs.StopBtcwallet(); err != nil {
 		bs.StopBtcd()
-		return "", fmt.Errorf("failed to stop btcwallet: %s", btcwalletStopResult)
+		return "", "", fmt.Errorf("failed to stop btcwallet: %w", err)
 	}
-	fmt.Println("btcwallet stopped successfully.")
-
-	// Allow time before stopping btcd
-	time.Sleep(1 * time.Second)
+	log.Info("btcwallet stopped successfully.")
 
 	// Step 6: Stop btcd
-	btcdStopResult := bs.StopBtcd()
-	if btcdStopResult != "btcd stopped successfully" {
-		return "", fmt.Errorf("failed to stop btcd: %s", btcdStopResult)
+	if _, err := bs.StopBtcd(); err != nil {
+		return "", "", fmt.Errorf("failed to stop btcd: %w", err)
 	}
-	fmt.Println("btcd stopped successfully.")
+	log.Info("btcd stopped successfully.")
 
-	// Step 7: Return the new address
-	return newAddress, nil
+	// Step 7: Return the new address and the seed phrase
+	return newAddress, mnemonic, nil
 }
 
 // Function to remove platform-specific file attributes
@@ -750,15 +572,15 @@ func forceRemoveAll(path string) error {
 // Function to check if a directory is being used by a process (simple example)
 func isDirectoryInUse(path string) bool {
 	// Check if related processes are running
-	if isProcessRunning("btcd") || isProcessRunning("btcwallet") {
-		fmt.Printf("Processes using the directory might be running. Checking for usage of %s\n", path)
+	if btcdProcess.Running() || btcwalletProcess.Running() {
+		log.Infof("Processes using the directory might be running. Checking for usage of %s", path)
 		return true
 	}
 
 	// Optionally, attempt to open the directory to verify usage
 	file, err := os.Open(path)
 	if err != nil {
-		fmt.Printf("Failed to open directory %s: %v\n", path, err)
+		log.Errorf("Failed to open directory %s: %v", path, err)
 		return true // Assume the directory is in use if it cannot be opened
 	}
 	defer file.Close()
@@ -789,19 +611,19 @@ func (bs *BtcService) Init() string {
 
 	// Step 0: Ensure mainnet directory is set up based on OS
 	if runtime.GOOS == "darwin" {
-		fmt.Println("Initializing mainnet directory for macOS...")
+		log.Info("Initializing mainnet directory for macOS...")
 		err := SetupMainnetDirectoryForMac()
 		if err != nil {
-			fmt.Printf("Failed to set up mainnet directory: %v\n", err)
+			log.Errorf("Failed to set up mainnet directory: %v", err)
 			return "Failed to set up mainnet directory"
 		}
 	} else {
 		mainnetPath := getMainnetPath()
-		fmt.Printf("Attempting to remove path: %s\n", mainnetPath)
+		log.Infof("Attempting to remove path: %s", mainnetPath)
 
 		// First, try to terminate processes using the directory
 		if isDirectoryInUse(mainnetPath) {
-			fmt.Println("Directory is in use. Attempting to stop related services...")
+			log.Info("Directory is in use. Attempting to stop related services...")
 			bs.StopBtcd()
 			bs.StopBtcwallet()
 			time.Sleep(2 * time.Second) // Wait for processes to terminate
@@ -810,39 +632,37 @@ func (bs *BtcService) Init() string {
 		// Attempt forced deletion
 		err := forceRemoveAll(mainnetPath)
 		if err != nil {
-			fmt.Printf("Failed to remove mainnet directory: %v\n", err)
+			log.Errorf("Failed to remove mainnet directory: %v", err)
 			return "Failed to remove mainnet directory"
 		}
-		fmt.Println("Mainnet directory removed successfully.")
+		log.Info("Mainnet directory removed successfully.")
 	}
 
 	// Step 1: Initialize temporary file
 	err := initializeTempFile()
 	if err != nil {
-		fmt.Printf("Failed to initialize temp file: %v\n", err)
+		log.Errorf("Failed to initialize temp file: %v", err)
 		return "Failed to initialize temp file"
 	}
-	fmt.Println("Temporary file initialized successfully.")
+	log.Info("Temporary file initialized successfully.")
 
 	// Step 2: Start btcd
-	btcdResult := bs.StartBtcd()
-	if btcdResult != "btcd started successfully" {
+	if _, err := bs.StartBtcd(); err != nil {
 		bs.StopBtcd()
 		bs.StopBtcwallet()
-		fmt.Println("Failed to start btcd.")
-		return btcdResult
+		log.Error("Failed to start btcd.")
+		return fmt.Sprintf("Failed to start btcd: %v", err)
 	}
-	fmt.Println("btcd started successfully.")
+	log.Info("btcd started successfully.")
 
 	// Step 3: Start btcwallet
-	btcwalletResult := bs.StartBtcwallet()
-	if btcwalletResult != "btcwallet started successfully" {
+	if _, err := bs.StartBtcwallet(); err != nil {
 		bs.StopBtcd()
 		bs.StopBtcwallet()
-		fmt.Println("Failed to start btcwallet.")
-		return btcwalletResult
+		log.Error("Failed to start btcwallet.")
+		return fmt.Sprintf("Failed to start btcwallet: %v", err)
 	}
-	fmt.Println("btcwallet started successfully.")
+	log.Info("btcwallet started successfully.")
 
 	// Step 4: Connect to TA server
 	cmd := exec.Command(
@@ -865,46 +685,44 @@ func (bs *BtcService) Init() string {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error connecting to TA server: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error connecting to TA server: %v", err)
 		bs.StopBtcd()
 		bs.StopBtcwallet()
 		return fmt.Sprintf("Error connecting to TA server: %s", output.String())
 	}
-	fmt.Println("Connected to TA server successfully.")
+	log.Info("Connected to TA server successfully.")
 
 	// Stop btcwallet if running
-	if isProcessRunning("btcwallet") {
-		stopBtcwalletResult := bs.StopBtcwallet()
-		if stopBtcwalletResult != "btcwallet stopped successfully" {
-			fmt.Println("Failed to stop btcwallet.")
-			return stopBtcwalletResult
+	if btcwalletProcess.Running() {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			log.Error("Failed to stop btcwallet.")
+			return fmt.Sprintf("Failed to stop btcwallet: %v", err)
 		}
-		fmt.Println("btcwallet stopped successfully.")
+		log.Info("btcwallet stopped successfully.")
 	}
 
 	// Stop btcd if running
-	if isProcessRunning("btcd") {
-		stopBtcdResult := bs.StopBtcd()
-		if stopBtcdResult != "btcd stopped successfully" {
-			fmt.Println("Failed to stop btcd.")
-			return stopBtcdResult
+	if btcdProcess.Running() {
+		if _, err := bs.StopBtcd(); err != nil {
+			log.Error("Failed to stop btcd.")
+			return fmt.Sprintf("Failed to stop btcd: %v", err)
 		}
-		fmt.Println("btcd stopped successfully.")
+		log.Info("btcd stopped successfully.")
 	}
 
-	fmt.Println("Initialization and cleanup completed successfully.")
+	log.Info("Initialization and cleanup completed successfully.")
 	return "Initialization and cleanup completed successfully"
 }
 
 // UnlockWallet is a function to unlock the wallet
 func (bs *BtcService) UnlockWallet(passphrase string) (string, error) {
 	// check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return "", fmt.Errorf("btcd is not running. Please start btcd before unlocking the wallet")
 	}
 
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return "", fmt.Errorf("btcwallet is not running. Please start btcwallet before unlocking the wallet")
 	}
 
@@ -930,24 +748,24 @@ func (bs *BtcService) UnlockWallet(passphrase string) (string, error) {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error unlocking wallet: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error unlocking wallet: %v", err)
 		return "", fmt.Errorf("error unlocking wallet: %w", err)
 	}
 
 	// result := strings.TrimSpace(output.String())
-	fmt.Println("Wallet unlocked successfully.")
+	log.Info("Wallet unlocked successfully.")
 	return "Wallet unlocked successfully", nil
 }
 
 // LockWallet is a function to lock the wallet
 func (bs *BtcService) LockWallet() (string, error) {
 	// check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return "", fmt.Errorf("btcd is not running. Please start btcd before locking the wallet")
 	}
 
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return "", fmt.Errorf("btcwallet is not running. Please start btcwallet before locking the wallet")
 	}
 
@@ -966,23 +784,23 @@ func (bs *BtcService) LockWallet() (string, error) {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error locking wallet: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error locking wallet: %v", err)
 		return "", fmt.Errorf("error locking wallet: %w", err)
 	}
 
 	result := strings.TrimSpace(output.String())
-	fmt.Println("Wallet locked successfully.")
+	log.Info("Wallet locked successfully.")
 	return result, nil
 }
 
-// GetNewAddress generates a new Bitcoin address from the wallet.
+// GetNewAddress generates a new Bitcoin address from the selected account of the active wallet.
 func (bs *BtcService) GetNewAddress() (string, error) {
 	// Check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return "", fmt.Errorf("btcd is not running. Please start btcd before calling this function")
 	}
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return "", fmt.Errorf("btcwallet is not running. Please start btcwallet before calling this function")
 	}
 
@@ -994,6 +812,7 @@ func (bs *BtcService) GetNewAddress() (string, error) {
 		"--rpcserver=127.0.0.1:8332",
 		"--notls",
 		"getnewaddress",
+		activeAccount(),
 	)
 
 	// Add macOS-specific PATH configuration
@@ -1007,14 +826,14 @@ func (bs *BtcService) GetNewAddress() (string, error) {
 	cmd.Stderr = &output
 
 	// Run the command
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error generating new address: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error generating new address: %v", err)
 		return "", fmt.Errorf("error generating new address: %w", err)
 	}
 
 	// Parse the result
 	newAddress := strings.TrimSpace(output.String())
-	fmt.Printf("Generated new address: %s\n", newAddress)
+	log.Infof("Generated new address: %s", newAddress)
 
 	return newAddress, nil
 }
@@ -1022,11 +841,11 @@ func (bs *BtcService) GetNewAddress() (string, error) {
 // ListReceivedByAddress is a function to list all received addresses
 func (bs *BtcService) ListReceivedByAddress() ([]map[string]interface{}, error) {
 	// Check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return nil, fmt.Errorf("btcd is not running. Please start btcd before listing addresses")
 	}
 
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return nil, fmt.Errorf("btcwallet is not running. Please start btcwallet before listing addresses")
 	}
 
@@ -1052,20 +871,20 @@ func (bs *BtcService) ListReceivedByAddress() ([]map[string]interface{}, error)
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error listing received addresses: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error listing received addresses: %v", err)
 		return nil, fmt.Errorf("error listing received addresses: %w", err)
 	}
 
 	// Parse the output as JSON
 	var addresses []map[string]interface{}
 	if err := json.Unmarshal(output.Bytes(), &addresses); err != nil {
-		fmt.Printf("Error parsing address list: %v\n", err)
+		log.Errorf("Error parsing address list: %v", err)
 		return nil, fmt.Errorf("error parsing address list: %w", err)
 	}
 
 	// Log full result for debugging
-	fmt.Printf("ㅇㅇFull list of received addresses: %v\n", addresses)
+	log.Infof("ㅇㅇFull list of received addresses: %v", addresses)
 
 	// Return full result
 	return addresses, nil
@@ -1093,190 +912,71 @@ func (bs *BtcService) GetMiningInfo() (string, error) {
 	cmd.Stderr = &output
 
 	// execute command
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error executing btcctl getmininginfo: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error executing btcctl getmininginfo: %v", err)
 		return "", fmt.Errorf("error executing btcctl getmininginfo: %w", err)
 	}
 
 	// get result
 	result := output.String()
-	fmt.Printf("getmininginfo output: %s\n", result)
+	log.Infof("getmininginfo output: %s", result)
 
 	return result, nil
 }
 
-// getMiningStatus is a function to check the mining status
-func (bs *BtcService) GetMiningStatus() (bool, error) {
-	// btcctl command
-	cmd := exec.Command(
-		btcctlPath,
-		"--rpcuser=user",
-		"--rpcpass=password",
-		"--rpcserver=127.0.0.1:8332",
-		"--notls",
-		"getgenerate",
-	)
-
-	// Add macOS-specific environment setup
-	if runtime.GOOS == "darwin" {
-		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
-	}
-
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-
-	// execute command
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error executing btcctl getgenerate: %v\n", err)
-		return false, fmt.Errorf("error executing btcctl getgenerate: %w", err)
-	}
-
-	// get result
-	result := output.String()
-	fmt.Printf("getgenerate output: %s\n", result)
-
-	// check if mining is active
-	if result == "true\n" {
-		return true, nil
-	}
-	return false, nil
-}
-
-// StartMining is a function to start mining
-func (bs *BtcService) StartMining(numBlock int) string {
-	// check if mining is already running
-	isMining, err := bs.GetMiningStatus()
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-		return "Error checking mining status"
+// Login starts btcd mining to walletAddress and btcwallet on the named wallet, the active one when no name is given
+func (bs *BtcService) Login(walletAddress, passphrase, walletName string) (result string, err error) {
+	name := walletName
+	if name == "" {
+		name = activeWallet()
 	}
-
-	if isMining {
-		fmt.Println("Mining is already running.")
-		return "mining is running"
+	if err := checkWalletName(name); err != nil {
+		return "Invalid wallet name", err
 	}
 
-	// start mining
-	cmd := exec.Command(
-		btcctlPath,
-		"--wallet",
-		"--rpcuser=user",
-		"--rpcpass=password",
-		"--rpcserver=127.0.0.1:8332",
-		"--notls",
-		"generate",
-		strconv.Itoa(numBlock),
-	)
-
-	// Add macOS-specific environment setup
-	if runtime.GOOS == "darwin" {
-		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
-	}
-
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-
-	// execute command
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error starting mining: %v\n", err)
-		return fmt.Sprintf("Error starting mining: %s", err.Error())
-	}
-
-	fmt.Printf("Mining started successfully. Output: %s\n", output.String())
-	return "mining started successfully"
-}
-
-// StopMining is a function to stop mining
-func (bs *BtcService) StopMining() string {
-	// check if mining is running
-	isMining, err := bs.GetMiningStatus()
-	if err != nil {
-		fmt.Printf("Failed to check mining status: %v\n", err)
-		return "Error checking mining status"
-	}
-
-	time.Sleep(1000)
-
-	// if mining is not running, no action needed
-	if !isMining {
-		fmt.Println("Mining is not active. No action needed.")
-		return "Mining is not active"
-	}
-
-	// get mining address from temp file
-	miningAddress, err := getMiningAddressFromTemp()
-	if err != nil {
-		fmt.Printf("Failed to retrieve mining address: %v\n", err)
-		return "Failed to retrieve mining address"
-	}
-	fmt.Printf("Retrieved mining address: %s\n", miningAddress)
-
-	time.Sleep(1000)
-
-	// stop btcd and btcwallet
-	stopBtcwalletResult := bs.StopBtcwallet()
-	if stopBtcwalletResult != "btcwallet stopped successfully" {
-		fmt.Printf("Failed to stop btcwallet: %s\n", stopBtcwalletResult)
-		return stopBtcwalletResult
-	}
-
-	time.Sleep(1000)
-
-	stopBtcdResult := bs.StopBtcd()
-	if stopBtcdResult != "btcd stopped successfully" {
-		fmt.Printf("Failed to stop btcd: %s\n", stopBtcdResult)
-		return stopBtcdResult
-	}
-
-	time.Sleep(1000)
-
-	// restart btcd and btcwallet with mining address
-	startBtcdResult := bs.StartBtcd(miningAddress)
-	if startBtcdResult != "btcd started successfully" {
-		fmt.Printf("Failed to restart btcd with mining address: %s\n", startBtcdResult)
-		return startBtcdResult
-	}
-
-	time.Sleep(1000)
-
-	startBtcwalletResult := bs.StartBtcwallet()
-	if startBtcwalletResult != "btcwallet started successfully" {
-		fmt.Printf("Failed to restart btcwallet: %s\n", startBtcwalletResult)
-		return startBtcwalletResult
-	}
-
-	fmt.Println("Mining process stopped and restarted successfully.")
-	return "Mining process stopped and restarted successfully"
-}
-
-func (bs *BtcService) Login(walletAddress, passphrase string) (string, error) {
 	// Step 0: Check if the wallet exists
-	var walletDBPath string
-	if runtime.GOOS == "windows" {
-		walletDBPath = fmt.Sprintf(`%s\AppData\Local\Btcwallet\mainnet\wallet.db`, os.Getenv("USERPROFILE"))
-	} else if runtime.GOOS == "darwin" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Printf("Failed to get home directory: %v\n", err)
-			return "Failed to get home directory", err
-		}
-		walletDBPath = filepath.Join(homeDir, "Library", "Application Support", "Btcwallet", "mainnet", "wallet.db")
-	} else {
-		return "Unsupported OS", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	walletDBPath, err := walletDBPathFor(name)
+	if err != nil {
+		return "Failed to find wallet", err
 	}
 
 	if _, err := os.Stat(walletDBPath); os.IsNotExist(err) {
-		fmt.Printf("Wallet does not exist at path: %s\n", walletDBPath)
+		log.Infof("Wallet does not exist at path: %s", walletDBPath)
 		return "Wallet does not exist", fmt.Errorf("wallet does not exist at path: %s", walletDBPath)
 	}
+	// btcwallet starts on the active wallet, so it is selected now and put back if the login fails
+	var previous string
+	var previousEntry *walletEntry
+	if err := updateWallets(func(registry *walletRegistry) {
+		previous = registry.Active
+		if entry := registry.Wallets[name]; entry != nil {
+			saved := *entry
+			previousEntry = &saved
+		}
+		registry.Active = name
+		registry.entry(name).MiningAddress = walletAddress
+	}); err != nil {
+		return "Failed to select wallet", err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		updateWallets(func(registry *walletRegistry) {
+			registry.Active = previous
+			if previousEntry != nil {
+				registry.Wallets[name] = previousEntry
+			} else {
+				delete(registry.Wallets, name)
+			}
+		})
+	}()
 
 	// Step 0.1: Ensure mainnet directory is set up for macOS
 	if runtime.GOOS == "darwin" {
 		err := SetupMainnetDirectoryForMac()
 		if err != nil {
-			fmt.Printf("Failed to set up mainnet directory: %v\n", err)
+			log.Errorf("Failed to set up mainnet directory: %v", err)
 			return "Failed to set up mainnet directory", fmt.Errorf("failed to set up mainnet directory: %w", err)
 		}
 	}
@@ -1285,56 +985,52 @@ func (bs *BtcService) Login(walletAddress, passphrase string) (string, error) {
 
 	// Get the mainnet path based on the OS
 	mainnetPath := getMainnetPath()
-	fmt.Printf("Attempting to remove path: %s\n", mainnetPath)
+	log.Infof("Attempting to remove path: %s", mainnetPath)
 
 	// First, try to terminate processes using the directory
 	if isDirectoryInUse(mainnetPath) {
-		fmt.Println("Directory is in use. Attempting to stop related services...")
+		log.Info("Directory is in use. Attempting to stop related services...")
 		bs.StopBtcd()
 		bs.StopBtcwallet()
 		time.Sleep(2 * time.Second) // Wait for processes to terminate
 	}
 
 	// Attempt forced deletion
-	err := forceRemoveAll(mainnetPath)
+	err = forceRemoveAll(mainnetPath)
 	if err != nil {
-		fmt.Printf("Failed to remove mainnet directory: %v\n", err)
+		log.Errorf("Failed to remove mainnet directory: %v", err)
 		return "Failed to remove mainnet directory", fmt.Errorf("failed to remove mainnet directory: %w", err)
 	}
-	fmt.Println("Mainnet directory removed successfully.")
+	log.Info("Mainnet directory removed successfully.")
 
 	// Initialize temp file
 	err = initializeTempFile()
 	if err != nil {
-		fmt.Printf("Failed to initialize temp file: %v\n", err)
+		log.Errorf("Failed to initialize temp file: %v", err)
 		return "Failed to initialize temp file", fmt.Errorf("failed to initialize temp file: %w", err)
 	}
-	fmt.Println("Temporary file initialized successfully.")
+	log.Info("Temporary file initialized successfully.")
 
 	// Step 1: Start btcd with wallet address
-	btcdResult := bs.StartBtcd(walletAddress)
-	time.Sleep(2 * time.Second) // Wait for btcd initialization
-	if btcdResult != "btcd started successfully" {
-		fmt.Printf("Failed to start btcd: %s\n", btcdResult)
+	if _, err := bs.StartBtcd(walletAddress); err != nil {
+		log.Errorf("Failed to start btcd: %v", err)
 		bs.StopBtcd()
-		return "Failed to start btcd", fmt.Errorf("failed to start btcd: %s", btcdResult)
+		return "Failed to start btcd", fmt.Errorf("failed to start btcd: %w", err)
 	}
 
 	// Step 2: Start btcwallet
-	btcwalletResult := bs.StartBtcwallet()
-	time.Sleep(2 * time.Second) // Wait for btcwallet initialization
-	if btcwalletResult != "btcwallet started successfully" {
-		fmt.Printf("Failed to start btcwallet: %s\n", btcwalletResult)
+	if _, err := bs.StartBtcwallet(); err != nil {
+		log.Errorf("Failed to start btcwallet: %v", err)
 		bs.StopBtcwallet()
 		bs.StopBtcd()
-		return "Failed to start btcwallet", fmt.Errorf("failed to start btcwallet: %s", btcwalletResult)
+		return "Failed to start btcwallet", fmt.Errorf("failed to start btcwallet: %w", err)
 	}
 
 	// Step 3: Unlock the wallet
 	unlockResult, err := bs.UnlockWallet(passphrase)
 	time.Sleep(2 * time.Second) // Allow sufficient time for wallet unlock
 	if err != nil {
-		fmt.Printf("Failed to unlock wallet: %v\n", err)
+		log.Errorf("Failed to unlock wallet: %v", err)
 		bs.StopBtcwallet()
 		time.Sleep(2 * time.Second) // Wait before stopping btcwallet
 		bs.StopBtcd()
@@ -1362,152 +1058,150 @@ func (bs *BtcService) Login(walletAddress, passphrase string) (string, error) {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error connecting to TA server: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error connecting to TA server: %v", err)
 		bs.StopBtcd()
 		bs.StopBtcwallet()
 		return "Error connecting to TA server", fmt.Errorf("error connecting to TA server: %s", output.String())
 	}
 
-	fmt.Println("Connected to TA server successfully.")
+	log.Info("Connected to TA server successfully.")
 
 	// Step 4: Success
-	fmt.Println("Login successful. Wallet unlocked.")
+	log.Info("Login successful. Wallet unlocked.")
 	return unlockResult, nil
 }
 
 // Logout stops the btcd and btcwallet processes if they are running.
 func (bs *BtcService) Logout() (string, error) {
 	// Step 1: Check and stop btcwallet
-	fmt.Println("Checking if btcwallet is running...")
-	if isProcessRunning("btcwallet") {
-		btcwalletStopResult := bs.StopBtcwallet()
-		if btcwalletStopResult != "btcwallet stopped successfully" {
-			fmt.Printf("Failed to stop btcwallet: %s\n", btcwalletStopResult)
-			return "", fmt.Errorf("failed to stop btcwallet: %s", btcwalletStopResult)
+	log.Info("Checking if btcwallet is running...")
+	if btcwalletProcess.Running() {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			log.Errorf("Failed to stop btcwallet: %v", err)
+			return "", fmt.Errorf("failed to stop btcwallet: %w", err)
 		}
-		fmt.Println("btcwallet stopped successfully.")
+		log.Info("btcwallet stopped successfully.")
 	} else {
-		fmt.Println("btcwallet is not running.")
+		log.Info("btcwallet is not running.")
 	}
 
 	// Step 2: Check and stop btcd
-	fmt.Println("Checking if btcd is running...")
-	if isProcessRunning("btcd") {
-		btcdStopResult := bs.StopBtcd()
-		if btcdStopResult != "btcd stopped successfully" {
-			fmt.Printf("Failed to stop btcd: %s\n", btcdStopResult)
-			return "", fmt.Errorf("failed to stop btcd: %s", btcdStopResult)
+	log.Info("Checking if btcd is running...")
+	if btcdProcess.Running() {
+		if _, err := bs.StopBtcd(); err != nil {
+			log.Errorf("Failed to stop btcd: %v", err)
+			return "", fmt.Errorf("failed to stop btcd: %w", err)
 		}
-		fmt.Println("btcd stopped successfully.")
+		log.Info("btcd stopped successfully.")
 	} else {
-		fmt.Println("btcd is not running.")
+		log.Info("btcd is not running.")
 	}
 
 	// Step 3: Update the temp file
-	fmt.Println("Updating temporary file...")
+	log.Info("Updating temporary file...")
 	if err := deleteFromTempFile("miningaddr"); err != nil {
-		fmt.Printf("Failed to delete mining address from temp file: %v\n", err)
+		log.Errorf("Failed to delete mining address from temp file: %v", err)
 		return "", fmt.Errorf("failed to delete mining address from temp file: %w", err)
 	}
 
 	if err := updateTempFile("status", "uninitialized"); err != nil {
-		fmt.Printf("Failed to update status in temp file: %v\n", err)
+		log.Errorf("Failed to update status in temp file: %v", err)
 		return "", fmt.Errorf("failed to update status in temp file: %w", err)
 	}
-	fmt.Println("Temporary file updated successfully.")
+	log.Info("Temporary file updated successfully.")
 
 	// Step 4: Success
-	fmt.Println("Logout successful. All processes stopped.")
+	log.Info("Logout successful. All processes stopped.")
 	return "Logout successful. All processes stopped.", nil
 
 }
 
 // DeleteAccount is a function to delete the account wallet
-func (bs *BtcService) DeleteAccount() (string, error) {
+// The wallet is backed up before it is removed, encrypted with passphrase when one is given
+func (bs *BtcService) DeleteAccount(passphrase string) (string, error) {
+	// the wallet is backed up encrypted before it is deleted, checked before anything is stopped
+	if passphrase == "" && bs.WalletExists() {
+		return "", ErrPassphraseRequired
+	}
+
 	// Step 1: Check and stop btcwallet
-	fmt.Println("Checking if btcwallet is running...")
-	if isProcessRunning("btcwallet") {
-		btcwalletStopResult := bs.StopBtcwallet()
-		if btcwalletStopResult != "btcwallet stopped successfully" {
-			fmt.Printf("Failed to stop btcwallet: %s\n", btcwalletStopResult)
-			return "", fmt.Errorf("failed to stop btcwallet: %s", btcwalletStopResult)
+	log.Info("Checking if btcwallet is running...")
+	if btcwalletProcess.Running() {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			log.Errorf("Failed to stop btcwallet: %v", err)
+			return "", fmt.Errorf("failed to stop btcwallet: %w", err)
 		}
-		fmt.Println("btcwallet stopped successfully.")
+		log.Info("btcwallet stopped successfully.")
 	} else {
-		fmt.Println("btcwallet is not running.")
+		log.Info("btcwallet is not running.")
 	}
 
 	// Step 2: Check and stop btcd
-	fmt.Println("Checking if btcd is running...")
-	if isProcessRunning("btcd") {
-		btcdStopResult := bs.StopBtcd()
-		if btcdStopResult != "btcd stopped successfully" {
-			fmt.Printf("Failed to stop btcd: %s\n", btcdStopResult)
-			return "", fmt.Errorf("failed to stop btcd: %s", btcdStopResult)
+	log.Info("Checking if btcd is running...")
+	if btcdProcess.Running() {
+		if _, err := bs.StopBtcd(); err != nil {
+			log.Errorf("Failed to stop btcd: %v", err)
+			return "", fmt.Errorf("failed to stop btcd: %w", err)
 		}
-		fmt.Println("btcd stopped successfully.")
+		log.Info("btcd stopped successfully.")
 	} else {
-		fmt.Println("btcd is not running.")
+		log.Info("btcd is not running.")
 	}
 
 	// Step 3: Update the temp file
-	fmt.Println("Updating temporary file...")
+	log.Info("Updating temporary file...")
 	if err := deleteFromTempFile("miningaddr"); err != nil {
-		fmt.Printf("Failed to delete mining address from temp file: %v\n", err)
+		log.Errorf("Failed to delete mining address from temp file: %v", err)
 		return "", fmt.Errorf("failed to delete mining address from temp file: %w", err)
 	}
 
 	if err := updateTempFile("status", "uninitialized"); err != nil {
-		fmt.Printf("Failed to update status in temp file: %v\n", err)
+		log.Errorf("Failed to update status in temp file: %v", err)
 		return "", fmt.Errorf("failed to update status in temp file: %w", err)
 	}
-	fmt.Println("Temporary file updated successfully.")
+	log.Info("Temporary file updated successfully.")
 
 	// Step 4: Delete the wallet database
-	fmt.Println("Checking if wallet database exists...")
-	var walletDBPath string
-	if runtime.GOOS == "windows" {
-		userProfile := os.Getenv("USERPROFILE")
-		if userProfile == "" {
-			return "", fmt.Errorf("could not determine user profile path on Windows")
-		}
-		walletDBPath = filepath.Join(userProfile, "AppData", "Local", "Btcwallet", "mainnet", "wallet.db")
-	} else if runtime.GOOS == "darwin" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("could not determine home directory on macOS: %v", err)
-		}
-		walletDBPath = filepath.Join(homeDir, "Library", "Application Support", "Btcwallet", "mainnet", "wallet.db")
-	} else {
-		return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	log.Info("Checking if wallet database exists...")
+	walletDBPath, err := walletDBPath()
+	if err != nil {
+		return "", err
 	}
 
 	// Check if wallet exists
 	if bs.WalletExists() {
-		err := os.Remove(walletDBPath)
+		// Keep a copy, the wallet is gone for good otherwise
+		backup, err := bs.backupWalletFile(passphrase, "deleted")
+		if err != nil {
+			log.Errorf("Failed to back up wallet database: %v", err)
+			return "", fmt.Errorf("failed to back up wallet database, not deleting it: %w", err)
+		}
+		log.Infof("Wallet database backed up as %s.", backup.Name)
+
+		err = os.Remove(walletDBPath)
 		if err != nil {
-			fmt.Printf("Failed to delete wallet database: %v\n", err)
+			log.Errorf("Failed to delete wallet database: %v", err)
 			return "", fmt.Errorf("failed to delete wallet database: %w", err)
 		}
-		fmt.Println("Wallet database deleted successfully.")
+		log.Info("Wallet database deleted successfully.")
 	} else {
-		fmt.Println("Wallet database does not exist.")
+		log.Info("Wallet database does not exist.")
 	}
 
 	// Step 5: Success
-	fmt.Println("Account deleted successfully. All processes stopped and wallet database removed.")
+	log.Info("Account deleted successfully. All processes stopped and wallet database removed.")
 	return "Account deleted successfully. All processes stopped and wallet database removed.", nil
 }
 
 // GetBalance is a function to get the wallet balance
 func (bs *BtcService) GetBalance() (string, error) {
 	// Check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return "", fmt.Errorf("btcd is not running. Please start btcd before checking balance")
 	}
 
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return "", fmt.Errorf("btcwallet is not running. Please start btcwallet before checking balance")
 	}
 
@@ -1531,25 +1225,25 @@ func (bs *BtcService) GetBalance() (string, error) {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error fetching balance: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error fetching balance: %v", err)
 		return "", fmt.Errorf("error fetching balance: %w", err)
 	}
 
 	// Return balance
 	balance := strings.TrimSpace(output.String())
-	fmt.Printf("Wallet balance: %s\n", balance)
+	log.Infof("Wallet balance: %s", balance)
 	return balance, nil
 }
 
 // GetReceivedByAddress is a function to get the received amount for a specific address
 func (bs *BtcService) GetReceivedByAddress(walletAddress string) (string, error) {
 	// Check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return "", fmt.Errorf("btcd is not running. Please start btcd before checking received amount")
 	}
 
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return "", fmt.Errorf("btcwallet is not running. Please start btcwallet before checking received amount")
 	}
 
@@ -1575,34 +1269,86 @@ func (bs *BtcService) GetReceivedByAddress(walletAddress string) (string, error)
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error fetching received amount for address %s: %v\n", walletAddress, err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error fetching received amount for address %s: %v", walletAddress, err)
 		return "", fmt.Errorf("error fetching received amount for address %s: %w", walletAddress, err)
 	}
 
 	// Return received amount
 	receivedAmount := strings.TrimSpace(output.String())
-	fmt.Printf("Received amount for address %s: %s\n", walletAddress, receivedAmount)
+	log.Infof("Received amount for address %s: %s", walletAddress, receivedAmount)
 	return receivedAmount, nil
 }
 
+// GetPaymentAmount returns how much a wallet transaction paid to walletAddress and how many confirmations it has
+func (bs *BtcService) GetPaymentAmount(txid, walletAddress string) (float64, int64, error) {
+	if !btcwalletProcess.Running() {
+		return 0, 0, fmt.Errorf("btcwallet is not running. Please start btcwallet before checking payments")
+	}
+
+	cmd := exec.Command(
+		btcctlPath,
+		"--wallet",
+		"--rpcuser=user",
+		"--rpcpass=password",
+		"--rpcserver=127.0.0.1:8332",
+		"--notls",
+		"gettransaction",
+		txid,
+	)
+
+	if runtime.GOOS == "darwin" {
+		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error fetching transaction %s: %v", txid, err)
+		return 0, 0, fmt.Errorf("error fetching transaction %s: %w", txid, err)
+	}
+
+	var result struct {
+		Confirmations int64 `json:"confirmations"`
+		Details       []struct {
+			Address  string  `json:"address"`
+			Category string  `json:"category"`
+			Amount   float64 `json:"amount"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &result); err != nil {
+		return 0, 0, fmt.Errorf("error parsing transaction %s: %w", txid, err)
+	}
+
+	var amount float64
+	for _, detail := range result.Details {
+		if detail.Category == "receive" && detail.Address == walletAddress {
+			amount += detail.Amount
+		}
+	}
+	log.Infof("Transaction %s paid %f to %s (%d confirmations)", txid, amount, walletAddress, result.Confirmations)
+	return amount, result.Confirmations, nil
+}
+
 // GetMiningAddressAndBalance retrieves the mining address and its associated Bitcoin balance.
 func (bs *BtcService) GetMiningAddressAndBalance() (string, string, error) {
 	// Step 1: Extract the mining address from the temp file
 	miningAddress, err := getMiningAddressFromTemp()
 	if err != nil {
-		fmt.Printf("Failed to retrieve mining address: %v\n", err)
+		log.Errorf("Failed to retrieve mining address: %v", err)
 		return "", "", fmt.Errorf("failed to retrieve mining address: %w", err)
 	}
-	fmt.Printf("Mining address retrieved: %s\n", miningAddress)
+	log.Infof("Mining address retrieved: %s", miningAddress)
 
 	// Step 2: Extract the amount of Bitcoin associated with the mining address
 	receivedAmount, err := bs.GetReceivedByAddress(miningAddress)
 	if err != nil {
-		fmt.Printf("Failed to retrieve Bitcoin amount for address %s: %v\n", miningAddress, err)
+		log.Errorf("Failed to retrieve Bitcoin amount for address %s: %v", miningAddress, err)
 		return "", "", fmt.Errorf("failed to retrieve Bitcoin amount for address %s: %w", miningAddress, err)
 	}
-	fmt.Printf("Received amount for address %s: %s\n", miningAddress, receivedAmount)
+	log.Infof("Received amount for address %s: %s", miningAddress, receivedAmount)
 
 	// Step 3: Return the mining address and the associated balance
 	return miningAddress, receivedAmount, nil
@@ -1611,7 +1357,7 @@ func (bs *BtcService) GetMiningAddressAndBalance() (string, string, error) {
 // GetBlockCount is a function to get the current block count
 func (bs *BtcService) GetBlockCount() (string, error) {
 	// Check if btcd is running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return "", fmt.Errorf("btcd is not running. Please start btcd before checking block count")
 	}
 
@@ -1634,25 +1380,25 @@ func (bs *BtcService) GetBlockCount() (string, error) {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error fetching block count: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error fetching block count: %v", err)
 		return "", fmt.Errorf("error fetching block count: %w", err)
 	}
 
 	// Return block count
 	blockCount := strings.TrimSpace(output.String())
-	fmt.Printf("Current block count: %s\n", blockCount)
+	log.Infof("Current block count: %s", blockCount)
 	return blockCount, nil
 }
 
 // ListUnspent is a function to list all unspent transactions
 func (bs *BtcService) ListUnspent() ([]map[string]interface{}, error) {
 	// Check if btcd and btcwallet are running
-	if !isProcessRunning("btcd") {
+	if !btcdProcess.Running() {
 		return nil, fmt.Errorf("btcd is not running. Please start btcd before listing unspent transactions")
 	}
 
-	if !isProcessRunning("btcwallet") {
+	if !btcwalletProcess.Running() {
 		return nil, fmt.Errorf("btcwallet is not running. Please start btcwallet before listing unspent transactions")
 	}
 
@@ -1676,20 +1422,20 @@ func (bs *BtcService) ListUnspent() ([]map[string]interface{}, error) {
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error listing unspent transactions: %v\n", err)
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("Error listing unspent transactions: %v", err)
 		return nil, fmt.Errorf("error listing unspent transactions: %w", err)
 	}
 
 	// Parse the output as JSON
 	var utxos []map[string]interface{}
 	if err := json.Unmarshal(output.Bytes(), &utxos); err != nil {
-		fmt.Printf("Error parsing UTXO list: %v\n", err)
+		log.Errorf("Error parsing UTXO list: %v", err)
 		return nil, fmt.Errorf("error parsing UTXO list: %w", err)
 	}
 
 	// Log full result for debugging
-	fmt.Printf("List of unspent transactions: %v\n", utxos)
+	log.Infof("List of unspent transactions: %v", utxos)
 
 	// Return full result
 	return utxos, nil
@@ -1698,13 +1444,13 @@ func (bs *BtcService) ListUnspent() ([]map[string]interface{}, error) {
 // CreateRawTransaction is a function to create a raw transaction
 func (bs *BtcService) CreateRawTransaction(txid string, dst string, amount float64) (string, error) {
 	// Step 1: Retrieve source address (mining address) from temp file
-	fmt.Println("Step 1: Retrieving source address from temp file...")
+	log.Info("Step 1: Retrieving source address from temp file...")
 	tempContent, err := ioutil.ReadFile(tempFilePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read temp file: %w", err)
 	}
 
-	fmt.Printf("Raw temp file content: %s\n", tempContent)
+	log.Infof("Raw temp file content: %s", tempContent)
 
 	var tempData map[string]string
 	if err := json.Unmarshal(tempContent, &tempData); err != nil {
@@ -1716,17 +1462,17 @@ func (bs *BtcService) CreateRawTransaction(txid string, dst string, amount float
 		return "", fmt.Errorf("source address not found in temp file")
 	}
 
-	fmt.Printf("Source address retrieved: %s\n", srcAddress)
+	log.Infof("Source address retrieved: %s", srcAddress)
 
 	// Step 2: Get UTXOs from ListUnspent
-	fmt.Println("Step 2: Retrieving unspent transactions (UTXOs)...")
+	log.Info("Step 2: Retrieving unspent transactions (UTXOs)...")
 	utxos, err := bs.ListUnspent()
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve unspent transactions: %w", err)
 	}
 
 	// Validate UTXOs
-	fmt.Println("Step 3: Validating UTXOs...")
+	log.Info("Step 3: Validating UTXOs...")
 	var selectedUTXO map[string]interface{}
 	for _, utxo := range utxos {
 		utxoTxID, ok1 := utxo["txid"].(string)
@@ -1740,7 +1486,7 @@ func (bs *BtcService) CreateRawTransaction(txid string, dst string, amount float
 		// Match txid, source address, and check amount sufficiency
 		if utxoTxID == txid && utxoAddress == srcAddress && utxoAmount >= amount {
 			selectedUTXO = utxo
-			fmt.Printf("Matching UTXO found: txid=%s, amount=%.8f\n", utxoTxID, utxoAmount)
+			log.Infof("Matching UTXO found: txid=%s, amount=%.8f", utxoTxID, utxoAmount)
 			break
 		}
 	}
@@ -1762,7 +1508,7 @@ func (bs *BtcService) CreateRawTransaction(txid string, dst string, amount float
 	}
 
 	// Step 4: Construct raw transaction command
-	fmt.Println("Step 4: Constructing raw transaction command...")
+	log.Info("Step 4: Constructing raw transaction command...")
 	txInputs := fmt.Sprintf(`[{"txid":"%s", "vout":%d}]`, txid, vout)
 	txOutputs := fmt.Sprintf(`{"%s": %.8f, "%s": %.8f}`, dst, amount, srcAddress, srcAmount-amount)
 
@@ -1777,10 +1523,10 @@ func (bs *BtcService) CreateRawTransaction(txid string, dst string, amount float
 		txOutputs,
 	}
 
-	fmt.Printf("Raw transaction command: %v\n", rawTxCommand)
+	log.Infof("Raw transaction command: %v", rawTxCommand)
 
 	// Step 5: Execute raw transaction command
-	fmt.Println("Step 5: Executing raw transaction command...")
+	log.Info("Step 5: Executing raw transaction command...")
 	cmd := exec.Command(btcctlPath, rawTxCommand...)
 
 	// Add macOS-specific PATH configuration
@@ -1793,21 +1539,21 @@ func (bs *BtcService) CreateRawTransaction(txid string, dst string, amount float
 	cmd.Stdout = &output
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("[ERROR] Command execution failed: %v\n", err)
-		fmt.Printf("[ERROR] Stderr: %s\n", stderr.String())
-		fmt.Printf("[DEBUG] Raw command output: %s\n", output.String())
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("[ERROR] Command execution failed: %v", err)
+		log.Errorf("[ERROR] Stderr: %s", stderr.String())
+		log.Debugf("Raw command output: %s", output.String())
 		return "", fmt.Errorf("failed to create raw transaction: %w. Stderr: %s", err, stderr.String())
 	}
 
 	rawId := strings.TrimSpace(output.String())
-	fmt.Printf("Raw transaction created: %s\n", rawId)
+	log.Infof("Raw transaction created: %s", rawId)
 	return rawId, nil
 }
 
 // signRawTransaction is a function to sign a raw transaction
 func (bs *BtcService) signRawTransaction(rawId string) (string, bool, error) {
-	fmt.Printf("[DEBUG] Starting signRawTransaction with rawId: %s\n", rawId)
+	log.Debugf("Starting signRawTransaction with rawId: %s", rawId)
 
 	// Validate rawId
 	if rawId == "" {
@@ -1832,20 +1578,20 @@ func (bs *BtcService) signRawTransaction(rawId string) (string, bool, error) {
 	cmd.Stderr = &stderr
 
 	// Execute the command
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("[ERROR] Command execution failed: %v\n", err)
-		fmt.Printf("[ERROR] Stderr: %s\n", stderr.String())
-		fmt.Printf("[DEBUG] Raw command output: %s\n", output.String())
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("[ERROR] Command execution failed: %v", err)
+		log.Errorf("[ERROR] Stderr: %s", stderr.String())
+		log.Debugf("Raw command output: %s", output.String())
 		return "", false, fmt.Errorf("failed to sign raw transaction: %w. Stderr: %s", err, stderr.String())
 	}
 
-	fmt.Printf("[DEBUG] Command executed successfully. Raw output: %s\n", output.String())
+	log.Debugf("Command executed successfully. Raw output: %s", output.String())
 
 	// Parse the output JSON
 	var signedTx map[string]interface{}
 	if err := json.Unmarshal(output.Bytes(), &signedTx); err != nil {
-		fmt.Printf("[ERROR] Failed to parse JSON output: %v\n", err)
-		fmt.Printf("[DEBUG] Raw JSON output: %s\n", output.String())
+		log.Errorf("[ERROR] Failed to parse JSON output: %v", err)
+		log.Debugf("Raw JSON output: %s", output.String())
 		return "", false, fmt.Errorf("failed to parse signed transaction: %w", err)
 	}
 
@@ -1854,11 +1600,11 @@ func (bs *BtcService) signRawTransaction(rawId string) (string, bool, error) {
 	complete, completeOk := signedTx["complete"].(bool)
 
 	if !hexOk || !completeOk {
-		fmt.Printf("[ERROR] Unexpected output format. Parsed data: %v\n", signedTx)
+		log.Errorf("[ERROR] Unexpected output format. Parsed data: %v", signedTx)
 		return "", false, fmt.Errorf("unexpected output format: %s", output.String())
 	}
 
-	fmt.Printf("[DEBUG] Transaction signed successfully. Hex: %s, Complete: %v\n", hex, complete)
+	log.Debugf("Transaction signed successfully. Hex: %s, Complete: %v", hex, complete)
 	return hex, complete, nil
 }
 
@@ -1882,16 +1628,16 @@ func (bs *BtcService) sendRawTransaction(hex string) (string, error) {
 	cmd.Stderr = &stderr
 
 	// Execute the command
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("[ERROR] Command execution failed: %v\n", err)
-		fmt.Printf("[ERROR] Stderr: %s\n", stderr.String())
-		fmt.Printf("[DEBUG] Raw command output: %s\n", output.String())
+	if err := runBtcctl(cmd); err != nil {
+		log.Errorf("[ERROR] Command execution failed: %v", err)
+		log.Errorf("[ERROR] Stderr: %s", stderr.String())
+		log.Debugf("Raw command output: %s", output.String())
 		return "", fmt.Errorf("failed to send raw transaction: %w. Stderr: %s", err, stderr.String())
 	}
 
 	// Get the transaction ID from the output
 	txid := strings.TrimSpace(output.String())
-	fmt.Printf("Transaction sent successfully. TxID: %s\n", txid)
+	log.Infof("Transaction sent successfully. TxID: %s", txid)
 
 	// Return the transaction ID
 	return txid, nil
@@ -1899,19 +1645,19 @@ func (bs *BtcService) sendRawTransaction(hex string) (string, error) {
 
 // Transaction is a function to perform a transaction
 func (bs *BtcService) Transaction(passphrase, txid, dst string, amount float64) (string, error) {
-	fmt.Printf("[DEBUG] Starting transaction with passphrase: %s, txid: %s, dst: %s, amount: %.8f\n", passphrase, txid, dst, amount)
+	log.Debugf("Starting transaction, txid: %s, dst: %s, amount: %.8f", txid, dst, amount)
 
 	// Step 1: Store original balance in a temp file
-	fmt.Println("[DEBUG] Step 1: Retrieving original balance...")
+	log.Debug("Step 1: Retrieving original balance...")
 	originalBalanceStr, err := bs.GetBalance()
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to retrieve original balance: %v\n", err)
+		log.Errorf("[ERROR] Failed to retrieve original balance: %v", err)
 		return "", fmt.Errorf("failed to retrieve original balance: %w", err)
 	}
-	fmt.Printf("[DEBUG] Original balance: %s\n", originalBalanceStr)
+	log.Debugf("Original balance: %s", originalBalanceStr)
 
 	if err := updateTempFile("originalBalance", originalBalanceStr); err != nil {
-		fmt.Printf("[ERROR] Failed to store original balance: %v\n", err)
+		log.Errorf("[ERROR] Failed to store original balance: %v", err)
 		return "", fmt.Errorf("failed to store original balance: %w", err)
 	}
 
@@ -1923,46 +1669,46 @@ func (bs *BtcService) Transaction(passphrase, txid, dst string, amount float64)
 	// }
 
 	// Step 2: Create a raw transaction
-	fmt.Println("[DEBUG] Step 2: Creating raw transaction...")
+	log.Debug("Step 2: Creating raw transaction...")
 	rawId, err := bs.CreateRawTransaction(txid, dst, amount)
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to create raw transaction: %v\n", err)
+		log.Errorf("[ERROR] Failed to create raw transaction: %v", err)
 		return "", fmt.Errorf("failed to create raw transaction: %w", err)
 	}
-	fmt.Printf("[DEBUG] Raw transaction ID: %s\n", rawId)
+	log.Debugf("Raw transaction ID: %s", rawId)
 	time.Sleep(1 * time.Second)
 
 	// Step 3: Unlock the wallet
-	fmt.Println("[DEBUG] Step 3: Unlocking the wallet...")
+	log.Debug("Step 3: Unlocking the wallet...")
 	if _, err := bs.UnlockWallet(passphrase); err != nil {
-		fmt.Printf("[ERROR] Failed to unlock wallet: %v\n", err)
+		log.Errorf("[ERROR] Failed to unlock wallet: %v", err)
 		return "", fmt.Errorf("failed to unlock wallet. Please check passphrase: %w", err)
 	}
 	time.Sleep(1 * time.Second)
 
 	// Step 4: Sign the raw transaction
-	fmt.Println("[DEBUG] Step 4: Signing raw transaction...")
+	log.Debug("Step 4: Signing raw transaction...")
 	hex, complete, err := bs.signRawTransaction(rawId)
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to sign raw transaction: %v\n", err)
+		log.Errorf("[ERROR] Failed to sign raw transaction: %v", err)
 		return "", fmt.Errorf("failed to sign raw transaction: %w", err)
 	}
-	fmt.Printf("[DEBUG] Transaction signing complete. Hex: %s, Complete: %v\n", hex, complete)
+	log.Debugf("Transaction signing complete. Hex: %s, Complete: %v", hex, complete)
 
 	if !complete {
-		fmt.Printf("[ERROR] Transaction signing incomplete\n")
+		log.Errorf("[ERROR] Transaction signing incomplete")
 		return "", fmt.Errorf("transaction signing incomplete")
 	}
 	time.Sleep(1 * time.Second)
 
 	// Step 5: Send the raw transaction
-	fmt.Println("[DEBUG] Step 5: Sending raw transaction...")
+	log.Debug("Step 5: Sending raw transaction...")
 	txIdResult, err := bs.sendRawTransaction(hex)
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to send raw transaction: %v\n", err)
+		log.Errorf("[ERROR] Failed to send raw transaction: %v", err)
 		return "", fmt.Errorf("failed to send raw transaction: %w", err)
 	}
-	fmt.Printf("[DEBUG] Raw transaction sent successfully. TxID: %s\n", txIdResult)
+	log.Debugf("Raw transaction sent successfully. TxID: %s", txIdResult)
 	time.Sleep(1 * time.Second)
 
 	// // Step 6: Verify the transaction and balance
@@ -1987,24 +1733,24 @@ func (bs *BtcService) Transaction(passphrase, txid, dst string, amount float64)
 	// 	return "", fmt.Errorf("balance mismatch after transaction")
 	// }
 
-	fmt.Println("[DEBUG] Balance validation successful.")
+	log.Debug("Balance validation successful.")
 	time.Sleep(1 * time.Second)
 
 	// Step 7: Lock the wallet again (optional)
-	fmt.Println("[DEBUG] Step 7: Locking the wallet again...")
+	log.Debug("Step 7: Locking the wallet again...")
 	if _, err := bs.LockWallet(); err != nil {
-		fmt.Printf("[WARNING] Failed to lock wallet: %v\n", err)
+		log.Warnf("[WARNING] Failed to lock wallet: %v", err)
 		// Continue even if locking fails
 	}
 	time.Sleep(1 * time.Second)
 
 	// Step 8: Delete temporary balance file
-	fmt.Println("[DEBUG] Step 8: Cleaning up temporary files...")
+	log.Debug("Step 8: Cleaning up temporary files...")
 	if err := deleteFromTempFile("originalBalance"); err != nil {
-		fmt.Printf("[WARNING] Failed to delete temp file: %v\n", err)
+		log.Warnf("[WARNING] Failed to delete temp file: %v", err)
 	}
 	time.Sleep(1 * time.Second)
 
-	fmt.Println("[DEBUG] Transaction completed successfully.")
+	log.Debug("Transaction completed successfully.")
 	return txIdResult, nil
 }
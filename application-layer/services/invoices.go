@@ -0,0 +1,491 @@
+package services
+
+import (
+	"application-layer/models"
+	"application-layer/websocket"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/google/uuid"
+)
+
+// invoices are paid to a fresh address each, so anything that lands on that address
+// pays the invoice. btcd tells us about transactions to the addresses we registered,
+// in the mempool and again once mined, and every block we check what btcwallet has
+// seen in case a notification was missed while we were disconnected
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrInvalidInvoice  = errors.New("invalid invoice")
+
+	defaultInvoiceExpiry  = time.Hour
+	invoiceGracePeriod    = 24 * time.Hour // an expired invoice is still checked this long for a late payment
+	invoiceRetryInterval  = 10 * time.Second
+	invoiceConfirmations  = 1
+	invoiceTimeFormat     = "2006-01-02 15:04:05"
+	errUnsupportedBIP21   = errors.New("not a bitcoin uri")
+	errInvoiceAmountParam = errors.New("invalid amount in bitcoin uri")
+)
+
+type invoiceBook struct {
+	mu       sync.Mutex
+	loadOnce sync.Once
+	client   *rpcclient.Client
+	Invoices map[string]*models.Invoice `json:"Invoices"`
+}
+
+var invoices = &invoiceBook{}
+
+// kept next to the temp file
+func invoicesPath() string {
+	return filepath.Join(filepath.Dir(tempFilePath), "btc_invoices.json")
+}
+
+// load reads the saved invoices the first time they are needed, caller holds b.mu
+func (b *invoiceBook) load() {
+	b.loadOnce.Do(func() {
+		content, err := ioutil.ReadFile(invoicesPath())
+		if err == nil {
+			if err := json.Unmarshal(content, b); err != nil {
+				log.Errorf("invoices: failed to parse %s: %v", invoicesPath(), err)
+			}
+		} else if !os.IsNotExist(err) {
+			log.Errorf("invoices: failed to read %s: %v", invoicesPath(), err)
+		}
+		if b.Invoices == nil {
+			b.Invoices = make(map[string]*models.Invoice)
+		}
+	})
+}
+
+// caller holds b.mu
+func (b *invoiceBook) save() error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal invoices: %w", err)
+	}
+	if err := ioutil.WriteFile(invoicesPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write invoices: %w", err)
+	}
+	return nil
+}
+
+// watched reports whether payments to the invoice are still looked for, which goes on for
+// invoiceGracePeriod after it expired
+func watched(invoice *models.Invoice, now time.Time) bool {
+	switch invoice.Status {
+	case "open", "pending":
+		return true
+	case "expired":
+		expires, err := time.ParseInLocation(invoiceTimeFormat, invoice.ExpiresAt, time.Local)
+		return err == nil && now.Before(expires.Add(invoiceGracePeriod))
+	}
+	return false
+}
+
+// byAddress finds the invoice paid to address, caller holds b.mu
+func (b *invoiceBook) byAddress(address string) *models.Invoice {
+	for _, invoice := range b.Invoices {
+		if invoice.Address == address {
+			return invoice
+		}
+	}
+	return nil
+}
+
+// EncodeBIP21 builds a bitcoin: uri, amount and the text fields are left out when empty
+func EncodeBIP21(address string, amount float64, label, message string) string {
+	var params []string
+	if amount > 0 {
+		params = append(params, "amount="+strconv.FormatFloat(amount, 'f', -1, 64))
+	}
+	if label != "" {
+		params = append(params, "label="+bip21Escape(label))
+	}
+	if message != "" {
+		params = append(params, "message="+bip21Escape(message))
+	}
+	uri := "bitcoin:" + address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri
+}
+
+// wallets disagree about "+" for spaces, %20 is read the same way by all of them
+func bip21Escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// ParseBIP21 reads the address, amount and message out of a bitcoin: uri
+// the message falls back to the label, unknown req- parameters make the uri unusable as BIP21 says
+func ParseBIP21(uri string) (string, float64, string, error) {
+	rest := strings.TrimSpace(uri)
+	if len(rest) < len("bitcoin:") || !strings.EqualFold(rest[:len("bitcoin:")], "bitcoin:") {
+		return "", 0, "", errUnsupportedBIP21
+	}
+	rest = rest[len("bitcoin:"):]
+	address, query := rest, ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		address, query = rest[:i], rest[i+1:]
+	}
+	if _, err := btcutil.DecodeAddress(address, &chaincfg.MainNetParams); err != nil {
+		return "", 0, "", fmt.Errorf("invalid address in bitcoin uri: %w", err)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("invalid bitcoin uri parameters: %w", err)
+	}
+	var amount float64
+	if value := values.Get("amount"); value != "" {
+		amount, err = strconv.ParseFloat(value, 64)
+		if err != nil || amount < 0 {
+			return "", 0, "", errInvoiceAmountParam
+		}
+	}
+	for key := range values {
+		if strings.HasPrefix(key, "req-") {
+			return "", 0, "", fmt.Errorf("unsupported required parameter %s in bitcoin uri", key)
+		}
+	}
+	message := values.Get("message")
+	if message == "" {
+		message = values.Get("label")
+	}
+	return address, amount, message, nil
+}
+
+// CreateInvoice asks the wallet for a new address and invoices amount to it
+// purpose and reference tie the invoice to what it pays for, a file transfer or a proxy session
+func (bs *BtcService) CreateInvoice(amount btcutil.Amount, memo string, expiry time.Duration, purpose, reference string) (models.Invoice, error) {
+	if amount <= 0 {
+		return models.Invoice{}, fmt.Errorf("%w: amount must be positive", ErrInvalidInvoice)
+	}
+	if expiry <= 0 {
+		expiry = defaultInvoiceExpiry
+	}
+	address, err := bs.GetNewAddress()
+	if err != nil {
+		return models.Invoice{}, fmt.Errorf("failed to get an address for the invoice: %w", err)
+	}
+	if _, err := btcutil.DecodeAddress(address, &chaincfg.MainNetParams); err != nil {
+		return models.Invoice{}, fmt.Errorf("wallet returned an invalid address %q: %w", address, err)
+	}
+
+	now := time.Now()
+	invoice := &models.Invoice{
+		ID:        uuid.New().String(),
+		Address:   address,
+		Amount:    int64(amount),
+		Memo:      memo,
+		Purpose:   purpose,
+		Reference: reference,
+		Status:    "open",
+		Payments:  []models.InvoicePayment{},
+		CreatedAt: now.Format(invoiceTimeFormat),
+		ExpiresAt: now.Add(expiry).Format(invoiceTimeFormat),
+	}
+	invoice.URI = EncodeBIP21(address, amount.ToBTC(), "OrcaNet", memo)
+
+	invoices.mu.Lock()
+	invoices.load()
+	invoices.Invoices[invoice.ID] = invoice
+	if err := invoices.save(); err != nil {
+		log.Infof("CreateInvoice: %v", err)
+	}
+	client := invoices.client
+	created := *invoice
+	invoices.mu.Unlock()
+
+	// without a connection the address is registered once WatchInvoices connects
+	if client != nil {
+		if err := client.NotifyReceived([]btcutil.Address{mustDecodeAddress(address)}); err != nil {
+			log.Errorf("CreateInvoice: failed to watch %s: %v", address, err)
+		}
+	}
+	log.Infof("invoice %s: %v to %s", created.ID, btcutil.Amount(created.Amount), created.Address)
+	return created, nil
+}
+
+func mustDecodeAddress(address string) btcutil.Address {
+	decoded, _ := btcutil.DecodeAddress(address, &chaincfg.MainNetParams)
+	return decoded
+}
+
+func (bs *BtcService) GetInvoice(id string) (models.Invoice, error) {
+	invoices.mu.Lock()
+	defer invoices.mu.Unlock()
+	invoices.load()
+	invoice, ok := invoices.Invoices[id]
+	if !ok {
+		return models.Invoice{}, ErrInvoiceNotFound
+	}
+	return *invoice, nil
+}
+
+// ListInvoices returns the invoices newest first, only those with status when it isn't empty
+func (bs *BtcService) ListInvoices(status string) []models.Invoice {
+	invoices.mu.Lock()
+	invoices.load()
+	list := []models.Invoice{}
+	for _, invoice := range invoices.Invoices {
+		if status == "" || invoice.Status == status {
+			list = append(list, *invoice)
+		}
+	}
+	invoices.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	return list
+}
+
+// WatchInvoices follows btcd's notifications for transactions to open invoices, it runs until the process exits
+func (bs *BtcService) WatchInvoices() {
+	for {
+		client, err := rpcclient.New(&rpcclient.ConnConfig{
+			Host:       "127.0.0.1:8334",
+			Endpoint:   "ws",
+			User:       "user",
+			Pass:       "password",
+			DisableTLS: true,
+		}, &rpcclient.NotificationHandlers{
+			// nil details while in the mempool, then again with the block once mined
+			OnRecvTx: func(tx *btcutil.Tx, details *btcjson.BlockDetails) {
+				invoices.received(tx, details != nil)
+			},
+			// handlers can't call the client themselves
+			OnBlockConnected: func(hash *chainhash.Hash, height int32, t time.Time) {
+				go invoices.reconcile()
+			},
+		})
+		if err != nil {
+			log.Infof("WatchInvoices: btcd not reachable, retrying in %s: %v", invoiceRetryInterval, err)
+			time.Sleep(invoiceRetryInterval)
+			continue
+		}
+
+		invoices.mu.Lock()
+		invoices.load()
+		invoices.client = client
+		var addresses []btcutil.Address
+		now := time.Now()
+		for _, invoice := range invoices.Invoices {
+			if address := mustDecodeAddress(invoice.Address); address != nil && watched(invoice, now) {
+				addresses = append(addresses, address)
+			}
+		}
+		invoices.mu.Unlock()
+
+		if err := client.NotifyBlocks(); err != nil {
+			log.Errorf("WatchInvoices: failed to register for block notifications: %v", err)
+		}
+		// registered addresses are registered again by the client when it reconnects
+		if len(addresses) > 0 {
+			if err := client.NotifyReceived(addresses); err != nil {
+				log.Errorf("WatchInvoices: failed to watch invoice addresses: %v", err)
+			}
+		}
+		invoices.reconcile()
+		client.WaitForShutdown()
+		return
+	}
+}
+
+// received books the outputs of tx that pay an invoice
+func (b *invoiceBook) received(tx *btcutil.Tx, confirmed bool) {
+	b.mu.Lock()
+	b.load()
+	var changed []models.Invoice
+	for _, out := range tx.MsgTx().TxOut {
+		_, addresses, _, err := txscript.ExtractPkScriptAddrs(out.PkScript, &chaincfg.MainNetParams)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			invoice := b.byAddress(address.EncodeAddress())
+			if invoice == nil {
+				continue
+			}
+			if addInvoicePayment(invoice, tx.Hash().String(), btcutil.Amount(out.Value), confirmed) {
+				changed = append(changed, *invoice)
+			}
+		}
+	}
+	if len(changed) > 0 {
+		if err := b.save(); err != nil {
+			log.Infof("invoices: %v", err)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, invoice := range changed {
+		announceInvoice(invoice)
+	}
+}
+
+// reconcile catches payments we weren't told about, also late ones to recently expired invoices,
+// and expires unpaid invoices
+func (b *invoiceBook) reconcile() {
+	now := time.Now()
+	b.mu.Lock()
+	b.load()
+	var open []models.Invoice
+	for _, invoice := range b.Invoices {
+		if watched(invoice, now) {
+			open = append(open, *invoice)
+		}
+	}
+	b.mu.Unlock()
+
+	var changed []models.Invoice
+	for _, snapshot := range open {
+		// btcwallet knows about the address, so this also sees payments made while we were away
+		var received btcutil.Amount
+		if btcwalletProcess.Running() {
+			if output, err := walletCommand("getreceivedbyaddress", snapshot.Address, strconv.Itoa(invoiceConfirmations)); err == nil {
+				if btc, err := strconv.ParseFloat(output, 64); err == nil {
+					received, _ = btcutil.NewAmount(btc)
+				}
+			}
+		}
+
+		b.mu.Lock()
+		invoice := b.Invoices[snapshot.ID]
+		if invoice == nil || !watched(invoice, now) {
+			b.mu.Unlock()
+			continue
+		}
+		before := invoice.Status
+		if int64(received) > invoice.Received {
+			invoice.Received = int64(received)
+		}
+		settleInvoice(invoice, now)
+		if invoice.Status == "open" {
+			if expires, err := time.ParseInLocation(invoiceTimeFormat, invoice.ExpiresAt, time.Local); err == nil && now.After(expires) {
+				invoice.Status = "expired"
+			}
+		}
+		if invoice.Status != before {
+			changed = append(changed, *invoice)
+		}
+		b.mu.Unlock()
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+	b.mu.Lock()
+	if err := b.save(); err != nil {
+		log.Infof("invoices: %v", err)
+	}
+	b.mu.Unlock()
+	for _, invoice := range changed {
+		announceInvoice(invoice)
+	}
+}
+
+// addInvoicePayment books an output to the invoice address, the same transaction comes again once it is mined
+// and then only flips to confirmed. reports whether anything changed
+func addInvoicePayment(invoice *models.Invoice, txid string, amount btcutil.Amount, confirmed bool) bool {
+	for i := range invoice.Payments {
+		payment := &invoice.Payments[i]
+		if payment.TxID != txid {
+			continue
+		}
+		if !confirmed || payment.Confirmed {
+			return false
+		}
+		payment.Confirmed = true
+		settleInvoice(invoice, time.Now())
+		return true
+	}
+	invoice.Payments = append(invoice.Payments, models.InvoicePayment{TxID: txid, Amount: int64(amount), Confirmed: confirmed})
+	if invoice.PaymentTxID == "" {
+		invoice.PaymentTxID = txid
+	}
+	settleInvoice(invoice, time.Now())
+	return true
+}
+
+// settleInvoice works out the status from the payments booked so far, a paid invoice stays that way
+// a payment arriving within invoiceGracePeriod after the expiry still pays the invoice, the buyer can't be
+// blamed for slow blocks
+func settleInvoice(invoice *models.Invoice, now time.Time) {
+	if invoice.Status == "paid" {
+		return
+	}
+	var confirmed, seen int64
+	for _, payment := range invoice.Payments {
+		seen += payment.Amount
+		if payment.Confirmed {
+			confirmed += payment.Amount
+		}
+	}
+	if confirmed > invoice.Received {
+		invoice.Received = confirmed
+	}
+	switch {
+	case invoice.Received >= invoice.Amount:
+		invoice.Status = "paid"
+		invoice.PaidAt = now.Format(invoiceTimeFormat)
+	case seen > 0 && invoice.Status != "expired":
+		invoice.Status = "pending"
+	}
+}
+
+// PayURI pays a bitcoin: uri from a single utxo at the mining address, as Transaction does
+func (bs *BtcService) PayURI(uri, passphrase string) (string, error) {
+	address, amount, _, err := ParseBIP21(uri)
+	if err != nil {
+		return "", err
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("%w: the uri has no amount", ErrInvalidInvoice)
+	}
+	source, err := getMiningAddressFromTemp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the address to pay from: %w", err)
+	}
+	utxos, err := bs.ListUnspent()
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve unspent transactions: %w", err)
+	}
+
+	// the smallest output that covers the amount, so large ones stay whole
+	var txid string
+	var best float64
+	for _, utxo := range utxos {
+		utxoTxID, ok1 := utxo["txid"].(string)
+		utxoAddress, ok2 := utxo["address"].(string)
+		utxoAmount, ok3 := utxo["amount"].(float64)
+		if !ok1 || !ok2 || !ok3 || utxoAddress != source || utxoAmount < amount {
+			continue
+		}
+		if txid == "" || utxoAmount < best {
+			txid, best = utxoTxID, utxoAmount
+		}
+	}
+	if txid == "" {
+		return "", fmt.Errorf("no unspent output of at least %.8f BTC at %s", amount, source)
+	}
+	return bs.Transaction(passphrase, txid, address, amount)
+}
+
+func announceInvoice(invoice models.Invoice) {
+	log.Infof("invoice %s is %s, received %v of %v", invoice.ID, invoice.Status, btcutil.Amount(invoice.Received), btcutil.Amount(invoice.Amount))
+	websocket.SendEvent(models.InvoiceEvent{Event: "invoice", Invoice: invoice})
+}
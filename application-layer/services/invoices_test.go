@@ -0,0 +1,68 @@
+package services
+
+import (
+	"application-layer/models"
+	"testing"
+	"time"
+)
+
+// go test -v -run ^TestInvoices$ -count=1 application-layer/services
+// TestInvoices checks the BIP21 uri of an invoice and how payments to its address settle it, no btcd needed.
+func TestInvoices(t *testing.T) {
+	address := "14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc"
+	uri := EncodeBIP21(address, 0.015, "OrcaNet", "movie night.mp4 & more")
+	if uri != "bitcoin:14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc?amount=0.015&label=OrcaNet&message=movie%20night.mp4%20%26%20more" {
+		t.Errorf("Unexpected uri: %s", uri)
+	}
+	parsed, amount, message, err := ParseBIP21(uri)
+	if err != nil || parsed != address || amount != 0.015 || message != "movie night.mp4 & more" {
+		t.Errorf("Round trip failed: %s %f %q %v", parsed, amount, message, err)
+	}
+	if _, _, message, _ := ParseBIP21("BITCOIN:" + address + "?label=Shop"); message != "Shop" {
+		t.Errorf("Expected the label when there is no message, got %q", message)
+	}
+	for _, bad := range []string{
+		"litecoin:" + address,
+		"bitcoin:notanaddress?amount=1",
+		"bitcoin:" + address + "?amount=-1",
+		"bitcoin:" + address + "?amount=1&req-somethingnew=1",
+	} {
+		if _, _, _, err := ParseBIP21(bad); err == nil {
+			t.Errorf("Expected %s to be refused", bad)
+		}
+	}
+
+	invoice := &models.Invoice{Address: address, Amount: 1500000, Status: "open"}
+	if !addInvoicePayment(invoice, "tx1", 1000000, false) || invoice.Status != "pending" {
+		t.Fatalf("Expected an unconfirmed payment to make the invoice pending, got %+v", invoice)
+	}
+	if addInvoicePayment(invoice, "tx1", 1000000, false) {
+		t.Errorf("The same unconfirmed transaction shouldn't be booked twice")
+	}
+	if !addInvoicePayment(invoice, "tx1", 1000000, true) || invoice.Status != "pending" || invoice.Received != 1000000 {
+		t.Fatalf("Expected a confirmed partial payment to leave the invoice pending, got %+v", invoice)
+	}
+	if addInvoicePayment(invoice, "tx3", 499999, true); invoice.Status == "paid" {
+		t.Fatalf("Expected a satoshi short to leave the invoice unpaid, got %+v", invoice)
+	}
+	invoice.Payments, invoice.Received = invoice.Payments[:1], 1000000
+
+	// an expired invoice is still watched for a while, and paying the rest then settles it
+	now := time.Now()
+	invoice.Status = "expired"
+	invoice.ExpiresAt = now.Add(-time.Hour).Format(invoiceTimeFormat)
+	if !watched(invoice, now) {
+		t.Errorf("Expected an invoice that expired an hour ago to be watched for late payments")
+	}
+	if watched(&models.Invoice{Status: "expired", ExpiresAt: now.Add(-invoiceGracePeriod - time.Hour).Format(invoiceTimeFormat)}, now) {
+		t.Errorf("Expected an invoice past the grace period to be left alone")
+	}
+	addInvoicePayment(invoice, "tx2", 500000, true)
+	if invoice.Status != "paid" || invoice.PaymentTxID != "tx1" || invoice.PaidAt == "" || len(invoice.Payments) != 2 {
+		t.Errorf("Expected the invoice paid by tx1 and tx2, got %+v", invoice)
+	}
+	settleInvoice(invoice, time.Now())
+	if invoice.Status != "paid" {
+		t.Errorf("A paid invoice should stay paid, got %s", invoice.Status)
+	}
+}
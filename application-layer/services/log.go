@@ -0,0 +1,5 @@
+package services
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("SRVC")
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"application-layer/metrics"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runBtcctl runs a btcctl command and records the call, the server and method come from its arguments
+func runBtcctl(cmd *exec.Cmd) error {
+	server, method := "btcd", ""
+	for _, arg := range cmd.Args[1:] {
+		switch {
+		case arg == "--wallet", strings.HasPrefix(arg, "--rpcserver=") && strings.HasSuffix(arg, ":8332"):
+			server = "btcwallet"
+		case method == "" && !strings.HasPrefix(arg, "-"):
+			method = arg
+		}
+	}
+	start := time.Now()
+	err := cmd.Run()
+	metrics.RPCCall(server, method, start, err)
+	return err
+}
+
+// btcdCollector asks btcd for its network stats on every scrape
+type btcdCollector struct {
+	up            *prometheus.Desc
+	bytesReceived *prometheus.Desc
+	bytesSent     *prometheus.Desc
+	peers         *prometheus.Desc
+	peerBytes     *prometheus.Desc
+	peerPing      *prometheus.Desc
+	blockHeight   *prometheus.Desc
+}
+
+func NewBtcdCollector() prometheus.Collector {
+	return &btcdCollector{
+		up:            prometheus.NewDesc("orcanet_btcd_up", "Whether btcd answered the last scrape.", nil, nil),
+		bytesReceived: prometheus.NewDesc("orcanet_btcd_received_bytes_total", "Bytes btcd received from its peers, from getnettotals.", nil, nil),
+		bytesSent:     prometheus.NewDesc("orcanet_btcd_sent_bytes_total", "Bytes btcd sent to its peers, from getnettotals.", nil, nil),
+		peers:         prometheus.NewDesc("orcanet_btcd_peers", "Peers btcd is connected to, by direction, from getpeerinfo.", []string{"direction"}, nil),
+		peerBytes:     prometheus.NewDesc("orcanet_btcd_peer_bytes", "Bytes exchanged with the current peers, by operation (received or sent), from getpeerinfo.", []string{"operation"}, nil),
+		peerPing:      prometheus.NewDesc("orcanet_btcd_peer_ping_seconds", "Average ping time of the current peers, from getpeerinfo.", nil, nil),
+		blockHeight:   prometheus.NewDesc("orcanet_btcd_block_height", "Height of btcd's best chain.", nil, nil),
+	}
+}
+
+func (c *btcdCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.up, c.bytesReceived, c.bytesSent, c.peers, c.peerBytes, c.peerPing, c.blockHeight} {
+		ch <- desc
+	}
+}
+
+func (c *btcdCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.collect(ch); err != nil {
+		log.Infof("btcd metrics: %v", err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+}
+
+func (c *btcdCollector) collect(ch chan<- prometheus.Metric) error {
+	if !btcdProcess.Running() {
+		return fmt.Errorf("btcd is not running")
+	}
+
+	output, err := btcdCommand("getnettotals")
+	if err != nil {
+		return err
+	}
+	var totals btcjson.GetNetTotalsResult
+	if err := json.Unmarshal([]byte(output), &totals); err != nil {
+		return fmt.Errorf("failed to parse getnettotals: %w", err)
+	}
+
+	output, err = btcdCommand("getpeerinfo")
+	if err != nil {
+		return err
+	}
+	var peers []btcjson.GetPeerInfoResult
+	if err := json.Unmarshal([]byte(output), &peers); err != nil {
+		return fmt.Errorf("failed to parse getpeerinfo: %w", err)
+	}
+
+	output, err = btcdCommand("getblockcount")
+	if err != nil {
+		return err
+	}
+	height, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse getblockcount: %w", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.bytesReceived, prometheus.CounterValue, float64(totals.TotalBytesRecv))
+	ch <- prometheus.MustNewConstMetric(c.bytesSent, prometheus.CounterValue, float64(totals.TotalBytesSent))
+	var inbound, outbound, received, sent, ping float64
+	for _, peer := range peers {
+		if peer.Inbound {
+			inbound++
+		} else {
+			outbound++
+		}
+		received += float64(peer.BytesRecv)
+		sent += float64(peer.BytesSent)
+		ping += peer.PingTime
+	}
+	ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, inbound, "inbound")
+	ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, outbound, "outbound")
+	ch <- prometheus.MustNewConstMetric(c.peerBytes, prometheus.GaugeValue, received, "received")
+	ch <- prometheus.MustNewConstMetric(c.peerBytes, prometheus.GaugeValue, sent, "sent")
+	if len(peers) > 0 {
+		// btcd reports ping times in microseconds
+		ch <- prometheus.MustNewConstMetric(c.peerPing, prometheus.GaugeValue, ping/float64(len(peers))/1e6)
+	}
+	ch <- prometheus.MustNewConstMetric(c.blockHeight, prometheus.GaugeValue, float64(height))
+	return nil
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"application-layer/models"
+	"application-layer/websocket"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// mining runs in the background, either in btcd itself (setgenerate) or in a cpuminer process
+// working on btcd's block templates. btcd only reads its mining address when it starts, cpuminer
+// builds its own coinbase so the address can be switched by restarting just the miner, which is
+// why a new address moves mining over to cpuminer
+const (
+	MinerBtcd     = "btcd"
+	MinerCpuminer = "cpuminer"
+)
+
+var (
+	cpuminerPath       = "../cpuminer/minerd"
+	miningFeedInterval = 5 * time.Second
+)
+
+type miningState struct {
+	mu          sync.Mutex
+	cpuminer    *exec.Cmd
+	threadRates map[int]float64 // hashes per second of each cpuminer thread
+	lastError   string
+	feedStop    chan struct{}
+}
+
+var mining = &miningState{threadRates: make(map[int]float64)}
+
+// readTempFile returns everything stored in the btcd temp file
+func readTempFile() (map[string]string, error) {
+	content, err := ioutil.ReadFile(tempFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp file: %w", err)
+	}
+	var data map[string]string
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal temp file content: %w", err)
+	}
+	return data, nil
+}
+
+// btcdCommand runs btcctl against btcd's rpc server (not the wallet) and returns its trimmed output
+func btcdCommand(args ...string) (string, error) {
+	cmd := exec.Command(
+		btcctlPath,
+		append([]string{
+			"--rpcuser=user",
+			"--rpcpass=password",
+			"--rpcserver=127.0.0.1:8334",
+			"--notls",
+		}, args...)...,
+	)
+
+	// Add macOS-specific environment setup
+	if runtime.GOOS == "darwin" {
+		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := runBtcctl(cmd); err != nil {
+		return "", fmt.Errorf("error executing btcctl %s: %w: %s", args[0], err, strings.TrimSpace(output.String()))
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// GetMiningSettings reads the miner, thread count and address from the temp file
+func (bs *BtcService) GetMiningSettings() models.MiningSettings {
+	return miningSettings()
+}
+
+func miningSettings() models.MiningSettings {
+	settings := models.MiningSettings{Miner: MinerBtcd}
+	data, err := readTempFile()
+	if err != nil {
+		return settings
+	}
+	if data["miner"] != "" {
+		settings.Miner = data["miner"]
+	}
+	settings.Threads, _ = strconv.Atoi(data["miningthreads"])
+	settings.Address = data["miningaddr"]
+	return settings
+}
+
+// SetMiningSettings switches miner, threads or address, a running miner picks them up without restarting btcd or btcwallet
+// an empty miner keeps the current one, unless the address changes and btcd can't follow it
+func (bs *BtcService) SetMiningSettings(settings models.MiningSettings) (models.MiningSettings, error) {
+	if settings.Miner != "" && settings.Miner != MinerBtcd && settings.Miner != MinerCpuminer {
+		return settings, fmt.Errorf("unknown miner %q, use %q or %q", settings.Miner, MinerBtcd, MinerCpuminer)
+	}
+	if settings.Threads < 0 {
+		return settings, fmt.Errorf("threads can't be negative")
+	}
+
+	mining.mu.Lock()
+	defer mining.mu.Unlock()
+	current := bs.GetMiningSettings()
+	if settings.Miner == "" {
+		settings.Miner = current.Miner
+	}
+	if settings.Address == "" {
+		settings.Address = current.Address
+	}
+	if settings.Address != current.Address {
+		if _, err := btcutil.DecodeAddress(settings.Address, &chaincfg.MainNetParams); err != nil {
+			return settings, fmt.Errorf("invalid mining address: %v", err)
+		}
+		if settings.Miner == MinerBtcd {
+			log.Infof("btcd mines to the address it was started with, switching to %s to mine to %s", MinerCpuminer, settings.Address)
+			settings.Miner = MinerCpuminer
+		}
+	}
+
+	wasGenerating, err := generating(current)
+	if err != nil {
+		return current, fmt.Errorf("failed to check mining status: %w", err)
+	}
+	if wasGenerating && (settings.Miner != current.Miner || settings.Address != current.Address || settings.Threads != current.Threads) {
+		if err := stopGenerating(current); err != nil {
+			return current, err
+		}
+	}
+
+	if err := updateTempFile("miner", settings.Miner); err != nil {
+		return current, err
+	}
+	if err := updateTempFile("miningthreads", strconv.Itoa(settings.Threads)); err != nil {
+		return current, err
+	}
+	if settings.Address != "" {
+		if err := updateTempFile("miningaddr", settings.Address); err != nil {
+			return current, err
+		}
+	}
+
+	if wasGenerating {
+		if err := startGenerating(settings); err != nil {
+			return settings, fmt.Errorf("settings saved but mining did not restart: %v", err)
+		}
+	}
+	log.Infof("mining settings updated: %+v", settings)
+	return settings, nil
+}
+
+// generating reports whether the configured miner is working, caller holds mining.mu
+func generating(settings models.MiningSettings) (bool, error) {
+	if settings.Miner == MinerCpuminer {
+		return mining.cpuminer != nil, nil
+	}
+	result, err := btcdCommand("getgenerate")
+	if err != nil {
+		return false, err
+	}
+	return result == "true", nil
+}
+
+// caller holds mining.mu
+func startGenerating(settings models.MiningSettings) error {
+	if settings.Miner == MinerCpuminer {
+		return startCpuminer(settings)
+	}
+	// btcd takes -1 as one thread per cpu
+	threads := settings.Threads
+	if threads == 0 {
+		threads = -1
+	}
+	if _, err := btcdCommand("setgenerate", "true", strconv.Itoa(threads)); err != nil {
+		return err
+	}
+	mining.lastError = ""
+	startMiningFeed()
+	return nil
+}
+
+// caller holds mining.mu
+func stopGenerating(settings models.MiningSettings) error {
+	stopMiningFeed()
+	if settings.Miner == MinerCpuminer {
+		stopCpuminer()
+		return nil
+	}
+	_, err := btcdCommand("setgenerate", "false")
+	return err
+}
+
+// cpuminer prints the rate of each thread as it goes, e.g. "thread 0: 2097152 hashes, 4521 khash/s"
+var cpuminerRate = regexp.MustCompile(`thread (\d+): \d+ hashes, ([\d.]+) (k|M)?hash/s`)
+
+// caller holds mining.mu
+func startCpuminer(settings models.MiningSettings) error {
+	if settings.Address == "" {
+		return fmt.Errorf("cpuminer needs a mining address")
+	}
+	threads := settings.Threads
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+
+	cmd := exec.Command(
+		cpuminerPath,
+		"--algo=sha256d",
+		"--url=http://127.0.0.1:8334",
+		"--userpass=user:password",
+		"--no-getwork",
+		fmt.Sprintf("--coinbase-addr=%s", settings.Address),
+		fmt.Sprintf("--threads=%d", threads),
+	)
+	if runtime.GOOS == "darwin" {
+		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to read cpuminer output: %v", err)
+	}
+	cmd.Stdout = os.Stdout
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start cpuminer: %v", err)
+	}
+	log.Infof("cpuminer started with PID: %d, mining to %s", cmd.Process.Pid, settings.Address)
+
+	mining.cpuminer = cmd
+	mining.threadRates = make(map[int]float64)
+	mining.lastError = ""
+	go watchCpuminer(cmd, stderr)
+	startMiningFeed()
+	return nil
+}
+
+// caller holds mining.mu
+func stopCpuminer() {
+	cmd := mining.cpuminer
+	if cmd == nil {
+		return
+	}
+	// cleared first so the watcher knows we stopped it on purpose
+	mining.cpuminer = nil
+	mining.threadRates = make(map[int]float64)
+	if err := cmd.Process.Kill(); err != nil {
+		log.Errorf("failed to stop cpuminer: %v", err)
+	}
+}
+
+// watchCpuminer collects hash rates from cpuminer's output until it exits
+func watchCpuminer(cmd *exec.Cmd, output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		match := cpuminerRate.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		thread, _ := strconv.Atoi(match[1])
+		rate, _ := strconv.ParseFloat(match[2], 64)
+		switch match[3] {
+		case "k":
+			rate *= 1e3
+		case "M":
+			rate *= 1e6
+		}
+		mining.mu.Lock()
+		if mining.cpuminer == cmd {
+			mining.threadRates[thread] = rate
+		}
+		mining.mu.Unlock()
+	}
+
+	err := cmd.Wait()
+	mining.mu.Lock()
+	defer mining.mu.Unlock()
+	if mining.cpuminer != cmd {
+		return
+	}
+	mining.cpuminer = nil
+	mining.threadRates = make(map[int]float64)
+	mining.lastError = fmt.Sprintf("cpuminer exited: %v", err)
+	log.Debug(mining.lastError)
+	stopMiningFeed()
+}
+
+// startMiningFeed pushes the mining status to the UI while we mine, caller holds mining.mu
+func startMiningFeed() {
+	if mining.feedStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	mining.feedStop = stop
+	go func() {
+		ticker := time.NewTicker(miningFeedInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				status, err := miningInfoStatus()
+				if err != nil {
+					status.Error = err.Error()
+				}
+				websocket.SendEvent(models.MiningEvent{Event: "mining", Status: status})
+			}
+		}
+	}()
+}
+
+// caller holds mining.mu
+func stopMiningFeed() {
+	if mining.feedStop != nil {
+		close(mining.feedStop)
+		mining.feedStop = nil
+	}
+}
+
+// GetMiningStatus reports whether the configured miner is working
+func (bs *BtcService) GetMiningStatus() (bool, error) {
+	mining.mu.Lock()
+	defer mining.mu.Unlock()
+	isMining, err := generating(bs.GetMiningSettings())
+	if err != nil {
+		log.Errorf("Error checking mining status: %v", err)
+		return false, err
+	}
+	return isMining, nil
+}
+
+// StartMining starts mining in the background with threads threads, 0 uses the saved setting
+func (bs *BtcService) StartMining(threads int) string {
+	if threads < 0 {
+		return "threads can't be negative"
+	}
+
+	mining.mu.Lock()
+	defer mining.mu.Unlock()
+	settings := bs.GetMiningSettings()
+	isMining, err := generating(settings)
+	if err != nil {
+		log.Infof("err: %v", err)
+		return "Error checking mining status"
+	}
+	if isMining {
+		log.Info("Mining is already running.")
+		return "mining is running"
+	}
+
+	if threads > 0 {
+		settings.Threads = threads
+		if err := updateTempFile("miningthreads", strconv.Itoa(threads)); err != nil {
+			log.Errorf("Failed to save mining threads: %v", err)
+		}
+	}
+	if err := startGenerating(settings); err != nil {
+		log.Errorf("Error starting mining: %v", err)
+		return fmt.Sprintf("Error starting mining: %s", err.Error())
+	}
+
+	log.Infof("Mining started with %s (%d threads)", settings.Miner, settings.Threads)
+	return "mining started successfully"
+}
+
+// StopMining stops the miner, btcd and btcwallet keep running
+func (bs *BtcService) StopMining() string {
+	mining.mu.Lock()
+	defer mining.mu.Unlock()
+	settings := bs.GetMiningSettings()
+	isMining, err := generating(settings)
+	if err != nil {
+		log.Errorf("Failed to check mining status: %v", err)
+		return "Error checking mining status"
+	}
+	if !isMining {
+		log.Info("Mining is not active. No action needed.")
+		return "Mining is not active"
+	}
+
+	if err := stopGenerating(settings); err != nil {
+		log.Errorf("Error stopping mining: %v", err)
+		return fmt.Sprintf("Error stopping mining: %s", err.Error())
+	}
+	log.Info("Mining stopped.")
+	return "mining stopped successfully"
+}
+
+// GetMiningInfoStatus combines getgenerate, gethashespersec and getmininginfo (or cpuminer's rates) into one status
+func (bs *BtcService) GetMiningInfoStatus() (models.MiningStatus, error) {
+	return miningInfoStatus()
+}
+
+// miningInfoStatus is GetMiningInfoStatus for the mining feed, which runs without a service
+func miningInfoStatus() (models.MiningStatus, error) {
+	settings := miningSettings()
+	status := models.MiningStatus{
+		Miner:     settings.Miner,
+		Threads:   settings.Threads,
+		Address:   settings.Address,
+		UpdatedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	mining.mu.Lock()
+	status.Error = mining.lastError
+	if settings.Miner == MinerCpuminer {
+		status.Generating = mining.cpuminer != nil
+		for _, rate := range mining.threadRates {
+			status.HashesPerSec += rate
+		}
+	}
+	mining.mu.Unlock()
+
+	infoRaw, err := btcdCommand("getmininginfo")
+	if err != nil {
+		return status, err
+	}
+	var info struct {
+		Blocks           int64   `json:"blocks"`
+		CurrentBlockSize int64   `json:"currentblocksize"`
+		Difficulty       float64 `json:"difficulty"`
+		Generate         bool    `json:"generate"`
+		GenProcLimit     int     `json:"genproclimit"`
+		NetworkHashPS    float64 `json:"networkhashps"`
+		PooledTx         int64   `json:"pooledtx"`
+	}
+	if err := json.Unmarshal([]byte(infoRaw), &info); err != nil {
+		return status, fmt.Errorf("failed to parse mining info: %v", err)
+	}
+	status.Blocks = info.Blocks
+	status.CurrentBlockSize = info.CurrentBlockSize
+	status.Difficulty = info.Difficulty
+	status.NetworkHashesPS = info.NetworkHashPS
+	status.PooledTx = info.PooledTx
+
+	if settings.Miner == MinerBtcd {
+		status.Generating = info.Generate
+		if info.Generate && info.GenProcLimit > 0 {
+			status.Threads = info.GenProcLimit
+		}
+		hashes, err := btcdCommand("gethashespersec")
+		if err != nil {
+			return status, err
+		}
+		status.HashesPerSec, _ = strconv.ParseFloat(hashes, 64)
+	}
+	return status, nil
+}
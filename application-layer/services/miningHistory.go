@@ -0,0 +1,311 @@
+package services
+
+import (
+	"application-layer/models"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// the blocks we mined, found by following btcd's block notifications and checking
+// each coinbase for outputs to one of our mining addresses
+var (
+	historyBackfill      int64 = 1000 // blocks looked at the first time, before that we have no history
+	historyRetryInterval       = 10 * time.Second
+)
+
+type minedBlocks struct {
+	mu            sync.Mutex
+	scanMu        sync.Mutex // one scan at a time
+	client        *rpcclient.Client
+	Blocks        []models.MinedBlock `json:"Blocks"`
+	Addresses     []string            `json:"Addresses"` // every mining address we have used, rewards to old ones still count
+	ScannedHeight int64               `json:"ScannedHeight"`
+}
+
+var history = &minedBlocks{}
+
+// kept next to the temp file
+func miningHistoryPath() string {
+	return filepath.Join(filepath.Dir(tempFilePath), "btcd_mining_history.json")
+}
+
+func (h *minedBlocks) load() error {
+	content, err := ioutil.ReadFile(miningHistoryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read mining history: %w", err)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := json.Unmarshal(content, h); err != nil {
+		return fmt.Errorf("failed to parse mining history: %w", err)
+	}
+	return nil
+}
+
+// caller holds h.mu
+func (h *minedBlocks) save() error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mining history: %w", err)
+	}
+	if err := ioutil.WriteFile(miningHistoryPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write mining history: %w", err)
+	}
+	return nil
+}
+
+// WatchMinedBlocks follows btcd's block notifications and records the blocks we mine, it runs until the process exits
+// btcd doesn't have to be up yet, we keep trying to connect and the client reconnects by itself afterwards
+func (bs *BtcService) WatchMinedBlocks() {
+	if err := history.load(); err != nil {
+		log.Infof("WatchMinedBlocks: %v", err)
+	}
+
+	for {
+		client, err := rpcclient.New(&rpcclient.ConnConfig{
+			Host:       "127.0.0.1:8334",
+			Endpoint:   "ws",
+			User:       "user",
+			Pass:       "password",
+			DisableTLS: true,
+		}, &rpcclient.NotificationHandlers{
+			// catch up on what we missed while disconnected
+			OnClientConnected: func() { history.scan() },
+			// handlers can't call the client themselves, the scan runs on its own
+			OnBlockConnected: func(hash *chainhash.Hash, height int32, t time.Time) {
+				go history.scan()
+			},
+			OnBlockDisconnected: func(hash *chainhash.Hash, height int32, t time.Time) {
+				history.disconnected(hash.String(), int64(height))
+			},
+		})
+		if err != nil {
+			log.Infof("WatchMinedBlocks: btcd not reachable, retrying in %s: %v", historyRetryInterval, err)
+			time.Sleep(historyRetryInterval)
+			continue
+		}
+
+		history.mu.Lock()
+		history.client = client
+		history.mu.Unlock()
+		if err := client.NotifyBlocks(); err != nil {
+			log.Errorf("WatchMinedBlocks: failed to register for block notifications: %v", err)
+		}
+		history.scan()
+		client.WaitForShutdown()
+		return
+	}
+}
+
+// scan looks at every block after the last one we scanned
+func (h *minedBlocks) scan() {
+	h.scanMu.Lock()
+	defer h.scanMu.Unlock()
+
+	h.mu.Lock()
+	client := h.client
+	if address := (&BtcService{}).GetMiningSettings().Address; address != "" && !contains(h.Addresses, address) {
+		h.Addresses = append(h.Addresses, address)
+	}
+	addresses := make(map[string]bool)
+	for _, address := range h.Addresses {
+		addresses[address] = true
+	}
+	from := h.ScannedHeight + 1
+	h.mu.Unlock()
+	if client == nil {
+		return
+	}
+
+	tip, err := client.GetBlockCount()
+	if err != nil {
+		log.Errorf("mining history: failed to get block count: %v", err)
+		return
+	}
+	if from == 1 && tip > historyBackfill {
+		from = tip - historyBackfill + 1
+	}
+
+	for height := from; height <= tip; height++ {
+		hash, err := client.GetBlockHash(height)
+		if err != nil {
+			log.Errorf("mining history: failed to get block hash at %d: %v", height, err)
+			break
+		}
+		block, err := client.GetBlock(hash)
+		if err != nil {
+			log.Errorf("mining history: failed to get block %s: %v", hash, err)
+			break
+		}
+
+		h.mu.Lock()
+		if mined, ok := minedBlockFrom(block, height, addresses); ok {
+			h.record(mined)
+			log.Infof("mined block %d (%s), %f BTC to %s", mined.Height, mined.Hash, mined.CoinbaseValue, mined.Address)
+		}
+		h.ScannedHeight = height
+		h.mu.Unlock()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.save(); err != nil {
+		log.Infof("mining history: %v", err)
+	}
+}
+
+// minedBlockFrom returns what the coinbase of block paid to addresses, if anything
+func minedBlockFrom(block *wire.MsgBlock, height int64, addresses map[string]bool) (models.MinedBlock, bool) {
+	if len(block.Transactions) == 0 {
+		return models.MinedBlock{}, false
+	}
+	mined := models.MinedBlock{
+		Height:  height,
+		Hash:    block.BlockHash().String(),
+		MinedAt: block.Header.Timestamp.Format("2006-01-02 15:04:05"),
+	}
+	var paid int64
+	for _, out := range block.Transactions[0].TxOut {
+		_, outAddresses, _, err := txscript.ExtractPkScriptAddrs(out.PkScript, &chaincfg.MainNetParams)
+		if err != nil {
+			continue
+		}
+		for _, address := range outAddresses {
+			if addresses[address.EncodeAddress()] {
+				paid += out.Value
+				mined.Address = address.EncodeAddress()
+				break
+			}
+		}
+	}
+	if paid == 0 {
+		return models.MinedBlock{}, false
+	}
+	mined.CoinbaseValue = btcutil.Amount(paid).ToBTC()
+	return mined, true
+}
+
+// record adds a mined block, or brings back one a reorg took away, caller holds h.mu
+func (h *minedBlocks) record(mined models.MinedBlock) {
+	for i := range h.Blocks {
+		if h.Blocks[i].Hash == mined.Hash {
+			h.Blocks[i].Maturity = ""
+			return
+		}
+	}
+	h.Blocks = append(h.Blocks, mined)
+}
+
+// disconnected marks a block of ours orphaned when a reorg removes it and rescans from there
+func (h *minedBlocks) disconnected(hash string, height int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.Blocks {
+		if h.Blocks[i].Hash == hash {
+			h.Blocks[i].Maturity = "orphaned"
+			log.Infof("mined block %d (%s) was orphaned", height, hash)
+		}
+	}
+	if h.ScannedHeight >= height {
+		h.ScannedHeight = height - 1
+	}
+}
+
+// GetMiningHistory lists the blocks we mined, newest first and at most limit of them when limit > 0, with totals over all of them
+func (bs *BtcService) GetMiningHistory(limit int) models.MiningHistory {
+	history.mu.Lock()
+	client := history.client
+	tip := history.ScannedHeight
+	blocks := append([]models.MinedBlock{}, history.Blocks...)
+	history.mu.Unlock()
+
+	stats := models.MiningStats{Unit: "BTC", ScannedHeight: tip}
+	maturity := int64(chaincfg.MainNetParams.CoinbaseMaturity)
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	var first time.Time
+	for i := range blocks {
+		block := &blocks[i]
+		if block.Maturity == "orphaned" {
+			stats.Orphaned++
+			continue
+		}
+		block.Confirmations = tip - block.Height + 1
+		stats.Blocks++
+		stats.TotalReward += block.CoinbaseValue
+		if block.Confirmations >= maturity {
+			block.Maturity = "mature"
+			stats.Mature++
+			stats.MatureReward += block.CoinbaseValue
+		} else {
+			block.Maturity = "immature"
+			stats.Immature++
+			stats.ImmatureReward += block.CoinbaseValue
+		}
+
+		minedAt, err := time.ParseInLocation("2006-01-02 15:04:05", block.MinedAt, time.Local)
+		if err != nil {
+			continue
+		}
+		if minedAt.After(dayAgo) {
+			stats.BlocksLastDay++
+		}
+		if first.IsZero() || minedAt.Before(first) {
+			first = minedAt
+		}
+	}
+	if !first.IsZero() {
+		days := time.Since(first).Hours() / 24
+		if days < 1 {
+			days = 1
+		}
+		stats.BlocksPerDay = float64(stats.Blocks) / days
+	}
+
+	if client != nil {
+		if networkHashes, err := client.GetNetworkHashPS(); err == nil {
+			stats.NetworkHashesPS = networkHashes
+		} else {
+			log.Errorf("mining history: failed to get network hash rate: %v", err)
+		}
+	}
+	if status, err := bs.GetMiningInfoStatus(); err == nil {
+		stats.HashesPerSec = status.HashesPerSec
+	}
+	if stats.NetworkHashesPS > 0 {
+		stats.EstimatedShare = stats.HashesPerSec / stats.NetworkHashesPS
+		if stats.EstimatedShare > 1 {
+			stats.EstimatedShare = 1
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Height > blocks[j].Height })
+	if limit > 0 && len(blocks) > limit {
+		blocks = blocks[:limit]
+	}
+	return models.MiningHistory{Stats: stats, Blocks: blocks}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
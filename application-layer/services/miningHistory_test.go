@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// go test -v -run ^TestMinedBlockFromCoinbase$ -count=1 application-layer/services
+// TestMinedBlockFromCoinbase checks that only coinbase outputs to our addresses count, no btcd needed.
+func TestMinedBlockFromCoinbase(t *testing.T) {
+	payTo := func(encoded string, value int64) *wire.TxOut {
+		address, err := btcutil.DecodeAddress(encoded, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", encoded, err)
+		}
+		script, err := txscript.PayToAddrScript(address)
+		if err != nil {
+			t.Fatalf("Failed to build script: %v", err)
+		}
+		return wire.NewTxOut(value, script)
+	}
+	ours := "14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc"
+	theirs := "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxOut(payTo(ours, 5000000000))
+	coinbase.AddTxOut(payTo(theirs, 100))
+	block := wire.NewMsgBlock(&wire.BlockHeader{Timestamp: time.Unix(1700000000, 0)})
+	block.AddTransaction(coinbase)
+
+	mined, ok := minedBlockFrom(block, 42, map[string]bool{ours: true})
+	if !ok {
+		t.Fatal("Block paying our address was not recognised")
+	}
+	if mined.Height != 42 || mined.Address != ours || mined.CoinbaseValue != 50 || mined.Hash != block.BlockHash().String() {
+		t.Errorf("Unexpected mined block: %+v", mined)
+	}
+
+	if _, ok := minedBlockFrom(block, 42, map[string]bool{"1111111111111111111114oLvT2": true}); ok {
+		t.Error("Block paying other addresses was counted as ours")
+	}
+}
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"application-layer/models"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// the supervisor owns the btcd and btcwallet processes we start, by their PID, so stopping
+// them never touches another program with a similar name. a child that crashes is started
+// again with growing delays, and its output goes to log files that are rotated by size
+
+var (
+	ErrAlreadyRunning = errors.New("already running")
+	ErrNotRunning     = errors.New("not running")
+)
+
+var (
+	readyTimeout   = 30 * time.Second
+	stopTimeout    = 15 * time.Second
+	minBackoff     = time.Second
+	maxBackoff     = time.Minute
+	stableAfter    = time.Minute // a run this long resets the backoff
+	maxLogSize     = int64(5 << 20)
+	maxLogFiles    = 3
+	processLogsDir = func() string { return filepath.Join(filepath.Dir(tempFilePath), "btc_logs") }
+)
+
+type supervisedProcess struct {
+	name   string
+	path   string
+	port   string       // rpc port, something answering there is running
+	ready  func() error // rpc check, passes once the process serves requests
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	args   []string
+	want   bool          // stop() clears it so the exit isn't taken for a crash
+	done   chan struct{} // closed when the current run exits
+	log    *rotatingLog
+	status models.ProcessStatus
+}
+
+var (
+	btcdProcess = &supervisedProcess{
+		name: "btcd",
+		path: btcdPath,
+		port: "127.0.0.1:8334",
+		ready: func() error {
+			_, err := btcdCommand("getblockcount")
+			return err
+		},
+	}
+	// btcwallet answers getinfo once it has opened the wallet and connected to btcd,
+	// its port opens before that
+	btcwalletProcess = &supervisedProcess{
+		name: "btcwallet",
+		path: btcwalletPath,
+		port: "127.0.0.1:8332",
+		ready: func() error {
+			_, err := walletCommand("getinfo")
+			return err
+		},
+	}
+)
+
+// Running reports whether the process is up, ours or one answering on its port
+func (p *supervisedProcess) Running() bool {
+	p.mu.Lock()
+	owned := p.cmd != nil
+	p.mu.Unlock()
+	return owned || p.external()
+}
+
+// external reports whether something we didn't start listens on our port
+func (p *supervisedProcess) external() bool {
+	p.mu.Lock()
+	owned := p.cmd != nil
+	p.mu.Unlock()
+	return !owned && listening(p.port)
+}
+
+func listening(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (p *supervisedProcess) Status() models.ProcessStatus {
+	p.mu.Lock()
+	status := p.status
+	owned := p.cmd != nil || p.want
+	p.mu.Unlock()
+	status.Name = p.name
+	if status.State == "" {
+		status.State = "stopped"
+	}
+	if !owned && p.external() {
+		status.State = "external"
+		status.PID = 0
+	}
+	return status
+}
+
+// start runs the process and waits until it answers rpc, a process that never gets ready is stopped again
+// the lock is held from checking want until the process is launched, so two starts can't both launch it
+func (p *supervisedProcess) start(args []string) (models.ProcessStatus, error) {
+	p.mu.Lock()
+	if p.want {
+		p.mu.Unlock()
+		return p.Status(), fmt.Errorf("%s is %w", p.name, ErrAlreadyRunning)
+	}
+	if p.cmd == nil && listening(p.port) {
+		p.mu.Unlock()
+		return p.Status(), fmt.Errorf("%s is %w, started outside of this app", p.name, ErrAlreadyRunning)
+	}
+
+	logFile := filepath.Join(processLogsDir(), p.name+".log")
+	out, err := openRotatingLog(logFile)
+	if err != nil {
+		p.mu.Unlock()
+		return p.Status(), err
+	}
+	if p.log != nil {
+		p.log.Close()
+	}
+	p.want = true
+	p.args = args
+	p.log = out
+	p.status = models.ProcessStatus{Name: p.name, State: "starting", Args: args, LogFile: logFile}
+	err = p.launch()
+	if err != nil {
+		// nothing runs to stop, launch already marked it failed
+		p.want = false
+		p.closeLog()
+		p.mu.Unlock()
+		return p.Status(), err
+	}
+	p.mu.Unlock()
+
+	if err := p.waitReady(); err != nil {
+		p.stop()
+		p.mu.Lock()
+		p.status.State = "failed"
+		p.mu.Unlock()
+		return p.Status(), err
+	}
+	return p.Status(), nil
+}
+
+// launch starts one run of the process, caller holds p.mu
+func (p *supervisedProcess) launch() error {
+	cmd := exec.Command(p.path, p.args...)
+	if runtime.GOOS == "darwin" {
+		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
+	}
+	cmd.Stdout = p.log
+	cmd.Stderr = p.log
+	if err := cmd.Start(); err != nil {
+		p.status.State = "failed"
+		p.status.LastExit = err.Error()
+		return fmt.Errorf("error starting %s: %v", p.name, err)
+	}
+	log.Infof("%s started with PID: %d", p.name, cmd.Process.Pid)
+
+	done := make(chan struct{})
+	p.cmd = cmd
+	p.done = done
+	p.status.PID = cmd.Process.Pid
+	p.status.StartedAt = time.Now().Format("2006-01-02 15:04:05")
+	go p.supervise(cmd, done)
+	return nil
+}
+
+// supervise waits for a run to end and starts the next one if nobody asked it to stop
+func (p *supervisedProcess) supervise(cmd *exec.Cmd, done chan struct{}) {
+	started := time.Now()
+	err := cmd.Wait()
+
+	exit := "exited"
+	if err != nil {
+		exit = err.Error()
+	}
+	log.Infof("%s (PID %d) %s", p.name, cmd.Process.Pid, exit)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// anyone waiting on done sees how the run ended
+	defer close(done)
+	if p.cmd != cmd {
+		return
+	}
+	p.cmd = nil
+	p.status.PID = 0
+	p.status.LastExit = exit
+	if !p.want {
+		p.status.State = "stopped"
+		return
+	}
+
+	// crashed, try again after a while
+	backoff := minBackoff << p.status.Restarts
+	if time.Since(started) > stableAfter {
+		p.status.Restarts = 0
+		backoff = minBackoff
+	}
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	p.status.Restarts++
+	p.status.State = "restarting"
+	log.Infof("%s crashed, restarting in %s", p.name, backoff)
+	go func() {
+		time.Sleep(backoff)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if !p.want || p.cmd != nil {
+			return
+		}
+		if err := p.launch(); err != nil {
+			log.Debug(err)
+			return
+		}
+		p.status.State = "starting"
+		go func() {
+			if err := p.waitReady(); err != nil {
+				log.Infof("%s did not come back: %v", p.name, err)
+			}
+		}()
+	}()
+}
+
+// waitReady polls the rpc check until it passes or readyTimeout runs out
+func (p *supervisedProcess) waitReady() error {
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		p.mu.Lock()
+		done := p.done
+		p.mu.Unlock()
+
+		err := p.ready()
+		if err == nil {
+			p.mu.Lock()
+			if p.cmd != nil {
+				p.status.State = "running"
+			}
+			p.mu.Unlock()
+			log.Infof("%s is ready", p.name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not answer rpc within %s: %v", p.name, readyTimeout, err)
+		}
+		select {
+		case <-done:
+			p.mu.Lock()
+			exit := p.status.LastExit
+			p.mu.Unlock()
+			return fmt.Errorf("%s exited before it was ready: %s", p.name, exit)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// stop ends our process, politely first, and waits for it to exit
+func (p *supervisedProcess) stop() (models.ProcessStatus, error) {
+	p.mu.Lock()
+	wasWanted := p.want
+	p.want = false
+	cmd, done := p.cmd, p.done
+	p.mu.Unlock()
+
+	if cmd == nil {
+		if wasWanted {
+			// waiting to be restarted
+			p.mu.Lock()
+			p.status.State = "stopped"
+			p.closeLog()
+			p.mu.Unlock()
+			return p.Status(), nil
+		}
+		if p.external() {
+			return p.Status(), fmt.Errorf("%s was started outside of this app, not stopping it", p.name)
+		}
+		return p.Status(), fmt.Errorf("%s is %w", p.name, ErrNotRunning)
+	}
+
+	// windows can't deliver an interrupt to another process
+	if runtime.GOOS == "windows" {
+		cmd.Process.Kill()
+	} else if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		log.Infof("%s did not exit within %s, killing it", p.name, stopTimeout)
+		cmd.Process.Kill()
+		<-done
+	}
+
+	// supervise has seen the exit by the time done is closed only if it got the lock, make sure of the state
+	p.mu.Lock()
+	if p.cmd == cmd {
+		p.cmd = nil
+		p.status.PID = 0
+	}
+	p.status.State = "stopped"
+	p.closeLog()
+	p.mu.Unlock()
+	log.Infof("%s stopped", p.name)
+	return p.Status(), nil
+}
+
+// closeLog closes the log once the process is stopped for good, caller holds p.mu
+func (p *supervisedProcess) closeLog() {
+	if p.log != nil {
+		p.log.Close()
+		p.log = nil
+	}
+}
+
+// GetProcessStatus reports btcd and btcwallet as the supervisor sees them
+func (bs *BtcService) GetProcessStatus() []models.ProcessStatus {
+	return []models.ProcessStatus{btcdProcess.Status(), btcwalletProcess.Status()}
+}
+
+// rotatingLog is a log file that moves to name.1, name.2, ... once it grows past maxLogSize
+type rotatingLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+func openRotatingLog(path string) (*rotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	return &rotatingLog{path: path, file: file, size: info.Size()}, nil
+}
+
+func (l *rotatingLog) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size+int64(len(data)) > maxLogSize {
+		if err := l.rotate(); err != nil {
+			log.Errorf("failed to rotate %s: %v", l.path, err)
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *rotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// caller holds l.mu
+func (l *rotatingLog) rotate() error {
+	l.file.Close()
+	for i := maxLogFiles - 1; i > 0; i-- {
+		older := fmt.Sprintf("%s.%d", l.path, i)
+		if i == 1 {
+			os.Rename(l.path, older)
+			continue
+		}
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i-1), older)
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = 0
+	return nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -v -run ^TestSupervisor$ -count=1 application-layer/services
+// TestSupervisor runs a stand-in child to check restarts after a crash and stopping by PID, no btcd needed.
+func TestSupervisor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	logsDir := t.TempDir()
+	oldLogsDir, oldBackoff := processLogsDir, minBackoff
+	processLogsDir = func() string { return logsDir }
+	minBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { processLogsDir, minBackoff = oldLogsDir, oldBackoff })
+
+	child := &supervisedProcess{
+		name: "child",
+		path: "/bin/sh",
+		port: "127.0.0.1:1", // nothing listens there, so nothing counts as external
+	}
+	// ready once the current run has said so in the log
+	child.ready = func() error {
+		data, _ := os.ReadFile(filepath.Join(logsDir, "child.log"))
+		if strings.Count(string(data), "started") <= child.Status().Restarts {
+			return errors.New("not started yet")
+		}
+		return nil
+	}
+	status, err := child.start([]string{"-c", "echo started; exec sleep 30"})
+	if err != nil || status.State != "running" || status.PID == 0 {
+		t.Fatalf("start: %+v, %v", status, err)
+	}
+	if _, err := child.start(nil); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second start: %v", err)
+	}
+
+	// a crash gets a new process
+	crashed, _ := os.FindProcess(status.PID)
+	crashed.Kill()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		restarted := child.Status()
+		if restarted.State == "running" && restarted.PID != 0 && restarted.PID != status.PID {
+			if restarted.Restarts != 1 {
+				t.Errorf("restarts = %d, want 1", restarted.Restarts)
+			}
+			status = restarted
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("child was not restarted: %+v", restarted)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped, err := child.stop()
+	if err != nil || stopped.State != "stopped" || stopped.PID != 0 {
+		t.Errorf("stop: %+v, %v", stopped, err)
+	}
+	if _, err := child.stop(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("second stop: %v", err)
+	}
+	if child.log != nil {
+		t.Errorf("log still open after stop")
+	}
+	if data, err := os.ReadFile(filepath.Join(logsDir, "child.log")); err != nil || string(data) != "started\nstarted\n" {
+		t.Errorf("log = %q, %v", data, err)
+	}
+
+	// of two starts at once only one launches the child
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := child.start([]string{"-c", "echo started; exec sleep 30"})
+			results <- err
+		}()
+	}
+	first, second := <-results, <-results
+	if (first == nil) == (second == nil) || !errors.Is(first, ErrAlreadyRunning) && !errors.Is(second, ErrAlreadyRunning) {
+		t.Errorf("concurrent starts: %v, %v", first, second)
+	}
+	if _, err := child.stop(); err != nil {
+		t.Errorf("stop after concurrent starts: %v", err)
+	}
+
+	// a child that can't be launched stays failed, nothing is left to stop
+	missing := &supervisedProcess{name: "missing", path: filepath.Join(logsDir, "no-such-binary"), port: "127.0.0.1:1", ready: func() error { return nil }}
+	if failed, err := missing.start(nil); err == nil || failed.State != "failed" || missing.log != nil {
+		t.Errorf("start of a missing binary: %+v, %v, log open %v", failed, err, missing.log != nil)
+	}
+
+	// logs move aside once they grow too big
+	oldMaxLogSize := maxLogSize
+	maxLogSize = 10
+	t.Cleanup(func() { maxLogSize = oldMaxLogSize })
+	log, err := openRotatingLog(filepath.Join(logsDir, "rotating.log"))
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	defer log.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		log.Write([]byte(line))
+	}
+	if data, _ := os.ReadFile(filepath.Join(logsDir, "rotating.log.2")); string(data) != "first\n" {
+		t.Errorf("oldest rotated log = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(logsDir, "rotating.log")); string(data) != "third\n" {
+		t.Errorf("current log = %q", data)
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"application-layer/models"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/scrypt"
+)
+
+// the wallet seed is a BIP39 mnemonic, the user writes the words down at signup and can
+// recreate the wallet from them. wallet.db itself is backed up encrypted with a key
+// derived from the wallet passphrase, backups live next to the temp file
+
+var (
+	ErrInvalidMnemonic = errors.New("invalid seed phrase")
+	ErrWrongPassphrase = errors.New("wrong passphrase or damaged backup")
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrNoWallet        = errors.New("no wallet to back up")
+	// wallet.db is only ever copied encrypted, so replacing or deleting it needs the passphrase too
+	ErrPassphraseRequired = errors.New("passphrase is required to back up the wallet")
+)
+
+const (
+	mnemonicBits   = 256           // 24 words
+	backupMagic    = "ORCAWALLET1" // start of every encrypted backup
+	backupSaltSize = 16
+	backupKeySize  = 32
+	// the words don't say when the wallet was first used, a restored wallet rescans the whole chain
+	restoredWalletBirthday = "genesis"
+)
+
+// scrypt cost, lowered by the tests
+var (
+	backupScryptN = 1 << 15
+	backupScryptR = 8
+	backupScryptP = 1
+)
+
+func walletBackupsDir() string {
+	return filepath.Join(filepath.Dir(tempFilePath), "wallet_backups")
+}
+
+// newMnemonic returns fresh seed words and the wallet seed they stand for, hex encoded for btcwallet
+func newMnemonic() (string, string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicBits)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate entropy: %w", err)
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate seed phrase: %w", err)
+	}
+	return mnemonic, hex.EncodeToString(bip39.NewSeed(mnemonic, "")), nil
+}
+
+// seedFromMnemonic checks the words and their checksum and returns the hex wallet seed
+func seedFromMnemonic(mnemonic string) (string, error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	// IsMnemonicValid only looks the words up, this also checks the checksum
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return "", ErrInvalidMnemonic
+	}
+	return hex.EncodeToString(seed), nil
+}
+
+// RestoreWallet recreates the wallet from its seed words, replacing the current one
+// btcwallet is left running, on its first start it scans the chain for the funds of the restored addresses.
+// the wallet and mining move to a new address of the restored wallet
+func (bs *BtcService) RestoreWallet(mnemonic, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", ErrPassphraseRequired
+	}
+	seed, err := seedFromMnemonic(mnemonic)
+	if err != nil {
+		return "", err
+	}
+	dbPath, err := walletDBPath()
+	if err != nil {
+		return "", err
+	}
+
+	wasRunning := btcwalletProcess.Running()
+	if wasRunning {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			return "", fmt.Errorf("failed to stop btcwallet: %w", err)
+		}
+	}
+	// the wallet we replace is backed up and moved aside, btcwallet refuses to create over it anyway.
+	// it is only dropped once the restored wallet runs, until then a failure puts it back
+	replaced := dbPath + ".replaced"
+	replacing := false
+	if _, err := os.Stat(dbPath); err == nil {
+		if _, err := bs.backupWalletFile(passphrase, "replaced"); err != nil {
+			return "", err
+		}
+		if err := os.Rename(dbPath, replaced); err != nil {
+			return "", fmt.Errorf("failed to move current wallet aside: %w", err)
+		}
+		replacing = true
+	}
+	fail := func(err error) (string, error) {
+		if btcwalletProcess.Running() {
+			bs.StopBtcwallet()
+		}
+		// whatever got created here goes, the wallet we had was moved aside or there was none
+		os.Remove(dbPath)
+		if replacing {
+			if renameErr := os.Rename(replaced, dbPath); renameErr != nil {
+				log.Errorf("RestoreWallet: failed to put the previous wallet back from %s: %v", replaced, renameErr)
+				return "", err
+			}
+		}
+		if wasRunning {
+			if _, startErr := bs.StartBtcwallet(); startErr != nil {
+				log.Errorf("RestoreWallet: failed to restart btcwallet on the previous wallet: %v", startErr)
+			}
+		}
+		return "", err
+	}
+
+	if !btcdProcess.Running() {
+		if _, err := bs.StartBtcd(); err != nil {
+			return fail(fmt.Errorf("failed to start btcd: %w", err))
+		}
+	}
+	if err := bs.BtcwalletCreate(passphrase, seed, restoredWalletBirthday); err != nil {
+		return fail(err)
+	}
+	if _, err := bs.StartBtcwallet(); err != nil {
+		return fail(fmt.Errorf("failed to start btcwallet: %w", err))
+	}
+	if replacing {
+		if err := os.Remove(replaced); err != nil {
+			log.Errorf("RestoreWallet: failed to remove the replaced wallet %s: %v", replaced, err)
+		}
+	}
+	log.Info("Wallet restored from seed phrase, btcwallet is rescanning the chain.")
+	message := "Wallet restored. btcwallet is rescanning the chain for its funds."
+
+	// the old mining address belongs to the wallet we replaced
+	address, err := bs.GetNewAddress()
+	if err != nil {
+		log.Errorf("RestoreWallet: failed to get an address of the restored wallet: %v", err)
+		return message + " Mining address not switched.", nil
+	}
+	if err := updateWallets(func(registry *walletRegistry) {
+		registry.entry(registry.Active).MiningAddress = address
+	}); err != nil {
+		log.Errorf("RestoreWallet: %v", err)
+	}
+	if settings := bs.GetMiningSettings(); settings.Address != "" && settings.Address != address {
+		settings.Address = address
+		if updated, err := bs.SetMiningSettings(settings); err != nil {
+			message += fmt.Sprintf(" Mining address not switched: %v", err)
+		} else {
+			message += fmt.Sprintf(" Mining to %s with %s.", updated.Address, updated.Miner)
+		}
+	}
+	return message, nil
+}
+
+// BackupWallet writes an encrypted copy of wallet.db to the backups directory
+func (bs *BtcService) BackupWallet(passphrase string) (models.WalletBackup, error) {
+	if passphrase == "" {
+		return models.WalletBackup{}, ErrPassphraseRequired
+	}
+	// bolt may be in the middle of a write while btcwallet runs, so a wallet of ours is stopped for the copy
+	restart := false
+	if btcwalletProcess.Status().State == "running" {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			return models.WalletBackup{}, fmt.Errorf("failed to stop btcwallet: %w", err)
+		}
+		restart = true
+	}
+	backup, err := bs.backupWalletFile(passphrase, "backup")
+	if restart {
+		if _, startErr := bs.StartBtcwallet(); startErr != nil {
+			log.Errorf("BackupWallet: failed to restart btcwallet: %v", startErr)
+		}
+	}
+	return backup, err
+}
+
+// backupWalletFile copies wallet.db into the backups directory, encrypted with passphrase
+func (bs *BtcService) backupWalletFile(passphrase, kind string) (models.WalletBackup, error) {
+	if passphrase == "" {
+		return models.WalletBackup{}, ErrPassphraseRequired
+	}
+	dbPath, err := walletDBPath()
+	if err != nil {
+		return models.WalletBackup{}, err
+	}
+	content, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return models.WalletBackup{}, ErrNoWallet
+		}
+		return models.WalletBackup{}, fmt.Errorf("failed to read wallet: %w", err)
+	}
+
+	name := fmt.Sprintf("wallet-%s-%s-%s.db.enc", activeWallet(), kind, time.Now().Format("20060102-150405"))
+	if content, err = encryptBackup(content, passphrase); err != nil {
+		return models.WalletBackup{}, err
+	}
+	if err := os.MkdirAll(walletBackupsDir(), 0700); err != nil {
+		return models.WalletBackup{}, fmt.Errorf("failed to create backups directory: %w", err)
+	}
+	path := filepath.Join(walletBackupsDir(), name)
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return models.WalletBackup{}, fmt.Errorf("failed to write backup: %w", err)
+	}
+	log.Infof("Wallet backed up to %s", path)
+	return walletBackupInfo(path)
+}
+
+// ListWalletBackups lists the backups, newest first
+func (bs *BtcService) ListWalletBackups() ([]models.WalletBackup, error) {
+	entries, err := ioutil.ReadDir(walletBackupsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.WalletBackup{}, nil
+		}
+		return nil, fmt.Errorf("failed to read backups directory: %w", err)
+	}
+	backups := []models.WalletBackup{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "wallet-") {
+			continue
+		}
+		backup, err := walletBackupInfo(filepath.Join(walletBackupsDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt > backups[j].CreatedAt })
+	return backups, nil
+}
+
+// RestoreWalletBackup puts a backup back in place of wallet.db, the current wallet is backed up first
+// with passphrase, which is needed for that even when the backup itself isn't encrypted
+func (bs *BtcService) RestoreWalletBackup(name, passphrase string) (models.WalletBackup, error) {
+	// only plain names, a backup can't point outside the backups directory
+	if name == "" || filepath.Base(name) != name {
+		return models.WalletBackup{}, ErrBackupNotFound
+	}
+	path := filepath.Join(walletBackupsDir(), name)
+	backup, err := walletBackupInfo(path)
+	if err != nil {
+		return models.WalletBackup{}, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return models.WalletBackup{}, fmt.Errorf("failed to read backup: %w", err)
+	}
+	if backup.Encrypted {
+		if content, err = decryptBackup(content, passphrase); err != nil {
+			return models.WalletBackup{}, err
+		}
+	}
+
+	dbPath, err := walletDBPath()
+	if err != nil {
+		return models.WalletBackup{}, err
+	}
+	restart := false
+	if btcwalletProcess.Status().State == "running" {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			return models.WalletBackup{}, fmt.Errorf("failed to stop btcwallet: %w", err)
+		}
+		restart = true
+	}
+	if _, err := bs.backupWalletFile(passphrase, "replaced"); err != nil && !errors.Is(err, ErrNoWallet) {
+		if restart {
+			bs.StartBtcwallet()
+		}
+		return models.WalletBackup{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		return models.WalletBackup{}, fmt.Errorf("failed to create wallet directory: %w", err)
+	}
+	// written next to it first so a failed write never leaves half a wallet
+	if err := ioutil.WriteFile(dbPath+".restore", content, 0600); err != nil {
+		return models.WalletBackup{}, fmt.Errorf("failed to write wallet: %w", err)
+	}
+	if err := os.Rename(dbPath+".restore", dbPath); err != nil {
+		return models.WalletBackup{}, fmt.Errorf("failed to replace wallet: %w", err)
+	}
+	log.Infof("Wallet restored from %s", path)
+
+	if restart {
+		if _, err := bs.StartBtcwallet(); err != nil {
+			return backup, fmt.Errorf("wallet restored but btcwallet did not start: %w", err)
+		}
+	}
+	return backup, nil
+}
+
+func walletBackupInfo(path string) (models.WalletBackup, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return models.WalletBackup{}, ErrBackupNotFound
+		}
+		return models.WalletBackup{}, fmt.Errorf("failed to stat backup: %w", err)
+	}
+	return models.WalletBackup{
+		Name:      info.Name(),
+		Size:      info.Size(),
+		Encrypted: strings.HasSuffix(info.Name(), ".enc"),
+		CreatedAt: info.ModTime().Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+// encryptBackup seals data with AES-GCM under a scrypt key, the layout is magic | salt | nonce | ciphertext
+func encryptBackup(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header := append(append([]byte(backupMagic), salt...), nonce...)
+	// the header is authenticated along with the wallet
+	return gcm.Seal(header, nonce, data, header), nil
+}
+
+func decryptBackup(sealed []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, []byte(backupMagic)) || len(sealed) < len(backupMagic)+backupSaltSize {
+		return nil, ErrWrongPassphrase
+	}
+	salt := sealed[len(backupMagic) : len(backupMagic)+backupSaltSize]
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(backupMagic) + backupSaltSize + gcm.NonceSize()
+	if len(sealed) < headerSize {
+		return nil, ErrWrongPassphrase
+	}
+	nonce := sealed[headerSize-gcm.NonceSize() : headerSize]
+	data, err := gcm.Open(nil, nonce, sealed[headerSize:], sealed[:headerSize])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return data, nil
+}
+
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, backupScryptN, backupScryptR, backupScryptP, backupKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
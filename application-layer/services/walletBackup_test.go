@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// go test -v -run ^TestWalletBackupRoundTrip$ -count=1 application-layer/services
+// TestWalletBackupRoundTrip backs up and restores a fake wallet.db in a temp home, no btcd or btcwallet needed.
+func TestWalletBackupRoundTrip(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("wallet path under a temp home is only set up for linux")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	oldTempFilePath, oldN := tempFilePath, backupScryptN
+	tempFilePath = filepath.Join(home, "btcd_temp.json")
+	backupScryptN = 1 << 10
+	defer func() { tempFilePath, backupScryptN = oldTempFilePath, oldN }()
+
+	// seed phrases have a checksum, a changed word is caught
+	mnemonic, seed, err := newMnemonic()
+	if err != nil {
+		t.Fatalf("newMnemonic failed: %v", err)
+	}
+	if words := strings.Fields(mnemonic); len(words) != 24 {
+		t.Fatalf("Expected 24 words, got %d", len(words))
+	}
+	if restored, err := seedFromMnemonic("  " + strings.ToUpper(mnemonic) + "\n"); err != nil || restored != seed {
+		t.Fatalf("Seed phrase did not give back the same seed: %v", err)
+	}
+	words := strings.Fields(mnemonic)
+	words[0], words[1] = words[1], words[0]
+	if words[0] != words[1] {
+		if _, err := seedFromMnemonic(strings.Join(words, " ")); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("Expected ErrInvalidMnemonic for swapped words, got %v", err)
+		}
+	}
+
+	bs := &BtcService{}
+	if _, err := bs.backupWalletFile("", "backup"); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Expected a backup without a passphrase to be refused, got %v", err)
+	}
+	if _, err := bs.backupWalletFile("secret", "backup"); !errors.Is(err, ErrNoWallet) {
+		t.Fatalf("Expected ErrNoWallet without a wallet, got %v", err)
+	}
+
+	dbPath, _ := walletDBPath()
+	os.MkdirAll(filepath.Dir(dbPath), 0700)
+	original := []byte("wallet contents")
+	ioutil.WriteFile(dbPath, original, 0600)
+
+	backup, err := bs.backupWalletFile("secret", "backup")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if !backup.Encrypted {
+		t.Errorf("Expected an encrypted backup, got %+v", backup)
+	}
+	sealed, _ := ioutil.ReadFile(filepath.Join(walletBackupsDir(), backup.Name))
+	if strings.Contains(string(sealed), string(original)) {
+		t.Errorf("Backup holds the wallet in the clear")
+	}
+
+	ioutil.WriteFile(dbPath, []byte("changed since"), 0600)
+	if _, err := bs.RestoreWalletBackup(backup.Name, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+	if _, err := bs.RestoreWalletBackup("../btcd_temp.json", "secret"); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("Expected ErrBackupNotFound for a path outside the backups, got %v", err)
+	}
+	if _, err := bs.RestoreWalletBackup(backup.Name, "secret"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored, _ := ioutil.ReadFile(dbPath); string(restored) != string(original) {
+		t.Errorf("Expected %q after restore, got %q", original, restored)
+	}
+
+	// a plain backup is restored too, but not over a wallet it can't keep an encrypted copy of
+	plain := filepath.Join(walletBackupsDir(), "wallet-default-backup-20200101-000000.db")
+	ioutil.WriteFile(plain, []byte("old plain backup"), 0600)
+	if _, err := bs.RestoreWalletBackup(filepath.Base(plain), ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Expected ErrPassphraseRequired replacing the wallet without a passphrase, got %v", err)
+	}
+	if current, _ := ioutil.ReadFile(dbPath); string(current) != string(original) {
+		t.Errorf("Expected the wallet untouched by a refused restore, got %q", current)
+	}
+
+	// the wallet that was replaced is kept as well, never in the clear
+	backups, err := bs.ListWalletBackups()
+	if err != nil {
+		t.Fatalf("ListWalletBackups failed: %v", err)
+	}
+	if len(backups) < 3 {
+		t.Errorf("Expected the backups and the replaced wallet, got %+v", backups)
+	}
+	for _, backup := range backups {
+		if !backup.Encrypted && backup.Name != filepath.Base(plain) {
+			t.Errorf("Expected every copy we made to be encrypted, got %+v", backup)
+		}
+	}
+}
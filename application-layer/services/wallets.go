@@ -0,0 +1,491 @@
+package services
+
+import (
+	"application-layer/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// several named wallets per install. the default wallet stays in btcwallet's usual data directory,
+// every other one gets its own directory under wallets/ in there and btcwallet is started with
+// --appdata pointing at it. only btcwallet is restarted to switch, btcd keeps running.
+// which wallet and account are in use, and each wallet's mining address, are kept in a registry
+// next to the temp file
+
+const defaultWalletName = "default"
+const defaultAccountName = "default"
+
+var (
+	ErrWalletNotFound = errors.New("wallet not found")
+	ErrWalletExists   = errors.New("wallet already exists")
+	ErrAccountUnknown = errors.New("account not found")
+)
+
+var walletNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// checkWalletName refuses names that aren't a plain directory name, e.g. ../.. would point --appdata
+// outside the wallets directory
+func checkWalletName(name string) error {
+	if !walletNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid wallet name %q, use up to 32 letters, digits, - or _", name)
+	}
+	return nil
+}
+
+// one at a time through the registry file
+var walletsMu sync.Mutex
+
+type walletRegistry struct {
+	Active  string                  `json:"Active"`
+	Wallets map[string]*walletEntry `json:"Wallets"`
+}
+
+type walletEntry struct {
+	Account       string `json:"Account"`
+	MiningAddress string `json:"MiningAddress"`
+	CreatedAt     string `json:"CreatedAt"`
+}
+
+func walletsPath() string {
+	return filepath.Join(filepath.Dir(tempFilePath), "btc_wallets.json")
+}
+
+// loadWallets reads the registry, a missing or broken file gives just the default wallet
+func loadWallets() *walletRegistry {
+	registry := &walletRegistry{Active: defaultWalletName, Wallets: map[string]*walletEntry{}}
+	content, err := ioutil.ReadFile(walletsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("failed to read wallet registry: %v", err)
+		}
+		return registry
+	}
+	if err := json.Unmarshal(content, registry); err != nil {
+		log.Errorf("failed to parse wallet registry: %v", err)
+	}
+	if registry.Active == "" {
+		registry.Active = defaultWalletName
+	}
+	if registry.Wallets == nil {
+		registry.Wallets = map[string]*walletEntry{}
+	}
+	return registry
+}
+
+func (r *walletRegistry) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal wallet registry: %w", err)
+	}
+	if err := ioutil.WriteFile(walletsPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write wallet registry: %w", err)
+	}
+	return nil
+}
+
+// entry returns the wallet's record, adding an empty one if there is none yet
+func (r *walletRegistry) entry(name string) *walletEntry {
+	if r.Wallets[name] == nil {
+		r.Wallets[name] = &walletEntry{Account: defaultAccountName}
+	}
+	if r.Wallets[name].Account == "" {
+		r.Wallets[name].Account = defaultAccountName
+	}
+	return r.Wallets[name]
+}
+
+func activeWallet() string {
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+	return loadWallets().Active
+}
+
+func activeAccount() string {
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+	registry := loadWallets()
+	return registry.entry(registry.Active).Account
+}
+
+// updateWallets changes the registry under walletsMu and saves it
+func updateWallets(change func(registry *walletRegistry)) error {
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+	registry := loadWallets()
+	change(registry)
+	return registry.save()
+}
+
+// btcwalletAppData is btcwallet's default data directory on this OS
+func btcwalletAppData() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		userProfile := os.Getenv("USERPROFILE")
+		if userProfile == "" {
+			return "", fmt.Errorf("could not determine user profile path on Windows")
+		}
+		return filepath.Join(userProfile, "AppData", "Local", "Btcwallet"), nil
+	case "darwin":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		return filepath.Join(homeDir, "Library", "Application Support", "Btcwallet"), nil
+	case "linux":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		return filepath.Join(homeDir, ".btcwallet"), nil
+	}
+	return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+}
+
+// walletAppData is the data directory of a named wallet
+func walletAppData(name string) (string, error) {
+	appData, err := btcwalletAppData()
+	if err != nil {
+		return "", err
+	}
+	if name == defaultWalletName {
+		return appData, nil
+	}
+	return filepath.Join(appData, "wallets", name), nil
+}
+
+// walletDBPath is where btcwallet keeps the mainnet database of the active wallet
+func walletDBPath() (string, error) {
+	return walletDBPathFor(activeWallet())
+}
+
+func walletDBPathFor(name string) (string, error) {
+	appData, err := walletAppData(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appData, "mainnet", "wallet.db"), nil
+}
+
+// btcwalletArgs are the flags btcwallet runs with for the active wallet
+func btcwalletArgs() []string {
+	args := []string{
+		"--btcdusername=user",
+		"--btcdpassword=password",
+		"--rpcconnect=127.0.0.1:8334",
+		"--noclienttls",
+		"--noservertls",
+		"--username=user",
+		"--password=password",
+	}
+	if name := activeWallet(); name != defaultWalletName {
+		if appData, err := walletAppData(name); err == nil {
+			args = append(args, "--appdata="+appData)
+		}
+	}
+	return args
+}
+
+// walletCommand runs btcctl against btcwallet's rpc server and returns its trimmed output
+func walletCommand(args ...string) (string, error) {
+	cmd := exec.Command(
+		btcctlPath,
+		append([]string{
+			"--wallet",
+			"--rpcuser=user",
+			"--rpcpass=password",
+			"--rpcserver=127.0.0.1:8332",
+			"--notls",
+		}, args...)...,
+	)
+
+	// Add macOS-specific environment setup
+	if runtime.GOOS == "darwin" {
+		cmd.Env = append(os.Environ(), "PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin")
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := runBtcctl(cmd); err != nil {
+		return "", fmt.Errorf("error executing btcctl %s: %w: %s", args[0], err, strings.TrimSpace(output.String()))
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+func walletInfo(registry *walletRegistry, name string) models.WalletInfo {
+	entry := registry.entry(name)
+	info := models.WalletInfo{
+		Name:          name,
+		Active:        name == registry.Active,
+		Account:       entry.Account,
+		MiningAddress: entry.MiningAddress,
+		CreatedAt:     entry.CreatedAt,
+	}
+	if appData, err := walletAppData(name); err == nil {
+		info.AppDataDir = appData
+	}
+	if dbPath, err := walletDBPathFor(name); err == nil {
+		_, err := os.Stat(dbPath)
+		info.Exists = err == nil
+	}
+	return info
+}
+
+// ListWallets lists the default wallet, the ones in the registry and any found in the wallets directory
+func (bs *BtcService) ListWallets() []models.WalletInfo {
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+	registry := loadWallets()
+
+	names := map[string]bool{defaultWalletName: true}
+	for name := range registry.Wallets {
+		names[name] = true
+	}
+	if appData, err := btcwalletAppData(); err == nil {
+		entries, _ := ioutil.ReadDir(filepath.Join(appData, "wallets"))
+		for _, entry := range entries {
+			if entry.IsDir() && walletNamePattern.MatchString(entry.Name()) {
+				names[entry.Name()] = true
+			}
+		}
+	}
+
+	wallets := []models.WalletInfo{}
+	for name := range names {
+		wallets = append(wallets, walletInfo(registry, name))
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Name < wallets[j].Name })
+	return wallets
+}
+
+// CreateNamedWallet creates another wallet from a new seed phrase and switches to it
+// btcd is started if it isn't running and is left running, like switching
+func (bs *BtcService) CreateNamedWallet(name, passphrase string) (models.WalletInfo, string, error) {
+	if err := checkWalletName(name); err != nil {
+		return models.WalletInfo{}, "", err
+	}
+	dbPath, err := walletDBPathFor(name)
+	if err != nil {
+		return models.WalletInfo{}, "", err
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		return models.WalletInfo{}, "", fmt.Errorf("%s: %w", name, ErrWalletExists)
+	}
+	mnemonic, seed, err := newMnemonic()
+	if err != nil {
+		return models.WalletInfo{}, "", err
+	}
+
+	if !btcdProcess.Running() {
+		if _, err := bs.StartBtcd(); err != nil {
+			return models.WalletInfo{}, "", fmt.Errorf("failed to start btcd: %w", err)
+		}
+	}
+	if btcwalletProcess.Running() {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			return models.WalletInfo{}, "", fmt.Errorf("failed to stop btcwallet: %w", err)
+		}
+	}
+
+	previous := activeWallet()
+	if err := updateWallets(func(registry *walletRegistry) {
+		registry.Active = name
+		registry.entry(name).CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	}); err != nil {
+		return models.WalletInfo{}, "", err
+	}
+	// back to the wallet we had if this one can't be made
+	fail := func(err error) (models.WalletInfo, string, error) {
+		updateWallets(func(registry *walletRegistry) {
+			registry.Active = previous
+			delete(registry.Wallets, name)
+		})
+		return models.WalletInfo{}, "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		return fail(fmt.Errorf("failed to create wallet directory: %w", err))
+	}
+	if err := bs.BtcwalletCreate(passphrase, seed, ""); err != nil {
+		return fail(err)
+	}
+	if _, err := bs.StartBtcwallet(); err != nil {
+		return fail(fmt.Errorf("failed to start btcwallet: %w", err))
+	}
+	address, err := bs.GetNewAddress()
+	if err != nil {
+		return fail(fmt.Errorf("failed to generate new address: %w", err))
+	}
+
+	var info models.WalletInfo
+	err = updateWallets(func(registry *walletRegistry) {
+		registry.entry(name).MiningAddress = address
+		info = walletInfo(registry, name)
+	})
+	log.Infof("Wallet %s created with address %s", name, address)
+	return info, mnemonic, err
+}
+
+// SwitchWallet restarts btcwallet on another wallet and unlocks it when passphrase is given
+// mining moves to the wallet's mining address right away, on cpuminer if btcd was mining
+func (bs *BtcService) SwitchWallet(name, passphrase string) (models.WalletInfo, string, error) {
+	if err := checkWalletName(name); err != nil {
+		return models.WalletInfo{}, "", err
+	}
+	dbPath, err := walletDBPathFor(name)
+	if err != nil {
+		return models.WalletInfo{}, "", err
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return models.WalletInfo{}, "", fmt.Errorf("%s: %w", name, ErrWalletNotFound)
+	}
+	if btcwalletProcess.Status().State == "external" {
+		return models.WalletInfo{}, "", fmt.Errorf("btcwallet was started outside of this app, can't switch wallets")
+	}
+
+	// the mining address in use belongs to the wallet we leave
+	previous := activeWallet()
+	miningAddress := bs.GetMiningSettings().Address
+	if err := updateWallets(func(registry *walletRegistry) {
+		if miningAddress != "" && registry.entry(previous).MiningAddress == "" {
+			registry.entry(previous).MiningAddress = miningAddress
+		}
+		registry.Active = name
+	}); err != nil {
+		return models.WalletInfo{}, "", err
+	}
+
+	// back to the wallet we had if this one can't be opened, a btcwallet that was running runs on it again
+	restore := func() {
+		updateWallets(func(registry *walletRegistry) {
+			registry.Active = previous
+		})
+	}
+	wasRunning := btcwalletProcess.Running()
+	fail := func(err error) (models.WalletInfo, string, error) {
+		restore()
+		if btcwalletProcess.Running() {
+			bs.StopBtcwallet()
+		}
+		if wasRunning {
+			if _, startErr := bs.StartBtcwallet(); startErr != nil {
+				log.Errorf("SwitchWallet: failed to restart btcwallet on %s: %v", previous, startErr)
+			}
+		}
+		return models.WalletInfo{}, "", err
+	}
+
+	if wasRunning {
+		if _, err := bs.StopBtcwallet(); err != nil {
+			restore()
+			return models.WalletInfo{}, "", fmt.Errorf("failed to stop btcwallet: %w", err)
+		}
+	}
+	if !btcdProcess.Running() {
+		if _, err := bs.StartBtcd(); err != nil {
+			return fail(fmt.Errorf("failed to start btcd: %w", err))
+		}
+	}
+	if _, err := bs.StartBtcwallet(); err != nil {
+		return fail(fmt.Errorf("failed to start btcwallet: %w", err))
+	}
+	if passphrase != "" {
+		if _, err := bs.UnlockWallet(passphrase); err != nil {
+			return fail(err)
+		}
+	}
+
+	walletsMu.Lock()
+	info := walletInfo(loadWallets(), name)
+	walletsMu.Unlock()
+
+	message := fmt.Sprintf("Switched to wallet %s.", name)
+	settings := bs.GetMiningSettings()
+	if info.MiningAddress != "" && info.MiningAddress != settings.Address {
+		settings.Address = info.MiningAddress
+		if updated, err := bs.SetMiningSettings(settings); err != nil {
+			message += fmt.Sprintf(" Mining address not switched: %v", err)
+		} else {
+			message += fmt.Sprintf(" Mining to %s with %s.", updated.Address, updated.Miner)
+		}
+	}
+	log.Debug(message)
+	return info, message, nil
+}
+
+// ListAccounts lists the accounts of the active wallet with their balances and addresses
+func (bs *BtcService) ListAccounts() ([]models.WalletAccount, error) {
+	if !btcwalletProcess.Running() {
+		return nil, fmt.Errorf("btcwallet is not running. Please start btcwallet before listing accounts")
+	}
+	output, err := walletCommand("listaccounts")
+	if err != nil {
+		return nil, err
+	}
+	var balances map[string]float64
+	if err := json.Unmarshal([]byte(output), &balances); err != nil {
+		return nil, fmt.Errorf("error parsing account list: %w", err)
+	}
+
+	active := activeAccount()
+	accounts := []models.WalletAccount{}
+	for name, balance := range balances {
+		account := models.WalletAccount{Name: name, Balance: balance, Addresses: []string{}, Active: name == active}
+		if output, err := walletCommand("getaddressesbyaccount", name); err == nil {
+			json.Unmarshal([]byte(output), &account.Addresses)
+		} else {
+			log.Infof("ListAccounts: %v", err)
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+// CreateAccount adds an account to the active wallet, btcwallet wants the wallet unlocked for it
+func (bs *BtcService) CreateAccount(name string) (models.WalletAccount, error) {
+	if name == "" || name == "*" || name == "imported" {
+		return models.WalletAccount{}, fmt.Errorf("invalid account name %q", name)
+	}
+	if !btcwalletProcess.Running() {
+		return models.WalletAccount{}, fmt.Errorf("btcwallet is not running. Please start btcwallet before creating an account")
+	}
+	if _, err := walletCommand("createnewaccount", name); err != nil {
+		return models.WalletAccount{}, err
+	}
+	log.Infof("Account %s created in wallet %s", name, activeWallet())
+	return models.WalletAccount{Name: name, Addresses: []string{}}, nil
+}
+
+// SelectAccount makes new receiving addresses of the active wallet come from account
+func (bs *BtcService) SelectAccount(name string) error {
+	accounts, err := bs.ListAccounts()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, account := range accounts {
+		if account.Name == name {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: %w", name, ErrAccountUnknown)
+	}
+	return updateWallets(func(registry *walletRegistry) {
+		registry.entry(registry.Active).Account = name
+	})
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// go test -v -run ^TestNamedWallets$ -count=1 application-layer/services
+// TestNamedWallets checks that each named wallet gets its own data directory and btcwallet flags, no btcwallet needed.
+func TestNamedWallets(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("wallet path under a temp home is only set up for linux")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	oldTempFilePath := tempFilePath
+	tempFilePath = filepath.Join(home, "btcd_temp.json")
+	defer func() { tempFilePath = oldTempFilePath }()
+
+	if activeWallet() != defaultWalletName || activeAccount() != defaultAccountName {
+		t.Fatalf("Expected the default wallet and account without a registry, got %s/%s", activeWallet(), activeAccount())
+	}
+	for _, arg := range btcwalletArgs() {
+		if strings.HasPrefix(arg, "--appdata") {
+			t.Errorf("The default wallet should use btcwallet's own data directory, got %s", arg)
+		}
+	}
+
+	// a wallet made outside the registry is found by its directory
+	savings, _ := walletDBPathFor("savings")
+	if savings != filepath.Join(home, ".btcwallet", "wallets", "savings", "mainnet", "wallet.db") {
+		t.Errorf("Unexpected path for wallet savings: %s", savings)
+	}
+	os.MkdirAll(filepath.Dir(savings), 0700)
+	ioutil.WriteFile(savings, []byte("wallet"), 0600)
+
+	if err := updateWallets(func(registry *walletRegistry) {
+		registry.Active = "savings"
+		registry.entry("savings").Account = "rent"
+		registry.entry("savings").MiningAddress = "14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc"
+	}); err != nil {
+		t.Fatalf("updateWallets failed: %v", err)
+	}
+	if path, _ := walletDBPath(); path != savings {
+		t.Errorf("Expected the active wallet's path %s, got %s", savings, path)
+	}
+	if activeAccount() != "rent" {
+		t.Errorf("Expected account rent, got %s", activeAccount())
+	}
+	args := btcwalletArgs()
+	if last := args[len(args)-1]; last != "--appdata="+filepath.Join(home, ".btcwallet", "wallets", "savings") {
+		t.Errorf("Expected btcwallet to run on the savings directory, got %s", last)
+	}
+
+	wallets := (&BtcService{}).ListWallets()
+	if len(wallets) != 2 || wallets[0].Name != defaultWalletName || wallets[1].Name != "savings" {
+		t.Fatalf("Expected default and savings, got %+v", wallets)
+	}
+	if wallets[0].Active || wallets[0].Exists {
+		t.Errorf("Default wallet should be inactive and missing, got %+v", wallets[0])
+	}
+	if !wallets[1].Active || !wallets[1].Exists || wallets[1].MiningAddress == "" {
+		t.Errorf("Savings wallet should be active with its mining address, got %+v", wallets[1])
+	}
+
+	if _, _, err := (&BtcService{}).CreateNamedWallet("../escape", "secret"); err == nil {
+		t.Errorf("Expected a wallet name with a path in it to be refused")
+	}
+	if _, _, err := (&BtcService{}).SwitchWallet("../..", ""); err == nil || !strings.Contains(err.Error(), "invalid wallet name") {
+		t.Errorf("Expected switching to a path to be refused, got %v", err)
+	}
+	if _, err := (&BtcService{}).Login("14QnrKvCS9cskoMjfKkCe7xaWkQwdWCbJc", "secret", "../.."); err == nil || activeWallet() != "savings" {
+		t.Errorf("Expected logging in to a path to be refused with savings still active, got %v and %s", err, activeWallet())
+	}
+
+	// a wallet that can't be opened leaves the one we had active
+	if btcdProcess.Running() || btcwalletProcess.Running() {
+		t.Skip("btcd or btcwallet is running, not switching wallets under it")
+	}
+	oldBtcdPath, oldBtcwalletPath, oldLogsDir := btcdProcess.path, btcwalletProcess.path, processLogsDir
+	btcdProcess.path = filepath.Join(home, "no-btcd")
+	btcwalletProcess.path = filepath.Join(home, "no-btcwallet")
+	processLogsDir = func() string { return filepath.Join(home, "logs") }
+	defer func() {
+		btcdProcess.path, btcwalletProcess.path, processLogsDir = oldBtcdPath, oldBtcwalletPath, oldLogsDir
+	}()
+	updateWallets(func(registry *walletRegistry) { registry.Active = defaultWalletName })
+	if _, _, err := (&BtcService{}).SwitchWallet("savings", ""); err == nil {
+		t.Errorf("Expected switching without btcd to fail")
+	}
+	if activeWallet() != defaultWalletName {
+		t.Errorf("Expected the default wallet to stay active after a failed switch, got %s", activeWallet())
+	}
+}
@@ -0,0 +1,454 @@
+package storage
+
+import (
+	"application-layer/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	FileCopyPath = filepath.Join("..", "..", "squidcoinFiles")
+	Blobs        = NewBlobStore(FileCopyPath)
+
+	ErrInvalidHash  = errors.New("invalid file hash")
+	ErrHashMismatch = errors.New("content does not match the expected hash")
+	ErrNotFound     = errors.New("blob not found")
+	ErrPinned       = errors.New("blob is still being added")
+)
+
+// temp files older than this are treated as leftovers from a crashed write
+const staleTempAge = time.Hour
+
+// BlobStore keeps file content addressed by its sha-256 hash
+// blobs live in <root>/blobs/<first two hash chars>/<hash> and user facing names in <root>/index.json
+type BlobStore struct {
+	root  string
+	mu    sync.Mutex
+	index map[string]models.BlobEntry
+	pins  map[string]int // blobs GC must leave alone until their new owner has listed them
+}
+
+func NewBlobStore(root string) *BlobStore {
+	return &BlobStore{root: root}
+}
+
+// ValidHash reports whether hash is a lowercase hex sha-256 digest
+func ValidHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// SanitizeName turns a name received from a peer into a plain file name without any directory parts
+func SanitizeName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == ':' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+func (bs *BlobStore) blobDir() string   { return filepath.Join(bs.root, "blobs") }
+func (bs *BlobStore) tempDir() string   { return filepath.Join(bs.root, "tmp") }
+func (bs *BlobStore) indexPath() string { return filepath.Join(bs.root, "index.json") }
+
+// EncryptedPath is where an encrypted download waits for its key, outside the temp dir so GC leaves it alone
+func (bs *BlobStore) EncryptedPath(transactionID string) string {
+	return filepath.Join(bs.root, "encrypted", SanitizeName(transactionID))
+}
+
+// Path returns where the blob for hash is stored, whether or not it exists yet
+func (bs *BlobStore) Path(hash string) (string, error) {
+	if !ValidHash(hash) {
+		return "", ErrInvalidHash
+	}
+	return filepath.Join(bs.blobDir(), hash[:2], hash), nil
+}
+
+func (bs *BlobStore) Has(hash string) bool {
+	path, err := bs.Path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// must be called with bs.mu held
+func (bs *BlobStore) loadIndex() error {
+	if bs.index != nil {
+		return nil
+	}
+	bs.index = make(map[string]models.BlobEntry)
+
+	data, err := os.ReadFile(bs.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read blob index: %v", err)
+	}
+	var entries []models.BlobEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse blob index: %v", err)
+	}
+	for _, entry := range entries {
+		bs.index[entry.Hash] = entry
+	}
+	return nil
+}
+
+// must be called with bs.mu held
+func (bs *BlobStore) saveIndex() error {
+	entries := make([]models.BlobEntry, 0, len(bs.index))
+	for _, entry := range bs.index {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal blob index: %v", err)
+	}
+	return writeFileAtomic(bs.indexPath(), data)
+}
+
+// Entry returns the index entry for hash
+func (bs *BlobStore) Entry(hash string) (models.BlobEntry, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if err := bs.loadIndex(); err != nil {
+		return models.BlobEntry{}, false
+	}
+	entry, exists := bs.index[hash]
+	return entry, exists
+}
+
+// List returns every indexed blob
+func (bs *BlobStore) List() ([]models.BlobEntry, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if err := bs.loadIndex(); err != nil {
+		return nil, err
+	}
+	entries := make([]models.BlobEntry, 0, len(bs.index))
+	for _, entry := range bs.index {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// BlobWriter streams content into a temp file and moves it into place once the hash checks out
+type BlobWriter struct {
+	store  *BlobStore
+	name   string
+	file   *os.File
+	hasher hash.Hash
+	chunks *chunkHasher
+	size   int64
+	done   bool
+}
+
+// Create starts writing a new blob that will be listed under name
+func (bs *BlobStore) Create(name string) (*BlobWriter, error) {
+	if err := os.MkdirAll(bs.tempDir(), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	file, err := os.CreateTemp(bs.tempDir(), "blob-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	return &BlobWriter{store: bs, name: SanitizeName(name), file: file, hasher: sha256.New(), chunks: newChunkHasher()}, nil
+}
+
+func (bw *BlobWriter) Write(p []byte) (int, error) {
+	n, err := bw.file.Write(p)
+	bw.hasher.Write(p[:n])
+	bw.chunks.Write(p[:n])
+	bw.size += int64(n)
+	return n, err
+}
+
+// Hash of everything written so far
+func (bw *BlobWriter) Hash() string {
+	return hex.EncodeToString(bw.hasher.Sum(nil))
+}
+
+// Commit verifies the content against expectedHash (skipped when empty) and renames the temp file into the store
+// the blob stays pinned until Unpin
+func (bw *BlobWriter) Commit(expectedHash string) (models.BlobEntry, error) {
+	if bw.done {
+		return models.BlobEntry{}, fmt.Errorf("blob writer already closed")
+	}
+	bw.done = true
+	tempPath := bw.file.Name()
+	defer os.Remove(tempPath) // no-op once renamed
+
+	if err := bw.file.Sync(); err != nil {
+		bw.file.Close()
+		return models.BlobEntry{}, fmt.Errorf("failed to flush blob: %v", err)
+	}
+	if err := bw.file.Close(); err != nil {
+		return models.BlobEntry{}, fmt.Errorf("failed to close blob: %v", err)
+	}
+
+	actualHash := bw.Hash()
+	if expectedHash != "" && !strings.EqualFold(expectedHash, actualHash) {
+		return models.BlobEntry{}, fmt.Errorf("%w: expected %s, got %s", ErrHashMismatch, expectedHash, actualHash)
+	}
+
+	// the blob is pinned before it lands in blobs/ so a GC running before the caller has
+	// written files.json (or wherever it lists the blob) can't take it away again
+	bs := bw.store
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if err := bs.loadIndex(); err != nil {
+		return models.BlobEntry{}, err
+	}
+
+	tree := bw.chunks.Tree()
+	if err := bs.saveTree(actualHash, tree); err != nil {
+		return models.BlobEntry{}, err
+	}
+
+	blobPath, _ := bs.Path(actualHash)
+	if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+		return models.BlobEntry{}, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	if err := os.Rename(tempPath, blobPath); err != nil {
+		return models.BlobEntry{}, fmt.Errorf("failed to move blob into place: %v", err)
+	}
+	bs.pin(actualHash)
+
+	entry := models.BlobEntry{
+		Hash:      actualHash,
+		Name:      bw.name,
+		Size:      bw.size,
+		ChunkRoot: tree.Root,
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if existing, exists := bs.index[actualHash]; exists {
+		entry.CreatedAt = existing.CreatedAt
+	}
+	bs.index[actualHash] = entry
+	if err := bs.saveIndex(); err != nil {
+		return models.BlobEntry{}, err
+	}
+	return entry, nil
+}
+
+// must be called with bs.mu held
+func (bs *BlobStore) pin(hash string) {
+	if bs.pins == nil {
+		bs.pins = make(map[string]int)
+	}
+	bs.pins[hash]++
+}
+
+// Unpin lets GC collect a blob returned by Commit, Put or Import again
+// call it once the blob is listed somewhere collectGarbage looks, or given up on
+func (bs *BlobStore) Unpin(hash string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.pins[hash] <= 1 {
+		delete(bs.pins, hash)
+		return
+	}
+	bs.pins[hash]--
+}
+
+// Abort throws away everything written so far
+func (bw *BlobWriter) Abort() {
+	if bw.done {
+		return
+	}
+	bw.done = true
+	bw.file.Close()
+	os.Remove(bw.file.Name())
+}
+
+// Put copies r into the store in one go, the blob is pinned like after Commit
+func (bs *BlobStore) Put(r io.Reader, name string, expectedHash string) (models.BlobEntry, error) {
+	writer, err := bs.Create(name)
+	if err != nil {
+		return models.BlobEntry{}, err
+	}
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.Abort()
+		return models.BlobEntry{}, fmt.Errorf("failed to write blob: %v", err)
+	}
+	return writer.Commit(expectedHash)
+}
+
+// Import adds an existing file on disk to the store, used for files saved by name before the blob store existed
+// the blob is pinned like after Commit
+func (bs *BlobStore) Import(path string, name string, expectedHash string) (models.BlobEntry, error) {
+	if entry, exists := bs.pinExisting(expectedHash); exists {
+		return entry, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return models.BlobEntry{}, err
+	}
+	defer file.Close()
+	return bs.Put(file, name, expectedHash)
+}
+
+// pin a blob that is already stored and indexed, reporting whether there was one
+func (bs *BlobStore) pinExisting(hash string) (models.BlobEntry, bool) {
+	if !bs.Has(hash) {
+		return models.BlobEntry{}, false
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if err := bs.loadIndex(); err != nil {
+		return models.BlobEntry{}, false
+	}
+	entry, exists := bs.index[hash]
+	// GC may have removed it between Has and taking the lock
+	if !exists || !bs.Has(hash) {
+		return models.BlobEntry{}, false
+	}
+	bs.pin(hash)
+	return entry, true
+}
+
+// Remove deletes the blob and its index entry, unless it is pinned
+func (bs *BlobStore) Remove(hash string) error {
+	path, err := bs.Path(hash)
+	if err != nil {
+		return err
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.pins[hash] > 0 {
+		return ErrPinned
+	}
+	if err := bs.loadIndex(); err != nil {
+		return err
+	}
+	_, indexed := bs.index[hash]
+	delete(bs.index, hash)
+	os.Remove(bs.treePath(hash))
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	if os.IsNotExist(err) && !indexed {
+		return ErrNotFound
+	}
+	return bs.saveIndex()
+}
+
+// GC removes blobs whose hash is not in keep or pinned, index entries without a blob and stale temp files
+func (bs *BlobStore) GC(keep map[string]bool) (models.GCReport, error) {
+	report := models.GCReport{RemovedBlobs: []string{}}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if err := bs.loadIndex(); err != nil {
+		return report, err
+	}
+
+	err := filepath.Walk(bs.blobDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		hash := info.Name()
+		if ValidHash(hash) && (keep[hash] || bs.pins[hash] > 0) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove orphaned blob %s: %v", hash, err)
+		}
+		delete(bs.index, hash)
+		if ValidHash(hash) {
+			os.Remove(bs.treePath(hash))
+		}
+		report.RemovedBlobs = append(report.RemovedBlobs, hash)
+		report.FreedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for hash := range bs.index {
+		path, _ := bs.Path(hash)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(bs.index, hash)
+		}
+	}
+
+	temps, err := os.ReadDir(bs.tempDir())
+	if err != nil && !os.IsNotExist(err) {
+		return report, fmt.Errorf("failed to read temp directory: %v", err)
+	}
+	for _, temp := range temps {
+		info, err := temp.Info()
+		if err != nil || time.Since(info.ModTime()) < staleTempAge {
+			continue
+		}
+		if os.Remove(filepath.Join(bs.tempDir(), temp.Name())) == nil {
+			report.RemovedTemp++
+			report.FreedBytes += info.Size()
+		}
+	}
+
+	return report, bs.saveIndex()
+}
+
+// write to a temp file in the same directory, then rename so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %v", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+	return nil
+}
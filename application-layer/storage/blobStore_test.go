@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// go test -v -run ^TestPutAndGC$ -count=1 application-layer/storage
+func TestPutAndGC(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+
+	kept, err := store.Put(strings.NewReader("keep me"), "keep.txt", hashOf("keep me"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	orphan, err := store.Put(strings.NewReader("orphan"), "orphan.txt", "")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if orphan.Hash != hashOf("orphan") {
+		t.Fatalf("expected hash %s, got %s", hashOf("orphan"), orphan.Hash)
+	}
+
+	// freshly committed blobs survive GC and Remove until whoever added them has listed them
+	report, err := store.GC(map[string]bool{kept.Hash: true})
+	if err != nil || len(report.RemovedBlobs) != 0 {
+		t.Fatalf("GC removed pinned blobs: %v, %v", report.RemovedBlobs, err)
+	}
+	if err := store.Remove(orphan.Hash); !errors.Is(err, ErrPinned) {
+		t.Fatalf("expected ErrPinned, got %v", err)
+	}
+	store.Unpin(kept.Hash)
+	store.Unpin(orphan.Hash)
+
+	report, err = store.GC(map[string]bool{kept.Hash: true})
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(report.RemovedBlobs) != 1 || report.RemovedBlobs[0] != orphan.Hash {
+		t.Fatalf("expected only the orphan to be removed, got %v", report.RemovedBlobs)
+	}
+	if !store.Has(kept.Hash) || store.Has(orphan.Hash) {
+		t.Fatalf("unexpected store contents after GC")
+	}
+	if _, exists := store.Entry(orphan.Hash); exists {
+		t.Fatalf("orphan still present in the index")
+	}
+}
+
+// go test -v -run ^TestCommitRejectsHashMismatch$ -count=1 application-layer/storage
+func TestCommitRejectsHashMismatch(t *testing.T) {
+	root := t.TempDir()
+	store := NewBlobStore(root)
+
+	_, err := store.Put(strings.NewReader("tampered"), "file.txt", hashOf("original"))
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+	if store.Has(hashOf("tampered")) {
+		t.Fatalf("mismatched content was stored")
+	}
+	temps, _ := os.ReadDir(filepath.Join(root, "tmp"))
+	if len(temps) != 0 {
+		t.Fatalf("temp file left behind: %v", temps)
+	}
+}
+
+// go test -v -run ^TestSanitizeName$ -count=1 application-layer/storage
+func TestSanitizeName(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":          "report.pdf",
+		"../../x":             "x",
+		"..\\..\\windows.ini": "windows.ini",
+		"/etc/passwd":         "passwd",
+		"..":                  "file",
+		"":                    "file",
+		"bad\x00name":         "badname",
+	}
+	for input, expected := range cases {
+		if got := SanitizeName(input); got != expected {
+			t.Errorf("SanitizeName(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+// go test -v -run ^TestChunkTree$ -count=1 application-layer/storage
+func TestChunkTree(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+
+	content := strings.Repeat("a", ChunkSize) + strings.Repeat("b", ChunkSize) + "tail"
+	entry, err := store.Put(strings.NewReader(content), "big.bin", "")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	tree, err := store.Tree(entry.Hash)
+	if err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+	if len(tree.Chunks) != 3 || tree.Root != entry.ChunkRoot {
+		t.Fatalf("unexpected tree: %d chunks, root %s (entry %s)", len(tree.Chunks), tree.Root, entry.ChunkRoot)
+	}
+	if err := VerifyTree(tree); err != nil {
+		t.Fatalf("VerifyTree failed: %v", err)
+	}
+	if err := VerifyChunk(tree, 2, []byte("tail")); err != nil {
+		t.Fatalf("VerifyChunk failed: %v", err)
+	}
+	if err := VerifyChunk(tree, 1, []byte("tail")); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+}
+
+// go test -v -run ^TestChunkVerifier$ -count=1 application-layer/storage
+func TestChunkVerifier(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+	content := strings.Repeat("a", ChunkSize) + strings.Repeat("b", ChunkSize) + "tail"
+	entry, err := store.Put(strings.NewReader(content), "big.bin", "")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	tree, err := store.Tree(entry.Hash)
+	if err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+
+	// odd sized writes come out the other end in whole, verified chunks
+	var out strings.Builder
+	verifier := NewChunkVerifier(tree, &out)
+	for rest := content; len(rest) > 0; {
+		n := 4096
+		if n > len(rest) {
+			n = len(rest)
+		}
+		if _, err := verifier.Write([]byte(rest[:n])); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := verifier.Close(); err != nil || out.String() != content {
+		t.Fatalf("Close = %v, passed on %d of %d bytes", err, out.Len(), len(content))
+	}
+
+	// a bad chunk is refused as soon as it is complete, before anything after it is read
+	out.Reset()
+	verifier = NewChunkVerifier(tree, &out)
+	tampered := strings.Repeat("a", ChunkSize) + strings.Repeat("c", ChunkSize)
+	if _, err := verifier.Write([]byte(tampered)); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+	if out.Len() != ChunkSize {
+		t.Errorf("passed on %d bytes, want only the good first chunk", out.Len())
+	}
+
+	// as is content that stops short
+	verifier = NewChunkVerifier(tree, io.Discard)
+	verifier.Write([]byte(content[:2*ChunkSize]))
+	if err := verifier.Close(); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("truncated content: expected ErrHashMismatch, got %v", err)
+	}
+}
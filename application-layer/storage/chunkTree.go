@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"application-layer/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// size of the pieces a file is split into for verification
+const ChunkSize = 256 * 1024
+
+// chunkHasher hashes data in ChunkSize pieces as it is written
+type chunkHasher struct {
+	current hash.Hash
+	filled  int
+	leaves  [][]byte
+}
+
+func newChunkHasher() *chunkHasher {
+	return &chunkHasher{current: sha256.New()}
+}
+
+func (ch *chunkHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := ChunkSize - ch.filled
+		if n > len(p) {
+			n = len(p)
+		}
+		ch.current.Write(p[:n])
+		ch.filled += n
+		p = p[n:]
+		if ch.filled == ChunkSize {
+			ch.leaves = append(ch.leaves, ch.current.Sum(nil))
+			ch.current.Reset()
+			ch.filled = 0
+		}
+	}
+	return written, nil
+}
+
+// Tree returns the chunk hashes and their merkle root
+func (ch *chunkHasher) Tree() models.ChunkTree {
+	leaves := ch.leaves
+	if ch.filled > 0 || len(leaves) == 0 {
+		leaves = append(leaves, ch.current.Sum(nil))
+	}
+
+	tree := models.ChunkTree{ChunkSize: ChunkSize, Chunks: make([]string, len(leaves))}
+	for i, leaf := range leaves {
+		tree.Chunks[i] = hex.EncodeToString(leaf)
+	}
+	tree.Root = hex.EncodeToString(merkleRoot(leaves))
+	return tree
+}
+
+// pairs of nodes are hashed together level by level, an odd node is carried up unchanged
+func merkleRoot(level [][]byte) []byte {
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			parent := sha256.New()
+			parent.Write(level[i])
+			parent.Write(level[i+1])
+			next = append(next, parent.Sum(nil))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// VerifyChunk checks one chunk of a file against its tree
+func VerifyChunk(tree models.ChunkTree, index int, data []byte) error {
+	if index < 0 || index >= len(tree.Chunks) {
+		return fmt.Errorf("chunk %d out of range", index)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != tree.Chunks[index] {
+		return fmt.Errorf("%w: chunk %d", ErrHashMismatch, index)
+	}
+	return nil
+}
+
+// VerifyTree checks that the chunk hashes add up to the advertised root
+func VerifyTree(tree models.ChunkTree) error {
+	leaves := make([][]byte, len(tree.Chunks))
+	for i, chunk := range tree.Chunks {
+		leaf, err := hex.DecodeString(chunk)
+		if err != nil {
+			return fmt.Errorf("invalid chunk hash %d: %v", i, err)
+		}
+		leaves[i] = leaf
+	}
+	if len(leaves) == 0 || hex.EncodeToString(merkleRoot(leaves)) != tree.Root {
+		return fmt.Errorf("%w: chunk tree root", ErrHashMismatch)
+	}
+	return nil
+}
+
+// ChunkVerifier checks content against a chunk tree as it is written, passing each chunk on to w
+// once it matches, so a bad chunk is caught when it arrives rather than after the whole file
+type ChunkVerifier struct {
+	tree    models.ChunkTree
+	w       io.Writer
+	pending []byte
+	index   int
+}
+
+// NewChunkVerifier expects a tree that already passed VerifyTree
+func NewChunkVerifier(tree models.ChunkTree, w io.Writer) *ChunkVerifier {
+	return &ChunkVerifier{tree: tree, w: w}
+}
+
+func (cv *ChunkVerifier) Write(p []byte) (int, error) {
+	written := len(p)
+	size := int(cv.tree.ChunkSize)
+	for len(p) > 0 {
+		n := size - len(cv.pending)
+		if n > len(p) {
+			n = len(p)
+		}
+		cv.pending = append(cv.pending, p[:n]...)
+		p = p[n:]
+		if len(cv.pending) == size {
+			if err := cv.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (cv *ChunkVerifier) flush() error {
+	if err := VerifyChunk(cv.tree, cv.index, cv.pending); err != nil {
+		return err
+	}
+	if _, err := cv.w.Write(cv.pending); err != nil {
+		return err
+	}
+	cv.index++
+	cv.pending = cv.pending[:0]
+	return nil
+}
+
+// Close checks the last, possibly short, chunk and that no chunk is missing
+func (cv *ChunkVerifier) Close() error {
+	if len(cv.pending) > 0 || cv.index == 0 {
+		if err := cv.flush(); err != nil {
+			return err
+		}
+	}
+	if cv.index != len(cv.tree.Chunks) {
+		return fmt.Errorf("%w: got %d of %d chunks", ErrHashMismatch, cv.index, len(cv.tree.Chunks))
+	}
+	return nil
+}
+
+func (bs *BlobStore) treePath(hash string) string {
+	return filepath.Join(bs.root, "trees", hash[:2], hash+".json")
+}
+
+// Tree returns the chunk tree saved when the blob was committed
+func (bs *BlobStore) Tree(hash string) (models.ChunkTree, error) {
+	if !ValidHash(hash) {
+		return models.ChunkTree{}, ErrInvalidHash
+	}
+	data, err := os.ReadFile(bs.treePath(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return models.ChunkTree{}, ErrNotFound
+		}
+		return models.ChunkTree{}, fmt.Errorf("failed to read chunk tree: %v", err)
+	}
+	var tree models.ChunkTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return models.ChunkTree{}, fmt.Errorf("failed to parse chunk tree: %v", err)
+	}
+	return tree, nil
+}
+
+func (bs *BlobStore) saveTree(hash string, tree models.ChunkTree) error {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk tree: %v", err)
+	}
+	return writeFileAtomic(bs.treePath(hash), data)
+}
@@ -13,13 +13,13 @@ func CheckDirectoryContents(path string) ([]string, error) {
 	}
 
 	var contents []string
-	fmt.Printf("Contents of %s:\n", path)
+	log.Infof("Contents of %s:", path)
 	for _, file := range files {
 		if file.IsDir() {
-			fmt.Printf("[DIR]  %s\n", file.Name())
+			log.Infof("[DIR]  %s", file.Name())
 			contents = append(contents, fmt.Sprintf("[DIR] %s", file.Name()))
 		} else {
-			fmt.Printf("[FILE] %s\n", file.Name())
+			log.Infof("[FILE] %s", file.Name())
 			contents = append(contents, fmt.Sprintf("[FILE] %s", file.Name()))
 		}
 	}
@@ -37,7 +37,7 @@ func SaveOrUpdateFile(newFileData models.FileMetadata, dirPath string, filePath
 		}
 	}
 
-	fmt.Println("file to be added/updated: ", newFileData)
+	log.Info("file to be added/updated: ", newFileData)
 
 	// read in JSON file
 	data, err := os.ReadFile(filePath)
@@ -135,3 +135,22 @@ func AddOrUpdateTransaction(transaction models.Transaction) error {
 
 	return nil
 }
+
+// GetTransaction returns the transaction we stored under transactionID
+func GetTransaction(transactionID string) (models.Transaction, error) {
+	data, err := os.ReadFile(transactionFilePath)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("failed to read transactionFiles.json: %v", err)
+	}
+
+	var transactions []models.Transaction
+	if err := json.Unmarshal(data, &transactions); err != nil {
+		return models.Transaction{}, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	for _, transaction := range transactions {
+		if transaction.TransactionID == transactionID {
+			return transaction, nil
+		}
+	}
+	return models.Transaction{}, fmt.Errorf("no transaction with id %s", transactionID)
+}
@@ -0,0 +1,5 @@
+package utils
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("UTIL")
@@ -0,0 +1,5 @@
+package websocket
+
+import "application-layer/logging"
+
+var log = logging.Subsystem("WSKT")
@@ -1,14 +1,16 @@
 package websocket
 
 import (
-	"log"
+	"encoding/json"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
 var wsClients = make(map[*websocket.Conn]bool) // Connected WebSocket clients
-var wsBroadcast = make(chan string)            // Channel for broadcast messages
+var wsClientsMutex sync.Mutex
+var wsBroadcast = make(chan string, 256) // Channel for broadcast messages
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
@@ -20,20 +22,24 @@ var upgrader = websocket.Upgrader{
 func WsHandler(w http.ResponseWriter, r *http.Request) {
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		log.Errorf("WebSocket upgrade error: %v", err)
 		return
 	}
 	defer ws.Close()
 
+	wsClientsMutex.Lock()
 	wsClients[ws] = true
-	log.Println("New WebSocket connection established")
+	wsClientsMutex.Unlock()
+	log.Info("New WebSocket connection established")
 
 	// Keep the connection alive
 	for {
 		_, _, err := ws.ReadMessage()
 		if err != nil {
-			log.Printf("WebSocket connection closed: %v", err)
+			log.Infof("WebSocket connection closed: %v", err)
+			wsClientsMutex.Lock()
 			delete(wsClients, ws)
+			wsClientsMutex.Unlock()
 			break
 		}
 	}
@@ -43,14 +49,16 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 func BroadcastMessages() {
 	for {
 		msg := <-wsBroadcast
+		wsClientsMutex.Lock()
 		for client := range wsClients {
 			err := client.WriteMessage(websocket.TextMessage, []byte(msg))
 			if err != nil {
-				log.Printf("WebSocket broadcast error: %v", err)
+				log.Errorf("WebSocket broadcast error: %v", err)
 				client.Close()
 				delete(wsClients, client)
 			}
 		}
+		wsClientsMutex.Unlock()
 	}
 }
 
@@ -58,3 +66,18 @@ func BroadcastMessages() {
 func SendMessage(message string) {
 	wsBroadcast <- message
 }
+
+// SendEvent encodes an event as JSON and queues it for broadcast
+// events are dropped instead of blocking the caller when nobody is draining the channel
+func SendEvent(event interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("WebSocket event encoding error: %v", err)
+		return
+	}
+
+	select {
+	case wsBroadcast <- string(data):
+	default:
+	}
+}
@@ -39,7 +39,9 @@ Add-Type -AssemblyName System.Windows.Forms
 $btcwalletPath = "../btcwallet/btcwallet"
 
 # Start the btcwallet process
-$process = Start-Process -FilePath $btcwalletPath -ArgumentList "--create" -WindowStyle Normal -PassThru
+# Extra flags, e.g. --appdata for a named wallet or --birthday for a restored one
+$extraArgs = $env:BTCWALLET_ARGS
+$process = Start-Process -FilePath $btcwalletPath -ArgumentList "--create $extraArgs" -WindowStyle Normal -PassThru
 
 Log-Message "btcwallet process started."
 
@@ -63,15 +65,22 @@ $confirmPassphrase = $env:BTCWALLET_PASSPHRASE
 $addEncryption = "no"
 $existingSeed = "no"
 $confirmOK = "OK"
+# Hex wallet seed from the seed phrase, empty lets btcwallet generate one
+$seed = $env:BTCWALLET_SEED
 
 # Simulate inputs
 $inputs = @(
     "$passphrase{ENTER}"        # Enter the passphrase and press Enter
     "$confirmPassphrase{ENTER}" # Confirm the passphrase and press Enter
     "$addEncryption{ENTER}"     # Select no additional encryption
-    "$existingSeed{ENTER}"      # Select no existing wallet seed
-    "$confirmOK{ENTER}"         # Confirm seed saving
 )
+if ($seed) {
+    $inputs += "yes{ENTER}"     # Select an existing wallet seed
+    $inputs += "$seed{ENTER}"   # Enter the seed
+} else {
+    $inputs += "$existingSeed{ENTER}" # Select no existing wallet seed
+    $inputs += "$confirmOK{ENTER}"    # Confirm seed saving
+}
 
 foreach ($input in $inputs) {
     [System.Windows.Forms.SendKeys]::SendWait($input)
@@ -51,6 +51,7 @@ type config struct {
 	ShowVersion     bool                    `short:"V" long:"version" description:"Display version information and exit"`
 	Create          bool                    `long:"create" description:"Create the wallet if it does not exist"`
 	CreateTemp      bool                    `long:"createtemp" description:"Create a temporary simulation wallet (pass=password) in the data directory indicated; must call with --datadir"`
+	Birthday        string                  `long:"birthday" description:"Birthday of a wallet made with --create from an existing seed, as YYYY-MM-DD or \"genesis\"; the first start rescans the chain from there (default now)"`
 	AppDataDir      *cfgutil.ExplicitString `short:"A" long:"appdata" description:"Application data directory for wallet config, databases and logs"`
 	TestNet3        bool                    `long:"testnet" description:"Use the test Bitcoin network (version 3) (default mainnet)"`
 	SimNet          bool                    `long:"simnet" description:"Use the simulation test network (default mainnet)"`
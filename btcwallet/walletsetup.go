@@ -99,6 +99,17 @@ func convertLegacyKeystore(legacyKeyStore *keystore.Store, w *wallet.Wallet) {
 // and generates the wallet accordingly.  The new wallet will reside at the
 // provided path.
 func createWallet(cfg *config) error {
+	// A wallet restored from an existing seed may already have funds on
+	// chain.  Whoever restores it says so with --birthday, which makes the
+	// recovery on the first start scan from there instead of only the
+	// blocks after now.  A seed that was just generated elsewhere and typed
+	// in has nothing on chain yet, so the default stays now.  The option is
+	// checked before the user spends time entering anything.
+	birthday, err := walletBirthday(cfg.Birthday)
+	if err != nil {
+		return err
+	}
+
 	dbDir := networkDir(cfg.AppDataDir.Value, activeNet.Params)
 	loader := wallet.NewLoader(
 		activeNet.Params, dbDir, true, cfg.DBTimeout, 250,
@@ -110,7 +121,7 @@ func createWallet(cfg *config) error {
 	netDir := networkDir(cfg.AppDataDir.Value, activeNet.Params)
 	keystorePath := filepath.Join(netDir, keystore.Filename)
 	var legacyKeyStore *keystore.Store
-	_, err := os.Stat(keystorePath)
+	_, err = os.Stat(keystorePath)
 	if err != nil && !os.IsNotExist(err) {
 		// A stat error not due to a non-existent file should be
 		// returned to the caller.
@@ -188,7 +199,7 @@ func createWallet(cfg *config) error {
 	}
 
 	fmt.Println("Creating the wallet...")
-	w, err := loader.CreateNewWallet(pubPass, privPass, seed, time.Now())
+	w, err := loader.CreateNewWallet(pubPass, privPass, seed, birthday)
 	if err != nil {
 		return err
 	}
@@ -198,6 +209,22 @@ func createWallet(cfg *config) error {
 	return nil
 }
 
+// walletBirthday parses the --birthday option.
+func walletBirthday(birthday string) (time.Time, error) {
+	switch birthday {
+	case "":
+		return time.Now(), nil
+	case "genesis":
+		return activeNet.Params.GenesisBlock.Header.Timestamp, nil
+	}
+	t, err := time.Parse("2006-01-02", birthday)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid birthday %q, use "+
+			"YYYY-MM-DD or genesis: %v", birthday, err)
+	}
+	return t, nil
+}
+
 // createSimulationWallet is intended to be called from the rpcclient
 // and used to create a wallet for actors involved in simulations.
 func createSimulationWallet(cfg *config) error {